@@ -26,12 +26,18 @@ import type { IPasswordService } from "../domain/identity/password-service.inter
 import type { IConnectionRepository } from "../domain/connection/connection-repository.interface.js";
 import type { IGeoIpLookup } from "../domain/connection/geoip-service.interface.js";
 import type { IMetricsStore } from "../domain/metrics/metrics-store.interface.js";
+import type { IIdempotencyStore } from "../domain/ingest/idempotency-store.interface.js";
+import type { IAgentRepository } from "../domain/agent/agent-repository.interface.js";
+import type { IAgentConfigRepository } from "../domain/agent/agent-config-repository.interface.js";
 import { MongoUserRepository } from "../infrastructure/persistence/user.repository.js";
 import { MongoTenantRepository } from "../infrastructure/persistence/tenant.repository.js";
 import { MongoConnectionRepository } from "../infrastructure/persistence/connection.repository.js";
+import { MongoAgentRepository } from "../infrastructure/persistence/agent.repository.js";
+import { MongoAgentConfigRepository } from "../infrastructure/persistence/agent-config.repository.js";
 import { ScryptPasswordService } from "../infrastructure/auth/scrypt-password.service.js";
 import { MaxmindGeoIpLookup } from "../infrastructure/geoip/maxmind-geoip.service.js";
 import { metricsStore } from "../services/metrics.js";
+import { idempotencyStore } from "../services/idempotency.js";
 import {
   getCompiledDomainDsl,
   type CompiledDomainDsl,
@@ -48,9 +54,12 @@ export interface AppContext {
   userRepository: IUserRepository;
   tenantRepository: ITenantRepository;
   connectionRepository: IConnectionRepository;
+  agentRepository: IAgentRepository;
+  agentConfigRepository: IAgentConfigRepository;
   passwordService: IPasswordService;
   geoIpLookup: IGeoIpLookup;
   metricsStore: IMetricsStore;
+  idempotencyStore: IIdempotencyStore;
   domainDsl: CompiledDomainDsl;
   jwt: {
     signToken: (claims: AuthTokenClaims, ttl?: string) => string;
@@ -71,9 +80,12 @@ export function createAppContext(io?: TypedSocketServer): AppContext {
     userRepository: new MongoUserRepository(),
     tenantRepository: new MongoTenantRepository(),
     connectionRepository: new MongoConnectionRepository(),
+    agentRepository: new MongoAgentRepository(),
+    agentConfigRepository: new MongoAgentConfigRepository(),
     passwordService: new ScryptPasswordService(),
     geoIpLookup: new MaxmindGeoIpLookup(),
     metricsStore,
+    idempotencyStore,
     domainDsl: getCompiledDomainDsl(),
     jwt: {
       signToken,
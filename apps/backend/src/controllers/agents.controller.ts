@@ -0,0 +1,337 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/controllers/agents.controller
+ */
+
+import type { Request, Response } from "express";
+import { z } from "zod";
+import type { AppContext } from "../config/composition-root.js";
+import {
+  agentConfigSettingsSchema,
+  agentHeartbeatSchema,
+  agentRegistrationSchema,
+  type Agent,
+} from "../domain/agent/types.js";
+import { getPrincipal } from "../auth/principal.js";
+import {
+  tryResolveTenantIdFromRequest,
+  userHasTenantAccess,
+} from "../utils/tenant.js";
+import { firstHeaderValue } from "../utils/request.js";
+import { emitToTenant } from "../services/connections/emitter.js";
+import {
+  AGENT_HEARTBEAT_INTERVAL_SECONDS,
+  resolveAgentConfig,
+  toAgentStatus,
+  verifyAgentSignature,
+} from "../services/agents.js";
+
+const agentParamsSchema = z.object({ agentId: z.uuid() });
+
+/**
+ * Lists configuration validation failures by setting.
+ * @param error - The validation error.
+ * @returns The issues.
+ */
+
+function configIssues(error: z.ZodError): { path: string; message: string }[] {
+  return error.issues.map((issue) => ({
+    path: issue.path.join("."),
+    message: issue.message,
+  }));
+}
+
+/**
+ * Creates agents controller.
+ * @param ctx - The ctx input.
+ */
+
+export function createAgentsController(ctx: AppContext) {
+  const publish = (agent: Agent): void => {
+    if (ctx.io) {
+      emitToTenant(ctx.io, agent.tenantId, "agent:update", toAgentStatus(agent));
+    }
+  };
+
+  const registration = (agent: Agent) => ({
+    agentId: agent.agentId,
+    tenantId: agent.tenantId,
+    heartbeatIntervalSeconds: AGENT_HEARTBEAT_INTERVAL_SECONDS,
+  });
+
+  return {
+    register: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      if (!principal) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+
+      const parsed = agentRegistrationSchema.safeParse(req.body);
+      if (!parsed.success) {
+        res.status(400).json({ error: "Invalid agent registration" });
+        return;
+      }
+      const body = parsed.data;
+
+      // Agents are bound to the tenant they register for; a token scoped
+      // to a single tenant needs no X-Tenant-Id.
+      const tenantId =
+        tryResolveTenantIdFromRequest(req) ??
+        (principal.tenantIds.length === 1 ? principal.tenantIds[0] : undefined);
+      if (!tenantId) {
+        res.status(400).json({ error: "Invalid request: tenant required" });
+        return;
+      }
+      if (!userHasTenantAccess(principal.tenantIds, tenantId)) {
+        res.status(403).json({ error: "Forbidden: no access to tenant" });
+        return;
+      }
+
+      if (
+        !verifyAgentSignature(
+          body.publicKey,
+          body.agentId,
+          body.timestamp,
+          firstHeaderValue(req.headers["x-agent-signature"]),
+        )
+      ) {
+        res.status(403).json({ error: "Invalid agent signature" });
+        return;
+      }
+
+      try {
+        const existing = await ctx.agentRepository.findByAgentId(body.agentId);
+        if (existing && existing.publicKey !== body.publicKey) {
+          res
+            .status(409)
+            .json({ error: "Agent ID is registered with a different key" });
+          return;
+        }
+        if (
+          existing &&
+          existing.tenantId !== tenantId &&
+          !userHasTenantAccess(principal.tenantIds, existing.tenantId)
+        ) {
+          res.status(403).json({ error: "Forbidden: no access to tenant" });
+          return;
+        }
+
+        const agent = await ctx.agentRepository.upsert({
+          agentId: body.agentId,
+          tenantId,
+          publicKey: body.publicKey,
+          hostname: body.hostname,
+          os: body.os,
+          kernel: body.kernel,
+          version: body.version,
+          interfaces: body.interfaces ?? [],
+          capabilities: body.capabilities ?? [],
+          lastSeenAt: new Date(),
+        });
+        publish(agent);
+
+        res.status(200).json(registration(agent));
+      } catch (error) {
+        console.error("[Agents] Error registering agent:", error);
+        res.status(500).json({ error: "Internal server error" });
+      }
+    },
+
+    heartbeat: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      if (!principal) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+
+      const params = agentParamsSchema.safeParse(req.params);
+      const parsed = agentHeartbeatSchema.safeParse(req.body);
+      if (!params.success || !parsed.success) {
+        res.status(400).json({ error: "Invalid agent heartbeat" });
+        return;
+      }
+      const { agentId } = params.data;
+
+      try {
+        const agent = await ctx.agentRepository.findByAgentId(agentId);
+        if (!agent) {
+          // The agent registers again when it sees this.
+          res.status(404).json({ error: "Agent not registered" });
+          return;
+        }
+        if (!userHasTenantAccess(principal.tenantIds, agent.tenantId)) {
+          res.status(403).json({ error: "Forbidden: no access to tenant" });
+          return;
+        }
+        if (
+          !verifyAgentSignature(
+            agent.publicKey,
+            agentId,
+            parsed.data.timestamp,
+            firstHeaderValue(req.headers["x-agent-signature"]),
+          )
+        ) {
+          res.status(403).json({ error: "Invalid agent signature" });
+          return;
+        }
+
+        const updated = await ctx.agentRepository.touch(agentId, new Date(), {
+          uptimeSeconds: parsed.data.uptimeSeconds,
+          configVersion: parsed.data.configVersion,
+          configError: parsed.data.configError,
+        });
+        if (!updated) {
+          res.status(404).json({ error: "Agent not registered" });
+          return;
+        }
+        publish(updated);
+
+        res.status(200).json(registration(updated));
+      } catch (error) {
+        console.error("[Agents] Error recording heartbeat:", error);
+        res.status(500).json({ error: "Internal server error" });
+      }
+    },
+
+    config: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      if (!principal) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+      const params = agentParamsSchema.safeParse(req.params);
+      if (!params.success) {
+        res.status(400).json({ error: "Invalid agent ID" });
+        return;
+      }
+
+      try {
+        const agent = await ctx.agentRepository.findByAgentId(
+          params.data.agentId,
+        );
+        if (!agent) {
+          res.status(404).json({ error: "Agent not registered" });
+          return;
+        }
+        if (!userHasTenantAccess(principal.tenantIds, agent.tenantId)) {
+          res.status(403).json({ error: "Forbidden: no access to tenant" });
+          return;
+        }
+
+        const [tenantSettings, agentSettings] = await Promise.all([
+          ctx.agentConfigRepository.find(agent.tenantId, null),
+          ctx.agentConfigRepository.find(agent.tenantId, agent.agentId),
+        ]);
+        const doc = resolveAgentConfig(tenantSettings, agentSettings);
+        const etag = `"${doc.version}"`;
+        res.setHeader("ETag", etag);
+        res.setHeader("Cache-Control", "no-cache");
+        if (firstHeaderValue(req.headers["if-none-match"]) === etag) {
+          res.status(304).end();
+          return;
+        }
+        res.status(200).json(doc);
+      } catch (error) {
+        console.error("[Agents] Error loading agent config:", error);
+        res.status(500).json({ error: "Internal server error" });
+      }
+    },
+
+    saveTenantConfig: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      const tenantId = tryResolveTenantIdFromRequest(req);
+      if (!principal || !tenantId) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+      if (!userHasTenantAccess(principal.tenantIds, tenantId)) {
+        res.status(403).json({ error: "Forbidden: no access to tenant" });
+        return;
+      }
+      const settings = agentConfigSettingsSchema.safeParse(req.body?.settings);
+      if (!settings.success) {
+        res.status(400).json({
+          error: "Invalid agent configuration",
+          issues: configIssues(settings.error),
+        });
+        return;
+      }
+
+      await ctx.agentConfigRepository.save(tenantId, null, settings.data);
+      res.status(200).json(resolveAgentConfig(settings.data, null));
+    },
+
+    saveAgentConfig: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      if (!principal) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+      const params = agentParamsSchema.safeParse(req.params);
+      const settings = agentConfigSettingsSchema.safeParse(req.body?.settings);
+      if (!params.success || !settings.success) {
+        res.status(400).json({
+          error: "Invalid agent configuration",
+          issues: settings.success ? [] : configIssues(settings.error),
+        });
+        return;
+      }
+
+      const agent = await ctx.agentRepository.findByAgentId(
+        params.data.agentId,
+      );
+      if (!agent) {
+        res.status(404).json({ error: "Agent not registered" });
+        return;
+      }
+      if (!userHasTenantAccess(principal.tenantIds, agent.tenantId)) {
+        res.status(403).json({ error: "Forbidden: no access to tenant" });
+        return;
+      }
+
+      await ctx.agentConfigRepository.save(
+        agent.tenantId,
+        agent.agentId,
+        settings.data,
+      );
+      const tenantSettings = await ctx.agentConfigRepository.find(
+        agent.tenantId,
+        null,
+      );
+      res.status(200).json(resolveAgentConfig(tenantSettings, settings.data));
+    },
+
+    list: async (req: Request, res: Response): Promise<void> => {
+      const principal = getPrincipal(req);
+      const tenantId = tryResolveTenantIdFromRequest(req);
+      if (!principal || !tenantId) {
+        res.status(401).json({ error: "Unauthorized" });
+        return;
+      }
+      if (!userHasTenantAccess(principal.tenantIds, tenantId)) {
+        res.status(403).json({ error: "Forbidden: no access to tenant" });
+        return;
+      }
+
+      const now = new Date();
+      const agents = await ctx.agentRepository.findByTenant(tenantId);
+      res.json({ agents: agents.map((agent) => toAgentStatus(agent, now)) });
+    },
+  };
+}
@@ -36,9 +36,12 @@ import {
   userHasTenantAccess,
 } from "../utils/tenant.js";
 import { getPrincipal } from "../auth/principal.js";
+import { ingestIdempotencyKey } from "../services/idempotency.js";
 
 type ConnectionsBody = {
   connections?: Partial<Connection>[];
+  batchId?: string;
+  sequence?: number;
 };
 
 function normalizeQueryString(value: unknown): string | undefined {
@@ -53,6 +56,8 @@ function normalizeQueryString(value: unknown): string | undefined {
 
 const connectionsBodySchema = z.object({
   connections: z.array(z.unknown()),
+  batchId: z.string().optional(),
+  sequence: z.number().int().nonnegative().optional(),
 });
 
 const historyFiltersSchema = z.object({
@@ -162,6 +167,21 @@ export function createConnectionsController(ctx: AppContext) {
         return;
       }
 
+      // A retried request whose first attempt was processed is acknowledged
+      // again without storing its connections twice.
+      const idempotencyKey = ingestIdempotencyKey({
+        tenantId,
+        scope: "connections",
+        header: req.headers["idempotency-key"],
+        batchId: body.batchId,
+      });
+      if (idempotencyKey && !ctx.idempotencyStore.claim(idempotencyKey)) {
+        res
+          .status(202)
+          .json({ received: connections.length, status: "duplicate" });
+        return;
+      }
+
       res
         .status(202)
         .json({ received: connections.length, status: "processing" });
@@ -29,13 +29,18 @@ import {
   userHasTenantAccess,
 } from "../utils/tenant.js";
 import { getPrincipal } from "../auth/principal.js";
+import { ingestIdempotencyKey } from "../services/idempotency.js";
 
 interface MetricsRequestBody {
   snapshots: TimeSeriesData[];
+  batchId?: string;
+  sequence?: number;
 }
 
 const metricsRequestBodySchema = z.object({
   snapshots: z.array(z.unknown()),
+  batchId: z.string().optional(),
+  sequence: z.number().int().nonnegative().optional(),
 });
 
 /**
@@ -46,6 +51,7 @@ const metricsRequestBodySchema = z.object({
 export function createMetricsController(ctx: AppContext) {
   return {
     ingest: async (req: Request, res: Response): Promise<void> => {
+      let idempotencyKey: string | undefined;
       try {
         const parsedBody = metricsRequestBodySchema.safeParse(req.body);
         if (!parsedBody.success) {
@@ -69,6 +75,20 @@ export function createMetricsController(ctx: AppContext) {
           return;
         }
 
+        idempotencyKey = ingestIdempotencyKey({
+          tenantId,
+          scope: "metrics",
+          header: req.headers["idempotency-key"],
+          batchId: body.batchId,
+        });
+        if (idempotencyKey && !ctx.idempotencyStore.claim(idempotencyKey)) {
+          res.status(202).json({
+            received: body.snapshots.length,
+            status: "duplicate",
+          });
+          return;
+        }
+
         ctx.metricsStore.addSnapshots(tenantId, body.snapshots);
 
         res.status(202).json({
@@ -76,6 +96,10 @@ export function createMetricsController(ctx: AppContext) {
           status: "processing",
         });
       } catch (error) {
+        // Let the client's retry of this batch through.
+        if (idempotencyKey) {
+          ctx.idempotencyStore.release(idempotencyKey);
+        }
         console.error("[Metrics] Error processing metrics:", error);
         res.status(500).json({ error: "Internal server error" });
       }
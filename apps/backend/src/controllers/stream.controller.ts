@@ -0,0 +1,257 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/controllers/stream.controller
+ */
+
+import type { IncomingMessage } from "node:http";
+import type { Duplex } from "node:stream";
+import type { Connection } from "@byteroute/shared";
+import { WebSocketServer, type RawData, type WebSocket } from "ws";
+import { z } from "zod";
+import type { AppContext } from "../config/composition-root.js";
+import { AuthService } from "../services/auth.service.js";
+import {
+  extractBearerTokenFromAuthorization,
+  verifyAuthToken,
+} from "../auth/passport.js";
+import {
+  enrichAndStoreConnections,
+  storeRawConnections,
+} from "../services/ingest.js";
+import { ingestIdempotencyKey } from "../services/idempotency.js";
+import { resolveReporterIp } from "../utils/ip.js";
+import { firstHeaderValue } from "../utils/request.js";
+import {
+  tryResolveTenantIdFromRequest,
+  userHasTenantAccess,
+} from "../utils/tenant.js";
+
+export const STREAM_PATH = "/api/stream";
+
+// Matches the express.json() limit on POST /api/connections.
+const STREAM_MAX_PAYLOAD_BYTES = 2 * 1024 * 1024;
+const STREAM_PING_INTERVAL_MS = 30_000;
+
+const streamBatchSchema = z.object({
+  connections: z.array(z.unknown()),
+  batchId: z.string().min(1).max(128),
+  sequence: z.number().int().nonnegative().optional(),
+});
+
+export type StreamReply =
+  | {
+      type: "ack";
+      batchId: string;
+      received: number;
+      status: "processing" | "duplicate";
+    }
+  | { type: "nack"; batchId?: string; error: string; retryable: boolean };
+
+export interface StreamSession {
+  tenantId: string;
+  reporterIp?: string;
+}
+
+/**
+ * Rejects an upgrade request with a bare HTTP status.
+ * @param socket - The upgrading socket.
+ * @param status - The HTTP status code.
+ * @param reason - The status text.
+ */
+
+function refuseUpgrade(socket: Duplex, status: number, reason: string): void {
+  socket.end(
+    `HTTP/1.1 ${status} ${reason}\r\nConnection: close\r\nContent-Length: 0\r\n\r\n`,
+  );
+}
+
+/**
+ * Creates the controller for the agent ingest stream: a WebSocket on
+ * /api/stream that carries connection batches in the POST body format and
+ * answers each with an ack or a nack.
+ * @param ctx - The ctx input.
+ */
+
+export function createStreamController(ctx: AppContext) {
+  const authService = new AuthService(
+    ctx.userRepository,
+    ctx.tenantRepository,
+    ctx.passwordService,
+    ctx.jwt,
+  );
+  const wss = new WebSocketServer({
+    noServer: true,
+    maxPayload: STREAM_MAX_PAYLOAD_BYTES,
+  });
+
+  /**
+   * Authenticates an upgrade request like the REST ingest routes do.
+   * @param req - The upgrade request.
+   * @returns The stream session, or the HTTP status to refuse it with.
+   */
+  async function authenticate(
+    req: IncomingMessage,
+  ): Promise<StreamSession | 401 | 403> {
+    const principal = verifyAuthToken(
+      extractBearerTokenFromAuthorization(
+        firstHeaderValue(req.headers.authorization),
+      ),
+    );
+    if (!principal) {
+      return 401;
+    }
+    const hydrated = await authService.refreshPrincipal(principal);
+    const url = new URL(req.url ?? "/", "http://localhost");
+    const tenantId = tryResolveTenantIdFromRequest({
+      headers: req.headers,
+      query: Object.fromEntries(url.searchParams),
+    });
+    if (!hydrated || !tenantId) {
+      return 401;
+    }
+    if (!userHasTenantAccess(hydrated.tenantIds, tenantId)) {
+      return 403;
+    }
+
+    const reporterIp = resolveReporterIp({
+      xForwardedFor: req.headers["x-forwarded-for"],
+      xRealIp: req.headers["x-real-ip"],
+      remoteAddress: req.socket.remoteAddress,
+    });
+    return { tenantId, reporterIp };
+  }
+
+  /**
+   * Accepts one streamed batch and starts storing it.
+   * @param session - The authenticated stream.
+   * @param data - The raw message.
+   * @returns The reply for the agent.
+   */
+  function handleMessage(session: StreamSession, data: string): StreamReply {
+    let raw: unknown;
+    try {
+      raw = JSON.parse(data);
+    } catch {
+      return { type: "nack", error: "Invalid JSON", retryable: false };
+    }
+    const parsed = streamBatchSchema.safeParse(raw);
+    if (!parsed.success) {
+      const batchId =
+        typeof (raw as { batchId?: unknown })?.batchId === "string"
+          ? (raw as { batchId: string }).batchId
+          : undefined;
+      return {
+        type: "nack",
+        batchId,
+        error: "Invalid payload: expected { connections: Connection[], batchId }",
+        retryable: false,
+      };
+    }
+
+    const { batchId } = parsed.data;
+    const connections = parsed.data.connections as Partial<Connection>[];
+    const key = ingestIdempotencyKey({
+      tenantId: session.tenantId,
+      scope: "connections",
+      header: undefined,
+      batchId,
+    });
+    if (key && !ctx.idempotencyStore.claim(key)) {
+      return {
+        type: "ack",
+        batchId,
+        received: connections.length,
+        status: "duplicate",
+      };
+    }
+
+    void enrichAndStoreConnections(ctx.io, connections, session).catch(
+      (err) => {
+        console.error("Enrichment failed:", err);
+        void storeRawConnections(connections, {
+          tenantId: session.tenantId,
+        }).catch((fallbackErr) => {
+          console.error("Raw insert fallback failed:", fallbackErr);
+        });
+      },
+    );
+    return {
+      type: "ack",
+      batchId,
+      received: connections.length,
+      status: "processing",
+    };
+  }
+
+  /**
+   * Serves an accepted stream until either side closes it.
+   * @param ws - The WebSocket.
+   * @param session - The authenticated stream.
+   */
+  function serve(ws: WebSocket, session: StreamSession): void {
+    let alive = true;
+    ws.on("pong", () => {
+      alive = true;
+    });
+    const pinger = setInterval(() => {
+      if (!alive) {
+        ws.terminate();
+        return;
+      }
+      alive = false;
+      ws.ping();
+    }, STREAM_PING_INTERVAL_MS);
+    ws.on("close", () => clearInterval(pinger));
+
+    ws.on("message", (data: RawData, isBinary: boolean) => {
+      alive = true;
+      const reply: StreamReply = isBinary
+        ? { type: "nack", error: "Expected a text message", retryable: false }
+        : handleMessage(session, data.toString());
+      ws.send(JSON.stringify(reply));
+    });
+  }
+
+  return {
+    authenticate,
+    handleMessage,
+
+    handleUpgrade: (
+      req: IncomingMessage,
+      socket: Duplex,
+      head: Buffer,
+    ): void => {
+      void authenticate(req)
+        .then((session) => {
+          if (session === 401) {
+            refuseUpgrade(socket, 401, "Unauthorized");
+            return;
+          }
+          if (session === 403) {
+            refuseUpgrade(socket, 403, "Forbidden");
+            return;
+          }
+          wss.handleUpgrade(req, socket, head, (ws) => serve(ws, session));
+        })
+        .catch((error) => {
+          console.error("[Stream] Error authenticating stream:", error);
+          refuseUpgrade(socket, 500, "Internal Server Error");
+        });
+    },
+  };
+}
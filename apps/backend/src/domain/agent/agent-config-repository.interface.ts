@@ -0,0 +1,37 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/domain/agent/agent-config-repository.interface
+ */
+
+import type { AgentConfigSettings } from "./types.js";
+
+/**
+ * Stores remote configuration documents. A null agentId addresses the
+ * tenant-wide document that per-agent documents are layered on.
+ */
+export interface IAgentConfigRepository {
+  find(
+    tenantId: string,
+    agentId: string | null,
+  ): Promise<AgentConfigSettings | null>;
+  save(
+    tenantId: string,
+    agentId: string | null,
+    settings: AgentConfigSettings,
+  ): Promise<void>;
+}
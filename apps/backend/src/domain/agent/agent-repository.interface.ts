@@ -0,0 +1,34 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/domain/agent/agent-repository.interface
+ */
+
+import type { Agent, AgentHeartbeatStatus } from "./types.js";
+
+export interface IAgentRepository {
+  findByAgentId(agentId: string): Promise<Agent | null>;
+  /** Creates the agent or replaces its host details, keeping registeredAt. */
+  upsert(agent: Omit<Agent, "registeredAt">): Promise<Agent>;
+  /** Records a heartbeat; returns null when the agent is not registered. */
+  touch(
+    agentId: string,
+    seenAt: Date,
+    status: AgentHeartbeatStatus,
+  ): Promise<Agent | null>;
+  findByTenant(tenantId: string): Promise<Agent[]>;
+}
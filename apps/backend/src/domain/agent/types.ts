@@ -0,0 +1,103 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/domain/agent/types
+ */
+
+import { z } from "zod";
+
+const agentInterfaceSchema = z.object({
+  name: z.string().min(1),
+  mac: z.string().optional(),
+  addrs: z.array(z.string()).optional(),
+});
+
+export const agentRegistrationSchema = z.object({
+  agentId: z.uuid(),
+  publicKey: z.base64().length(44),
+  hostname: z.string().max(255).optional(),
+  os: z.string().max(64).optional(),
+  kernel: z.string().max(255).optional(),
+  version: z.string().max(64).optional(),
+  interfaces: z.array(agentInterfaceSchema).max(256).optional(),
+  capabilities: z.array(z.string().max(64)).max(64).optional(),
+  timestamp: z.iso.datetime({ offset: true }),
+});
+
+export const agentHeartbeatSchema = z.object({
+  timestamp: z.iso.datetime({ offset: true }),
+  uptimeSeconds: z.number().int().nonnegative().optional(),
+  configVersion: z.string().max(64).optional(),
+  configError: z.string().max(1024).optional(),
+});
+
+// Mirrors the Go client's config.Validate; keys are the client's flag names.
+const goDurationPattern = /^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$/;
+const goDurationSchema = z
+  .string()
+  .regex(goDurationPattern, "expected a duration like 10s");
+const zeroDurationPattern = /^(0+(\.0+)?(ns|us|µs|ms|s|m|h))+$/;
+const positiveGoDurationSchema = goDurationSchema.refine(
+  (value) => !zeroDurationPattern.test(value),
+  { message: "must be positive" },
+);
+
+export const agentConfigSettingsSchema = z
+  .object({
+    bpf: z.string().max(4096),
+    direction: z.enum(["out", "in", "both"]),
+    dedupe: z.enum(["flow", "ip"]),
+    compression: z.enum(["none", "gzip", "zstd"]),
+    "wire-format": z.enum(["json", "protobuf"]),
+    flush: positiveGoDurationSchema,
+    "idle-ttl": goDurationSchema,
+    "metrics-interval": positiveGoDurationSchema,
+    "max-batch-conns": z.number().int().min(1),
+    "max-batch-bytes": z.number().int(),
+  })
+  .partial()
+  .strict();
+
+export type AgentRegistration = z.infer<typeof agentRegistrationSchema>;
+export type AgentHeartbeat = z.infer<typeof agentHeartbeatSchema>;
+export type AgentInterface = z.infer<typeof agentInterfaceSchema>;
+export type AgentConfigSettings = z.infer<typeof agentConfigSettingsSchema>;
+
+export interface Agent {
+  agentId: string;
+  tenantId: string;
+  /** Raw Ed25519 public key, base64. */
+  publicKey: string;
+  hostname?: string;
+  os?: string;
+  kernel?: string;
+  version?: string;
+  interfaces: AgentInterface[];
+  capabilities: string[];
+  registeredAt: Date;
+  lastSeenAt: Date;
+  uptimeSeconds?: number;
+  /** Remote configuration version the agent reports as applied. */
+  configVersion?: string;
+  configError?: string;
+}
+
+export interface AgentHeartbeatStatus {
+  uptimeSeconds?: number;
+  configVersion?: string;
+  configError?: string;
+}
@@ -70,6 +70,11 @@ export function normalizeConnection(
 
   return {
     id,
+    conversationId:
+      typeof input.conversationId === "string" &&
+      input.conversationId.trim().length > 0
+        ? input.conversationId
+        : undefined,
     tenantId,
     sourceIp: input.sourceIp ?? "0.0.0.0",
     destIp: input.destIp ?? "0.0.0.0",
@@ -77,6 +82,10 @@ export function normalizeConnection(
     destPort: input.destPort ?? 0,
     protocol,
     status,
+    direction:
+      input.direction === "in" || input.direction === "out"
+        ? input.direction
+        : undefined,
     startTime: input.startTime ?? nowIso,
     lastActivity: input.lastActivity ?? nowIso,
     duration: input.duration,
@@ -98,5 +107,15 @@ export function normalizeConnection(
     bytesOut: input.bytesOut,
     packetsIn: input.packetsIn,
     packetsOut: input.packetsOut,
+    intervalStart: input.intervalStart,
+    intervalEnd: input.intervalEnd,
+    deltaBytesIn: input.deltaBytesIn,
+    deltaBytesOut: input.deltaBytesOut,
+    deltaPacketsIn: input.deltaPacketsIn,
+    deltaPacketsOut: input.deltaPacketsOut,
+    samplingRate:
+      typeof input.samplingRate === "number" && input.samplingRate > 1
+        ? input.samplingRate
+        : undefined,
   };
 }
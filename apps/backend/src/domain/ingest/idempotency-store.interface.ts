@@ -0,0 +1,30 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/**
+ * @module backend/domain/ingest/idempotency-store.interface
+ */
+
+export interface IIdempotencyStore {
+  /**
+   * Records key as seen; returns false when it was already seen within the
+   * deduplication window.
+   */
+  claim(key: string): boolean;
+  /** Forgets key so a failed request can be retried with it. */
+  release(key: string): void;
+}
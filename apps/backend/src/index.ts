@@ -43,9 +43,17 @@ import {
 } from "./services/connections.js";
 import { createRoutes } from "./routes/index.js";
 import { createSocketController } from "./controllers/socket.controller.js";
+import {
+  STREAM_PATH,
+  createStreamController,
+} from "./controllers/stream.controller.js";
 import { ensurePassportAuthInitialized } from "./infrastructure/auth/passport.js";
 import { createSocketAuthMiddleware } from "./middleware/socket-auth.middleware.js";
 import { errorHandler } from "./middleware/error.middleware.js";
+import {
+  decodeConnectionsBody,
+  decodeMetricsBody,
+} from "./middleware/decompression.middleware.js";
 import { createAppContext } from "./config/composition-root.js";
 import { compileDomainDslAtStartup } from "./infrastructure/dsl/domain-dsl.js";
 
@@ -63,8 +71,14 @@ const io: TypedSocketServer = new SocketIOServer<
   SocketData
 >(server, {
   cors: { origin: true, credentials: true },
+  // Upgrades outside Socket.IO's path are handled below.
+  destroyUpgrade: false,
 });
 
+// Agents may send gzip/zstd-compressed or protobuf ingest bodies; decode them
+// before express.json(), which only handles a subset of encodings and JSON.
+app.use("/api/connections", decodeConnectionsBody);
+app.use("/api/metrics", decodeMetricsBody);
 app.use(express.json({ limit: "2mb" }));
 ensurePassportAuthInitialized();
 app.use(passport.initialize());
@@ -80,6 +94,18 @@ app.use(errorHandler);
 // Socket.IO connection handler
 io.on("connection", (socket) => socketController.handleConnection(io, socket));
 
+// Agents stream connection batches over a WebSocket on STREAM_PATH; any
+// other upgrade that Socket.IO does not own is refused.
+const streamController = createStreamController(ctx);
+server.on("upgrade", (req, socket, head) => {
+  const path = new URL(req.url ?? "/", "http://localhost").pathname;
+  if (path === STREAM_PATH) {
+    streamController.handleUpgrade(req, socket, head);
+  } else if (!path.startsWith("/socket.io/")) {
+    socket.destroy();
+  }
+});
+
 const port = Number(process.env.PORT ?? 4000);
 let statsEmitTimer: NodeJS.Timeout | undefined;
 
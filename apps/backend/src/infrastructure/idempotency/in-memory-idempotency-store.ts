@@ -0,0 +1,98 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/**
+ * @module backend/infrastructure/idempotency/in-memory-idempotency-store
+ */
+
+import type { IIdempotencyStore } from "../../domain/ingest/idempotency-store.interface.js";
+
+const DEFAULT_WINDOW_MS = 10 * 60 * 1000;
+const DEFAULT_MAX_KEYS = 100_000;
+
+export type InMemoryIdempotencyStoreOptions = {
+  /** How long a key is remembered. */
+  windowMs?: number;
+  /** Upper bound on remembered keys; the oldest are evicted first. */
+  maxKeys?: number;
+  now?: () => number;
+};
+
+/**
+ * Represents an in memory idempotency store. Keys are kept in insertion
+ * order, so expiry and eviction only ever look at the front of the map.
+ */
+
+export class InMemoryIdempotencyStore implements IIdempotencyStore {
+  private readonly expiresAt = new Map<string, number>();
+  private readonly windowMs: number;
+  private readonly maxKeys: number;
+  private readonly now: () => number;
+
+  constructor(options: InMemoryIdempotencyStoreOptions = {}) {
+    this.windowMs = options.windowMs ?? DEFAULT_WINDOW_MS;
+    this.maxKeys = options.maxKeys ?? DEFAULT_MAX_KEYS;
+    this.now = options.now ?? Date.now;
+  }
+
+  /**
+   * Claims a key.
+   * @param key - The key input.
+   * @returns Whether the key was not seen within the window.
+   */
+
+  claim(key: string): boolean {
+    const now = this.now();
+    this.prune(now);
+
+    const expiresAt = this.expiresAt.get(key);
+    if (expiresAt !== undefined && expiresAt > now) {
+      return false;
+    }
+
+    this.expiresAt.delete(key);
+    this.expiresAt.set(key, now + this.windowMs);
+    while (this.expiresAt.size > this.maxKeys) {
+      const oldest = this.expiresAt.keys().next().value as string;
+      this.expiresAt.delete(oldest);
+    }
+    return true;
+  }
+
+  /**
+   * Releases a key.
+   * @param key - The key input.
+   */
+
+  release(key: string): void {
+    this.expiresAt.delete(key);
+  }
+
+  /**
+   * Drops expired keys from the front of the map.
+   * @param now - The now input.
+   */
+
+  private prune(now: number): void {
+    for (const [key, expiresAt] of this.expiresAt) {
+      if (expiresAt > now) {
+        break;
+      }
+      this.expiresAt.delete(key);
+    }
+  }
+}
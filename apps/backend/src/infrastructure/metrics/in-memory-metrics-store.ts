@@ -67,6 +67,8 @@ export class InMemoryMetricsStore implements IMetricsStore {
         bandwidthIn: snapshot.bandwidthIn,
         bandwidthOut: snapshot.bandwidthOut,
         inactive: snapshot.inactive ?? 0,
+        ...(snapshot.samplingRate ? { samplingRate: snapshot.samplingRate } : {}),
+        ...(snapshot.capture ? { capture: snapshot.capture } : {}),
       });
     }
 
@@ -0,0 +1,64 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/infrastructure/persistence/agent-config.repository
+ */
+
+import type { IAgentConfigRepository } from "../../domain/agent/agent-config-repository.interface.js";
+import type { AgentConfigSettings } from "../../domain/agent/types.js";
+import { AgentConfigModel } from "./models/agent-config.model.js";
+
+export class MongoAgentConfigRepository implements IAgentConfigRepository {
+  /**
+   * Finds a configuration document.
+   * @param tenantId - The tenant ID input.
+   * @param agentId - The agent ID, or null for the tenant-wide document.
+   * @returns The stored settings, or null when none were saved.
+   */
+
+  async find(
+    tenantId: string,
+    agentId: string | null,
+  ): Promise<AgentConfigSettings | null> {
+    const doc = await AgentConfigModel.findOne({
+      tenantId,
+      agentId: agentId ?? "",
+    })
+      .select("settings")
+      .lean<{ settings?: AgentConfigSettings }>();
+    return doc ? (doc.settings ?? {}) : null;
+  }
+
+  /**
+   * Saves a configuration document, replacing its settings.
+   * @param tenantId - The tenant ID input.
+   * @param agentId - The agent ID, or null for the tenant-wide document.
+   * @param settings - The settings input.
+   */
+
+  async save(
+    tenantId: string,
+    agentId: string | null,
+    settings: AgentConfigSettings,
+  ): Promise<void> {
+    await AgentConfigModel.updateOne(
+      { tenantId, agentId: agentId ?? "" },
+      { $set: { settings } },
+      { upsert: true },
+    );
+  }
+}
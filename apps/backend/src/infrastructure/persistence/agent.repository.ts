@@ -0,0 +1,158 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/infrastructure/persistence/agent.repository
+ */
+
+import type { IAgentRepository } from "../../domain/agent/agent-repository.interface.js";
+import type {
+  Agent,
+  AgentHeartbeatStatus,
+  AgentInterface,
+} from "../../domain/agent/types.js";
+import { AgentModel } from "./models/agent.model.js";
+
+const AGENT_FIELDS =
+  "agentId tenantId publicKey hostname os kernel version interfaces capabilities registeredAt lastSeenAt uptimeSeconds configVersion configError";
+
+type AgentLean = {
+  agentId: string;
+  tenantId: string;
+  publicKey: string;
+  hostname?: string | null;
+  os?: string | null;
+  kernel?: string | null;
+  version?: string | null;
+  interfaces?: { name: string; mac?: string | null; addrs?: string[] }[];
+  capabilities?: string[];
+  registeredAt: Date;
+  lastSeenAt: Date;
+  uptimeSeconds?: number | null;
+  configVersion?: string | null;
+  configError?: string | null;
+};
+
+/**
+ * Maps a stored document to the domain type.
+ * @param doc - The doc input.
+ * @returns The agent.
+ */
+
+function toAgent(doc: AgentLean): Agent {
+  return {
+    agentId: doc.agentId,
+    tenantId: doc.tenantId,
+    publicKey: doc.publicKey,
+    hostname: doc.hostname ?? undefined,
+    os: doc.os ?? undefined,
+    kernel: doc.kernel ?? undefined,
+    version: doc.version ?? undefined,
+    interfaces: (doc.interfaces ?? []).map(
+      (iface): AgentInterface => ({
+        name: iface.name,
+        mac: iface.mac ?? undefined,
+        addrs: iface.addrs ?? [],
+      }),
+    ),
+    capabilities: doc.capabilities ?? [],
+    registeredAt: doc.registeredAt,
+    lastSeenAt: doc.lastSeenAt,
+    uptimeSeconds: doc.uptimeSeconds ?? undefined,
+    configVersion: doc.configVersion ?? undefined,
+    configError: doc.configError ?? undefined,
+  };
+}
+
+export class MongoAgentRepository implements IAgentRepository {
+  /**
+   * Finds by agent ID.
+   * @param agentId - The agent ID input.
+   * @returns The by agent ID result.
+   */
+
+  async findByAgentId(agentId: string): Promise<Agent | null> {
+    const doc = await AgentModel.findOne({ agentId })
+      .select(AGENT_FIELDS)
+      .lean<AgentLean>();
+    return doc ? toAgent(doc) : null;
+  }
+
+  /**
+   * Creates or updates an agent registration.
+   * @param agent - The agent input.
+   * @returns The stored agent.
+   */
+
+  async upsert(agent: Omit<Agent, "registeredAt">): Promise<Agent> {
+    const doc = await AgentModel.findOneAndUpdate(
+      { agentId: agent.agentId },
+      {
+        $set: agent,
+        $setOnInsert: { registeredAt: agent.lastSeenAt },
+      },
+      { upsert: true, new: true },
+    )
+      .select(AGENT_FIELDS)
+      .lean<AgentLean>();
+    return toAgent(doc as AgentLean);
+  }
+
+  /**
+   * Records a heartbeat.
+   * @param agentId - The agent ID input.
+   * @param seenAt - The seen at input.
+   * @param status - The status reported with the heartbeat.
+   * @returns The updated agent, or null when unknown.
+   */
+
+  async touch(
+    agentId: string,
+    seenAt: Date,
+    status: AgentHeartbeatStatus,
+  ): Promise<Agent | null> {
+    const update: Record<string, unknown> = {
+      lastSeenAt: seenAt,
+      configVersion: status.configVersion ?? null,
+      configError: status.configError ?? null,
+    };
+    if (status.uptimeSeconds !== undefined) {
+      update.uptimeSeconds = status.uptimeSeconds;
+    }
+    const doc = await AgentModel.findOneAndUpdate(
+      { agentId },
+      { $set: update },
+      { new: true },
+    )
+      .select(AGENT_FIELDS)
+      .lean<AgentLean>();
+    return doc ? toAgent(doc) : null;
+  }
+
+  /**
+   * Finds by tenant.
+   * @param tenantId - The tenant ID input.
+   * @returns The by tenant result.
+   */
+
+  async findByTenant(tenantId: string): Promise<Agent[]> {
+    const docs = await AgentModel.find({ tenantId })
+      .select(AGENT_FIELDS)
+      .sort({ hostname: 1, agentId: 1 })
+      .lean<AgentLean[]>();
+    return docs.map((doc) => toAgent(doc));
+  }
+}
@@ -0,0 +1,42 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/infrastructure/persistence/models/agent-config.model
+ */
+
+import mongoose, { Schema, type InferSchemaType } from "mongoose";
+
+const agentConfigSchema = new Schema(
+  {
+    tenantId: { type: String, required: true },
+    // Empty for the tenant-wide document.
+    agentId: { type: String, default: "" },
+    settings: { type: Schema.Types.Mixed, default: {} },
+  },
+  {
+    timestamps: true,
+    minimize: false,
+  },
+);
+
+agentConfigSchema.index({ tenantId: 1, agentId: 1 }, { unique: true });
+
+export type AgentConfigDoc = InferSchemaType<typeof agentConfigSchema>;
+
+export const AgentConfigModel =
+  mongoose.models.AgentConfig ??
+  mongoose.model<AgentConfigDoc>("AgentConfig", agentConfigSchema);
@@ -0,0 +1,57 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/infrastructure/persistence/models/agent.model
+ */
+
+import mongoose, { Schema, type InferSchemaType } from "mongoose";
+
+const agentInterfaceSchema = new Schema(
+  {
+    name: { type: String, required: true },
+    mac: { type: String },
+    addrs: { type: [String], default: [] },
+  },
+  { _id: false },
+);
+
+const agentSchema = new Schema(
+  {
+    agentId: { type: String, required: true, unique: true },
+    tenantId: { type: String, required: true, index: true },
+    publicKey: { type: String, required: true },
+    hostname: { type: String },
+    os: { type: String },
+    kernel: { type: String },
+    version: { type: String },
+    interfaces: { type: [agentInterfaceSchema], default: [] },
+    capabilities: { type: [String], default: [] },
+    registeredAt: { type: Date, required: true },
+    lastSeenAt: { type: Date, required: true },
+    uptimeSeconds: { type: Number },
+    configVersion: { type: String },
+    configError: { type: String },
+  },
+  {
+    timestamps: true,
+  },
+);
+
+export type AgentDoc = InferSchemaType<typeof agentSchema>;
+
+export const AgentModel =
+  mongoose.models.Agent ?? mongoose.model<AgentDoc>("Agent", agentSchema);
@@ -25,12 +25,14 @@ const connectionSchema = new Schema(
   {
     tenantId: { type: String, required: true, index: true, trim: true },
     id: { type: String, required: true, index: true, trim: true },
+    conversationId: { type: String, trim: true },
     sourceIp: { type: String, required: true, trim: true },
     destIp: { type: String, required: true, trim: true },
     sourcePort: { type: Number, required: true },
     destPort: { type: Number, required: true },
     protocol: { type: String, required: true },
     status: { type: String, required: true },
+    direction: { type: String },
 
     enriched: { type: Boolean, default: false },
 
@@ -52,6 +54,13 @@ const connectionSchema = new Schema(
     bytesOut: { type: Number },
     packetsIn: { type: Number },
     packetsOut: { type: Number },
+    intervalStart: { type: Date },
+    intervalEnd: { type: Date },
+    deltaBytesIn: { type: Number },
+    deltaBytesOut: { type: Number },
+    deltaPacketsIn: { type: Number },
+    deltaPacketsOut: { type: Number },
+    samplingRate: { type: Number },
 
     startTime: { type: Date, required: true },
     lastActivity: { type: Date, required: true },
@@ -64,6 +73,7 @@ const connectionSchema = new Schema(
 
 connectionSchema.index({ tenantId: 1, id: 1 }, { unique: true });
 connectionSchema.index({ lastActivity: -1 });
+connectionSchema.index({ tenantId: 1, conversationId: 1, startTime: -1 });
 connectionSchema.index({
   tenantId: 1,
   sourceIp: 1,
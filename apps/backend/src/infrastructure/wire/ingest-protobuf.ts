@@ -0,0 +1,448 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/**
+ * @module backend/infrastructure/wire/ingest-protobuf
+ *
+ * Decoder for the binary ingest format defined in
+ * proto/byteroute/ingest/v1/ingest.proto. Payloads are converted to the same
+ * shape as the JSON bodies so the controllers and their validation are shared.
+ */
+
+export const INGEST_PROTOBUF_CONTENT_TYPE =
+  "application/vnd.byteroute.ingest.v1+protobuf";
+
+const PROTOCOLS = ["", "TCP", "UDP", "ICMP", "OTHER"] as const;
+const STATUSES = ["", "active", "inactive"] as const;
+const DIRECTIONS = ["", "out", "in"] as const;
+
+const WIRE_VARINT = 0;
+const WIRE_FIXED64 = 1;
+const WIRE_BYTES = 2;
+const WIRE_FIXED32 = 5;
+
+type Field = {
+  num: number;
+  type: number;
+  value: bigint | Buffer;
+};
+
+export class WireFormatError extends Error {}
+
+/**
+ * Reads a base-128 varint.
+ * @param buf - The buffer.
+ * @param pos - The offset of the varint.
+ * @returns The unsigned value and the offset after it.
+ */
+
+function readVarint(buf: Buffer, pos: number): [bigint, number] {
+  let result = 0n;
+  for (let shift = 0n; shift < 70n; shift += 7n) {
+    if (pos >= buf.length) {
+      throw new WireFormatError("truncated varint");
+    }
+    const byte = buf[pos++];
+    result |= BigInt(byte & 0x7f) << shift;
+    if (byte < 0x80) {
+      return [BigInt.asUintN(64, result), pos];
+    }
+  }
+  throw new WireFormatError("varint too long");
+}
+
+/**
+ * Splits one protobuf message level into its fields.
+ * @param buf - The encoded message.
+ * @returns The fields in wire order.
+ */
+
+function readFields(buf: Buffer): Field[] {
+  const fields: Field[] = [];
+  let pos = 0;
+
+  const varint = (): bigint => {
+    const [value, next] = readVarint(buf, pos);
+    pos = next;
+    return value;
+  };
+
+  const take = (n: number): Buffer => {
+    if (pos + n > buf.length) {
+      throw new WireFormatError("truncated field");
+    }
+    const slice = buf.subarray(pos, pos + n);
+    pos += n;
+    return slice;
+  };
+
+  while (pos < buf.length) {
+    const tag = varint();
+    const num = Number(tag >> 3n);
+    const type = Number(tag & 7n);
+    if (num === 0) {
+      throw new WireFormatError("invalid field number 0");
+    }
+
+    switch (type) {
+      case WIRE_VARINT:
+        fields.push({ num, type, value: varint() });
+        break;
+      case WIRE_FIXED64:
+        fields.push({ num, type, value: take(8) });
+        break;
+      case WIRE_BYTES:
+        fields.push({ num, type, value: take(Number(varint())) });
+        break;
+      case WIRE_FIXED32:
+        take(4);
+        break;
+      default:
+        throw new WireFormatError(`unsupported wire type ${type}`);
+    }
+  }
+
+  return fields;
+}
+
+const asInt = (value: bigint | Buffer): number =>
+  typeof value === "bigint"
+    ? Number(BigInt.asIntN(64, value))
+    : Number(value.readBigInt64LE());
+
+const asDouble = (value: bigint | Buffer): number =>
+  Buffer.isBuffer(value) ? value.readDoubleLE() : Number(value);
+
+const asBytes = (value: bigint | Buffer): Buffer =>
+  Buffer.isBuffer(value) ? value : Buffer.alloc(0);
+
+const asString = (value: bigint | Buffer): string =>
+  asBytes(value).toString("utf8");
+
+/**
+ * Formats a Unix nanosecond timestamp as an ISO 8601 string.
+ * @param value - The sfixed64 field value.
+ * @returns The timestamp string.
+ */
+
+function asTimestamp(value: bigint | Buffer): string {
+  const nanos = Buffer.isBuffer(value)
+    ? value.readBigInt64LE()
+    : BigInt.asIntN(64, value);
+  return new Date(Number(nanos / 1_000_000n)).toISOString();
+}
+
+/**
+ * Formats a 4 or 16 byte address in its canonical text form.
+ * @param value - The bytes field value.
+ * @returns The IP address string.
+ */
+
+function asIp(value: bigint | Buffer): string {
+  const bytes = asBytes(value);
+  if (bytes.length === 4) {
+    return Array.from(bytes).join(".");
+  }
+  if (bytes.length !== 16) {
+    throw new WireFormatError(`invalid IP address length ${bytes.length}`);
+  }
+
+  const groups: number[] = [];
+  for (let i = 0; i < 16; i += 2) {
+    groups.push(bytes.readUInt16BE(i));
+  }
+
+  // Compress the longest run of zero groups (RFC 5952).
+  let bestStart = -1;
+  let bestLen = 1;
+  for (let i = 0; i < 8; ) {
+    let j = i;
+    while (j < 8 && groups[j] === 0) j++;
+    if (j - i > bestLen) {
+      bestStart = i;
+      bestLen = j - i;
+    }
+    i = j === i ? i + 1 : j;
+  }
+
+  const hex = groups.map((g) => g.toString(16));
+  if (bestStart < 0) {
+    return hex.join(":");
+  }
+  const head = hex.slice(0, bestStart).join(":");
+  const tail = hex.slice(bestStart + bestLen).join(":");
+  return `${head}::${tail}`;
+}
+
+/**
+ * Reads a packed repeated integer field.
+ * @param value - The bytes field value.
+ * @returns The integers.
+ */
+
+function asPackedInts(value: bigint | Buffer): number[] {
+  if (typeof value === "bigint") {
+    return [asInt(value)];
+  }
+  const out: number[] = [];
+  let pos = 0;
+  while (pos < value.length) {
+    const [result, next] = readVarint(value, pos);
+    out.push(asInt(result));
+    pos = next;
+  }
+  return out;
+}
+
+const CONNECTION_FIELDS: Record<
+  number,
+  [string, (value: bigint | Buffer) => unknown]
+> = {
+  1: ["id", asString],
+  2: ["sourceIp", asIp],
+  3: ["destIp", asIp],
+  4: ["sourcePort", asInt],
+  5: ["destPort", asInt],
+  6: ["protocol", (v) => PROTOCOLS[asInt(v)] || undefined],
+  7: ["status", (v) => STATUSES[asInt(v)] || undefined],
+  8: ["startTime", asTimestamp],
+  9: ["lastActivity", asTimestamp],
+  10: ["duration", asInt],
+  11: ["bytesIn", asInt],
+  12: ["bytesOut", asInt],
+  13: ["packetsIn", asInt],
+  14: ["packetsOut", asInt],
+  15: ["bandwidth", asInt],
+  16: ["intervalStart", asTimestamp],
+  17: ["intervalEnd", asTimestamp],
+  18: ["deltaBytesIn", asInt],
+  19: ["deltaBytesOut", asInt],
+  20: ["deltaPacketsIn", asInt],
+  21: ["deltaPacketsOut", asInt],
+  22: ["conversationId", asString],
+  23: ["direction", (v) => DIRECTIONS[asInt(v)] || undefined],
+  24: ["samplingRate", asInt],
+  30: ["country", asString],
+  31: ["countryCode", asString],
+  32: ["city", asString],
+  33: ["latitude", asDouble],
+  34: ["longitude", asDouble],
+  35: ["asn", asInt],
+  36: ["asOrganization", asString],
+  37: ["enriched", (v) => asInt(v) !== 0],
+};
+
+const RATE_SUMMARY_FIELDS: Record<
+  number,
+  [string, (value: bigint | Buffer) => unknown]
+> = {
+  1: ["min", asInt],
+  2: ["mean", asDouble],
+  3: ["p50", asInt],
+  4: ["p95", asInt],
+  5: ["p99", asInt],
+  6: ["max", asInt],
+};
+
+const CAPTURE_STATS_FIELDS: Record<
+  number,
+  [string, (value: bigint | Buffer) => unknown]
+> = {
+  1: ["policy", asString],
+  2: ["received", asInt],
+  3: ["channelDrops", asInt],
+  4: ["kernelDrops", asInt],
+  5: ["ifDrops", asInt],
+  6: ["queuePeak", asDouble],
+};
+
+const PROTOCOL_TOTALS_FIELDS: Record<
+  number,
+  [string, (value: bigint | Buffer) => unknown]
+> = {
+  1: ["bytesIn", asInt],
+  2: ["bytesOut", asInt],
+  3: ["packetsIn", asInt],
+  4: ["packetsOut", asInt],
+};
+
+/**
+ * Decodes a message using a field table, ignoring unknown fields.
+ * @param buf - The encoded message.
+ * @param table - Field number to property name and converter.
+ * @param defaults - Proto3 defaults for implicit-presence fields.
+ * @returns The decoded object.
+ */
+
+function decodeMessage(
+  buf: Buffer,
+  table: Record<number, [string, (value: bigint | Buffer) => unknown]>,
+  defaults: Record<string, unknown> = {},
+): Record<string, unknown> {
+  const out: Record<string, unknown> = { ...defaults };
+  for (const field of readFields(buf)) {
+    const entry = table[field.num];
+    if (!entry) continue;
+    const value = entry[1](field.value);
+    if (value !== undefined) {
+      out[entry[0]] = value;
+    }
+  }
+  return out;
+}
+
+const RATE_SUMMARY_DEFAULTS = { min: 0, mean: 0, p50: 0, p95: 0, p99: 0, max: 0 };
+
+const decodeRateSummary = (v: bigint | Buffer) =>
+  decodeMessage(asBytes(v), RATE_SUMMARY_FIELDS, RATE_SUMMARY_DEFAULTS);
+
+const decodeCaptureStats = (v: bigint | Buffer) =>
+  decodeMessage(asBytes(v), CAPTURE_STATS_FIELDS, {
+    policy: "",
+    received: 0,
+    channelDrops: 0,
+    kernelDrops: 0,
+    ifDrops: 0,
+    queuePeak: 0,
+  });
+
+const SNAPSHOT_FIELDS: Record<
+  number,
+  [string, (value: bigint | Buffer) => unknown]
+> = {
+  1: ["timestamp", asTimestamp],
+  2: ["connections", asInt],
+  3: ["bandwidthIn", asInt],
+  4: ["bandwidthOut", asInt],
+  5: ["inactive", asInt],
+  6: ["endTime", asTimestamp],
+  7: ["packetsIn", asInt],
+  8: ["packetsOut", asInt],
+  9: ["rateIn", asDouble],
+  10: ["rateOut", asDouble],
+  11: ["peakRateIn", asInt],
+  12: ["peakRateOut", asInt],
+  14: ["throughputIn", decodeRateSummary],
+  15: ["throughputOut", decodeRateSummary],
+  16: ["newConnections", asInt],
+  17: ["newConnsPerSec", decodeRateSummary],
+  20: ["oversizeRecords", asInt],
+  21: ["samplingRate", asInt],
+  22: ["capture", decodeCaptureStats],
+};
+
+/**
+ * Decodes a v1 MetricsSnapshot message.
+ * @param buf - The encoded message.
+ * @returns The snapshot in its JSON shape.
+ */
+
+function decodeSnapshot(buf: Buffer): Record<string, unknown> {
+  const out = decodeMessage(buf, SNAPSHOT_FIELDS, {
+    connections: 0,
+    bandwidthIn: 0,
+    bandwidthOut: 0,
+    inactive: 0,
+  });
+
+  // Map and repeated fields may be split across several occurrences.
+  const protocols: Record<string, unknown> = {};
+  const bounds: number[] = [];
+  const sizes: number[] = [];
+  for (const field of readFields(buf)) {
+    if (field.num === 13) {
+      let key = "";
+      let totals: Buffer = Buffer.alloc(0);
+      for (const entry of readFields(asBytes(field.value))) {
+        if (entry.num === 1) key = asString(entry.value);
+        if (entry.num === 2) totals = asBytes(entry.value);
+      }
+      protocols[key] = decodeMessage(totals, PROTOCOL_TOTALS_FIELDS, {
+        bytesIn: 0,
+        bytesOut: 0,
+        packetsIn: 0,
+        packetsOut: 0,
+      });
+    } else if (field.num === 18) {
+      bounds.push(...asPackedInts(field.value));
+    } else if (field.num === 19) {
+      sizes.push(...asPackedInts(field.value));
+    }
+  }
+
+  if (Object.keys(protocols).length > 0) out.protocols = protocols;
+  if (bounds.length > 0) out.packetSizeBounds = bounds;
+  if (sizes.length > 0) out.packetSizes = sizes;
+  return out;
+}
+
+type BatchInfo = {
+  batchId?: string;
+  sequence?: number;
+};
+
+/**
+ * Collects the batch_id and sequence fields shared by both payloads.
+ * @param fields - The payload's top-level fields.
+ * @returns The batch info present in the payload.
+ */
+
+function decodeBatchInfo(fields: Field[]): BatchInfo {
+  const info: BatchInfo = {};
+  for (const field of fields) {
+    if (field.num === 2) info.batchId = asString(field.value);
+    if (field.num === 3) info.sequence = asInt(field.value);
+  }
+  return info;
+}
+
+/**
+ * Decodes a v1 ConnectionsPayload into `{ connections: [...] }`.
+ * @param buf - The request body.
+ * @returns The payload in its JSON shape.
+ */
+
+export function decodeConnectionsPayload(buf: Buffer): BatchInfo & {
+  connections: Record<string, unknown>[];
+} {
+  const fields = readFields(buf);
+  const connections = fields
+    .filter((field) => field.num === 1)
+    .map((field) =>
+      decodeMessage(asBytes(field.value), CONNECTION_FIELDS, {
+        sourcePort: 0,
+        destPort: 0,
+      }),
+    );
+  return { connections, ...decodeBatchInfo(fields) };
+}
+
+/**
+ * Decodes a v1 MetricsPayload into `{ snapshots: [...] }`.
+ * @param buf - The request body.
+ * @returns The payload in its JSON shape.
+ */
+
+export function decodeMetricsPayload(buf: Buffer): BatchInfo & {
+  snapshots: Record<string, unknown>[];
+} {
+  const fields = readFields(buf);
+  const snapshots = fields
+    .filter((field) => field.num === 1)
+    .map((field) => decodeSnapshot(asBytes(field.value)));
+  return { snapshots, ...decodeBatchInfo(fields) };
+}
@@ -0,0 +1,180 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/**
+ * @module backend/middleware/decompression.middleware
+ */
+
+import type { NextFunction, Request, Response } from "express";
+import { promisify } from "node:util";
+import zlib from "node:zlib";
+import {
+  decodeConnectionsPayload,
+  decodeMetricsPayload,
+  INGEST_PROTOBUF_CONTENT_TYPE,
+} from "../infrastructure/wire/ingest-protobuf.js";
+import { firstHeaderValue } from "../utils/request.js";
+
+const DEFAULT_LIMIT_BYTES = 2 * 1024 * 1024;
+
+type Decoder = (input: Buffer, options: zlib.ZlibOptions) => Promise<Buffer>;
+
+const gunzip = promisify(zlib.gunzip) as Decoder;
+const inflate = promisify(zlib.inflate) as Decoder;
+
+const DECODERS = new Map<string, Decoder>([
+  ["gzip", gunzip],
+  ["x-gzip", gunzip],
+  ["deflate", inflate],
+]);
+
+// zstd is only available on newer Node.js runtimes; without it the client
+// receives 415 and falls back to gzip.
+if (typeof zlib.zstdDecompress === "function") {
+  DECODERS.set("zstd", promisify(zlib.zstdDecompress) as Decoder);
+}
+
+export type DecompressionOptions = {
+  /** Maximum size of the decompressed body in bytes. */
+  limitBytes?: number;
+  /** Decoder for protobuf bodies; without one they are answered with 415. */
+  protobuf?: (body: Buffer) => unknown;
+};
+
+/**
+ * Reads the raw request body, aborting once it exceeds the limit.
+ * @param req - The req input.
+ * @param limitBytes - The limit bytes input.
+ * @returns The raw body, or undefined when the limit was exceeded.
+ */
+
+async function readRawBody(
+  req: Request,
+  limitBytes: number,
+): Promise<Buffer | undefined> {
+  const chunks: Buffer[] = [];
+  let total = 0;
+
+  for await (const chunk of req) {
+    const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(chunk);
+    total += buffer.length;
+    if (total > limitBytes) {
+      return undefined;
+    }
+    chunks.push(buffer);
+  }
+
+  return Buffer.concat(chunks);
+}
+
+/**
+ * Creates a middleware that decodes compressed JSON request bodies
+ * (gzip, deflate or zstd) and, when configured, binary protobuf bodies. Other
+ * encodings and media types are answered with 415 so clients can fall back.
+ * Uncompressed JSON requests are left for express.json().
+ * @param options - The options input.
+ * @returns The decompression middleware.
+ */
+
+export function createDecompressionMiddleware(
+  options: DecompressionOptions = {},
+) {
+  const limitBytes = options.limitBytes ?? DEFAULT_LIMIT_BYTES;
+
+  return async (
+    req: Request,
+    res: Response,
+    next: NextFunction,
+  ): Promise<void> => {
+    const rawEncoding = firstHeaderValue(req.headers["content-encoding"])
+      ?.trim()
+      .toLowerCase();
+    const encoding = rawEncoding === "identity" ? undefined : rawEncoding;
+    const isProtobuf =
+      firstHeaderValue(req.headers["content-type"])
+        ?.split(";")[0]
+        .trim()
+        .toLowerCase() === INGEST_PROTOBUF_CONTENT_TYPE;
+
+    if (!encoding && !isProtobuf) {
+      next();
+      return;
+    }
+
+    const decode = encoding ? DECODERS.get(encoding) : undefined;
+    if (encoding && !decode) {
+      res
+        .status(415)
+        .json({ error: `Unsupported Content-Encoding: ${encoding}` });
+      return;
+    }
+    if (isProtobuf && !options.protobuf) {
+      res
+        .status(415)
+        .json({ error: `Unsupported Content-Type: ${INGEST_PROTOBUF_CONTENT_TYPE}` });
+      return;
+    }
+
+    let decoded: Buffer;
+    try {
+      const raw = await readRawBody(req, limitBytes);
+      if (!raw) {
+        res.status(413).json({ error: "Payload too large" });
+        return;
+      }
+      decoded = decode
+        ? await decode(raw, { maxOutputLength: limitBytes })
+        : raw;
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException)?.code === "ERR_BUFFER_TOO_LARGE") {
+        res.status(413).json({ error: "Payload too large" });
+        return;
+      }
+      res.status(400).json({ error: "Invalid compressed body" });
+      return;
+    }
+
+    if (isProtobuf && options.protobuf) {
+      try {
+        req.body = options.protobuf(decoded);
+      } catch {
+        res.status(400).json({ error: "Invalid protobuf body" });
+        return;
+      }
+      next();
+      return;
+    }
+
+    try {
+      req.body = decoded.length > 0 ? JSON.parse(decoded.toString("utf8")) : {};
+    } catch {
+      res.status(400).json({ error: "Invalid JSON body" });
+      return;
+    }
+
+    // The stream is consumed, so express.json() skips this request.
+    next();
+  };
+}
+
+export const decodeConnectionsBody = createDecompressionMiddleware({
+  protobuf: decodeConnectionsPayload,
+});
+
+export const decodeMetricsBody = createDecompressionMiddleware({
+  protobuf: decodeMetricsPayload,
+});
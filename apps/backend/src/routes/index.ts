@@ -26,6 +26,7 @@ import { healthCheck } from "../controllers/health.controller.js";
 import * as connectionsControllerModule from "../controllers/connections.controller.js";
 import * as metricsControllerModule from "../controllers/metrics.controller.js";
 import * as tenantsControllerModule from "../controllers/tenants.controller.js";
+import { createAgentsController } from "../controllers/agents.controller.js";
 import * as authControllerModule from "../controllers/auth.controller.js";
 import * as authMiddlewareModule from "../middleware/auth.middleware.js";
 import * as csrfMiddlewareModule from "../middleware/csrf.middleware.js";
@@ -103,6 +104,7 @@ export function createRoutes(ctx: AppContext): Router {
           create: tenantsControllerModule.createTenant,
           remove: tenantsControllerModule.deleteTenant,
         };
+  const agentsController = createAgentsController(ctx);
   const requireApiAuth =
     requireApiAuthLegacy ??
     (typeof createAuthMiddleware === "function"
@@ -133,6 +135,13 @@ export function createRoutes(ctx: AppContext): Router {
 
   router.post("/api/metrics", metricsController.ingest);
 
+  router.post("/api/agents/register", agentsController.register);
+  router.post("/api/agents/:agentId/heartbeat", agentsController.heartbeat);
+  router.put("/api/agents/config", agentsController.saveTenantConfig);
+  router.get("/api/agents/:agentId/config", agentsController.config);
+  router.put("/api/agents/:agentId/config", agentsController.saveAgentConfig);
+  router.get("/api/agents", agentsController.list);
+
   router.get("/api/tenants", tenantsController.list);
   router.post("/api/tenants", tenantsController.create);
   router.delete("/api/tenants/:tenantId", tenantsController.remove);
@@ -0,0 +1,151 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/**
+ * @module backend/services/agents
+ */
+
+import { createHash, createPublicKey, verify } from "node:crypto";
+import type { AgentStatus } from "@byteroute/shared";
+import type { Agent, AgentConfigSettings } from "../domain/agent/types.js";
+
+/** Interval agents are told to send heartbeats at. */
+export const AGENT_HEARTBEAT_INTERVAL_SECONDS = Number(
+  process.env.AGENT_HEARTBEAT_INTERVAL_SECONDS ?? 30,
+);
+
+/** An agent is shown offline after missing this many heartbeats. */
+const MISSED_HEARTBEATS_OFFLINE = 3;
+
+/** Signed timestamps further than this from the server clock are rejected. */
+export const AGENT_MAX_CLOCK_SKEW_MS = 5 * 60 * 1000;
+
+/**
+ * Builds the message an agent signs: its ID and the request timestamp.
+ * @param agentId - The agent ID input.
+ * @param timestamp - The timestamp from the request body.
+ * @returns The signed bytes.
+ */
+
+export function agentSignatureMessage(
+  agentId: string,
+  timestamp: string,
+): Buffer {
+  return Buffer.from(`byteroute-agent-v1\n${agentId}\n${timestamp}`, "utf8");
+}
+
+/**
+ * Verifies an agent request signature.
+ * @param publicKey - The raw Ed25519 public key, base64.
+ * @param agentId - The agent ID input.
+ * @param timestamp - The timestamp from the request body.
+ * @param signature - The X-Agent-Signature header, base64.
+ * @param now - The current time.
+ * @returns Whether the signature is valid and the timestamp is recent.
+ */
+
+export function verifyAgentSignature(
+  publicKey: string,
+  agentId: string,
+  timestamp: string,
+  signature: string | undefined,
+  now: Date = new Date(),
+): boolean {
+  if (!signature) {
+    return false;
+  }
+  const signedAt = Date.parse(timestamp);
+  if (
+    Number.isNaN(signedAt) ||
+    Math.abs(now.getTime() - signedAt) > AGENT_MAX_CLOCK_SKEW_MS
+  ) {
+    return false;
+  }
+  try {
+    const key = createPublicKey({
+      key: {
+        kty: "OKP",
+        crv: "Ed25519",
+        x: Buffer.from(publicKey, "base64").toString("base64url"),
+      },
+      format: "jwk",
+    });
+    return verify(
+      null,
+      agentSignatureMessage(agentId, timestamp),
+      key,
+      Buffer.from(signature, "base64"),
+    );
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Converts an agent to its dashboard view.
+ * @param agent - The agent input.
+ * @param now - The current time.
+ * @returns The agent status.
+ */
+
+export function toAgentStatus(agent: Agent, now: Date = new Date()): AgentStatus {
+  const offlineAfterMs =
+    AGENT_HEARTBEAT_INTERVAL_SECONDS * MISSED_HEARTBEATS_OFFLINE * 1000;
+  return {
+    agentId: agent.agentId,
+    tenantId: agent.tenantId,
+    hostname: agent.hostname,
+    os: agent.os,
+    kernel: agent.kernel,
+    version: agent.version,
+    interfaces: agent.interfaces.map((iface) => iface.name),
+    capabilities: agent.capabilities,
+    registeredAt: agent.registeredAt.toISOString(),
+    lastSeenAt: agent.lastSeenAt.toISOString(),
+    uptimeSeconds: agent.uptimeSeconds,
+    configVersion: agent.configVersion,
+    configError: agent.configError,
+    online: now.getTime() - agent.lastSeenAt.getTime() <= offlineAfterMs,
+  };
+}
+
+/**
+ * Layers an agent's configuration over its tenant's and versions the result
+ * by content, so an unchanged document keeps its version and ETag.
+ * @param tenantSettings - The tenant-wide settings.
+ * @param agentSettings - The agent's own settings.
+ * @returns The effective document.
+ */
+
+export function resolveAgentConfig(
+  tenantSettings: AgentConfigSettings | null,
+  agentSettings: AgentConfigSettings | null,
+): { version: string; settings: AgentConfigSettings } {
+  const merged: Record<string, unknown> = {
+    ...tenantSettings,
+    ...agentSettings,
+  };
+  const settings = Object.fromEntries(
+    Object.keys(merged)
+      .sort()
+      .map((key) => [key, merged[key]]),
+  ) as AgentConfigSettings;
+  const version = createHash("sha256")
+    .update(JSON.stringify(settings))
+    .digest("hex")
+    .slice(0, 16);
+  return { version, settings };
+}
@@ -49,6 +49,8 @@ export async function loadConnectionsFromDb(limit = 500): Promise<number> {
       _id: 0,
       tenantId: 1,
       id: 1,
+      conversationId: 1,
+      direction: 1,
       sourceIp: 1,
       destIp: 1,
       sourcePort: 1,
@@ -73,6 +75,13 @@ export async function loadConnectionsFromDb(limit = 500): Promise<number> {
       bytesOut: 1,
       packetsIn: 1,
       packetsOut: 1,
+      intervalStart: 1,
+      intervalEnd: 1,
+      deltaBytesIn: 1,
+      deltaBytesOut: 1,
+      deltaPacketsIn: 1,
+      deltaPacketsOut: 1,
+      samplingRate: 1,
       startTime: 1,
       lastActivity: 1,
       duration: 1,
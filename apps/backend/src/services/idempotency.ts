@@ -0,0 +1,47 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/**
+ * @module backend/services/idempotency
+ */
+
+import { InMemoryIdempotencyStore } from "../infrastructure/idempotency/in-memory-idempotency-store.js";
+import { firstHeaderValue } from "../utils/request.js";
+
+export const idempotencyStore = new InMemoryIdempotencyStore({
+  windowMs: Number(process.env.INGEST_IDEMPOTENCY_WINDOW_MS ?? 10 * 60 * 1000),
+});
+
+/**
+ * Builds the deduplication key for an ingest request from its
+ * Idempotency-Key header, falling back to the payload's batch ID.
+ * @param input - The tenant, route scope, header and batch ID.
+ * @returns The scoped key, or undefined when the request carries none.
+ */
+
+export function ingestIdempotencyKey(input: {
+  tenantId: string;
+  scope: "connections" | "metrics";
+  header: string | string[] | undefined;
+  batchId?: string;
+}): string | undefined {
+  const key = (firstHeaderValue(input.header) ?? input.batchId)?.trim();
+  if (!key) {
+    return undefined;
+  }
+  return `${input.tenantId}:${input.scope}:${key}`;
+}
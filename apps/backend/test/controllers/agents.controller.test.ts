@@ -0,0 +1,295 @@
+import { describe, it, expect, beforeEach, vi } from 'vitest'
+import type { Request, Response } from 'express'
+import { generateKeyPairSync, sign, type KeyObject } from 'node:crypto'
+import { createAgentsController } from '../../src/controllers/agents.controller.js'
+import { agentSignatureMessage } from '../../src/services/agents.js'
+import type { IAgentRepository } from '../../src/domain/agent/agent-repository.interface.js'
+import type { IAgentConfigRepository } from '../../src/domain/agent/agent-config-repository.interface.js'
+import type { Agent, AgentConfigSettings, AgentHeartbeatStatus } from '../../src/domain/agent/types.js'
+
+class InMemoryAgentRepository implements IAgentRepository {
+  agents = new Map<string, Agent>()
+
+  async findByAgentId(agentId: string): Promise<Agent | null> {
+    return this.agents.get(agentId) ?? null
+  }
+
+  async upsert(agent: Omit<Agent, 'registeredAt'>): Promise<Agent> {
+    const registeredAt = this.agents.get(agent.agentId)?.registeredAt ?? agent.lastSeenAt
+    const stored = { ...agent, registeredAt }
+    this.agents.set(agent.agentId, stored)
+    return stored
+  }
+
+  async touch(agentId: string, seenAt: Date, status: AgentHeartbeatStatus): Promise<Agent | null> {
+    const agent = this.agents.get(agentId)
+    if (!agent) return null
+    agent.lastSeenAt = seenAt
+    agent.uptimeSeconds = status.uptimeSeconds ?? agent.uptimeSeconds
+    agent.configVersion = status.configVersion
+    agent.configError = status.configError
+    return agent
+  }
+
+  async findByTenant(tenantId: string): Promise<Agent[]> {
+    return [...this.agents.values()].filter((agent) => agent.tenantId === tenantId)
+  }
+}
+
+class InMemoryAgentConfigRepository implements IAgentConfigRepository {
+  docs = new Map<string, AgentConfigSettings>()
+
+  async find(tenantId: string, agentId: string | null): Promise<AgentConfigSettings | null> {
+    return this.docs.get(`${tenantId}/${agentId ?? ''}`) ?? null
+  }
+
+  async save(tenantId: string, agentId: string | null, settings: AgentConfigSettings): Promise<void> {
+    this.docs.set(`${tenantId}/${agentId ?? ''}`, settings)
+  }
+}
+
+const AGENT_ID = '0b6f4a52-53a4-4c36-9a1e-0f1ad9a3c7e1'
+
+function keypair(): { publicKey: string; privateKey: KeyObject } {
+  const { publicKey, privateKey } = generateKeyPairSync('ed25519')
+  const jwk = publicKey.export({ format: 'jwk' })
+  return { publicKey: Buffer.from(jwk.x as string, 'base64url').toString('base64'), privateKey }
+}
+
+function signature(privateKey: KeyObject, agentId: string, timestamp: string): string {
+  return sign(null, agentSignatureMessage(agentId, timestamp), privateKey).toString('base64')
+}
+
+function createMockResponse() {
+  const res: any = { statusCode: 200, jsonData: undefined }
+  res.status = vi.fn((code: number) => {
+    res.statusCode = code
+    return res
+  })
+  res.json = vi.fn((data: unknown) => {
+    res.jsonData = data
+    return res
+  })
+  res.headers = {} as Record<string, string>
+  res.setHeader = vi.fn((name: string, value: string) => {
+    res.headers[name.toLowerCase()] = value
+    return res
+  })
+  res.end = vi.fn(() => res)
+  return res
+}
+
+function registerRequest(key: { publicKey: string; privateKey: KeyObject }, overrides: Record<string, unknown> = {}) {
+  const timestamp = new Date().toISOString()
+  return {
+    headers: { 'x-agent-signature': signature(key.privateKey, AGENT_ID, timestamp) },
+    user: { id: 'user-1', tenantIds: ['default'], scopes: [] },
+    query: {},
+    body: {
+      agentId: AGENT_ID,
+      publicKey: key.publicKey,
+      hostname: 'sensor-1',
+      os: 'linux',
+      kernel: '6.8.0',
+      version: 'v1.2.3',
+      interfaces: [{ name: 'eth0', mac: '02:00:00:00:00:01', addrs: ['10.0.0.5/24'] }],
+      capabilities: ['wire:protobuf'],
+      timestamp,
+      ...overrides
+    }
+  }
+}
+
+function heartbeatRequest(privateKey: KeyObject, timestamp = new Date().toISOString()) {
+  return {
+    headers: { 'x-agent-signature': signature(privateKey, AGENT_ID, timestamp) },
+    user: { id: 'user-1', tenantIds: ['default'], scopes: [] },
+    params: { agentId: AGENT_ID },
+    query: {},
+    body: { timestamp, uptimeSeconds: 120, configVersion: 'abc123' }
+  }
+}
+
+describe('agents.controller', () => {
+  let repo: InMemoryAgentRepository
+  let configs: InMemoryAgentConfigRepository
+  let emit: ReturnType<typeof vi.fn>
+  let controller: ReturnType<typeof createAgentsController>
+
+  beforeEach(() => {
+    repo = new InMemoryAgentRepository()
+    configs = new InMemoryAgentConfigRepository()
+    emit = vi.fn()
+    controller = createAgentsController({
+      agentRepository: repo,
+      agentConfigRepository: configs,
+      io: { to: vi.fn(() => ({ emit })) }
+    } as any)
+  })
+
+  describe('register', () => {
+    it('binds the agent to the token tenant and returns the heartbeat interval', async () => {
+      const key = keypair()
+      const res = createMockResponse()
+
+      await controller.register(registerRequest(key) as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(200)
+      expect(res.jsonData).toEqual({ agentId: AGENT_ID, tenantId: 'default', heartbeatIntervalSeconds: 30 })
+      expect(repo.agents.get(AGENT_ID)).toMatchObject({ tenantId: 'default', hostname: 'sensor-1', kernel: '6.8.0' })
+      expect(emit).toHaveBeenCalledWith('agent:update', expect.objectContaining({ agentId: AGENT_ID, online: true }))
+    })
+
+    it('rejects a bad signature', async () => {
+      const key = keypair()
+      const req = registerRequest(key)
+      req.headers['x-agent-signature'] = signature(keypair().privateKey, AGENT_ID, req.body.timestamp as string)
+      const res = createMockResponse()
+
+      await controller.register(req as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(403)
+      expect(repo.agents.size).toBe(0)
+    })
+
+    it('rejects a stale timestamp', async () => {
+      const key = keypair()
+      const timestamp = new Date(Date.now() - 10 * 60 * 1000).toISOString()
+      const req = registerRequest(key, { timestamp })
+      req.headers['x-agent-signature'] = signature(key.privateKey, AGENT_ID, timestamp)
+      const res = createMockResponse()
+
+      await controller.register(req as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(403)
+    })
+
+    it('refuses to re-register an agent ID with a different key', async () => {
+      await controller.register(registerRequest(keypair()) as unknown as Request, createMockResponse() as Response)
+      const res = createMockResponse()
+
+      await controller.register(registerRequest(keypair()) as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(409)
+    })
+
+    it('requires a tenant when the token grants several', async () => {
+      const req = registerRequest(keypair())
+      req.user.tenantIds = ['a', 'b']
+      const res = createMockResponse()
+
+      await controller.register(req as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(400)
+    })
+  })
+
+  describe('heartbeat', () => {
+    it('updates last-seen for a registered agent', async () => {
+      const key = keypair()
+      await controller.register(registerRequest(key) as unknown as Request, createMockResponse() as Response)
+      const res = createMockResponse()
+
+      await controller.heartbeat(heartbeatRequest(key.privateKey) as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(200)
+      expect(repo.agents.get(AGENT_ID)).toMatchObject({ uptimeSeconds: 120, configVersion: 'abc123' })
+    })
+
+    it('returns 404 for an unknown agent so it registers again', async () => {
+      const res = createMockResponse()
+
+      await controller.heartbeat(heartbeatRequest(keypair().privateKey) as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(404)
+    })
+
+    it('rejects a heartbeat signed with another key', async () => {
+      await controller.register(registerRequest(keypair()) as unknown as Request, createMockResponse() as Response)
+      const res = createMockResponse()
+
+      await controller.heartbeat(heartbeatRequest(keypair().privateKey) as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(403)
+    })
+  })
+
+  describe('config', () => {
+    const user = { id: 'user-1', tenantIds: ['default'], scopes: [] }
+
+    async function registered() {
+      await controller.register(registerRequest(keypair()) as unknown as Request, createMockResponse() as Response)
+    }
+
+    it('layers agent settings over tenant settings and answers 304 for the same ETag', async () => {
+      await registered()
+      await controller.saveTenantConfig(
+        { headers: { 'x-tenant-id': 'default' }, user, query: {}, body: { settings: { flush: '10s', dedupe: 'ip' } } } as unknown as Request,
+        createMockResponse() as Response
+      )
+      await controller.saveAgentConfig(
+        { headers: {}, user, params: { agentId: AGENT_ID }, query: {}, body: { settings: { flush: '30s' } } } as unknown as Request,
+        createMockResponse() as Response
+      )
+
+      const res = createMockResponse()
+      await controller.config({ headers: {}, user, params: { agentId: AGENT_ID }, query: {} } as unknown as Request, res as Response)
+
+      expect(res.status).toHaveBeenCalledWith(200)
+      expect(res.jsonData.settings).toEqual({ dedupe: 'ip', flush: '30s' })
+      expect(res.headers.etag).toBe(`"${res.jsonData.version}"`)
+
+      const again = createMockResponse()
+      await controller.config(
+        { headers: { 'if-none-match': res.headers.etag }, user, params: { agentId: AGENT_ID }, query: {} } as unknown as Request,
+        again as Response
+      )
+      expect(again.status).toHaveBeenCalledWith(304)
+    })
+
+    it('rejects settings the client would reject', async () => {
+      for (const settings of [{ flush: '0s' }, { compression: 'brotli' }, { 'max-batch-conns': 0 }, { iface: 'eth1' }]) {
+        const res = createMockResponse()
+        await controller.saveTenantConfig(
+          { headers: { 'x-tenant-id': 'default' }, user, query: {}, body: { settings } } as unknown as Request,
+          res as Response
+        )
+        expect(res.status).toHaveBeenCalledWith(400)
+      }
+      expect(configs.docs.size).toBe(0)
+    })
+
+    it('returns 404 for an unregistered agent', async () => {
+      const res = createMockResponse()
+      await controller.config({ headers: {}, user, params: { agentId: AGENT_ID }, query: {} } as unknown as Request, res as Response)
+      expect(res.status).toHaveBeenCalledWith(404)
+    })
+  })
+
+  describe('list', () => {
+    it('reports agents offline after three missed heartbeats', async () => {
+      const key = keypair()
+      await controller.register(registerRequest(key) as unknown as Request, createMockResponse() as Response)
+      repo.agents.get(AGENT_ID)!.lastSeenAt = new Date(Date.now() - 5 * 60 * 1000)
+      const res = createMockResponse()
+
+      await controller.list(
+        { headers: { 'x-tenant-id': 'default' }, user: { id: 'user-1', tenantIds: ['default'] }, query: {} } as unknown as Request,
+        res as Response
+      )
+
+      expect(res.jsonData.agents).toEqual([expect.objectContaining({ agentId: AGENT_ID, online: false, interfaces: ['eth0'] })])
+    })
+
+    it('returns 403 for a tenant the user cannot access', async () => {
+      const res = createMockResponse()
+
+      await controller.list(
+        { headers: { 'x-tenant-id': 'other' }, user: { id: 'user-1', tenantIds: ['default'] }, query: {} } as unknown as Request,
+        res as Response
+      )
+
+      expect(res.status).toHaveBeenCalledWith(403)
+    })
+  })
+})
@@ -316,6 +316,32 @@ describe('Connections Controller', () => {
 
       expect(res.status).toHaveBeenCalledWith(403)
     })
+
+    it('acknowledges a repeated Idempotency-Key without storing twice', async () => {
+      const connections = [createConnection()]
+      const headers = { 'idempotency-key': 'batch-dedupe-test' }
+
+      const first = createMockResponse()
+      await postConnections(createMockRequest({ connections }, headers) as Request, first as Response)
+      const second = createMockResponse()
+      await postConnections(createMockRequest({ connections }, headers) as Request, second as Response)
+
+      expect(first.jsonData).toEqual({ received: 1, status: 'processing' })
+      expect(second.status).toHaveBeenCalledWith(202)
+      expect(second.jsonData).toEqual({ received: 1, status: 'duplicate' })
+      expect(enrichAndStoreConnections).toHaveBeenCalledTimes(1)
+    })
+
+    it('deduplicates by payload batchId when the header is missing', async () => {
+      const body = { connections: [createConnection()], batchId: 'batch-body-test', sequence: 7 }
+
+      await postConnections(createMockRequest(body) as Request, createMockResponse() as Response)
+      const second = createMockResponse()
+      await postConnections(createMockRequest(body) as Request, second as Response)
+
+      expect(second.jsonData.status).toBe('duplicate')
+      expect(enrichAndStoreConnections).toHaveBeenCalledTimes(1)
+    })
   })
 
   describe('searchHistory', () => {
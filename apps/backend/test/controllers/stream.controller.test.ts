@@ -0,0 +1,100 @@
+import { afterEach, beforeEach, describe, expect, it, vi } from 'vitest'
+import type { IncomingMessage } from 'node:http'
+
+vi.mock('../../src/services/ingest.js', () => ({
+  enrichAndStoreConnections: vi.fn().mockResolvedValue(undefined),
+  storeRawConnections: vi.fn().mockResolvedValue(undefined)
+}))
+
+import { createStreamController } from '../../src/controllers/stream.controller.js'
+import { enrichAndStoreConnections } from '../../src/services/ingest.js'
+import { signAuthToken } from '../../src/auth/passport.js'
+import { InMemoryIdempotencyStore } from '../../src/infrastructure/idempotency/in-memory-idempotency-store.js'
+
+const originalEnv = { ...process.env }
+
+function createController() {
+  return createStreamController({
+    userRepository: {
+      findById: vi.fn(async (id: string) => (id === 'user-1' ? { id, email: 'user@example.com', name: 'User' } : null))
+    },
+    tenantRepository: { findOwnedTenantIds: vi.fn(async () => ['default']) },
+    idempotencyStore: new InMemoryIdempotencyStore({ windowMs: 60_000 })
+  } as any)
+}
+
+function upgradeRequest(headers: Record<string, string>, url = '/api/stream'): IncomingMessage {
+  return { url, headers, socket: { remoteAddress: '203.0.113.7' } } as unknown as IncomingMessage
+}
+
+describe('stream.controller', () => {
+  beforeEach(() => {
+    process.env = { ...originalEnv, JWT_SECRET: 'test-jwt-secret' }
+    vi.clearAllMocks()
+  })
+
+  afterEach(() => {
+    process.env = { ...originalEnv }
+  })
+
+  describe('authenticate', () => {
+    const token = () => signAuthToken({ sub: 'user-1', email: 'user@example.com', name: 'User', tenantIds: ['default'] })
+
+    it('accepts a bearer token with access to the tenant', async () => {
+      const session = await createController().authenticate(
+        upgradeRequest({ authorization: `Bearer ${token()}`, 'x-tenant-id': 'default' })
+      )
+      expect(session).toEqual({ tenantId: 'default', reporterIp: '203.0.113.7' })
+    })
+
+    it('reads the tenant from the query string', async () => {
+      const session = await createController().authenticate(
+        upgradeRequest({ authorization: `Bearer ${token()}` }, '/api/stream?tenantId=default')
+      )
+      expect(session).toMatchObject({ tenantId: 'default' })
+    })
+
+    it('refuses missing tokens and foreign tenants', async () => {
+      const controller = createController()
+      expect(await controller.authenticate(upgradeRequest({ 'x-tenant-id': 'default' }))).toBe(401)
+      expect(
+        await controller.authenticate(upgradeRequest({ authorization: `Bearer ${token()}`, 'x-tenant-id': 'other' }))
+      ).toBe(403)
+    })
+  })
+
+  describe('handleMessage', () => {
+    const session = { tenantId: 'default', reporterIp: '203.0.113.7' }
+    const batch = (batchId: string) =>
+      JSON.stringify({ batchId, sequence: 1, connections: [{ sourceIp: '10.0.0.1', destIp: '1.1.1.1', protocol: 'TCP' }] })
+
+    it('acknowledges a batch and stores it for the session tenant', () => {
+      const reply = createController().handleMessage(session, batch('b-1'))
+
+      expect(reply).toEqual({ type: 'ack', batchId: 'b-1', received: 1, status: 'processing' })
+      expect(enrichAndStoreConnections).toHaveBeenCalledWith(undefined, [expect.objectContaining({ sourceIp: '10.0.0.1' })], session)
+    })
+
+    it('acknowledges a repeated batch ID without storing it again', () => {
+      const controller = createController()
+      controller.handleMessage(session, batch('b-1'))
+      const reply = controller.handleMessage(session, batch('b-1'))
+
+      expect(reply).toMatchObject({ type: 'ack', status: 'duplicate' })
+      expect(enrichAndStoreConnections).toHaveBeenCalledTimes(1)
+    })
+
+    it('nacks malformed messages as not retryable', () => {
+      const controller = createController()
+
+      expect(controller.handleMessage(session, '{')).toMatchObject({ type: 'nack', retryable: false })
+      expect(controller.handleMessage(session, JSON.stringify({ batchId: 'b-2' }))).toEqual({
+        type: 'nack',
+        batchId: 'b-2',
+        error: expect.any(String),
+        retryable: false
+      })
+      expect(enrichAndStoreConnections).not.toHaveBeenCalled()
+    })
+  })
+})
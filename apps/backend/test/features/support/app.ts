@@ -10,6 +10,7 @@ import { createRoutes } from '../../../src/routes/index.js';
 import { createAppContext } from '../../../src/config/composition-root.js';
 import { ensurePassportAuthInitialized } from '../../../src/auth/passport.js';
 import { errorHandler } from '../../../src/middleware/error.middleware.js';
+import { decodeConnectionsBody, decodeMetricsBody } from '../../../src/middleware/decompression.middleware.js';
 
 // Must be set before ensurePassportAuthInitialized is called
 process.env.JWT_SECRET = process.env.JWT_SECRET ?? 'test-jwt-secret-for-cucumber';
@@ -22,6 +23,8 @@ const mockIo = {
 
 export function buildTestApp(): express.Express {
   const app = express();
+  app.use('/api/connections', decodeConnectionsBody);
+  app.use('/api/metrics', decodeMetricsBody);
   app.use(express.json({ limit: '2mb' }));
 
   ensurePassportAuthInitialized();
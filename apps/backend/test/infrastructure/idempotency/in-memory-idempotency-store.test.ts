@@ -0,0 +1,53 @@
+import { describe, expect, it } from "vitest";
+import { InMemoryIdempotencyStore } from "../../../src/infrastructure/idempotency/in-memory-idempotency-store.js";
+import { ingestIdempotencyKey } from "../../../src/services/idempotency.js";
+
+describe("InMemoryIdempotencyStore", () => {
+  it("rejects a key seen within the window", () => {
+    let now = 0;
+    const store = new InMemoryIdempotencyStore({ windowMs: 1000, now: () => now });
+
+    expect(store.claim("a")).toBe(true);
+    expect(store.claim("a")).toBe(false);
+    expect(store.claim("b")).toBe(true);
+
+    now = 1000;
+    expect(store.claim("a")).toBe(true);
+  });
+
+  it("forgets released keys", () => {
+    const store = new InMemoryIdempotencyStore();
+
+    expect(store.claim("a")).toBe(true);
+    store.release("a");
+    expect(store.claim("a")).toBe(true);
+  });
+
+  it("evicts the oldest keys beyond maxKeys", () => {
+    const store = new InMemoryIdempotencyStore({ maxKeys: 2 });
+
+    store.claim("a");
+    store.claim("b");
+    store.claim("c");
+
+    expect(store.claim("a")).toBe(true);
+    expect(store.claim("c")).toBe(false);
+  });
+});
+
+describe("ingestIdempotencyKey", () => {
+  it("scopes the header by tenant and route", () => {
+    expect(
+      ingestIdempotencyKey({ tenantId: "t1", scope: "metrics", header: " k1 ", batchId: "b1" }),
+    ).toBe("t1:metrics:k1");
+  });
+
+  it("falls back to the batch ID and ignores blank keys", () => {
+    expect(
+      ingestIdempotencyKey({ tenantId: "t1", scope: "connections", header: undefined, batchId: "b1" }),
+    ).toBe("t1:connections:b1");
+    expect(
+      ingestIdempotencyKey({ tenantId: "t1", scope: "connections", header: "  " }),
+    ).toBeUndefined();
+  });
+});
@@ -0,0 +1,133 @@
+import { describe, expect, it } from "vitest";
+import {
+  decodeConnectionsPayload,
+  decodeMetricsPayload,
+  WireFormatError,
+} from "../../../src/infrastructure/wire/ingest-protobuf.js";
+
+// Produced by the Go client's backend.MarshalConnectionsProto and
+// backend.MarshalMetricsProto so both ends are checked against each other.
+const CONNECTIONS_HEX =
+  "0a510a06666c6f772d3112040a0000011a1020010db800000000000000000000000120b88e0328bb0330023802410097633af2ca86184900fc3058f2ca861858dc0b98010089020000000000c042409802c176";
+const METRICS_HEX =
+  "0a3d090032961cf2ca8618100318e8074900000000008030406a0b0a03544350120408022001720b110000000000000440300792010340dc0b9a0103010004";
+
+describe("ingest protobuf decoder", () => {
+  it("decodes connections into the JSON payload shape", () => {
+    const payload = decodeConnectionsPayload(Buffer.from(CONNECTIONS_HEX, "hex"));
+
+    expect(payload.connections).toEqual([
+      {
+        id: "flow-1",
+        sourceIp: "10.0.0.1",
+        destIp: "2001:db8::1",
+        sourcePort: 51000,
+        destPort: 443,
+        protocol: "UDP",
+        status: "inactive",
+        startTime: "2026-01-02T03:04:05.500Z",
+        lastActivity: "2026-01-02T03:04:06.000Z",
+        bytesIn: 1500,
+        deltaBytesOut: 0,
+        latitude: 37.5,
+        asn: 15169,
+      },
+    ]);
+  });
+
+  it("decodes the conversation ID", () => {
+    // backend.MarshalConnectionsProto([{ID: "a", ConversationID: "c"}])
+    const payload = decodeConnectionsPayload(
+      Buffer.from("0a070a0161b2010163", "hex"),
+    );
+
+    expect(payload.connections).toEqual([{ id: "a", conversationId: "c" }]);
+  });
+
+  it("decodes the flow direction", () => {
+    // backend.MarshalConnectionsProto([{ID: "a", Direction: "in"}])
+    const payload = decodeConnectionsPayload(
+      Buffer.from("0a060a0161b80102", "hex"),
+    );
+
+    expect(payload.connections).toEqual([{ id: "a", direction: "in" }]);
+  });
+
+  it("decodes the sampling rate", () => {
+    // backend.MarshalConnectionsProto([{ID: "a", SamplingRate: 10}])
+    const payload = decodeConnectionsPayload(
+      Buffer.from("0a060a0161c0010a", "hex"),
+    );
+
+    expect(payload.connections).toEqual([{ id: "a", samplingRate: 10 }]);
+  });
+
+  it("decodes metrics snapshots into the JSON payload shape", () => {
+    const payload = decodeMetricsPayload(Buffer.from(METRICS_HEX, "hex"));
+
+    expect(payload.snapshots).toEqual([
+      {
+        timestamp: "2026-01-02T03:04:05.000Z",
+        connections: 3,
+        bandwidthIn: 1000,
+        bandwidthOut: 0,
+        inactive: 0,
+        rateIn: 16.5,
+        protocols: {
+          TCP: { bytesIn: 2, bytesOut: 0, packetsIn: 0, packetsOut: 1 },
+        },
+        throughputIn: { min: 0, mean: 2.5, p50: 0, p95: 0, p99: 0, max: 7 },
+        packetSizeBounds: [64, 1500],
+        packetSizes: [1, 0, 4],
+      },
+    ]);
+  });
+
+  it("decodes capture statistics", () => {
+    // backend.MarshalMetricsProto([{Timestamp: "2026-01-02T03:04:05Z",
+    //   Capture: {Policy: "drop", Received: 10, ChannelDrops: 2, QueuePeak: 0.5}}])
+    const payload = decodeMetricsPayload(
+      Buffer.from(
+        "0a1f090032961cf2ca8618b201130a0464726f70100a180231000000000000e03f",
+        "hex",
+      ),
+    );
+
+    expect(payload.snapshots[0]).toMatchObject({
+      capture: {
+        policy: "drop",
+        received: 10,
+        channelDrops: 2,
+        kernelDrops: 0,
+        ifDrops: 0,
+        queuePeak: 0.5,
+      },
+    });
+  });
+
+  it("decodes batch info", () => {
+    // batch_id "b1", sequence 7, no snapshots
+    const body = Buffer.from([0x12, 0x02, 0x62, 0x31, 0x18, 0x07]);
+
+    expect(decodeMetricsPayload(body)).toEqual({
+      snapshots: [],
+      batchId: "b1",
+      sequence: 7,
+    });
+  });
+
+  it("skips unknown fields", () => {
+    // field 99 (varint 1) followed by an empty connection
+    const body = Buffer.from([0x98, 0x06, 0x01, 0x0a, 0x00]);
+
+    expect(decodeConnectionsPayload(body).connections).toEqual([
+      { sourcePort: 0, destPort: 0 },
+    ]);
+  });
+
+  it("rejects truncated input", () => {
+    const truncated = Buffer.from(CONNECTIONS_HEX, "hex").subarray(0, 20);
+
+    expect(() => decodeConnectionsPayload(truncated)).toThrow(WireFormatError);
+  });
+});
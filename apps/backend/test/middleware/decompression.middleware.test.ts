@@ -0,0 +1,127 @@
+import { describe, expect, it } from "vitest";
+import express from "express";
+import request from "supertest";
+import zlib from "node:zlib";
+import { createDecompressionMiddleware } from "../../src/middleware/decompression.middleware.js";
+import {
+  decodeConnectionsPayload,
+  INGEST_PROTOBUF_CONTENT_TYPE,
+} from "../../src/infrastructure/wire/ingest-protobuf.js";
+
+function createApp(limitBytes?: number, protobuf = decodeConnectionsPayload) {
+  const app = express();
+  app.use(
+    "/api/connections",
+    createDecompressionMiddleware({ limitBytes, protobuf }),
+  );
+  app.use(express.json());
+  app.post("/api/connections", (req, res) => {
+    res.status(202).json({ received: req.body.connections.length });
+  });
+  return app;
+}
+
+const payload = JSON.stringify({ connections: [{ id: "a" }, { id: "b" }] });
+
+describe("decompression.middleware", () => {
+  it("passes uncompressed bodies through to express.json", async () => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", "application/json")
+      .send(payload)
+      .expect(202);
+
+    expect(response.body).toEqual({ received: 2 });
+  });
+
+  it.each([
+    ["gzip", zlib.gzipSync],
+    ["deflate", zlib.deflateSync],
+    ["zstd", zlib.zstdCompressSync],
+  ] as const)("decodes %s bodies", async (encoding, compress) => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", "application/json")
+      .set("Content-Encoding", encoding)
+      .send(compress(Buffer.from(payload)))
+      .expect(202);
+
+    expect(response.body).toEqual({ received: 2 });
+  });
+
+  it("returns 415 for unsupported encodings", async () => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", "application/json")
+      .set("Content-Encoding", "br")
+      .send(zlib.brotliCompressSync(Buffer.from(payload)))
+      .expect(415);
+
+    expect(response.body).toEqual({ error: "Unsupported Content-Encoding: br" });
+  });
+
+  it("returns 413 when the decompressed body exceeds the limit", async () => {
+    const large = JSON.stringify({ connections: new Array(5000).fill({ id: "x" }) });
+
+    await request(createApp(1024))
+      .post("/api/connections")
+      .set("Content-Type", "application/json")
+      .set("Content-Encoding", "gzip")
+      .send(zlib.gzipSync(Buffer.from(large)))
+      .expect(413);
+  });
+
+  it("returns 400 for corrupt compressed bodies", async () => {
+    await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", "application/json")
+      .set("Content-Encoding", "gzip")
+      .send(Buffer.from("not gzip"))
+      .expect(400);
+  });
+
+  // Two connections with ids "a" and "b".
+  const protobufPayload = Buffer.from("0a030a01610a030a0162", "hex");
+
+  it("decodes protobuf bodies", async () => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", INGEST_PROTOBUF_CONTENT_TYPE)
+      .send(protobufPayload)
+      .expect(202);
+
+    expect(response.body).toEqual({ received: 2 });
+  });
+
+  it("decodes compressed protobuf bodies", async () => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", INGEST_PROTOBUF_CONTENT_TYPE)
+      .set("Content-Encoding", "gzip")
+      .send(zlib.gzipSync(protobufPayload))
+      .expect(202);
+
+    expect(response.body).toEqual({ received: 2 });
+  });
+
+  it("returns 415 for protobuf when no decoder is configured", async () => {
+    const app = express();
+    app.use("/api/connections", createDecompressionMiddleware());
+
+    await request(app)
+      .post("/api/connections")
+      .set("Content-Type", INGEST_PROTOBUF_CONTENT_TYPE)
+      .send(protobufPayload)
+      .expect(415);
+  });
+
+  it("returns 400 for malformed protobuf bodies", async () => {
+    const response = await request(createApp())
+      .post("/api/connections")
+      .set("Content-Type", INGEST_PROTOBUF_CONTENT_TYPE)
+      .send(Buffer.from([0x0a, 0x10, 0x01]))
+      .expect(400);
+
+    expect(response.body).toEqual({ error: "Invalid protobuf body" });
+  });
+});
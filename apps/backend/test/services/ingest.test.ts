@@ -183,6 +183,55 @@ describe("ingest service", () => {
     expect(update.lastActivity.getTime()).toBe(lastActivity);
   });
 
+  it("keeps the conversation ID next to the per-epoch ID", async () => {
+    mocks.enrichBatch.mockImplementation(async (connections) => connections);
+    mocks.bulkWrite.mockResolvedValue({ upsertedCount: 1, modifiedCount: 0, insertedCount: 0, matchedCount: 0 });
+
+    await enrichAndStoreConnections(undefined, [
+      baseConnection({ id: "h1.k.epoch-2", conversationId: "h1.k.conv" })
+    ], {});
+
+    const ops = mocks.bulkWrite.mock.calls[0]?.[0] as any[];
+    expect(ops[0]?.updateOne?.filter).toMatchObject({ id: "h1.k.epoch-2" });
+    expect(ops[0]?.updateOne?.update?.$set.conversationId).toBe("h1.k.conv");
+  });
+
+  it("keeps a known direction and drops anything else", async () => {
+    mocks.enrichBatch.mockImplementation(async (connections) => connections);
+    mocks.bulkWrite.mockResolvedValue({ upsertedCount: 2, modifiedCount: 0, insertedCount: 0, matchedCount: 0 });
+
+    await enrichAndStoreConnections(undefined, [
+      baseConnection({ id: "d1", direction: "in" }),
+      baseConnection({ id: "d2", direction: "sideways" as any })
+    ], {});
+
+    const ops = mocks.bulkWrite.mock.calls[0]?.[0] as any[];
+    expect(ops[0]?.updateOne?.update?.$set.direction).toBe("in");
+    expect(ops[1]?.updateOne?.update?.$set.direction).toBeUndefined();
+  });
+
+  it("stores the interval deltas reported by the agent", async () => {
+    mocks.enrichBatch.mockImplementation(async (connections) => connections);
+    mocks.bulkWrite.mockResolvedValue({ upsertedCount: 1, modifiedCount: 0, insertedCount: 0, matchedCount: 0 });
+
+    await enrichAndStoreConnections(undefined, [
+      baseConnection({
+        id: "i1",
+        intervalStart: "2026-01-01T00:00:00.000Z",
+        intervalEnd: "2026-01-01T00:00:10.000Z",
+        deltaBytesIn: 100,
+        deltaBytesOut: 50,
+        deltaPacketsIn: 2,
+        deltaPacketsOut: 1
+      })
+    ], {});
+
+    const update = (mocks.bulkWrite.mock.calls[0]?.[0] as any[])[0]?.updateOne?.update?.$set;
+    expect(update.intervalEnd).toBe("2026-01-01T00:00:10.000Z");
+    expect(update.deltaBytesIn).toBe(100);
+    expect(update.deltaPacketsOut).toBe(1);
+  });
+
   it("fills defaults for missing network fields", async () => {
     mocks.enrichBatch.mockImplementation(async (connections) => connections);
     mocks.bulkWrite.mockResolvedValue({ upsertedCount: 1, modifiedCount: 0, insertedCount: 0, matchedCount: 0 });
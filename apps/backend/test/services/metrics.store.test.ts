@@ -54,4 +54,28 @@ describe("metricsStore", () => {
     expect(tenantAll).toHaveLength(2);
   });
 
+  it("keeps capture statistics reported by the agent", () => {
+    const capture = { policy: "drop", received: 100, channelDrops: 3, kernelDrops: 1, ifDrops: 0, queuePeak: 0.9 };
+
+    metricsStore.addSnapshots(DEFAULT_TENANT_ID, [
+      { ...createSnapshot({ connections: 1 }), capture },
+      createSnapshot({ connections: 2 }),
+    ]);
+
+    const stored = metricsStore.getAllSnapshots(DEFAULT_TENANT_ID);
+    expect(stored[0]?.capture).toEqual(capture);
+    expect(stored[1]).not.toHaveProperty("capture");
+  });
+
+  it("keeps the sampling rate reported by the agent", () => {
+    metricsStore.addSnapshots(DEFAULT_TENANT_ID, [
+      { ...createSnapshot({ connections: 1 }), samplingRate: 10 },
+      createSnapshot({ connections: 2 }),
+    ]);
+
+    const stored = metricsStore.getAllSnapshots(DEFAULT_TENANT_ID);
+    expect(stored[0]?.samplingRate).toBe(10);
+    expect(stored[1]).not.toHaveProperty("samplingRate");
+  });
+
 });
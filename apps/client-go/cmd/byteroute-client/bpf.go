@@ -0,0 +1,80 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/byteroute/client-go/internal/capture"
+	"github.com/byteroute/client-go/internal/config"
+)
+
+// runBPF prints the filter the agent would capture with, given the same
+// flags, and the instructions it compiles to for the interface's link type.
+// With --pcap FILE it also reports how many packets of FILE it matches.
+func runBPF(cfg config.Config, pcapFile string) {
+	var localIPs map[string]struct{}
+	if cfg.Iface != "" {
+		ips, err := capture.LocalIPsForInterface(cfg.Iface)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: could not resolve local IPs for iface %q: %v\n", cfg.Iface, err)
+		}
+		localIPs = ips
+	}
+	expr, err := effectiveBPF(cfg, localIPs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Printf("filter: %s\n", expr)
+
+	linkType, source := layers.LinkTypeEthernet, "assumed"
+	if cfg.Iface != "" {
+		if lt, err := capture.Probe(cfg.Iface, cfg.SnapLen, false); err != nil {
+			fmt.Fprintf(os.Stderr, "warn: cannot open %s (%v); compiling for Ethernet\n", cfg.Iface, err)
+		} else {
+			linkType, source = lt, cfg.Iface
+		}
+	}
+	prog, err := capture.CompileBPF(linkType, cfg.SnapLen, expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compile for %s: %v\n", linkType, err)
+		os.Exit(1)
+	}
+	fmt.Printf("link type: %s (%s)\n", linkType, source)
+	fmt.Printf("instructions: %d\n", len(prog))
+	for _, line := range capture.Disassemble(prog) {
+		fmt.Println(line)
+	}
+
+	if pcapFile != "" {
+		res, err := capture.FilterFile(pcapFile, expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", pcapFile, err)
+			os.Exit(1)
+		}
+		share := 0.0
+		if res.Packets > 0 {
+			share = 100 * float64(res.Matched) / float64(res.Packets)
+		}
+		fmt.Printf("%s: %d of %d packets match (%.1f%%)\n", pcapFile, res.Matched, res.Packets, share)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/capture"
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/privilege"
+)
+
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+	statusSkip = "skip"
+)
+
+// Clock skew beyond these makes token expiry and flow timestamps unreliable.
+const (
+	skewWarn = 5 * time.Second
+	skewFail = time.Minute
+)
+
+// check is one line of the doctor report.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+type doctorReport struct {
+	Version string  `json:"version"`
+	OK      bool    `json:"ok"`
+	Checks  []check `json:"checks"`
+}
+
+// doctor runs the checks in order; later ones use what earlier ones found.
+type doctor struct {
+	cfg      config.Config
+	localIPs map[string]struct{}
+	linkType layers.LinkType
+	health   *backend.Health
+	report   doctorReport
+}
+
+func (d *doctor) add(name, status, format string, args ...any) {
+	d.report.Checks = append(d.report.Checks, check{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	if status == statusFail {
+		d.report.OK = false
+	}
+}
+
+// runDoctor checks that this host and configuration can run the agent and
+// prints a report, as text or with --json as JSON. It exits non-zero when a
+// check fails.
+func runDoctor(cfg config.Config, jsonOut bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*cfg.HTTPTimeout)
+	defer cancel()
+
+	d := &doctor{cfg: cfg, report: doctorReport{Version: version, OK: true}}
+	d.checkInterface()
+	d.checkPrivileges()
+	d.checkCapture()
+	d.checkBPF()
+	d.checkBackend(ctx)
+	d.checkToken(ctx)
+	d.checkClock()
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(d.report)
+	} else {
+		for _, c := range d.report.Checks {
+			fmt.Printf("%-4s  %-10s %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+		}
+	}
+	if !d.report.OK {
+		os.Exit(1)
+	}
+}
+
+func (d *doctor) checkInterface() {
+	if d.cfg.Iface == "" {
+		d.add("interface", statusFail, "--iface is required")
+		return
+	}
+	ips, err := capture.LocalIPsForInterface(d.cfg.Iface)
+	if err != nil {
+		d.add("interface", statusFail, "%s: %v", d.cfg.Iface, err)
+		return
+	}
+	d.localIPs = ips
+	if len(ips) == 0 {
+		d.add("interface", statusWarn, "%s has no addresses; the default filter cannot tell directions apart", d.cfg.Iface)
+		return
+	}
+	addrs := make([]string, 0, len(ips))
+	for ip := range ips {
+		addrs = append(addrs, ip)
+	}
+	sort.Strings(addrs)
+	d.add("interface", statusOK, "%s: %s", d.cfg.Iface, strings.Join(addrs, ", "))
+}
+
+// checkPrivileges reports the privileges this process holds, which are the
+// ones the agent starts with when run the same way, and what they become
+// after the capture handle is open.
+func (d *doctor) checkPrivileges() {
+	st, err := privilege.Current()
+	if err != nil {
+		d.add("privileges", statusSkip, "%v", err)
+		return
+	}
+	opts, err := privilegeOptions(d.cfg)
+	if err != nil {
+		d.add("privileges", statusFail, "%v", err)
+		return
+	}
+
+	after := fmt.Sprintf("after capture starts: caps=%s", opts.Keep)
+	if opts.UID >= 0 || opts.GID >= 0 {
+		after += fmt.Sprintf(" uid=%d gid=%d", opts.UID, opts.GID)
+	}
+	if opts.Seccomp {
+		after += " seccomp=filter"
+	}
+	if !st.CanCapture() {
+		d.add("privileges", statusFail, "%s; capture needs cap_net_raw: run as root or grant cap_net_raw,cap_net_admin; %s", st, after)
+		return
+	}
+	d.add("privileges", statusOK, "%s; %s", st, after)
+}
+
+func (d *doctor) checkCapture() {
+	if d.cfg.Iface == "" {
+		d.add("capture", statusSkip, "no interface")
+		return
+	}
+	lt, err := capture.Probe(d.cfg.Iface, d.cfg.SnapLen, d.cfg.Promisc)
+	if err != nil {
+		d.add("capture", statusFail, "open %s: %v", d.cfg.Iface, err)
+		return
+	}
+	d.linkType = lt
+	d.add("capture", statusOK, "opened %s, link type %s", d.cfg.Iface, lt)
+}
+
+func (d *doctor) checkBPF() {
+	expr, err := effectiveBPF(d.cfg, d.localIPs)
+	if err != nil {
+		d.add("bpf", statusFail, "%v", err)
+		return
+	}
+	lt, assumed := d.linkType, ""
+	if lt == 0 {
+		lt, assumed = layers.LinkTypeEthernet, " (link type Ethernet assumed)"
+	}
+	insns, err := capture.CompileBPF(lt, d.cfg.SnapLen, expr)
+	if err != nil {
+		d.add("bpf", statusFail, "%q: %v%s", expr, err, assumed)
+		return
+	}
+	d.add("bpf", statusOK, "%q compiles to %d instructions%s", expr, len(insns), assumed)
+}
+
+// checkBackend resolves the backend, connects and requests /health, and
+// reports DNS, TLS and the health response as separate checks.
+func (d *doctor) checkBackend(ctx context.Context) {
+	if d.cfg.BackendURL == "" {
+		d.add("health", statusSkip, "no --backend; exporting to the OTLP collector only")
+		return
+	}
+	u, err := url.Parse(d.cfg.BackendURL)
+	if err != nil || u.Hostname() == "" {
+		d.add("dns", statusFail, "invalid --backend %q", d.cfg.BackendURL)
+		return
+	}
+	d.checkDNS(ctx, u.Hostname())
+
+	transport, err := backendTransport(d.cfg)
+	if err != nil {
+		d.add("tls", statusFail, "%v", err)
+		return
+	}
+	bc, err := backend.NewClient(d.cfg.BackendURL, d.cfg.HTTPTimeout, "", backend.WithTransport(transport))
+	if err != nil {
+		d.add("health", statusFail, "%v", err)
+		return
+	}
+
+	var tlsErr error
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) { tlsErr = err },
+	}
+	h, err := bc.Health(httptrace.WithClientTrace(ctx, trace))
+	d.health = h
+
+	switch {
+	case u.Scheme != "https":
+		d.add("tls", statusWarn, "%s is plain HTTP; tokens and flows are sent unencrypted", u.Scheme)
+	case tlsErr != nil:
+		d.add("tls", statusFail, "%v", tlsErr)
+	case h == nil || h.TLS == nil:
+		d.add("tls", statusSkip, "no connection")
+	default:
+		status, detail := tlsCheck(h.TLS)
+		d.add("tls", status, "%s", detail)
+	}
+
+	switch {
+	case err != nil:
+		d.add("health", statusFail, "%v", err)
+	case !h.OK:
+		d.add("health", statusFail, "backend reports it is not ok")
+	default:
+		d.add("health", statusOK, "%s answered in %s", u.Redacted(), h.RTT.Round(time.Millisecond))
+	}
+}
+
+func (d *doctor) checkDNS(ctx context.Context, host string) {
+	if net.ParseIP(host) != nil {
+		d.add("dns", statusOK, "%s is an IP address", host)
+		return
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	switch {
+	case err != nil && d.cfg.Proxy != "":
+		d.add("dns", statusWarn, "%v (the proxy resolves the backend)", err)
+	case err != nil:
+		d.add("dns", statusFail, "%v", err)
+	default:
+		d.add("dns", statusOK, "%s: %s", host, strings.Join(addrs, ", "))
+	}
+}
+
+// tlsCheck describes the negotiated connection, warning when the server
+// certificate expires within two weeks.
+func tlsCheck(st *tls.ConnectionState) (status, detail string) {
+	if len(st.PeerCertificates) == 0 {
+		return statusOK, tls.VersionName(st.Version)
+	}
+	cert := st.PeerCertificates[0]
+	status = statusOK
+	if time.Until(cert.NotAfter) < 14*24*time.Hour {
+		status = statusWarn
+	}
+	return status, fmt.Sprintf("%s, certificate %s issued by %s, expires %s",
+		tls.VersionName(st.Version), cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format(time.DateOnly))
+}
+
+// checkToken decodes the configured token as the client does when it sets
+// X-Tenant-Id. With an enrolment credential this fetches a client token.
+func (d *doctor) checkToken(ctx context.Context) {
+	transport, err := backendTransport(d.cfg)
+	if err != nil {
+		d.add("token", statusSkip, "%v", err)
+		return
+	}
+	creds, err := credentials(d.cfg, &http.Client{Timeout: d.cfg.HTTPTimeout, Transport: transport})
+	if err != nil {
+		d.add("token", statusFail, "%v", err)
+		return
+	}
+	if creds == nil {
+		creds = backend.StaticCredentials(strings.TrimSpace(d.cfg.AuthToken))
+	}
+	token, err := creds.Token(ctx)
+	if err != nil {
+		d.add("token", statusFail, "%v", err)
+		return
+	}
+	if token == "" {
+		d.add("token", statusWarn, "no token configured; requests are sent unauthenticated")
+		return
+	}
+
+	claims, ok := backend.DecodeToken(token)
+	if !ok {
+		d.add("token", statusOK, "opaque token, not decoded")
+		return
+	}
+	tenant := claims.TenantID
+	if tenant == "" {
+		tenant = "none"
+	}
+	switch {
+	case claims.Expires.IsZero():
+		d.add("token", statusOK, "tenant %s, no expiry", tenant)
+	case time.Now().After(claims.Expires):
+		d.add("token", statusFail, "tenant %s, expired %s", tenant, claims.Expires.UTC().Format(time.RFC3339))
+	default:
+		d.add("token", statusOK, "tenant %s, expires %s (in %s)", tenant, claims.Expires.UTC().Format(time.RFC3339), time.Until(claims.Expires).Round(time.Minute))
+	}
+}
+
+// checkClock compares the local clock with the Date header of the health
+// response, which has a resolution of one second.
+func (d *doctor) checkClock() {
+	if d.health == nil || d.health.Date.IsZero() {
+		d.add("clock", statusSkip, "no Date header from the backend")
+		return
+	}
+	skew := time.Since(d.health.Date) - d.health.RTT/2
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	status := statusOK
+	switch {
+	case abs > skewFail:
+		status = statusFail
+	case abs > skewWarn:
+		status = statusWarn
+	}
+	d.add("clock", status, "local clock is %s off the backend's", skew.Round(100*time.Millisecond))
+}
@@ -0,0 +1,290 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/flow"
+	"github.com/byteroute/client-go/internal/metrics"
+	"github.com/byteroute/client-go/internal/rules"
+	"github.com/byteroute/client-go/internal/util"
+)
+
+// exporter sends dirty flows to the backend: over the stream while one is
+// connected, as POST batches otherwise. Flows also go to the OTLP
+// collector, independently of the backend, which may not be configured at
+// all. After a failed send, exports pause until retryAt; failures counts
+// consecutive failed sends to grow the backoff. The failed batch is held
+// and sent again as is, under the same batch ID, so the backend can drop it
+// if the first send got through.
+type exporter struct {
+	agg     *flow.Aggregator
+	bc      *backend.Client // nil without --backend
+	stream  *backend.Stream // nil unless --transport=stream
+	metrics *metrics.Collector
+	otlp    *otlpSink     // nil unless --otlp-endpoint is set
+	rules   *rules.Engine // nil unless --rules-file is set
+	retry   backend.RetryPolicy
+
+	retryAt  time.Time
+	failures int
+	held     *backend.BatchBuilder
+	heldKeys []flow.Key
+}
+
+// flush exports every dirty flow that is not pending, batch by batch,
+// acknowledging or re-queueing each batch by the backend's answer.
+func (x *exporter) flush(ctx context.Context, cfg config.Config, now time.Time) {
+	if x.rules != nil {
+		if changed, err := x.rules.ReloadIfChanged(); err != nil {
+			log.Printf("rules: keeping previous rules: %v", err)
+		} else if changed {
+			log.Printf("rules: reloaded %s", cfg.RulesFile)
+		}
+	}
+	x.exportChanges(cfg)
+	if x.bc == nil || now.Before(x.retryAt) {
+		return
+	}
+	if x.held != nil {
+		held, keys := x.held, x.heldKeys
+		x.held, x.heldKeys = nil, nil
+		if !x.deliver(ctx, held, keys) {
+			return
+		}
+	}
+	builder := x.bc.NewBatchBuilder(cfg.MaxBatchBytes)
+
+	for {
+		batch, keys := x.agg.ExportBatch(cfg.MaxBatchConns)
+		if len(batch) == 0 {
+			return
+		}
+		batch, keys, denied := x.applyRules(batch, keys, true)
+		// Denied records are acknowledged so they are not exported again
+		// until they see new traffic. Records waiting on a hostname stay
+		// pending until the next flush interval resets them.
+		x.agg.Ack(denied)
+		if len(batch) == 0 {
+			continue
+		}
+
+		builder.Reset()
+		keys, rest, skipped := fillBatch(builder, batch, keys)
+		// Records that did not fit go back for the next request.
+		x.agg.Nack(rest)
+		if len(skipped) > 0 {
+			// They can never be sent; acknowledge so they stop
+			// being exported, and surface them in metrics.
+			x.agg.Ack(skipped)
+			x.metrics.RecordOversize(len(skipped))
+		}
+		if builder.Len() == 0 {
+			continue
+		}
+
+		// Count flows before posting so a backend outage does not
+		// blank out local metrics; bytes come from the capture loop.
+		for _, conn := range builder.Connections() {
+			x.metrics.RecordFlow(conn.ID, conn.Status == "inactive")
+		}
+
+		if !x.deliver(ctx, builder, keys) {
+			return
+		}
+	}
+}
+
+// deliver sends b and acknowledges its records by the backend's answer.
+// After a retryable failure it holds b for the next flush and reports that
+// exporting should pause.
+func (x *exporter) deliver(ctx context.Context, b *backend.BatchBuilder, keys []flow.Key) bool {
+	// The client bounds each attempt with --http-timeout and retries
+	// transient failures itself.
+	streamed, err := x.send(ctx, b)
+
+	if err != nil && backend.Kind(err) == backend.KindPermanent {
+		// The backend will never accept this batch as sent; drop it
+		// rather than retrying it forever.
+		x.agg.Ack(keys)
+		log.Printf("post batch rejected, dropped %d connections: %v", b.Len(), err)
+		return true
+	}
+	if err != nil {
+		// The records stay out of later batches until the held batch
+		// went through: flush only exports new batches after it.
+		x.held, x.heldKeys = b, keys
+		delay := x.retry.Backoff(x.failures, backend.RetryAfter(err))
+		x.failures++
+		x.retryAt = time.Now().Add(delay)
+		log.Printf("post batch failed (%s, retrying in %s): %v", backend.Kind(err), delay.Round(time.Millisecond), err)
+		return false
+	}
+
+	x.failures = 0
+	x.agg.Ack(keys)
+	if !streamed {
+		// Streamed batches are small and frequent; only POSTs are logged.
+		log.Printf("posted %d connections", b.Len())
+	}
+	return true
+}
+
+// exportChanges sends the flows that changed since the previous flush to
+// the OTLP collector. The aggregator keeps separate deltas for it, so flow
+// logs neither wait for the backend nor are counted twice when a backend
+// batch is resent.
+func (x *exporter) exportChanges(cfg config.Config) {
+	if x.otlp == nil {
+		return
+	}
+	conns, keys := x.agg.Changes()
+	if len(conns) == 0 {
+		return
+	}
+	// Rule hits and flow counts are taken by the backend export when there
+	// is one.
+	conns, keys, denied := x.applyRules(conns, keys, x.bc == nil)
+	x.agg.MarkSeen(keys)
+	x.agg.MarkSeen(denied)
+	if x.bc == nil {
+		for _, conn := range conns {
+			x.metrics.RecordFlow(conn.ID, conn.Status == "inactive")
+		}
+	}
+	for batch := range slices.Chunk(conns, max(cfg.MaxBatchConns, 1)) {
+		x.otlp.exportFlows(batch)
+	}
+}
+
+// applyRules splits records by the export rules into those to export, with
+// their keys, and the keys of denied records. Records waiting on a hostname
+// are in neither. count says whether the decisions count as rule hits.
+func (x *exporter) applyRules(batch []backend.Connection, keys []flow.Key, count bool) ([]backend.Connection, []flow.Key, []flow.Key) {
+	if x.rules == nil {
+		return batch, keys, nil
+	}
+	evaluate := x.rules.Check
+	if count {
+		evaluate = x.rules.Evaluate
+	}
+	var denied []flow.Key
+	n := 0
+	for i, conn := range batch {
+		// Rules see the addresses as captured, not as exported.
+		match := conn
+		match.SourceIP, match.DestIP = x.agg.Endpoints(keys[i])
+		switch evaluate(match) {
+		case rules.Allow:
+			batch[n], keys[n] = conn, keys[i]
+			n++
+		case rules.Deny:
+			denied = append(denied, keys[i])
+		}
+	}
+	return batch[:n], keys[:n], denied
+}
+
+// send streams b when possible and posts it otherwise. It reports whether
+// the batch went over the stream.
+func (x *exporter) send(ctx context.Context, b *backend.BatchBuilder) (streamed bool, err error) {
+	if x.stream != nil && x.stream.Connected() {
+		_, err := x.stream.Send(ctx, b)
+		if !errors.Is(err, backend.ErrStreamUnavailable) {
+			return true, err
+		}
+	}
+	_, err = x.bc.PostBatch(ctx, b)
+	return false, err
+}
+
+// fillBatch adds connections to b until it is full. It returns the keys of
+// the records added, the keys left over for a later request and the keys of
+// records that cannot be encoded within the size limit at all.
+func fillBatch(b *backend.BatchBuilder, batch []backend.Connection, keys []flow.Key) (added, rest, skipped []flow.Key) {
+	added = make([]flow.Key, 0, len(keys))
+	for i, conn := range batch {
+		ok, err := b.Add(conn)
+		if err != nil {
+			log.Printf("skipping flow record: %v", err)
+			skipped = append(skipped, keys[i])
+			continue
+		}
+		if !ok {
+			return added, keys[i:], skipped
+		}
+		added = append(added, keys[i])
+	}
+	return added, nil, skipped
+}
+
+// metricsQueue bounds the snapshots waiting for the backend.
+const metricsQueue = 4
+
+// metricsPoster posts metrics snapshots from a goroutine of its own, so the
+// client's retries, backoff and breaker waits never hold up flushes, remote
+// configuration or streaming in the main loop.
+type metricsPoster struct {
+	bc        *backend.Client
+	snapshots chan metrics.Snapshot
+}
+
+func newMetricsPoster(bc *backend.Client) *metricsPoster {
+	return &metricsPoster{bc: bc, snapshots: make(chan metrics.Snapshot, metricsQueue)}
+}
+
+// run posts queued snapshots until ctx is done. Each post, retries
+// included, is bounded by timeout.
+func (p *metricsPoster) run(ctx context.Context, timeout time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case snapshot := <-p.snapshots:
+			p.post(ctx, snapshot, timeout)
+		}
+	}
+}
+
+func (p *metricsPoster) post(ctx context.Context, snapshot metrics.Snapshot, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := p.bc.PostMetrics(ctx, []backend.MetricsSnapshot{toBackendSnapshot(snapshot)}); err != nil {
+		log.Printf("post metrics failed: %v", err)
+		return
+	}
+	log.Printf("posted metrics snapshot: %d connections (%d inactive), %s in, %s out",
+		snapshot.Connections, snapshot.Inactive, util.FormatBytes(snapshot.BandwidthIn), util.FormatBytes(snapshot.BandwidthOut))
+}
+
+// queue hands a snapshot to run. When the backend is too far behind the
+// snapshot is dropped, as a failed post would be.
+func (p *metricsPoster) queue(snapshot metrics.Snapshot) {
+	select {
+	case p.snapshots <- snapshot:
+	default:
+		log.Printf("warn: backend is falling behind, dropped metrics snapshot")
+	}
+}
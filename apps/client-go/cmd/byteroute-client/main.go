@@ -19,23 +19,53 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/byteroute/client-go/internal/agent"
+	"github.com/byteroute/client-go/internal/anon"
+	"github.com/byteroute/client-go/internal/api"
 	"github.com/byteroute/client-go/internal/backend"
 	"github.com/byteroute/client-go/internal/capture"
 	"github.com/byteroute/client-go/internal/config"
 	"github.com/byteroute/client-go/internal/flow"
 	"github.com/byteroute/client-go/internal/metrics"
+	"github.com/byteroute/client-go/internal/proc"
+	"github.com/byteroute/client-go/internal/rdns"
+	"github.com/byteroute/client-go/internal/rules"
+	"github.com/byteroute/client-go/internal/state"
+	"github.com/byteroute/client-go/internal/util"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "top":
+			runTop(subcommandConfig())
+			return
+		case "bpf":
+			pcapFile := takeValue("pcap")
+			runBPF(subcommandConfig(), pcapFile)
+			return
+		case "doctor":
+			jsonOut := takeFlag("json")
+			runDoctor(subcommandConfig(), jsonOut)
+			return
+		}
+	}
+
 	cfg := config.Parse()
 	if cfg.ListIfaces {
 		ifaces, err := capture.ListIfaces()
@@ -47,55 +77,134 @@ func main() {
 		}
 		return
 	}
-	if cfg.Iface == "" {
-		fmt.Fprintln(os.Stderr, "--iface is required")
-		os.Exit(2)
-	}
 
-	localIPs, err := capture.LocalIPsForInterface(cfg.Iface)
-	if err != nil {
-		log.Printf("warn: could not resolve local IPs for iface %q: %v", cfg.Iface, err)
-		localIPs = map[string]struct{}{}
-	}
+	localIPs, bpf := captureSetup(cfg)
 
-	// Default BPF: focus on outbound/inbound using local IPv4s if available.
-	bpf := cfg.BPF
-	if bpf == "" {
-		bpf = capture.BuildDefaultBPF("tcp or udp or icmp", cfg.Direction, localIPs)
+	identity := loadIdentity(cfg.StateDir)
+	if cfg.HostID == "" {
+		// Keeps flow IDs from colliding across machines.
+		cfg.HostID = identity.ID
 	}
 
 	agg := flow.New(cfg.HostID, cfg.DedupMode, cfg.IdleTTL, localIPs)
+	anonymizer, err := newAnonymizer(cfg)
+	if err != nil {
+		log.Fatalf("anonymisation: %v", err)
+	}
+	if anonymizer != nil {
+		agg.SetAnonymizer(anonymizer)
+	}
+	agg.SetFlowIDs(flowIDs(cfg), cfg.FlowIDEpochs)
 
 	// Create metrics collector for time-series data
-	metricsCollector := metrics.New(168) // Keep 7 days of hourly metrics
+	metricsCollector := metrics.New(cfg.MetricsRetention)
 
-	handle, packets, err := capture.Start(cfg.Iface, bpf, cfg.SnapLen, cfg.Promisc)
+	privs, err := privilegeOptions(cfg)
+	if err != nil {
+		log.Fatalf("privileges: %v", err)
+	}
+
+	sampler := capture.NewSampler(cfg.SamplePackets, cfg.SampleFlows, cfg.SamplePacketsMax)
+	captureCounters := &capture.Counters{}
+	handle, packets, err := capture.Start(cfg.Iface, bpf, cfg.SnapLen, cfg.Promisc,
+		capture.WithSampler(sampler),
+		capture.WithOverflow(cfg.CaptureOverflow),
+		capture.WithQueueSize(cfg.CaptureQueue),
+		capture.WithCounters(captureCounters))
 	if err != nil {
 		log.Fatalf("capture start: %v", err)
 	}
 	defer handle.Close()
 
-	bc, err := backend.NewClient(cfg.BackendURL, cfg.HTTPTimeout, cfg.AuthToken)
-	if err != nil {
-		log.Fatalf("backend client: %v", err)
+	retryPolicy := backend.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = cfg.RetryMaxAttempts
+	retryPolicy.MaxDelay = cfg.RetryMaxDelay
+
+	// Without --backend, flows and metrics only go to the OTLP collector.
+	var bc *backend.Client
+	if cfg.BackendURL != "" {
+		bc = newBackendClient(cfg, retryPolicy)
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
 	log.Printf(
-		"byteroute-client: iface=%s direction=%s bpf=%q backend=%s flush=%s dedupe=%s",
+		"byteroute-client: iface=%s direction=%s bpf=%q backend=%s transport=%s flush=%s dedupe=%s compression=%s wire=%s anon=%s/%s",
 		cfg.Iface,
 		cfg.Direction,
 		bpf,
 		cfg.BackendURL,
+		cfg.Transport,
 		cfg.FlushInterval,
 		cfg.DedupMode,
+		cfg.Compression,
+		cfg.WireFormat,
+		cfg.AnonLocal,
+		cfg.AnonRemote,
 	)
+	if sampler != nil {
+		log.Printf("sampling 1 in %d packets (up to 1 in %d) of 1 in %d flows", sampler.PacketRate(), max(sampler.PacketRate(), cfg.SamplePacketsMax), max(cfg.SampleFlows, 1))
+	}
+
+	// Registration, heartbeats and remote configuration need the backend.
+	var runner *agent.Runner
+	if bc != nil {
+		runner = &agent.Runner{
+			Client:   bc,
+			Identity: identity,
+			Info:     agent.Registration(identity, version, capabilities(cfg)),
+			Retry:    retryPolicy,
+			// Requests name the tenant the agent is bound to, unless the
+			// token names one itself.
+			OnRegistered: func(b backend.AgentBinding) { bc.SetTenant(b.TenantID) },
+		}
+		go runner.Run(ctx)
+	}
+
+	var ruleEngine *rules.Engine
+	if cfg.RulesFile != "" {
+		ruleEngine, err = rules.Load(cfg.RulesFile,
+			rules.WithHostnames(rdns.New().Lookup),
+			rules.WithProcesses(proc.New().Lookup))
+		if err != nil {
+			log.Fatalf("rules: %v", err)
+		}
+		log.Printf("applying export rules from %s", cfg.RulesFile)
+	}
+
+	if cfg.APIListen != "" {
+		ln, err := api.Listen(cfg.APIListen)
+		if err != nil {
+			log.Fatalf("api listen: %v", err)
+		}
+		handler := api.NewHandler(agg, metricsCollector, ruleEngine)
+		if cfg.APIToken != "" {
+			handler = api.RequireToken(handler, cfg.APIToken)
+		}
+		srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("api server: %v", err)
+			}
+		}()
+		defer srv.Close()
+		log.Printf("local api listening on %s", cfg.APIListen)
+	}
+
+	// Everything needing privileges (capture, key files, the API port) is
+	// set up by now.
+	if err := dropPrivileges(cfg.StateDir, privs); err != nil {
+		log.Fatalf("drop privileges: %v", err)
+	}
 
 	go func() {
 		for ev := range packets {
-			agg.Update(ev.Timestamp, ev.SrcIP, ev.DstIP, ev.SrcPort, ev.DstPort, ev.Protocol, ev.Length)
+			if agg.UpdateSampled(ev.Timestamp, ev.SrcIP, ev.DstIP, ev.SrcPort, ev.DstPort, ev.Protocol, ev.Length, ev.SampleRate) {
+				metricsCollector.RecordSampledConnection(ev.Timestamp, sampler.FlowRate())
+			}
+			_, outbound := localIPs[ev.SrcIP.String()]
+			metricsCollector.RecordSampledPacket(ev.Timestamp, ev.Protocol, ev.Length, outbound, ev.SampleRate)
 		}
 		cancel()
 	}()
@@ -103,164 +212,438 @@ func main() {
 	ticker := time.NewTicker(cfg.FlushInterval)
 	defer ticker.Stop()
 
-	// Metrics snapshot ticker (every minute for faster feedback)
-	metricsInterval := time.Minute
-	metricsTicker := time.NewTicker(metricsInterval)
+	metricsTicker := time.NewTicker(cfg.MetricsInterval)
 	defer metricsTicker.Stop()
 
-	backoff := 250 * time.Millisecond
+	// Remote configuration is applied on top of the local configuration,
+	// so a setting the server stops sending reverts to the local value.
+	local := cfg
+	remoteUpdates := make(chan config.Remote)
+	if cfg.RemoteConfigInterval > 0 && bc != nil {
+		watcher := &agent.ConfigWatcher{Client: bc, AgentID: identity.ID, Interval: cfg.RemoteConfigInterval}
+		go watcher.Run(ctx, remoteUpdates)
+	}
+	live := &liveConfig{handle: handle, localIPs: localIPs, agg: agg, bc: bc, flush: ticker, metrics: metricsTicker}
+	appliedVersion := ""
+	var captureStats capture.Stats
+
+	var poster *metricsPoster
+	if bc != nil {
+		poster = newMetricsPoster(bc)
+		go poster.run(ctx, cfg.MetricsInterval)
+	}
+
+	exp := &exporter{agg: agg, bc: bc, metrics: metricsCollector, rules: ruleEngine, retry: retryPolicy}
+	sink, err := newOTLPSink(cfg, identity)
+	if err != nil {
+		log.Fatalf("otlp exporter: %v", err)
+	}
+	if sink != nil {
+		exp.otlp = sink
+		go sink.run(ctx)
+		log.Printf("exporting metrics and flows to OTLP collector %s (%s)", cfg.OTLPEndpoint, cfg.OTLPProtocol)
+	}
+	// While streaming, updated flows are exported as they change, at most
+	// once per --stream-interval; the flush ticker still covers pruning and
+	// the POST fallback.
+	var dirty <-chan struct{}
+	var streamDue <-chan time.Time
+	var nextStream time.Time
+	if cfg.Transport == "stream" && bc != nil {
+		stream := bc.NewStream()
+		stream.OnConnect = func() { log.Printf("stream connected") }
+		stream.OnDisconnect = func(err error) { log.Printf("stream disconnected, using POST until it reconnects: %v", err) }
+		exp.stream = stream
+		dirty = agg.Dirty()
+		go func() {
+			if err := stream.Run(ctx); err != nil {
+				log.Printf("streaming unavailable, using POST: %v", err)
+			}
+		}()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("shutting down")
 			return
+		case doc := <-remoteUpdates:
+			next, ignored, err := local.ApplyRemote(doc)
+			if err == nil {
+				err = live.apply(cfg, next)
+			}
+			if err != nil {
+				log.Printf("remote config %s rejected: %v", doc.Version, err)
+				runner.SetConfigStatus(appliedVersion, fmt.Sprintf("%s: %v", doc.Version, err))
+				continue
+			}
+			if len(ignored) > 0 {
+				log.Printf("remote config %s: ignored locked or unknown settings %v", doc.Version, ignored)
+			}
+			cfg, appliedVersion = next, doc.Version
+			runner.SetConfigStatus(appliedVersion, "")
+			log.Printf("applied remote config %s", doc.Version)
 		case <-metricsTicker.C:
+			captureStats = recordCaptureStats(metricsCollector, captureCounters.Stats(handle, packets), captureStats)
+
 			// Take metrics snapshot and send to backend
 			snapshot := metricsCollector.TakeSnapshot()
-			snapshots := []backend.MetricsSnapshot{
-				{
-					Timestamp:    snapshot.Timestamp.UTC().Format(time.RFC3339Nano),
-					Connections:  snapshot.Connections,
-					BandwidthIn:  snapshot.BandwidthIn,
-					BandwidthOut: snapshot.BandwidthOut,
-					Inactive:     snapshot.Inactive,
-				},
+			if sink != nil {
+				sink.exportMetrics(ctx, snapshot)
 			}
-
-			reqCtx, cancelReq := context.WithTimeout(ctx, cfg.HTTPTimeout)
-			_, err := bc.PostMetrics(reqCtx, snapshots)
-			cancelReq()
-
-			if err != nil {
-				log.Printf("post metrics failed: %v", err)
-			} else {
-				log.Printf("posted metrics snapshot: %d connections (%d inactive), %s in, %s out",
-					snapshot.Connections, snapshot.Inactive, formatBytes(snapshot.BandwidthIn), formatBytes(snapshot.BandwidthOut))
+			if poster != nil {
+				poster.queue(snapshot)
+			}
+			if snapshot.SamplingRate > 0 {
+				log.Printf("sampling: estimates from 1 in %d packets on average, now 1 in %d", snapshot.SamplingRate, captureStats.PacketRate)
+			}
+		case <-dirty:
+			dirty = nil
+			streamDue = time.After(time.Until(nextStream))
+		case t := <-streamDue:
+			streamDue, dirty = nil, agg.Dirty()
+			nextStream = t.Add(cfg.StreamInterval)
+			if exp.stream.Connected() {
+				agg.ResetPending()
+				exp.flush(ctx, cfg, t)
 			}
 		case t := <-ticker.C:
 			agg.Prune(t)
 			// Allow flows to be exported again for this interval.
 			agg.ResetPending()
-
-			for {
-				batch, keys := agg.ExportBatch(cfg.MaxBatchConns)
-				if len(batch) == 0 {
-					break
-				}
-
-				batch, keys = enforceMaxBytes(batch, keys, cfg.MaxBatchBytes)
-				if len(batch) == 0 {
-					break
-				}
-
-				reqCtx, cancelReq := context.WithTimeout(ctx, cfg.HTTPTimeout)
-				_, err := bc.PostConnections(reqCtx, batch)
-				cancelReq()
-
-				if err != nil {
-					agg.Nack(keys)
-					log.Printf("post batch failed (will retry): %v", err)
-					select {
-					case <-time.After(backoff):
-						backoff = minDuration(backoff*2, 5*time.Second)
-					case <-ctx.Done():
-						return
-					}
-					break
-				}
-
-				backoff = 250 * time.Millisecond
-				agg.Ack(keys)
-				log.Printf("posted %d connections", len(batch))
-
-				// Record metrics for posted connections
-				for _, conn := range batch {
-					bytesIn := int64(0)
-					bytesOut := int64(0)
-					inactive := conn.Status == "inactive"
-
-					if conn.BytesIn != nil {
-						bytesIn = *conn.BytesIn
-					}
-					if conn.BytesOut != nil {
-						bytesOut = *conn.BytesOut
-					}
-
-					metricsCollector.RecordConnection(conn.ID, bytesIn, bytesOut, inactive)
-				}
-			}
+			exp.flush(ctx, cfg, t)
 		}
 	}
 }
 
-func minDuration(a, b time.Duration) time.Duration {
-	if a < b {
-		return a
-	}
-	return b
+// subcommandConfig parses the flags that follow a subcommand name, so
+// subcommands accept the same flags and env vars as the agent itself.
+func subcommandConfig() config.Config {
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return config.Parse()
 }
 
-func formatBytes(bytes int64) string {
-	const unit = 1000
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// takeFlag removes a boolean --name (or -name) from the command line,
+// reporting whether it was there. Subcommands use it for flags the agent
+// does not have.
+func takeFlag(name string) bool {
+	found := false
+	args := os.Args[:1]
+	for _, a := range os.Args[1:] {
+		if a == "--"+name || a == "-"+name {
+			found = true
+			continue
+		}
+		args = append(args, a)
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	os.Args = args
+	return found
+}
+
+// takeValue removes --name VALUE (or --name=VALUE) from the command line
+// and returns VALUE.
+func takeValue(name string) string {
+	value := ""
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		a := os.Args[i]
+		switch {
+		case (a == "--"+name || a == "-"+name) && i+1 < len(os.Args):
+			value = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--"+name+"="), strings.HasPrefix(a, "-"+name+"="):
+			value = a[strings.Index(a, "=")+1:]
+		default:
+			args = append(args, a)
+		}
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	os.Args = args
+	return value
 }
 
-func enforceMaxBytes(batch []backend.Connection, keys []flow.Key, maxBytes int) ([]backend.Connection, []flow.Key) {
-	if maxBytes <= 0 {
-		return batch, keys
+// captureSetup resolves the interface's local IPs and the effective BPF
+// filter, exiting when no interface was configured.
+func captureSetup(cfg config.Config) (map[string]struct{}, string) {
+	if cfg.Iface == "" {
+		fmt.Fprintln(os.Stderr, "--iface is required")
+		os.Exit(2)
+	}
+
+	localIPs, err := capture.LocalIPsForInterface(cfg.Iface)
+	if err != nil {
+		log.Printf("warn: could not resolve local IPs for iface %q: %v", cfg.Iface, err)
+		localIPs = map[string]struct{}{}
 	}
 
-	// Fast path: check if full batch fits.
-	payload := backend.ConnectionsPayload{Connections: batch}
-	b, err := json.Marshal(payload)
-	if err == nil && len(b) <= maxBytes {
-		return batch, keys
+	bpf, err := effectiveBPF(cfg, localIPs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	return localIPs, bpf
+}
 
-	// Reduce until it fits.
-	lo := 0
-	hi := len(batch)
-	best := 0
+// effectiveBPF is --bpf, or by default a filter focused on outbound/inbound
+// traffic using the local IPv4s if available, built on the --bpf-* lists.
+func effectiveBPF(cfg config.Config, localIPs map[string]struct{}) (string, error) {
+	if cfg.BPF != "" {
+		return cfg.BPF, nil
+	}
+	base, err := capture.Filter{
+		Protocols:    cfg.BPFProtocols,
+		IncludeNets:  cfg.BPFIncludeNets,
+		ExcludeNets:  cfg.BPFExcludeNets,
+		IncludePorts: cfg.BPFIncludePorts,
+		ExcludePorts: cfg.BPFExcludePorts,
+	}.Expr()
+	if err != nil {
+		return "", fmt.Errorf("capture filter: %w", err)
+	}
+	return capture.BuildDefaultBPF(base, cfg.Direction, localIPs), nil
+}
 
-	for lo <= hi {
-		mid := (lo + hi) / 2
-		payload := backend.ConnectionsPayload{Connections: batch[:mid]}
-		bb, e := json.Marshal(payload)
-		if e != nil {
-			// fall back to linear reduction
-			break
+// newAnonymizer builds the endpoint anonymisation from the config, loading
+// or creating its secret when a keyed mode is selected. It returns nil when
+// addresses are exported as captured.
+func newAnonymizer(cfg config.Config) (*anon.Anonymizer, error) {
+	local, err := anon.ParseMode(cfg.AnonLocal)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := anon.ParseMode(cfg.AnonRemote)
+	if err != nil {
+		return nil, err
+	}
+	ac := anon.Config{Local: local, Remote: remote, IPv4Prefix: cfg.AnonIPv4Prefix, IPv6Prefix: cfg.AnonIPv6Prefix}
+	if local.Keyed() || remote.Keyed() {
+		path := cfg.AnonSecretFile
+		if path == "" {
+			path = filepath.Join(cfg.StateDir, "anon.key")
+		}
+		// A secret that changes also changes every anonymised address
+		// and flow ID, so there is no per-process fallback.
+		if ac.Secret, err = state.LoadSecret(path, 32); err != nil {
+			return nil, err
 		}
-		if len(bb) <= maxBytes {
-			best = mid
-			lo = mid + 1
-		} else {
-			hi = mid - 1
+	}
+	return anon.New(ac)
+}
+
+// flowIDs returns the flow ID scheme selected by --flow-id-scheme.
+func flowIDs(cfg config.Config) util.FlowIDs {
+	if cfg.FlowIDScheme == "sha1" {
+		return util.LegacyIDs{HostID: cfg.HostID}
+	}
+	path := cfg.FlowIDSecretFile
+	if path == "" {
+		path = filepath.Join(cfg.StateDir, "flow-id.key")
+	}
+	secret, err := state.LoadSecret(path, 32)
+	if err != nil {
+		log.Printf("warn: flow IDs will change with the next restart: %v", err)
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("flow ID secret: %v", err)
 		}
 	}
+	ids := util.NewKeyedIDs(cfg.HostID, secret)
+	log.Printf("flow IDs keyed with %s", ids.KeyID())
+	return ids
+}
+
+// openSequence opens the persisted batch sequence, checking up front that it
+// can be written so a read-only state dir does not fail every post.
+func openSequence(dir string) (*state.Sequence, error) {
+	seq, err := state.OpenSequence(filepath.Join(dir, "sequence"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := seq.Next(); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+// loadIdentity loads the persistent agent identity, falling back to one
+// that lasts only as long as the process.
+func loadIdentity(dir string) *agent.Identity {
+	id, err := agent.LoadIdentity(filepath.Join(dir, "agent.json"))
+	if err == nil {
+		return id
+	}
+	log.Printf("warn: agent identity will not survive a restart: %v", err)
+	id, err = agent.NewIdentity()
+	if err != nil {
+		log.Fatalf("agent identity: %v", err)
+	}
+	return id
+}
+
+// capabilities lists the optional features this agent supports, reported
+// at registration.
+func capabilities(cfg config.Config) []string {
+	caps := []string{"compression:gzip", "compression:zstd", "wire:protobuf", "idempotency"}
+	if cfg.Transport == "stream" {
+		caps = append(caps, "transport:stream")
+	}
+	if cfg.APIListen != "" {
+		caps = append(caps, "local-api")
+	}
+	if cfg.OTLPEndpoint != "" {
+		caps = append(caps, "export:otlp")
+	}
+	return caps
+}
+
+// newBackendClient creates the backend client with the configured
+// encoding, wire format, retries, transport, credentials and sequence.
+func newBackendClient(cfg config.Config, retryPolicy backend.RetryPolicy) *backend.Client {
+	encoding, err := backend.ParseEncoding(cfg.Compression)
+	if err != nil {
+		log.Fatalf("backend client: %v", err)
+	}
+
+	wireFormat, err := backend.ParseWireFormat(cfg.WireFormat)
+	if err != nil {
+		log.Fatalf("backend client: %v", err)
+	}
 
-	if best > 0 {
-		return batch[:best], keys[:best]
+	opts := []backend.Option{
+		backend.WithCompression(encoding),
+		backend.WithWireFormat(wireFormat),
+		backend.WithRetryPolicy(retryPolicy),
+	}
+	transport, err := backendTransport(cfg)
+	if err != nil {
+		log.Fatalf("backend transport: %v", err)
+	}
+	opts = append(opts, backend.WithTransport(transport))
+	if creds, err := credentials(cfg, &http.Client{Timeout: cfg.HTTPTimeout, Transport: transport}); err != nil {
+		log.Fatalf("backend credentials: %v", err)
+	} else if creds != nil {
+		opts = append(opts, backend.WithCredentials(creds))
+	}
+	if seq, err := openSequence(cfg.StateDir); err != nil {
+		log.Printf("warn: batch sequence will restart with the process: %v", err)
+	} else {
+		opts = append(opts, backend.WithSequence(seq))
+	}
+
+	bc, err := backend.NewClient(cfg.BackendURL, cfg.HTTPTimeout, cfg.AuthToken, opts...)
+	if err != nil {
+		log.Fatalf("backend client: %v", err)
 	}
+	return bc
+}
+
+// backendTransport builds the TLS and proxy settings for backend requests.
+func backendTransport(cfg config.Config) (*http.Transport, error) {
+	return backend.NewTransport(backend.TransportConfig{
+		CAFile:              cfg.CAFile,
+		CertFile:            cfg.ClientCert,
+		KeyFile:             cfg.ClientKey,
+		MinVersion:          cfg.TLSMinVersion,
+		ServerName:          cfg.TLSServerName,
+		PinnedSPKI:          cfg.PinnedSPKI,
+		Proxy:               cfg.Proxy,
+		NoProxy:             cfg.NoProxy,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TCPKeepAlive:        cfg.TCPKeepAlive,
+		DisableKeepAlives:   cfg.DisableKeepAlives,
+	})
+}
 
-	// Last resort: try single item
-	if len(batch) > 0 {
-		payload := backend.ConnectionsPayload{Connections: batch[:1]}
-		bb, e := json.Marshal(payload)
-		if e == nil && len(bb) <= maxBytes {
-			return batch[:1], keys[:1]
+// credentials picks the token source from the config: an enrolment
+// credential (refreshing client tokens), then a token file. It returns nil
+// to keep the static --auth-token.
+func credentials(cfg config.Config, hc *http.Client) (backend.Credentials, error) {
+	var enrolment backend.Credentials
+	switch {
+	case cfg.EnrolmentTokenFile != "":
+		f, err := backend.NewFileCredentials(cfg.EnrolmentTokenFile)
+		if err != nil {
+			return nil, err
 		}
+		enrolment = f
+	case cfg.EnrolmentToken != "":
+		enrolment = backend.StaticCredentials(strings.TrimSpace(cfg.EnrolmentToken))
+	}
+	if enrolment != nil {
+		return backend.NewRefreshingCredentials(cfg.BackendURL, hc, enrolment, cfg.TenantID)
 	}
 
-	// Cannot fit even one item; drop and surface via error elsewhere.
-	_ = errors.New("payload too large")
+	if cfg.AuthTokenFile != "" {
+		return backend.NewFileCredentials(cfg.AuthTokenFile)
+	}
 	return nil, nil
 }
+
+func toBackendSnapshot(s metrics.Snapshot) backend.MetricsSnapshot {
+	out := backend.MetricsSnapshot{
+		Timestamp:    s.Timestamp.UTC().Format(time.RFC3339Nano),
+		Connections:  s.Connections,
+		BandwidthIn:  s.BandwidthIn,
+		BandwidthOut: s.BandwidthOut,
+		Inactive:     s.Inactive,
+		EndTime:      s.EndTime.UTC().Format(time.RFC3339Nano),
+		PacketsIn:    s.PacketsIn,
+		PacketsOut:   s.PacketsOut,
+		RateIn:       s.RateIn,
+		RateOut:      s.RateOut,
+		PeakRateIn:   s.PeakRateIn,
+		PeakRateOut:  s.PeakRateOut,
+
+		ThroughputIn:     rateSummary(s.ThroughputIn),
+		ThroughputOut:    rateSummary(s.ThroughputOut),
+		NewConnections:   s.NewConnections,
+		NewConnsPerSec:   rateSummary(s.NewConnsPerSec),
+		PacketSizeBounds: metrics.PacketSizeBounds,
+		PacketSizes:      s.PacketSizes,
+		OversizeRecords:  s.OversizeRecords,
+		SamplingRate:     s.SamplingRate,
+	}
+	if s.Capture != nil {
+		c := backend.CaptureStats(*s.Capture)
+		out.Capture = &c
+	}
+	if len(s.Protocols) > 0 {
+		out.Protocols = make(map[string]backend.MetricsProtocolTotals, len(s.Protocols))
+		for proto, ps := range s.Protocols {
+			out.Protocols[proto] = backend.MetricsProtocolTotals(ps)
+		}
+	}
+	return out
+}
+
+// recordCaptureStats logs the capture's health since prev and adds it to
+// the metrics period. It returns cur for the next call.
+func recordCaptureStats(collector *metrics.Collector, cur, prev capture.Stats) capture.Stats {
+	d := cur.Sub(prev)
+	peak := float64(d.PeakQueued) / float64(max(d.Capacity, 1))
+	collector.RecordCapture(metrics.CaptureStats{
+		Policy:       d.Policy,
+		Received:     int64(d.Received),
+		ChannelDrops: int64(d.ChannelDrops),
+		KernelDrops:  int64(d.KernelDrops),
+		IfDrops:      int64(d.IfDrops),
+		QueuePeak:    peak,
+	})
+
+	kernel := "kernel drops unavailable"
+	if d.KernelStats {
+		kernel = fmt.Sprintf("%d kernel drops, %d interface drops", d.KernelDrops, d.IfDrops)
+	}
+	msg := fmt.Sprintf("capture: %d packets, %d dropped on a full queue (%s), %s, queue peak %.0f%% of %d",
+		d.Received, d.ChannelDrops, d.Policy, kernel, peak*100, d.Capacity)
+	if d.ChannelDrops > 0 || d.KernelDrops > 0 || d.IfDrops > 0 {
+		msg = "warn: " + msg + "; metrics for this period are incomplete"
+	}
+	log.Print(msg)
+	return cur
+}
+
+func rateSummary(r metrics.RateStats) *backend.RateSummary {
+	out := backend.RateSummary(r)
+	return &out
+}
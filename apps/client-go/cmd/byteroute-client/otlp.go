@@ -0,0 +1,105 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/byteroute/client-go/internal/agent"
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/metrics"
+	"github.com/byteroute/client-go/internal/otlp"
+)
+
+// otlpQueue is the number of flow batches waiting for the collector before
+// new ones are dropped.
+const otlpQueue = 16
+
+// otlpSink publishes to an OpenTelemetry collector, next to the backend or
+// instead of it. Flow batches are queued so a slow collector does not hold
+// up the flush loop.
+type otlpSink struct {
+	exp   *otlp.Exporter
+	flows chan []backend.Connection
+}
+
+// newOTLPSink returns nil when --otlp-endpoint is not set.
+func newOTLPSink(cfg config.Config, identity *agent.Identity) (*otlpSink, error) {
+	if cfg.OTLPEndpoint == "" {
+		return nil, nil
+	}
+	protocol, err := otlp.ParseProtocol(cfg.OTLPProtocol)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := otlp.ParseHeaders(cfg.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	opts := []otlp.Option{
+		otlp.WithHeaders(headers),
+		otlp.WithInterface(cfg.Iface),
+		otlp.WithResource(otlp.Resource{ServiceVersion: version, HostName: hostname, InstanceID: identity.ID}),
+	}
+	if cfg.OTLPCompression == "gzip" {
+		opts = append(opts, otlp.WithGzip())
+	}
+	exp, err := otlp.New(cfg.OTLPEndpoint, protocol, cfg.HTTPTimeout, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpSink{exp: exp, flows: make(chan []backend.Connection, otlpQueue)}, nil
+}
+
+// run exports queued flow batches until ctx is done.
+func (s *otlpSink) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case conns := <-s.flows:
+			if err := s.exp.ExportFlows(ctx, conns); err != nil {
+				log.Printf("otlp flow export failed, dropped %d records: %v", len(conns), err)
+			}
+		}
+	}
+}
+
+// exportFlows queues a batch. The slice is copied because the caller may
+// reuse it.
+func (s *otlpSink) exportFlows(conns []backend.Connection) {
+	select {
+	case s.flows <- slices.Clone(conns):
+	default:
+		log.Printf("otlp collector is falling behind, dropped %d flow records", len(conns))
+	}
+}
+
+// exportMetrics publishes a snapshot in the background.
+func (s *otlpSink) exportMetrics(ctx context.Context, snapshot metrics.Snapshot) {
+	go func() {
+		if err := s.exp.ExportMetrics(ctx, snapshot); err != nil {
+			log.Printf("otlp metrics export failed: %v", err)
+		}
+	}()
+}
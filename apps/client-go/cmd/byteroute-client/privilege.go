@@ -0,0 +1,90 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/privilege"
+)
+
+// privilegeOptions resolves --user, --group and --keep-caps before capture
+// starts, so a typo fails while the agent still runs with full privileges.
+func privilegeOptions(cfg config.Config) (privilege.Options, error) {
+	keep, err := privilege.ParseCaps(cfg.KeepCaps)
+	if err != nil {
+		return privilege.Options{}, fmt.Errorf("--keep-caps: %w", err)
+	}
+	uid, gid, err := privilege.LookupUser(cfg.User, cfg.Group)
+	if err != nil {
+		return privilege.Options{}, err
+	}
+	opts := privilege.Options{UID: uid, GID: gid, Keep: keep, Seccomp: cfg.Seccomp}
+	return opts, privilege.Check(opts)
+}
+
+// dropPrivileges applies opts once the capture handle is open. A state
+// directory is handed to the new user first, since state files are
+// replaced rather than rewritten in place.
+func dropPrivileges(stateDir string, opts privilege.Options) error {
+	if stateDir != "" && (opts.UID >= 0 || opts.GID >= 0) && os.Geteuid() == 0 {
+		if err := chownDir(stateDir, opts.UID, opts.GID); err != nil {
+			return fmt.Errorf("state dir: %w", err)
+		}
+	}
+	if err := privilege.Drop(opts); err != nil {
+		return err
+	}
+
+	st, err := privilege.Current()
+	if err != nil {
+		// Nothing to report outside linux.
+		return nil
+	}
+	log.Printf("privileges: %s", st)
+	// Started with file capabilities, cgo builds can only drop them on one
+	// thread.
+	if extra := (st.Effective | st.Permitted) &^ opts.Keep; extra != 0 {
+		log.Printf("warn: some threads still hold %s; start as root with --user to drop them everywhere", extra)
+	}
+	return nil
+}
+
+// chownDir changes the owner of dir and the files directly in it.
+func chownDir(dir string, uid, gid int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Lchown(filepath.Join(dir, e.Name()), uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/flow"
+)
+
+// liveConfig holds what a configuration change has to reach in the running
+// agent.
+type liveConfig struct {
+	handle   *pcap.Handle
+	localIPs map[string]struct{}
+	agg      *flow.Aggregator
+	bc       *backend.Client
+	flush    *time.Ticker
+	metrics  *time.Ticker
+}
+
+// apply switches the running agent from cur to next. Batch limits need
+// nothing here; the flush loop reads them from the config each time.
+// Everything is parsed before anything changes, and the BPF filter goes
+// first, since it is the only change the system can refuse; a rejected
+// document thus leaves the running configuration untouched.
+func (l *liveConfig) apply(cur, next config.Config) error {
+	bpf, err := effectiveBPF(next, l.localIPs)
+	if err != nil {
+		return err
+	}
+	enc, err := backend.ParseEncoding(next.Compression)
+	if err != nil {
+		return err
+	}
+	f, err := backend.ParseWireFormat(next.WireFormat)
+	if err != nil {
+		return err
+	}
+
+	if prev, _ := effectiveBPF(cur, l.localIPs); bpf != prev {
+		if err := l.handle.SetBPFFilter(bpf); err != nil {
+			return fmt.Errorf("set bpf %q: %w", bpf, err)
+		}
+		log.Printf("capture filter changed: %q", bpf)
+	}
+	if next.DedupMode != cur.DedupMode || next.IdleTTL != cur.IdleTTL {
+		l.agg.Reconfigure(next.DedupMode, next.IdleTTL)
+	}
+	if next.FlushInterval != cur.FlushInterval {
+		l.flush.Reset(next.FlushInterval)
+	}
+	if next.MetricsInterval != cur.MetricsInterval {
+		l.metrics.Reset(next.MetricsInterval)
+	}
+	if next.Compression != cur.Compression {
+		l.bc.SetCompression(enc)
+	}
+	if next.WireFormat != cur.WireFormat {
+		l.bc.SetWireFormat(f)
+	}
+	return nil
+}
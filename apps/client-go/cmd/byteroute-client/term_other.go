@@ -0,0 +1,32 @@
+//go:build !linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "errors"
+
+var errNoTerminal = errors.New("terminal control is only supported on linux")
+
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errNoTerminal
+}
+
+func termSize(fd int) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,128 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/byteroute/client-go/internal/capture"
+	"github.com/byteroute/client-go/internal/config"
+	"github.com/byteroute/client-go/internal/flow"
+	"github.com/byteroute/client-go/internal/rdns"
+	"github.com/byteroute/client-go/internal/top"
+)
+
+const topRefresh = time.Second
+
+// runTop captures locally and renders a live table of flows. It never talks
+// to the backend, so it works on hosts without one configured.
+func runTop(cfg config.Config) {
+	localIPs, bpf := captureSetup(cfg)
+	agg := flow.New(cfg.HostID, cfg.DedupMode, cfg.IdleTTL, localIPs)
+	privs, err := privilegeOptions(cfg)
+	if err != nil {
+		log.Fatalf("privileges: %v", err)
+	}
+
+	sampler := capture.NewSampler(cfg.SamplePackets, cfg.SampleFlows, cfg.SamplePacketsMax)
+	handle, packets, err := capture.Start(cfg.Iface, bpf, cfg.SnapLen, cfg.Promisc,
+		capture.WithSampler(sampler),
+		capture.WithOverflow(cfg.CaptureOverflow),
+		capture.WithQueueSize(cfg.CaptureQueue))
+	if err != nil {
+		log.Fatalf("capture start: %v", err)
+	}
+	defer handle.Close()
+	if err := dropPrivileges("", privs); err != nil {
+		log.Fatalf("drop privileges: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	go func() {
+		for ev := range packets {
+			agg.UpdateSampled(ev.Timestamp, ev.SrcIP, ev.DstIP, ev.SrcPort, ev.DstPort, ev.Protocol, ev.Length, ev.SampleRate)
+		}
+		cancel()
+	}()
+
+	keys := make(chan byte)
+	if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+		defer restore()
+		go func() {
+			r := bufio.NewReader(os.Stdin)
+			for {
+				b, err := r.ReadByte()
+				if err != nil {
+					return
+				}
+				keys <- b
+			}
+		}()
+	}
+
+	// Hide the cursor while drawing; restore it and clear the frame on exit.
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[H\x1b[2J")
+
+	resolver := rdns.New()
+	view := top.New()
+	title := fmt.Sprintf("byteroute-client top  iface=%s  dedupe=%s  bpf=%q", cfg.Iface, cfg.DedupMode, bpf)
+
+	render := func() {
+		width, height, err := termSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		view.Render(os.Stdout, title, width, height)
+	}
+	refresh := func(now time.Time) {
+		agg.Prune(now)
+		view.Update(now, agg.Flows(), func(ip string) string {
+			name, _ := resolver.Lookup(ip)
+			return name
+		})
+		render()
+	}
+
+	refresh(time.Now())
+	ticker := time.NewTicker(topRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			refresh(t)
+		case k := <-keys:
+			if view.HandleKey(k) {
+				return
+			}
+			render()
+		}
+	}
+}
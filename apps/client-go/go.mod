@@ -2,6 +2,10 @@ module github.com/byteroute/client-go
 
 go 1.26.5
 
-require github.com/google/gopacket v1.1.19
+require (
+	github.com/google/gopacket v1.1.19
+	github.com/klauspost/compress v1.18.0
+	google.golang.org/protobuf v1.36.12
+)
 
 require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
@@ -0,0 +1,217 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+)
+
+// defaultHeartbeat is used when the backend does not suggest an interval.
+const defaultHeartbeat = 30 * time.Second
+
+// Registration collects the host details sent when registering.
+func Registration(id *Identity, version string, capabilities []string) backend.AgentRegistration {
+	hostname, _ := os.Hostname()
+	return backend.AgentRegistration{
+		AgentID:      id.ID,
+		PublicKey:    id.PublicKey(),
+		Hostname:     hostname,
+		OS:           runtime.GOOS + "/" + runtime.GOARCH,
+		Kernel:       kernelRelease(),
+		Version:      version,
+		Interfaces:   interfaces(),
+		Capabilities: capabilities,
+	}
+}
+
+func kernelRelease() string {
+	b, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// interfaces lists the host's non-loopback interfaces and their addresses.
+func interfaces() []backend.AgentInterface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []backend.AgentInterface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ai := backend.AgentInterface{Name: iface.Name, MAC: iface.HardwareAddr.String()}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, a := range addrs {
+				ai.Addrs = append(ai.Addrs, a.String())
+			}
+		}
+		out = append(out, ai)
+	}
+	return out
+}
+
+// Runner keeps the agent registered and sends heartbeats.
+type Runner struct {
+	Client   *backend.Client
+	Identity *Identity
+	// Info is sent on every registration; its Timestamp is filled in.
+	Info  backend.AgentRegistration
+	Retry backend.RetryPolicy
+	// OnRegistered, if set, is called after each successful registration.
+	OnRegistered func(backend.AgentBinding)
+
+	started time.Time
+
+	mu            sync.Mutex
+	configVersion string
+	configError   string
+
+	// every overrides the backend's heartbeat interval in tests.
+	every time.Duration
+}
+
+// SetConfigStatus records the remote configuration version in effect and,
+// if the latest document was rejected, why. Both are sent with heartbeats.
+func (r *Runner) SetConfigStatus(version, errMsg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configVersion, r.configError = version, errMsg
+}
+
+// Run registers and then heartbeats until ctx is done. A backend without
+// agent endpoints (404 on register) stops it after one log line.
+func (r *Runner) Run(ctx context.Context) {
+	r.started = time.Now()
+	for ctx.Err() == nil {
+		binding, ok := r.register(ctx)
+		if !ok {
+			return
+		}
+		r.heartbeat(ctx, r.interval(binding))
+	}
+}
+
+// register retries until the agent is registered. It reports false when ctx
+// is done or the backend has no agent endpoints.
+func (r *Runner) register(ctx context.Context) (*backend.AgentBinding, bool) {
+	for failures := 0; ; failures++ {
+		info := r.Info
+		info.Timestamp = timestamp()
+		binding, err := r.Client.RegisterAgent(ctx, info, r.Identity.Sign(info.Timestamp))
+		if err == nil {
+			log.Printf("agent %s registered for tenant %s", binding.AgentID, binding.TenantID)
+			if r.OnRegistered != nil {
+				r.OnRegistered(*binding)
+			}
+			return binding, true
+		}
+		if isNotFound(err) {
+			log.Printf("backend has no agent registration endpoint; running unregistered")
+			return nil, false
+		}
+
+		delay := r.Retry.Backoff(failures, backend.RetryAfter(err))
+		log.Printf("agent registration failed (%s, retrying in %s): %v", backend.Kind(err), delay.Round(time.Millisecond), err)
+		if !sleep(ctx, delay) {
+			return nil, false
+		}
+	}
+}
+
+// heartbeat sends heartbeats every interval until ctx is done or the backend
+// no longer knows the agent.
+func (r *Runner) heartbeat(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		hb := backend.AgentHeartbeat{
+			Timestamp:     timestamp(),
+			UptimeSeconds: int64(time.Since(r.started) / time.Second),
+			ConfigVersion: r.configVersion,
+			ConfigError:   r.configError,
+		}
+		r.mu.Unlock()
+		binding, err := r.Client.AgentHeartbeat(ctx, r.Identity.ID, hb, r.Identity.Sign(hb.Timestamp))
+		if isNotFound(err) {
+			log.Printf("backend does not know agent %s; registering again", r.Identity.ID)
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("agent heartbeat failed: %v", err)
+			}
+			continue
+		}
+		if next := r.interval(binding); next != every {
+			every = next
+			ticker.Reset(every)
+		}
+	}
+}
+
+func (r *Runner) interval(b *backend.AgentBinding) time.Duration {
+	if r.every > 0 {
+		return r.every
+	}
+	if b == nil || b.HeartbeatIntervalSeconds <= 0 {
+		return defaultHeartbeat
+	}
+	return time.Duration(b.HeartbeatIntervalSeconds) * time.Second
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func isNotFound(err error) bool {
+	var re *backend.RequestError
+	return errors.As(err, &re) && re.StatusCode == http.StatusNotFound
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
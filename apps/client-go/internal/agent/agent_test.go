@@ -0,0 +1,224 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/config"
+)
+
+// agentServer records registrations and heartbeats, verifying signatures
+// like the backend does.
+type agentServer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	known         map[string]string // agentId -> public key
+	registrations int
+	heartbeats    int
+}
+
+func newAgentServer(t *testing.T) *agentServer {
+	t.Helper()
+	s := &agentServer{known: map[string]string{}}
+	verify := func(pubKey, agentID, ts, sig string) bool {
+		pub, _ := base64.StdEncoding.DecodeString(pubKey)
+		raw, _ := base64.StdEncoding.DecodeString(sig)
+		return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, signatureMessage(agentID, ts), raw)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.URL.Path == "/api/agents/register":
+			var reg backend.AgentRegistration
+			_ = json.NewDecoder(r.Body).Decode(&reg)
+			if !verify(reg.PublicKey, reg.AgentID, reg.Timestamp, r.Header.Get("X-Agent-Signature")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			s.known[reg.AgentID] = reg.PublicKey
+			s.registrations++
+			_ = json.NewEncoder(w).Encode(backend.AgentBinding{AgentID: reg.AgentID, TenantID: "tenant-a", HeartbeatIntervalSeconds: 30})
+		case strings.HasSuffix(r.URL.Path, "/heartbeat"):
+			agentID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/agents/"), "/heartbeat")
+			var hb backend.AgentHeartbeat
+			_ = json.NewDecoder(r.Body).Decode(&hb)
+			pub, ok := s.known[agentID]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if !verify(pub, agentID, hb.Timestamp, r.Header.Get("X-Agent-Signature")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			s.heartbeats++
+			_ = json.NewEncoder(w).Encode(backend.AgentBinding{AgentID: agentID, TenantID: "tenant-a", HeartbeatIntervalSeconds: 30})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *agentServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registrations, s.heartbeats
+}
+
+func (s *agentServer) forget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.known)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunner_RegistersHeartbeatsAndReregisters(t *testing.T) {
+	srv := newAgentServer(t)
+	bc, err := backend.NewClient(srv.URL, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bound sync.WaitGroup
+	bound.Add(1)
+	var once sync.Once
+	r := &Runner{
+		Client:       bc,
+		Identity:     id,
+		Info:         Registration(id, "test", []string{"wire:protobuf"}),
+		Retry:        backend.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		OnRegistered: func(b backend.AgentBinding) { once.Do(bound.Done) },
+		every:        10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	bound.Wait()
+	waitFor(t, func() bool { _, hb := srv.counts(); return hb >= 2 })
+
+	// The backend lost the agent: the next heartbeat gets 404 and the
+	// runner registers again.
+	srv.forget()
+	waitFor(t, func() bool { reg, _ := srv.counts(); return reg >= 2 })
+}
+
+func TestRunner_StopsWithoutAgentEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	bc, err := backend.NewClient(srv.URL, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		(&Runner{Client: bc, Identity: id, Info: Registration(id, "test", nil)}).Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner kept retrying against a backend without agent endpoints")
+	}
+}
+
+func TestConfigWatcher_UsesETag(t *testing.T) {
+	var mu sync.Mutex
+	doc := `{"version":"v1","settings":{"flush":"10s"}}`
+	etag := `"v1"`
+	var polls, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		polls++
+		if r.URL.Path != "/api/agents/agent-1/config" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+	bc, err := backend.NewClient(srv.URL, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := make(chan config.Remote)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go (&ConfigWatcher{Client: bc, AgentID: "agent-1", Interval: 10 * time.Millisecond}).Run(ctx, updates)
+
+	first := <-updates
+	if first.Version != "v1" || string(first.Settings["flush"]) != `"10s"` {
+		t.Fatalf("unexpected document %+v", first)
+	}
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return notModified >= 2 })
+
+	mu.Lock()
+	doc, etag = `{"version":"v2","settings":{}}`, `"v2"`
+	mu.Unlock()
+	if second := <-updates; second.Version != "v2" {
+		t.Fatalf("expected v2 after change, got %q", second.Version)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package agent gives the client a persistent identity and keeps it
+// registered with the backend.
+package agent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/byteroute/client-go/internal/state"
+)
+
+// Identity is the agent's ID and signing key, created on first start.
+type Identity struct {
+	ID  string
+	key ed25519.PrivateKey
+}
+
+type identityFile struct {
+	AgentID string `json:"agentId"`
+	// PrivateKey is the Ed25519 seed, base64.
+	PrivateKey string `json:"privateKey"`
+}
+
+// NewIdentity generates a random ID and keypair.
+func NewIdentity() (*Identity, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{ID: newUUID(), key: key}, nil
+}
+
+// LoadIdentity reads the identity stored at path, creating and saving a new
+// one if the file does not exist.
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		id, err := NewIdentity()
+		if err != nil {
+			return nil, err
+		}
+		return id, id.save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f identityFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(f.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize || f.AgentID == "" {
+		return nil, fmt.Errorf("parse %s: invalid identity", path)
+	}
+	return &Identity{ID: f.AgentID, key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func (id *Identity) save(path string) error {
+	data, err := json.MarshalIndent(identityFile{
+		AgentID:    id.ID,
+		PrivateKey: base64.StdEncoding.EncodeToString(id.key.Seed()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// PublicKey returns the raw Ed25519 public key, base64.
+func (id *Identity) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(id.key.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the X-Agent-Signature value for a request carrying timestamp.
+func (id *Identity) Sign(timestamp string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(id.key, signatureMessage(id.ID, timestamp)))
+}
+
+func signatureMessage(agentID, timestamp string) []byte {
+	return []byte("byteroute-agent-v1\n" + agentID + "\n" + timestamp)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
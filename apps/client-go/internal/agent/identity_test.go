@@ -0,0 +1,76 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestLoadIdentity_CreatesAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "agent.json")
+	first, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(first.ID) {
+		t.Fatalf("expected a v4 UUID, got %q", first.ID)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected identity file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	second, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || second.PublicKey() != first.PublicKey() {
+		t.Fatal("expected the same identity after reload")
+	}
+}
+
+func TestLoadIdentity_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, []byte(`{"agentId":"x","privateKey":"short"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIdentity(path); err == nil {
+		t.Fatal("expected error for corrupt identity")
+	}
+}
+
+func TestIdentity_Sign(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := base64.StdEncoding.DecodeString(id.PublicKey())
+	sig, _ := base64.StdEncoding.DecodeString(id.Sign("2026-10-18T10:00:00Z"))
+	msg := []byte("byteroute-agent-v1\n" + id.ID + "\n2026-10-18T10:00:00Z")
+	if !ed25519.Verify(pub, msg, sig) {
+		t.Fatal("signature does not verify")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/config"
+)
+
+// ConfigWatcher polls the backend for the agent's configuration document,
+// using its ETag so unchanged documents cost a 304.
+type ConfigWatcher struct {
+	Client   *backend.Client
+	AgentID  string
+	Interval time.Duration
+
+	etag string
+}
+
+// Run polls immediately and then every Interval until ctx is done, sending
+// each changed document on updates.
+func (w *ConfigWatcher) Run(ctx context.Context, updates chan<- config.Remote) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		if doc, ok := w.poll(ctx); ok {
+			select {
+			case updates <- doc:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the document once and reports whether it changed.
+func (w *ConfigWatcher) poll(ctx context.Context) (config.Remote, bool) {
+	data, etag, err := w.Client.AgentConfig(ctx, w.AgentID, w.etag)
+	if err != nil {
+		// 404 until the agent is registered, or from a backend without
+		// remote configuration; neither is worth a log line per poll.
+		if !isNotFound(err) && ctx.Err() == nil {
+			log.Printf("remote config poll failed: %v", err)
+		}
+		return config.Remote{}, false
+	}
+	if data == nil {
+		return config.Remote{}, false
+	}
+
+	var doc config.Remote
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Printf("remote config: invalid document: %v", err)
+		return config.Remote{}, false
+	}
+	w.etag = etag
+	return doc, true
+}
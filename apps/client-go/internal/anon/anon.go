@@ -0,0 +1,197 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package anon anonymises flow endpoint addresses before they leave the
+// agent.
+package anon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Mode is how an address is anonymised.
+type Mode string
+
+const (
+	// ModeNone keeps the address.
+	ModeNone Mode = "none"
+	// ModeCryptoPAn maps the address with prefix-preserving Crypto-PAn.
+	ModeCryptoPAn Mode = "cryptopan"
+	// ModeTruncate zeroes the host bits beyond the configured prefix.
+	ModeTruncate Mode = "truncate"
+	// ModeHash replaces the address with a keyed hash of it, shaped as an
+	// address of the same family.
+	ModeHash Mode = "hash"
+	// ModeDrop replaces the address with the unspecified address.
+	ModeDrop Mode = "drop"
+)
+
+// ParseMode accepts the Mode names; "" is ModeNone.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeNone, nil
+	case ModeNone, ModeCryptoPAn, ModeTruncate, ModeHash, ModeDrop:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown anonymisation mode %q (expected none, cryptopan, truncate, hash or drop)", s)
+}
+
+// Keyed reports whether the mode needs a secret.
+func (m Mode) Keyed() bool {
+	return m == ModeCryptoPAn || m == ModeHash
+}
+
+// Config selects the anonymisation of local and remote endpoints.
+type Config struct {
+	Local  Mode
+	Remote Mode
+	// Secret keys Crypto-PAn and hashing; any length.
+	Secret []byte
+	// Prefix lengths kept by ModeTruncate.
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+// cacheSize bounds the number of remembered mappings. Crypto-PAn costs one
+// AES block per address bit, so addresses are mapped once, not per packet.
+const cacheSize = 1 << 16
+
+// Anonymizer maps endpoint addresses. It is safe for concurrent use.
+type Anonymizer struct {
+	local, remote Mode
+	cryptoPAn     *CryptoPAn
+	hashKey       []byte
+	v4Mask        net.IPMask
+	v6Mask        net.IPMask
+
+	mu    sync.Mutex
+	cache map[cacheKey]string
+}
+
+type cacheKey struct {
+	ip    string
+	local bool
+}
+
+// New creates an Anonymizer. It returns nil if both modes are ModeNone.
+func New(cfg Config) (*Anonymizer, error) {
+	if cfg.Local == "" {
+		cfg.Local = ModeNone
+	}
+	if cfg.Remote == "" {
+		cfg.Remote = ModeNone
+	}
+	if cfg.Local == ModeNone && cfg.Remote == ModeNone {
+		return nil, nil
+	}
+	if (cfg.Local.Keyed() || cfg.Remote.Keyed()) && len(cfg.Secret) == 0 {
+		return nil, fmt.Errorf("anonymisation mode %s/%s needs a secret", cfg.Local, cfg.Remote)
+	}
+	if cfg.IPv4Prefix < 0 || cfg.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid IPv4 prefix /%d", cfg.IPv4Prefix)
+	}
+	if cfg.IPv6Prefix < 0 || cfg.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix /%d", cfg.IPv6Prefix)
+	}
+
+	a := &Anonymizer{
+		local:   cfg.Local,
+		remote:  cfg.Remote,
+		hashKey: derive(cfg.Secret, "byteroute/anon/hash"),
+		v4Mask:  net.CIDRMask(cfg.IPv4Prefix, 32),
+		v6Mask:  net.CIDRMask(cfg.IPv6Prefix, 128),
+		cache:   make(map[cacheKey]string),
+	}
+	if cfg.Local == ModeCryptoPAn || cfg.Remote == ModeCryptoPAn {
+		cp, err := NewCryptoPAn(derive(cfg.Secret, "byteroute/anon/cryptopan"))
+		if err != nil {
+			return nil, err
+		}
+		a.cryptoPAn = cp
+	}
+	return a, nil
+}
+
+// derive returns an independent 32-byte key per purpose, so the same
+// secret can serve both keyed modes.
+func derive(secret []byte, purpose string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// Addr anonymises ip, a local or a remote endpoint. Values that are not
+// IP addresses are returned unchanged.
+func (a *Anonymizer) Addr(ip string, local bool) string {
+	mode := a.remote
+	if local {
+		mode = a.local
+	}
+	if mode == ModeNone {
+		return ip
+	}
+
+	k := cacheKey{ip: ip, local: local}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if out, ok := a.cache[k]; ok {
+		return out
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	out := a.apply(mode, parsed).String()
+	if len(a.cache) >= cacheSize {
+		clear(a.cache)
+	}
+	a.cache[k] = out
+	return out
+}
+
+func (a *Anonymizer) apply(mode Mode, ip net.IP) net.IP {
+	v4 := ip.To4()
+	switch mode {
+	case ModeCryptoPAn:
+		return a.cryptoPAn.Anonymize(ip)
+	case ModeTruncate:
+		if v4 != nil {
+			return v4.Mask(a.v4Mask)
+		}
+		return ip.Mask(a.v6Mask)
+	case ModeHash:
+		m := hmac.New(sha256.New, a.hashKey)
+		if v4 != nil {
+			m.Write(v4)
+			return net.IP(m.Sum(nil)[:net.IPv4len])
+		}
+		m.Write(ip)
+		return net.IP(m.Sum(nil)[:net.IPv6len])
+	case ModeDrop:
+		if v4 != nil {
+			return net.IPv4zero
+		}
+		return net.IPv6unspecified
+	}
+	return ip
+}
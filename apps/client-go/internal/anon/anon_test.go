@@ -0,0 +1,138 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anon
+
+import (
+	"net"
+	"testing"
+)
+
+// Sample key and mappings published with the reference Crypto-PAn
+// implementation.
+var referenceKey = []byte{
+	21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2,
+}
+
+func TestCryptoPAn_ReferenceVectors(t *testing.T) {
+	cp, err := NewCryptoPAn(referenceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"128.11.68.132":   "135.242.180.132",
+		"129.118.74.4":    "134.136.186.123",
+		"130.132.252.244": "133.68.164.234",
+		"141.223.7.43":    "141.167.8.160",
+		"141.233.145.108": "141.129.237.235",
+		"152.163.225.39":  "151.140.114.167",
+		"156.29.3.236":    "147.225.12.42",
+		"165.247.96.84":   "162.9.99.234",
+		"192.102.249.13":  "252.138.62.131",
+	} {
+		if got := cp.Anonymize(net.ParseIP(in)).String(); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
+
+// commonPrefix returns the number of leading bits a and b share.
+func commonPrefix(a, b net.IP) int {
+	n := 0
+	for i := range a {
+		x := a[i] ^ b[i]
+		for bit := 7; bit >= 0; bit-- {
+			if x&(1<<bit) != 0 {
+				return n
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func TestCryptoPAn_PreservesIPv6Prefixes(t *testing.T) {
+	cp, err := NewCryptoPAn(referenceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := net.ParseIP("2001:db8:1:2::10"), net.ParseIP("2001:db8:1:3::10")
+	ma, mb := cp.Anonymize(a), cp.Anonymize(b)
+	if ma.Equal(a) {
+		t.Fatal("expected the address to change")
+	}
+	if got, want := commonPrefix(ma, mb), commonPrefix(a, b); got != want {
+		t.Fatalf("expected %d shared prefix bits, got %d", want, got)
+	}
+}
+
+func TestAnonymizer_Modes(t *testing.T) {
+	secret := []byte("tenant secret")
+	tests := []struct {
+		mode  Mode
+		in    string
+		check func(out string) bool
+	}{
+		{ModeTruncate, "10.1.2.3", func(out string) bool { return out == "10.1.2.0" }},
+		{ModeTruncate, "2001:db8:1:2:3::4", func(out string) bool { return out == "2001:db8:1::" }},
+		{ModeDrop, "10.1.2.3", func(out string) bool { return out == "0.0.0.0" }},
+		{ModeDrop, "2001:db8::1", func(out string) bool { return out == "::" }},
+		{ModeHash, "10.1.2.3", func(out string) bool { return out != "10.1.2.3" && net.ParseIP(out).To4() != nil }},
+		{ModeHash, "2001:db8::1", func(out string) bool { return out != "2001:db8::1" && net.ParseIP(out).To4() == nil }},
+		{ModeCryptoPAn, "10.1.2.3", func(out string) bool { return out != "10.1.2.3" && net.ParseIP(out).To4() != nil }},
+	}
+	for _, tt := range tests {
+		a, err := New(Config{Local: tt.mode, Secret: secret, IPv4Prefix: 24, IPv6Prefix: 48})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := a.Addr(tt.in, true)
+		if !tt.check(out) {
+			t.Errorf("%s(%s): unexpected %s", tt.mode, tt.in, out)
+		}
+		if again := a.Addr(tt.in, true); again != out {
+			t.Errorf("%s(%s): expected a stable mapping, got %s then %s", tt.mode, tt.in, out, again)
+		}
+		if remote := a.Addr(tt.in, false); remote != tt.in {
+			t.Errorf("%s: expected remote endpoints untouched, got %s", tt.mode, remote)
+		}
+	}
+}
+
+func TestAnonymizer_SecretChangesMapping(t *testing.T) {
+	a, _ := New(Config{Remote: ModeHash, Secret: []byte("one")})
+	b, _ := New(Config{Remote: ModeHash, Secret: []byte("two")})
+	if a.Addr("192.0.2.7", false) == b.Addr("192.0.2.7", false) {
+		t.Fatal("expected different secrets to give different hashes")
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	if a, err := New(Config{}); a != nil || err != nil {
+		t.Fatalf("expected no anonymizer without modes, got %v, %v", a, err)
+	}
+	if _, err := New(Config{Remote: ModeCryptoPAn}); err == nil {
+		t.Fatal("expected error for cryptopan without a secret")
+	}
+	if _, err := New(Config{Local: ModeTruncate, IPv4Prefix: 33}); err == nil {
+		t.Fatal("expected error for an IPv4 prefix over 32")
+	}
+	if _, err := ParseMode("scramble"); err == nil {
+		t.Fatal("expected error for an unknown mode")
+	}
+}
@@ -0,0 +1,75 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"net"
+)
+
+// CryptoPAn is the prefix-preserving address anonymisation of Xu, Fan,
+// Ammar and Moon: two addresses sharing an n-bit prefix map to addresses
+// sharing an n-bit prefix, and the mapping cannot be reversed without the
+// key. IPv6 addresses use the same construction over 128 bits.
+type CryptoPAn struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+}
+
+// NewCryptoPAn creates the mapping for a 32-byte key: the first half is the
+// AES key, the second half is encrypted to form the padding.
+func NewCryptoPAn(key []byte) (*CryptoPAn, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("crypto-pan key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	c := &CryptoPAn{block: block}
+	block.Encrypt(c.pad[:], key[16:])
+	return c, nil
+}
+
+// Anonymize maps ip, which must be a 4- or 16-byte address.
+func (c *CryptoPAn) Anonymize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	bits := len(ip) * 8
+	out := make(net.IP, len(ip))
+	var in, enc [aes.BlockSize]byte
+	for pos := 0; pos < bits; pos++ {
+		// The block holds the first pos bits of the address followed by
+		// the padding; the first bit of its encryption flips bit pos.
+		in = c.pad
+		copy(in[:pos/8], ip[:pos/8])
+		if rem := pos % 8; rem != 0 {
+			mask := byte(0xff) << (8 - rem)
+			in[pos/8] = ip[pos/8]&mask | c.pad[pos/8]&^mask
+		}
+		c.block.Encrypt(enc[:], in[:])
+		out[pos/8] |= (enc[0] >> 7) << (7 - pos%8)
+	}
+	for i := range out {
+		out[i] ^= ip[i]
+	}
+	return out
+}
@@ -0,0 +1,333 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package api serves a local, read-only HTTP view of the live flow table and
+// the interface metrics history, for troubleshooting without the backend.
+package api
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/flow"
+	"github.com/byteroute/client-go/internal/metrics"
+	"github.com/byteroute/client-go/internal/rules"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// FlowsResponse is the body of GET /flows.
+type FlowsResponse struct {
+	Total  int                  `json:"total"`
+	Offset int                  `json:"offset"`
+	Limit  int                  `json:"limit"`
+	Flows  []backend.Connection `json:"flows"`
+}
+
+// SnapshotsResponse is the body of GET /metrics.
+type SnapshotsResponse struct {
+	Snapshots []metrics.Snapshot `json:"snapshots"`
+}
+
+// NewHandler returns the API routes:
+//
+//	GET /flows            current flows (filter, sort, paginate)
+//	GET /metrics          retained metrics snapshots
+//	GET /metrics/current  running period, not yet snapshotted
+//	GET /rules            export rule hit counters, when engine is non-nil
+func NewHandler(agg *flow.Aggregator, collector *metrics.Collector, engine *rules.Engine) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /flows", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseFlowQuery(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, q.apply(agg.Flows()))
+	})
+
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, SnapshotsResponse{Snapshots: collector.GetSnapshots()})
+	})
+
+	mux.HandleFunc("GET /metrics/current", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, collector.GetCurrentMetrics())
+	})
+
+	if engine != nil {
+		mux.HandleFunc("GET /rules", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, engine.Stats())
+		})
+	}
+
+	return mux
+}
+
+// RequireToken wraps h so that every request must carry token as a bearer
+// token.
+func RequireToken(h http.Handler, token string) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Listen opens addr for the API. "unix:/path/to.sock" listens on a Unix
+// socket (replacing a stale socket file); anything else is a TCP address.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return listenUnix(path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix only ever replaces a socket, since it runs before privileges
+// are dropped. Flow data is sensitive: the socket is bound in a private
+// directory and moved into place once it is owner-only.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".api-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ln, path: path}, nil
+}
+
+// unixListener removes the socket it was moved to on Close.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+type flowQuery struct {
+	ip       netip.Addr
+	prefix   netip.Prefix
+	port     int
+	protocol string
+	status   string
+	sortBy   string
+	asc      bool
+	limit    int
+	offset   int
+}
+
+func parseFlowQuery(r *http.Request) (flowQuery, error) {
+	v := r.URL.Query()
+	q := flowQuery{port: -1, sortBy: "bytes", limit: defaultLimit}
+
+	if s := v.Get("ip"); s != "" {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return q, fmt.Errorf("invalid ip %q", s)
+		}
+		q.ip = ip.Unmap()
+	}
+	if s := v.Get("cidr"); s != "" {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return q, fmt.Errorf("invalid cidr %q", s)
+		}
+		q.prefix = p.Masked()
+	}
+	if s := v.Get("port"); s != "" {
+		port, err := strconv.Atoi(s)
+		if err != nil || port < 0 || port > 65535 {
+			return q, fmt.Errorf("invalid port %q", s)
+		}
+		q.port = port
+	}
+	q.protocol = strings.ToUpper(v.Get("protocol"))
+
+	switch s := v.Get("status"); s {
+	case "", "active", "inactive":
+		q.status = s
+	default:
+		return q, fmt.Errorf("invalid status %q (expected active or inactive)", s)
+	}
+
+	switch s := v.Get("sort"); s {
+	case "":
+	case "bytes", "packets", "last":
+		q.sortBy = s
+	default:
+		return q, fmt.Errorf("invalid sort %q (expected bytes, packets or last)", s)
+	}
+
+	switch s := v.Get("order"); s {
+	case "", "desc":
+	case "asc":
+		q.asc = true
+	default:
+		return q, fmt.Errorf("invalid order %q (expected asc or desc)", s)
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", s)
+		}
+		q.limit = min(n, maxLimit)
+	}
+	if s := v.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid offset %q", s)
+		}
+		q.offset = n
+	}
+
+	return q, nil
+}
+
+func (q flowQuery) match(c backend.Connection) bool {
+	if q.ip.IsValid() && !sameIP(c.SourceIP, q.ip) && !sameIP(c.DestIP, q.ip) {
+		return false
+	}
+	if q.prefix.IsValid() && !inPrefix(c.SourceIP, q.prefix) && !inPrefix(c.DestIP, q.prefix) {
+		return false
+	}
+	if q.port >= 0 && c.SourcePort != q.port && c.DestPort != q.port {
+		return false
+	}
+	if q.protocol != "" && c.Protocol != q.protocol {
+		return false
+	}
+	if q.status != "" && c.Status != q.status {
+		return false
+	}
+	return true
+}
+
+func (q flowQuery) apply(flows []backend.Connection) FlowsResponse {
+	matched := flows[:0]
+	for _, c := range flows {
+		if q.match(c) {
+			matched = append(matched, c)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b backend.Connection) int {
+		var c int
+		switch q.sortBy {
+		case "packets":
+			c = cmp.Compare(total(a.PacketsIn, a.PacketsOut), total(b.PacketsIn, b.PacketsOut))
+		case "last":
+			// RFC3339Nano drops trailing zeros, so compare parsed times.
+			c = parseTime(a.LastActivity).Compare(parseTime(b.LastActivity))
+		default:
+			c = cmp.Compare(total(a.BytesIn, a.BytesOut), total(b.BytesIn, b.BytesOut))
+		}
+		if !q.asc {
+			c = -c
+		}
+		if c == 0 {
+			// Stable pagination across requests.
+			return strings.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+
+	resp := FlowsResponse{Total: len(matched), Offset: q.offset, Limit: q.limit, Flows: []backend.Connection{}}
+	if q.offset < len(matched) {
+		end := min(q.offset+q.limit, len(matched))
+		resp.Flows = matched[q.offset:end]
+	}
+	return resp
+}
+
+func sameIP(s string, ip netip.Addr) bool {
+	a, err := netip.ParseAddr(s)
+	return err == nil && a.Unmap() == ip
+}
+
+func inPrefix(s string, p netip.Prefix) bool {
+	a, err := netip.ParseAddr(s)
+	return err == nil && p.Contains(a.Unmap())
+}
+
+func total(a, b *int64) int64 {
+	var n int64
+	if a != nil {
+		n += *a
+	}
+	if b != nil {
+		n += *b
+	}
+	return n
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,239 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/byteroute/client-go/internal/flow"
+	"github.com/byteroute/client-go/internal/metrics"
+	"github.com/byteroute/client-go/internal/rules"
+)
+
+func newTestAggregator() *flow.Aggregator {
+	agg := flow.New("host", "flow", time.Minute, map[string]struct{}{"10.0.0.1": {}})
+	now := time.Now()
+	agg.Update(now, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 5000, 53, "UDP", 100)
+	agg.Update(now.Add(time.Second), net.ParseIP("10.0.0.1"), net.ParseIP("1.1.1.1"), 5001, 443, "TCP", 1000)
+	agg.Update(now.Add(2*time.Second), net.ParseIP("10.0.0.1"), net.ParseIP("1.1.1.1"), 5001, 443, "TCP", 1000)
+	agg.Update(now.Add(3*time.Second), net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.7"), 5002, 443, "TCP", 500)
+	return agg
+}
+
+func getFlows(t *testing.T, h http.Handler, query string) (int, FlowsResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flows"+query, nil))
+	var resp FlowsResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestFlows_DefaultSortsByBytesDesc(t *testing.T) {
+	h := NewHandler(newTestAggregator(), metrics.New(10), nil)
+
+	code, resp := getFlows(t, h, "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if resp.Total != 3 || len(resp.Flows) != 3 {
+		t.Fatalf("expected 3 flows, got total=%d len=%d", resp.Total, len(resp.Flows))
+	}
+	if resp.Flows[0].DestIP != "1.1.1.1" || resp.Flows[2].DestIP != "8.8.8.8" {
+		t.Fatalf("unexpected order: %s, %s, %s", resp.Flows[0].DestIP, resp.Flows[1].DestIP, resp.Flows[2].DestIP)
+	}
+}
+
+func TestFlows_Filters(t *testing.T) {
+	h := NewHandler(newTestAggregator(), metrics.New(10), nil)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?ip=8.8.8.8", 1},
+		{"?ip=10.0.0.1", 3},
+		{"?cidr=192.0.2.0/24", 1},
+		{"?port=443", 2},
+		{"?protocol=udp", 1},
+		{"?status=inactive", 0},
+		{"?port=443&cidr=1.0.0.0/8", 1},
+	}
+	for _, tt := range tests {
+		code, resp := getFlows(t, h, tt.query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.query, code)
+		}
+		if resp.Total != tt.want {
+			t.Errorf("%s: total = %d, want %d", tt.query, resp.Total, tt.want)
+		}
+	}
+}
+
+func TestFlows_SortAndPaginate(t *testing.T) {
+	h := NewHandler(newTestAggregator(), metrics.New(10), nil)
+
+	_, resp := getFlows(t, h, "?sort=last&order=asc&limit=1&offset=1")
+	if resp.Total != 3 || len(resp.Flows) != 1 {
+		t.Fatalf("expected one flow of three, got total=%d len=%d", resp.Total, len(resp.Flows))
+	}
+	if resp.Flows[0].DestIP != "1.1.1.1" {
+		t.Fatalf("expected second-oldest activity to be 1.1.1.1, got %s", resp.Flows[0].DestIP)
+	}
+
+	_, resp = getFlows(t, h, "?offset=10")
+	if len(resp.Flows) != 0 || resp.Flows == nil {
+		t.Fatalf("expected empty (non-null) page past the end, got %v", resp.Flows)
+	}
+}
+
+func TestFlows_InvalidQuery(t *testing.T) {
+	h := NewHandler(newTestAggregator(), metrics.New(10), nil)
+
+	for _, q := range []string{"?ip=nope", "?cidr=10.0.0.0", "?port=70000", "?status=open", "?sort=size", "?order=up", "?limit=-1"} {
+		if code, _ := getFlows(t, h, q); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, code)
+		}
+	}
+}
+
+func TestMetricsEndpoints(t *testing.T) {
+	c := metrics.New(10)
+	c.RecordConnection("conn1", 100, 200, false)
+	c.TakeSnapshot()
+	c.RecordConnection("conn2", 5, 5, false)
+
+	h := NewHandler(newTestAggregator(), c, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var snaps SnapshotsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &snaps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(snaps.Snapshots) != 1 || snaps.Snapshots[0].BandwidthIn != 100 {
+		t.Fatalf("unexpected snapshots: %+v", snaps.Snapshots)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/current", nil))
+	var current metrics.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if current.BandwidthIn != 5 {
+		t.Fatalf("expected current bandwidthIn=5, got %d", current.BandwidthIn)
+	}
+}
+
+func TestRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [{"name": "dns", "action": "deny", "ports": ["53"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := rules.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := newTestAggregator()
+	for _, c := range agg.Flows() {
+		engine.Evaluate(c)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(agg, metrics.New(10), engine).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules", nil))
+	var st rules.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(st.Rules) != 1 || st.Rules[0].Hits != 1 || st.DefaultHits != 2 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(agg, metrics.New(10), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without rules, got %d", rec.Code)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := RequireToken(NewHandler(newTestAggregator(), metrics.New(10), nil), "secret")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the token, got %d", rec.Code)
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ln.Close()
+
+	// A stale socket file must not prevent re-listening.
+	ln, err = Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	defer ln.Close()
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected an owner-only socket, got %v (%v)", fi.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("expected only the socket in its directory, got %d entries", len(entries))
+	}
+}
+
+func TestListen_KeepsNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "important.conf")
+	if err := os.WriteFile(path, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := Listen("unix:" + path); err == nil {
+		ln.Close()
+		t.Fatal("expected Listen to refuse a regular file")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Fatalf("file was changed: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type AgentInterface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+// AgentRegistration describes the agent and its host to the backend.
+type AgentRegistration struct {
+	AgentID      string           `json:"agentId"`
+	PublicKey    string           `json:"publicKey"`
+	Hostname     string           `json:"hostname,omitempty"`
+	OS           string           `json:"os,omitempty"`
+	Kernel       string           `json:"kernel,omitempty"`
+	Version      string           `json:"version,omitempty"`
+	Interfaces   []AgentInterface `json:"interfaces,omitempty"`
+	Capabilities []string         `json:"capabilities,omitempty"`
+	Timestamp    string           `json:"timestamp"`
+}
+
+type AgentHeartbeat struct {
+	Timestamp     string `json:"timestamp"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	// ConfigVersion is the remote configuration in effect; ConfigError
+	// explains why a newer document was rejected.
+	ConfigVersion string `json:"configVersion,omitempty"`
+	ConfigError   string `json:"configError,omitempty"`
+}
+
+// AgentBinding is the backend's answer to a registration or heartbeat.
+type AgentBinding struct {
+	AgentID                  string `json:"agentId"`
+	TenantID                 string `json:"tenantId"`
+	HeartbeatIntervalSeconds int    `json:"heartbeatIntervalSeconds"`
+}
+
+// RegisterAgent registers the agent, or updates its host details. signature
+// is the agent's signature over its ID and reg.Timestamp.
+func (c *Client) RegisterAgent(ctx context.Context, reg AgentRegistration, signature string) (*AgentBinding, error) {
+	var out AgentBinding
+	if err := c.postAgent(ctx, "/api/agents/register", reg, signature, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AgentHeartbeat reports the agent as alive. A 404 means the backend does not
+// know the agent and it should register again.
+func (c *Client) AgentHeartbeat(ctx context.Context, agentID string, hb AgentHeartbeat, signature string) (*AgentBinding, error) {
+	var out AgentBinding
+	if err := c.postAgent(ctx, "/api/agents/"+url.PathEscape(agentID)+"/heartbeat", hb, signature, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AgentConfig fetches the agent's configuration document. etag is the ETag
+// of the document the agent already has; when it is still current the
+// backend answers 304 and AgentConfig returns a nil document.
+func (c *Client) AgentConfig(ctx context.Context, agentID, etag string) (doc []byte, newETag string, err error) {
+	status, header, body, err := c.agentRequest(ctx, http.MethodGet, "/api/agents/"+url.PathEscape(agentID)+"/config", nil, func(req *http.Request) {
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	switch status {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusOK:
+		return body, header.Get("ETag"), nil
+	}
+	return nil, "", statusError(status, header, body)
+}
+
+// postAgent sends a small signed JSON request once. Unlike ingest posts it
+// is not retried here; the agent loop calls again on its own schedule.
+func (c *Client) postAgent(ctx context.Context, path string, payload any, signature string, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	status, header, respBody, err := c.agentRequest(ctx, http.MethodPost, path, body, func(req *http.Request) {
+		req.Header.Set("Content-Type", ContentTypeJSON)
+		req.Header.Set("X-Agent-Signature", signature)
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return statusError(status, header, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &RequestError{Kind: KindRetryable, Err: fmt.Errorf("decode %s response: %w", path, err)}
+	}
+	return nil
+}
+
+// agentRequest sends one request, renewing the token once on 401.
+func (c *Client) agentRequest(ctx context.Context, method, path string, body []byte, prepare func(*http.Request)) (int, http.Header, []byte, error) {
+	endpoint := c.baseURL.ResolveReference(&url.URL{Path: path}).String()
+
+	renewed := false
+	for {
+		token, err := c.credentials.Token(ctx)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		prepare(req)
+		c.applyAuth(req, token)
+
+		resp, err := c.hc.Do(req)
+		if err != nil {
+			return 0, nil, nil, &RequestError{Kind: KindRetryable, Err: err}
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized && !renewed {
+			renewed = true
+			if c.credentials.Invalidate(token) {
+				continue
+			}
+		}
+		return resp.StatusCode, resp.Header, respBody, nil
+	}
+}
@@ -0,0 +1,288 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrRecordTooLarge is returned by BatchBuilder.Add for a connection that
+// exceeds the size limit even in a batch of its own.
+var ErrRecordTooLarge = errors.New("record exceeds max request size")
+
+var (
+	jsonBatchPrefix = []byte(`{"connections":[`)
+	jsonBatchSuffix = []byte(`]}`)
+)
+
+// batchInfoReserve is kept free below the size limit for the batch ID and
+// sequence, which are only known when the batch is sent.
+const batchInfoReserve = 80
+
+// MaxDecompressedBytes is the backend's limit on a request body after
+// decompression. Batches stay within it whatever their compressed size.
+const MaxDecompressedBytes = 2 << 20
+
+// compressReserve covers the compression framing: the gzip or zstd header,
+// the final block and the trailer.
+const compressReserve = 64
+
+// BatchBuilder encodes a connections request body incrementally, so a batch
+// can be filled up to a byte limit with each record marshalled exactly once.
+// The limit applies to the body as sent, after compression with the client's
+// current encoding; the body before compression is also kept within
+// MaxDecompressedBytes.
+type BatchBuilder struct {
+	format   WireFormat
+	enc      Encoding
+	maxBytes int
+
+	body  []byte
+	conns []Connection
+	// info identifies the batch once it was first sent, so sending it
+	// again is recognised by the backend as the same batch.
+	info BatchInfo
+
+	// With compression, the body is also compressed as it grows and flushed
+	// after each record, so compressed tracks the size the batch compresses
+	// to (slightly overestimated by the flushes).
+	zw         compressWriter
+	compressed byteCounter
+}
+
+// NewBatchBuilder returns a builder for the client's current wire format and
+// encoding. maxBytes <= 0 leaves only the MaxDecompressedBytes limit.
+func (c *Client) NewBatchBuilder(maxBytes int) *BatchBuilder {
+	return &BatchBuilder{format: c.WireFormat(), enc: c.Encoding(), maxBytes: maxBytes}
+}
+
+// Add appends conn if the body stays within the limit. It returns false
+// without consuming conn when the batch is full, and ErrRecordTooLarge when
+// conn cannot be sent in any batch.
+func (b *BatchBuilder) Add(conn Connection) (bool, error) {
+	rec, err := b.encode(&conn)
+	if err != nil {
+		return false, err
+	}
+
+	tooLarge := b.rawSizeWith(rec, true) > MaxDecompressedBytes
+	if !tooLarge && b.maxBytes > 0 && b.sizeWith(rec, true) > b.maxBytes {
+		size, err := b.aloneSize(rec)
+		if err != nil {
+			return false, err
+		}
+		tooLarge = size > b.maxBytes
+	}
+	if tooLarge {
+		return false, fmt.Errorf("connection %s: %d bytes: %w", conn.ID, len(rec), ErrRecordTooLarge)
+	}
+	if len(b.conns) > 0 {
+		if b.rawSizeWith(rec, false) > MaxDecompressedBytes || b.maxBytes > 0 && b.sizeWith(rec, false) > b.maxBytes {
+			return false, nil
+		}
+	}
+
+	start := len(b.body)
+	if b.format == WireJSON && len(b.conns) > 0 {
+		b.body = append(b.body, ',')
+	}
+	b.body = append(b.body, rec...)
+	if err := b.compress(b.body[start:]); err != nil {
+		b.body = b.body[:start]
+		return false, err
+	}
+	b.conns = append(b.conns, conn)
+	b.info = BatchInfo{}
+	return true, nil
+}
+
+// Len returns the number of connections in the batch.
+func (b *BatchBuilder) Len() int {
+	return len(b.conns)
+}
+
+// Size returns the encoded size of the batch without batch metadata.
+func (b *BatchBuilder) Size() int {
+	if b.format == WireJSON {
+		return len(jsonBatchPrefix) + len(b.body) + len(jsonBatchSuffix)
+	}
+	return len(b.body)
+}
+
+// Connections returns the connections added so far.
+func (b *BatchBuilder) Connections() []Connection {
+	return b.conns
+}
+
+// Reset empties the builder, keeping its buffers for reuse.
+func (b *BatchBuilder) Reset() {
+	b.body = b.body[:0]
+	b.conns = b.conns[:0]
+	b.info = BatchInfo{}
+}
+
+// batchInfo returns the batch's ID and sequence, assigning them from c the
+// first time the batch is sent.
+func (b *BatchBuilder) batchInfo(c *Client) (BatchInfo, error) {
+	if b.info.ID == "" {
+		info, err := c.newBatch()
+		if err != nil {
+			return BatchInfo{}, err
+		}
+		b.info = info
+	}
+	return b.info, nil
+}
+
+// Body returns the encoded request body in format f, re-encoding only when
+// f differs from the format the batch was built in.
+func (b *BatchBuilder) Body(f WireFormat, batch BatchInfo) ([]byte, error) {
+	if f != b.format {
+		return marshal(f, ConnectionsPayload{Connections: b.conns, BatchID: batch.ID, Sequence: batch.Sequence})
+	}
+	out := make([]byte, 0, b.Size()+batchInfoReserve)
+	if b.format != WireJSON {
+		out = append(out, b.body...)
+		return appendBatchInfo(out, batch), nil
+	}
+	out = append(out, jsonBatchPrefix...)
+	out = append(out, b.body...)
+	out = append(out, ']')
+	if batch.ID != "" {
+		id, err := json.Marshal(batch.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, `,"batchId":`...)
+		out = append(out, id...)
+	}
+	if batch.Sequence != 0 {
+		out = append(out, `,"sequence":`...)
+		out = strconv.AppendUint(out, batch.Sequence, 10)
+	}
+	return append(out, '}'), nil
+}
+
+// encode marshals one connection as it appears inside the payload: a JSON
+// array element, or a length-delimited field 1 of ConnectionsPayload.
+func (b *BatchBuilder) encode(conn *Connection) ([]byte, error) {
+	if b.format == WireJSON {
+		return json.Marshal(conn)
+	}
+	msg, err := appendConnection(nil, conn)
+	if err != nil {
+		return nil, err
+	}
+	out := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(out, msg), nil
+}
+
+// compress feeds the bytes just appended to the body into the compressed
+// size estimate, starting a new stream for the first record.
+func (b *BatchBuilder) compress(p []byte) error {
+	if b.enc != EncodingGzip && b.enc != EncodingZstd {
+		return nil
+	}
+	if len(b.conns) == 0 {
+		b.compressed = 0
+		if b.zw == nil {
+			b.zw = newCompressWriter(b.enc, &b.compressed)
+		} else {
+			b.zw.Reset(&b.compressed)
+		}
+		if b.format == WireJSON {
+			if _, err := b.zw.Write(jsonBatchPrefix); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := b.zw.Write(p); err != nil {
+		return err
+	}
+	return b.zw.Flush()
+}
+
+// rawSizeWith returns the size of the body before compression after
+// appending rec, to an empty batch when alone is set.
+func (b *BatchBuilder) rawSizeWith(rec []byte, alone bool) int {
+	head, tail := b.headTail(rec, alone)
+	if !alone {
+		head += len(b.body)
+	}
+	return head + tail
+}
+
+// sizeWith returns the worst-case size of the body as sent after appending
+// rec, to an empty batch when alone is set.
+func (b *BatchBuilder) sizeWith(rec []byte, alone bool) int {
+	if b.enc != EncodingGzip && b.enc != EncodingZstd {
+		return b.rawSizeWith(rec, alone)
+	}
+	// The body so far is compressed; bound the tail as if it did not
+	// compress at all, which costs the framing of stored blocks.
+	head, tail := b.headTail(rec, alone)
+	if !alone {
+		head = int(b.compressed)
+	}
+	return head + tail + tail/1024 + compressReserve
+}
+
+// headTail splits the uncompressed body after appending rec into the
+// JSON prefix and what would still be added to the body.
+func (b *BatchBuilder) headTail(rec []byte, alone bool) (head, tail int) {
+	tail = len(rec) + batchInfoReserve
+	if b.format == WireJSON {
+		head = len(jsonBatchPrefix)
+		tail += len(jsonBatchSuffix)
+		if !alone {
+			tail++ // separator
+		}
+	}
+	return head, tail
+}
+
+// aloneSize returns the size of a body holding only rec, compressed when the
+// builder compresses. It is only needed when sizeWith's bound is too coarse.
+func (b *BatchBuilder) aloneSize(rec []byte) (int, error) {
+	if b.enc != EncodingGzip && b.enc != EncodingZstd {
+		return b.sizeWith(rec, true), nil
+	}
+	body := rec
+	if b.format == WireJSON {
+		body = slices.Concat(jsonBatchPrefix, rec, jsonBatchSuffix)
+	}
+	out, err := compress(b.enc, body)
+	if err != nil {
+		return 0, err
+	}
+	return len(out) + batchInfoReserve, nil
+}
+
+// byteCounter is an io.Writer that only counts.
+type byteCounter int
+
+func (n *byteCounter) Write(p []byte) (int, error) {
+	*n += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,320 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/byteroute/client-go/internal/state"
+)
+
+func testConnections(n int) []Connection {
+	conns := make([]Connection, n)
+	for i := range conns {
+		conns[i] = Connection{
+			ID:           fmt.Sprintf("flow-%d", i),
+			SourceIP:     "10.0.0.1",
+			DestIP:       "8.8.8.8",
+			SourcePort:   40000 + i,
+			DestPort:     53,
+			Protocol:     "UDP",
+			Status:       "active",
+			StartTime:    "2026-01-02T03:04:05Z",
+			LastActivity: "2026-01-02T03:04:06Z",
+		}
+	}
+	return conns
+}
+
+func TestBatchBuilder_BodyMatchesMarshal(t *testing.T) {
+	conns := testConnections(3)
+	for _, format := range []WireFormat{WireJSON, WireProtobuf} {
+		t.Run(string(format), func(t *testing.T) {
+			c, _ := NewClient("http://localhost", time.Second, "", WithWireFormat(format))
+			b := c.NewBatchBuilder(0)
+			for _, conn := range conns {
+				if ok, err := b.Add(conn); !ok || err != nil {
+					t.Fatalf("Add = %v, %v", ok, err)
+				}
+			}
+
+			got, err := b.Body(format, BatchInfo{})
+			if err != nil {
+				t.Fatalf("Body: %v", err)
+			}
+			want, _ := marshal(format, ConnectionsPayload{Connections: conns})
+			if !slices.Equal(got, want) {
+				t.Fatalf("body mismatch:\n got %q\nwant %q", got, want)
+			}
+			if b.Size() != len(want) {
+				t.Fatalf("Size() = %d, want %d", b.Size(), len(want))
+			}
+		})
+	}
+}
+
+func TestBatchBuilder_BodyIncludesBatchInfo(t *testing.T) {
+	conns := testConnections(2)
+	batch := BatchInfo{ID: "batch-1", Sequence: 42}
+	for _, format := range []WireFormat{WireJSON, WireProtobuf} {
+		c, _ := NewClient("http://localhost", time.Second, "", WithWireFormat(format))
+		b := c.NewBatchBuilder(0)
+		for _, conn := range conns {
+			_, _ = b.Add(conn)
+		}
+
+		got, err := b.Body(format, batch)
+		if err != nil {
+			t.Fatalf("%s: Body: %v", format, err)
+		}
+		want, _ := marshal(format, ConnectionsPayload{Connections: conns, BatchID: batch.ID, Sequence: batch.Sequence})
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: body mismatch:\n got %q\nwant %q", format, got, want)
+		}
+	}
+}
+
+func TestBatchBuilder_StopsAtLimit(t *testing.T) {
+	conns := testConnections(50)
+	one, _ := json.Marshal(ConnectionsPayload{Connections: conns[:1]})
+	limit := len(one)*5 + batchInfoReserve
+
+	c, _ := NewClient("http://localhost", time.Second, "")
+	b := c.NewBatchBuilder(limit)
+
+	added := 0
+	for _, conn := range conns {
+		ok, err := b.Add(conn)
+		if err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		if !ok {
+			break
+		}
+		added++
+	}
+
+	if added == 0 || added == len(conns) {
+		t.Fatalf("expected a partial batch, added %d", added)
+	}
+	body, _ := b.Body(WireJSON, BatchInfo{ID: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", Sequence: 1<<64 - 1})
+	if len(body) > limit {
+		t.Fatalf("body %d bytes exceeds limit %d", len(body), limit)
+	}
+	var payload ConnectionsPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("body is not valid JSON: %v", err)
+	}
+	if len(payload.Connections) != added || b.Len() != added {
+		t.Fatalf("expected %d connections, got %d (Len %d)", added, len(payload.Connections), b.Len())
+	}
+
+	// The record that did not fit fits after a reset.
+	b.Reset()
+	if ok, err := b.Add(conns[added]); !ok || err != nil {
+		t.Fatalf("Add after Reset = %v, %v", ok, err)
+	}
+}
+
+func TestBatchBuilder_RecordTooLarge(t *testing.T) {
+	c, _ := NewClient("http://localhost", time.Second, "")
+	b := c.NewBatchBuilder(64)
+
+	ok, err := b.Add(testConnections(1)[0])
+	if ok || !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("expected ErrRecordTooLarge, got %v, %v", ok, err)
+	}
+	if b.Len() != 0 || b.Size() != len(`{"connections":[]}`) {
+		t.Fatalf("expected builder to stay empty")
+	}
+}
+
+func TestBatchBuilder_CompressedLimit(t *testing.T) {
+	conns := testConnections(500)
+	one, _ := json.Marshal(ConnectionsPayload{Connections: conns[:1]})
+	limit := len(one) * 5
+
+	for _, enc := range []Encoding{EncodingGzip, EncodingZstd} {
+		t.Run(string(enc), func(t *testing.T) {
+			c, _ := NewClient("http://localhost", time.Second, "", WithCompression(enc))
+			b := c.NewBatchBuilder(limit)
+			for _, conn := range conns {
+				if ok, err := b.Add(conn); err != nil {
+					t.Fatalf("Add: %v", err)
+				} else if !ok {
+					break
+				}
+			}
+
+			// Similar records compress well, so many more than five fit.
+			if b.Len() <= 10 || b.Len() == len(conns) {
+				t.Fatalf("expected a partial batch of compressed records, got %d", b.Len())
+			}
+			body, _ := b.Body(WireJSON, BatchInfo{ID: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", Sequence: 1<<64 - 1})
+			sent, err := compress(enc, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sent) > limit {
+				t.Fatalf("compressed body %d bytes exceeds limit %d", len(sent), limit)
+			}
+		})
+	}
+}
+
+func TestBatchBuilder_DecompressedLimit(t *testing.T) {
+	conns := testConnections(20000)
+	c, _ := NewClient("http://localhost", time.Second, "", WithCompression(EncodingGzip))
+	b := c.NewBatchBuilder(1500000)
+	for _, conn := range conns {
+		if ok, err := b.Add(conn); err != nil {
+			t.Fatalf("Add: %v", err)
+		} else if !ok {
+			break
+		}
+	}
+
+	if b.Len() == len(conns) {
+		t.Fatal("expected the batch to fill before taking every record")
+	}
+	body, _ := b.Body(WireJSON, BatchInfo{ID: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", Sequence: 1<<64 - 1})
+	if len(body) > MaxDecompressedBytes {
+		t.Fatalf("body %d bytes exceeds the decompressed limit %d", len(body), MaxDecompressedBytes)
+	}
+	sent, err := compress(EncodingGzip, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The compressed limit is far from reached; the decompressed one decided.
+	if len(body) < MaxDecompressedBytes*9/10 || len(sent) > 1500000/2 {
+		t.Fatalf("expected a batch near the decompressed limit, got %d bytes (%d compressed)", len(body), len(sent))
+	}
+}
+
+func TestClient_PostBatch(t *testing.T) {
+	var got ConnectionsPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: len(got.Connections), Status: "processing"})
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "")
+	b := c.NewBatchBuilder(0)
+	for _, conn := range testConnections(2) {
+		_, _ = b.Add(conn)
+	}
+
+	resp, err := c.PostBatch(context.Background(), b)
+	if err != nil {
+		t.Fatalf("PostBatch: %v", err)
+	}
+	if resp.Received != 2 || len(got.Connections) != 2 || got.Connections[1].ID != "flow-1" {
+		t.Fatalf("unexpected delivery: %+v, %+v", resp, got)
+	}
+}
+
+func TestClient_PostBatchReusesBatchID(t *testing.T) {
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"received":1,"status":"processing"}`))
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "")
+	b := c.NewBatchBuilder(0)
+	_, _ = b.Add(testConnections(1)[0])
+	for range 2 {
+		if _, err := c.PostBatch(context.Background(), b); err != nil {
+			t.Fatalf("PostBatch: %v", err)
+		}
+	}
+	b.Reset()
+	_, _ = b.Add(testConnections(1)[0])
+	if _, err := c.PostBatch(context.Background(), b); err != nil {
+		t.Fatalf("PostBatch: %v", err)
+	}
+
+	if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] == keys[0] {
+		t.Fatalf("expected a resent batch to keep its key and a new one to get another, got %q", keys)
+	}
+}
+
+func TestClient_PostBatchSequenceUnwritable(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "state")
+	seq, err := state.OpenSequence(filepath.Join(dir, "sequence"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Root ignores directory permissions, so a file in place of the state
+	// directory stands in for a read-only one.
+	if err := os.WriteFile(dir, nil, 0o400); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithSequence(seq))
+	b := c.NewBatchBuilder(0)
+	_, _ = b.Add(testConnections(1)[0])
+	_, err = c.PostBatch(context.Background(), b)
+	if !IsRetryable(err) {
+		t.Fatalf("expected a retryable error, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected nothing to be sent, got %d requests", requests)
+	}
+}
+
+func BenchmarkBatchBuilder_JSON(b *testing.B) {
+	conns := benchConnections(200)
+	c, _ := NewClient("http://localhost", time.Second, "")
+	builder := c.NewBatchBuilder(1500000)
+	b.ReportAllocs()
+	for b.Loop() {
+		builder.Reset()
+		for _, conn := range conns {
+			if _, err := builder.Add(conn); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := builder.Body(WireJSON, BatchInfo{ID: "x", Sequence: 1}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -20,71 +20,197 @@ package backend
 import (
 	"bytes"
 	"context"
+	cryptorand "crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
-	baseURL   *url.URL
-	hc        *http.Client
-	authToken string
-	tenantID  string
+	baseURL     *url.URL
+	hc          *http.Client
+	credentials Credentials
+
+	mu       sync.Mutex
+	encoding Encoding
+	format   WireFormat
+	tenantID string
+
+	retry   RetryPolicy
+	breaker *breaker
+	budgets map[string]*retryBudget
+	randN   func(int64) int64
+
+	sequence SequenceSource
+}
+
+// SequenceSource hands out the per-agent batch sequence numbers.
+type SequenceSource interface {
+	Next() (uint64, error)
+}
+
+// memorySequence is the SequenceSource used without WithSequence; it
+// restarts at 1 with the process.
+type memorySequence struct {
+	n atomic.Uint64
+}
+
+func (s *memorySequence) Next() (uint64, error) {
+	return s.n.Add(1), nil
+}
+
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// WithCompression compresses request bodies with enc. If the backend answers
+// 415 Unsupported Media Type the client falls back (zstd -> gzip -> identity)
+// and keeps using the accepted encoding.
+func WithCompression(enc Encoding) Option {
+	return func(c *Client) {
+		c.encoding = enc
+	}
+}
+
+// WithWireFormat selects the request body serialisation. A backend that
+// answers 415 to protobuf (after compression has been ruled out) makes the
+// client fall back to JSON.
+func WithWireFormat(f WireFormat) Option {
+	return func(c *Client) {
+		c.format = f
+	}
+}
+
+// WithSequence sets the source of batch sequence numbers, normally one
+// persisted across restarts.
+func WithSequence(s SequenceSource) Option {
+	return func(c *Client) {
+		c.sequence = s
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithCredentials replaces the static token passed to NewClient.
+func WithCredentials(cr Credentials) Option {
+	return func(c *Client) {
+		c.credentials = cr
+	}
+}
+
+// WithTransport sends requests through rt, normally one built by
+// NewTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.hc.Transport = rt
+	}
 }
 
 type authTokenClaims struct {
 	TenantID  string   `json:"tenantId"`
 	TenantIDs []string `json:"tenantIds"`
+	Exp       int64    `json:"exp"`
 }
 
-func NewClient(baseURL string, timeout time.Duration, authToken string) (*Client, error) {
+func NewClient(baseURL string, timeout time.Duration, authToken string, opts ...Option) (*Client, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
+	c := &Client{
 		baseURL: u,
 		hc: &http.Client{
 			Timeout: timeout,
 		},
-		authToken: strings.TrimSpace(authToken),
-		tenantID:  extractTenantIDFromToken(authToken),
-	}, nil
+		credentials: StaticCredentials(strings.TrimSpace(authToken)),
+		encoding:    EncodingIdentity,
+		format:      WireJSON,
+		retry:       DefaultRetryPolicy,
+		budgets:     map[string]*retryBudget{},
+		randN:       rand.Int64N,
+		sequence:    &memorySequence{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.breaker = &breaker{threshold: c.retry.BreakerThreshold, cooldown: c.retry.BreakerCooldown}
+	return c, nil
 }
 
-func (c *Client) applyAuth(req *http.Request) {
-	if c.authToken != "" {
-		req.Header.Set("Authorization", "Bearer "+c.authToken)
+// SetTenant sets the tenant sent as X-Tenant-Id when the token does not
+// name one, such as the tenant the agent was bound to at registration.
+func (c *Client) SetTenant(tenantID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tenantID = tenantID
+}
+
+func (c *Client) applyAuth(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	tenantID := extractTenantIDFromToken(token)
+	if tenantID == "" {
+		c.mu.Lock()
+		tenantID = c.tenantID
+		c.mu.Unlock()
 	}
-	if c.tenantID != "" {
-		req.Header.Set("X-Tenant-Id", c.tenantID)
+	if tenantID != "" {
+		req.Header.Set("X-Tenant-Id", tenantID)
 	}
 }
 
-func extractTenantIDFromToken(token string) string {
+// decodeTokenClaims reads the payload of a JWT without verifying it; the
+// backend does that.
+func decodeTokenClaims(token string) (authTokenClaims, bool) {
+	var claims authTokenClaims
+
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return ""
+		return claims, false
 	}
 
 	parts := strings.Split(token, ".")
 	if len(parts) < 2 {
-		return ""
+		return claims, false
 	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return ""
+		return claims, false
 	}
 
-	var claims authTokenClaims
 	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
+
+// tokenExpiry returns the token's exp claim, or the zero time without one.
+func tokenExpiry(token string) time.Time {
+	claims, ok := decodeTokenClaims(token)
+	if !ok || claims.Exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+func extractTenantIDFromToken(token string) string {
+	claims, ok := decodeTokenClaims(token)
+	if !ok {
 		return ""
 	}
 
@@ -101,76 +227,246 @@ func extractTenantIDFromToken(token string) string {
 	return ""
 }
 
-func (c *Client) PostConnections(ctx context.Context, connections []Connection) (*AcceptedResponse, error) {
-	endpoint := c.baseURL.ResolveReference(&url.URL{Path: "/api/connections"})
+// Encoding returns the content encoding currently used for request bodies.
+func (c *Client) Encoding() Encoding {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoding
+}
 
-	payload := ConnectionsPayload{Connections: connections}
-	bodyBytes, err := json.Marshal(payload)
+// WireFormat returns the serialisation currently used for request bodies.
+func (c *Client) WireFormat() WireFormat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.format
+}
+
+func (c *Client) PostConnections(ctx context.Context, connections []Connection) (*AcceptedResponse, error) {
+	batch, err := c.newBatch()
 	if err != nil {
 		return nil, err
 	}
+	return c.post(ctx, "/api/connections", func(f WireFormat, batch BatchInfo) ([]byte, error) {
+		return marshal(f, ConnectionsPayload{Connections: connections, BatchID: batch.ID, Sequence: batch.Sequence})
+	}, len(connections), batch)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(bodyBytes))
+// PostBatch sends the connections collected in b, reusing its encoded body.
+// Posting b again before it is reset or added to reuses its batch ID, so a
+// batch the backend processed despite a failed response is not stored twice.
+func (c *Client) PostBatch(ctx context.Context, b *BatchBuilder) (*AcceptedResponse, error) {
+	batch, err := b.batchInfo(c)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	c.applyAuth(req)
+	return c.post(ctx, "/api/connections", b.Body, b.Len(), batch)
+}
 
-	resp, err := c.hc.Do(req)
+func (c *Client) PostMetrics(ctx context.Context, snapshots []MetricsSnapshot) (*AcceptedResponse, error) {
+	batch, err := c.newBatch()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return c.post(ctx, "/api/metrics", func(f WireFormat, batch BatchInfo) ([]byte, error) {
+		return marshal(f, MetricsPayload{Snapshots: snapshots, BatchID: batch.ID, Sequence: batch.Sequence})
+	}, len(snapshots), batch)
+}
 
-	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+// newBatch assigns a fresh ID and the next sequence number to a payload.
+// Failing to persist the sequence says nothing about the payload, so the
+// error is retryable.
+func (c *Client) newBatch() (BatchInfo, error) {
+	seq, err := c.sequence.Next()
+	if err != nil {
+		return BatchInfo{}, &RequestError{Kind: KindRetryable, Err: err}
+	}
+	return BatchInfo{ID: cryptorand.Text(), Sequence: seq}, nil
+}
+
+// post sends the body produced by encode, retrying retryable failures
+// within the endpoint's retry budget. Failures are returned as *RequestError.
+// Every attempt carries the same batch ID, so the backend can drop
+// duplicates of a request that succeeded but whose response was lost.
+func (c *Client) post(ctx context.Context, path string, encode func(WireFormat, BatchInfo) ([]byte, error), count int, batch BatchInfo) (*AcceptedResponse, error) {
+	endpoint := c.baseURL.ResolveReference(&url.URL{Path: path}).String()
+	body := &requestBody{encode: encode, batch: batch}
+
+	for attempt := 0; ; attempt++ {
+		if wait, ok := c.breaker.allow(time.Now()); !ok {
+			return nil, &RequestError{Kind: KindRetryable, RetryAfter: wait, Err: ErrCircuitOpen}
+		}
 
-	if resp.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf("backend returned %d: %s", resp.StatusCode, string(respBody))
+		accepted, err := c.attempt(ctx, endpoint, body, count)
+		var reqErr *RequestError
+		if ctx.Err() != nil || (err != nil && !errors.As(err, &reqErr)) {
+			// Cancelled by the caller or never sent (e.g. encoding failed);
+			// neither says anything about the backend's health.
+			return accepted, err
+		}
+		failed := IsRetryable(err)
+		c.breaker.record(time.Now(), failed)
+		canRetry := c.recordAttempt(path, failed)
+		if !failed || !canRetry || attempt+1 >= c.retry.MaxAttempts {
+			return accepted, err
+		}
+
+		delay := c.retry.backoff(attempt, RetryAfter(err), c.randN)
+		if c.retry.MaxDelay > 0 && delay > c.retry.MaxDelay {
+			// The backend asked for a longer pause than we are willing to
+			// block for; let the caller reschedule.
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
 	}
+}
 
-	var accepted AcceptedResponse
-	if err := json.Unmarshal(respBody, &accepted); err != nil {
-		// Backend always returns JSON today, but don't fail hard if it changes.
-		return &AcceptedResponse{Received: len(connections), Status: "processing"}, nil
+// recordAttempt updates the endpoint's retry budget and reports whether a
+// retry is still allowed.
+func (c *Client) recordAttempt(path string, failed bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.budgets[path]
+	if b == nil {
+		b = newRetryBudget(c.retry)
+		c.budgets[path] = b
 	}
+	b.record(failed)
+	return b.canRetry()
+}
 
-	return &accepted, nil
+// requestBody caches the encoded body for the current wire format.
+type requestBody struct {
+	encode func(WireFormat, BatchInfo) ([]byte, error)
+	batch  BatchInfo
+	format WireFormat
+	bytes  []byte
 }
 
-func (c *Client) PostMetrics(ctx context.Context, snapshots []MetricsSnapshot) (*AcceptedResponse, error) {
-	endpoint := c.baseURL.ResolveReference(&url.URL{Path: "/api/metrics"})
+func (b *requestBody) get(f WireFormat) ([]byte, error) {
+	if b.bytes == nil || b.format != f {
+		data, err := b.encode(f, b.batch)
+		if err != nil {
+			return nil, err
+		}
+		b.bytes, b.format = data, f
+	}
+	return b.bytes, nil
+}
+
+// attempt sends the body once, renegotiating compression and wire format on
+// 415 Unsupported Media Type and renewing the token once on 401.
+func (c *Client) attempt(ctx context.Context, endpoint string, body *requestBody, count int) (*AcceptedResponse, error) {
+	renewed := false
+	for {
+		enc, format := c.Encoding(), c.WireFormat()
+		bodyBytes, err := body.get(format)
+		if err != nil {
+			return nil, err
+		}
 
-	payload := MetricsPayload{Snapshots: snapshots}
-	bodyBytes, err := json.Marshal(payload)
+		token, err := c.credentials.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		status, header, respBody, err := c.send(ctx, endpoint, enc, format, token, body.batch.ID, bodyBytes)
+		if err != nil {
+			return nil, &RequestError{Kind: KindRetryable, Err: err}
+		}
+
+		if status == http.StatusUnauthorized && !renewed {
+			renewed = true
+			if c.credentials.Invalidate(token) {
+				continue
+			}
+		}
+
+		if status == http.StatusUnsupportedMediaType {
+			if enc != EncodingIdentity {
+				c.downgrade(enc)
+				continue
+			}
+			if format != WireJSON {
+				c.downgradeFormat(format)
+				continue
+			}
+		}
+
+		if status != http.StatusAccepted {
+			return nil, statusError(status, header, respBody)
+		}
+
+		var accepted AcceptedResponse
+		if err := json.Unmarshal(respBody, &accepted); err != nil {
+			// Backend always returns JSON today, but don't fail hard if it changes.
+			return &AcceptedResponse{Received: count, Status: "processing"}, nil
+		}
+		return &accepted, nil
+	}
+}
+
+func (c *Client) send(ctx context.Context, endpoint string, enc Encoding, format WireFormat, token, idempotencyKey string, body []byte) (int, http.Header, []byte, error) {
+	body, err := compress(enc, body)
 	if err != nil {
-		return nil, err
+		return 0, nil, nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return 0, nil, nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	c.applyAuth(req)
+	req.Header.Set("Content-Type", format.contentType())
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if enc != EncodingIdentity {
+		req.Header.Set("Content-Encoding", string(enc))
+	}
+	c.applyAuth(req, token)
 
 	resp, err := c.hc.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, resp.Header, respBody, nil
+}
 
-	if resp.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf("backend returned %d: %s", resp.StatusCode, string(respBody))
-	}
+// SetCompression switches the encoding used for later requests.
+func (c *Client) SetCompression(enc Encoding) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoding = enc
+}
+
+// SetWireFormat switches the serialisation used for later requests.
+func (c *Client) SetWireFormat(f WireFormat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.format = f
+}
 
-	var accepted AcceptedResponse
-	if err := json.Unmarshal(respBody, &accepted); err != nil {
-		// Backend always returns JSON today, but don't fail hard if it changes.
-		return &AcceptedResponse{Received: len(snapshots), Status: "processing"}, nil
+// downgrade moves off an encoding the backend rejected. Concurrent callers
+// that saw the same rejection only step down once.
+func (c *Client) downgrade(rejected Encoding) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.encoding == rejected {
+		c.encoding = rejected.fallback()
 	}
+}
 
-	return &accepted, nil
+// downgradeFormat falls back to JSON after the backend rejected format.
+func (c *Client) downgradeFormat(rejected WireFormat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.format == rejected {
+		c.format = WireJSON
+	}
 }
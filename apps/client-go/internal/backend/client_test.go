@@ -18,12 +18,17 @@
 package backend
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const testJWTWithTenantID = "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJ0ZW5hbnRJZCI6InRlbmFudC1hIiwidGVuYW50SWRzIjpbInRlbmFudC1hIiwidGVuYW50LWIiXX0."
@@ -254,3 +259,171 @@ func TestClient_UsesFirstTenantIDWhenPrimaryClaimMissing(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestClient_SetTenant(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Tenant-Id"))
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Status: "processing"})
+	}))
+	defer ts.Close()
+
+	// The bound tenant fills in for a token without one, but does not
+	// override a token's own tenant.
+	for _, token := range []string{"opaque-token", testJWTWithTenantID} {
+		c, _ := NewClient(ts.URL, 2*time.Second, token)
+		c.SetTenant("tenant-bound")
+		if _, err := c.PostConnections(context.Background(), []Connection{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(got) != 2 || got[0] != "tenant-bound" || got[1] != "tenant-a" {
+		t.Fatalf("unexpected tenants %q", got)
+	}
+}
+
+func TestClient_PostConnections_Compression(t *testing.T) {
+	for _, enc := range []Encoding{EncodingGzip, EncodingZstd} {
+		t.Run(string(enc), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Encoding"); got != string(enc) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				body, err := decompressForTest(enc, r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				var payload ConnectionsPayload
+				if err := json.Unmarshal(body, &payload); err != nil || len(payload.Connections) != 1 {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: 1, Status: "processing"})
+			}))
+			defer ts.Close()
+
+			c, _ := NewClient(ts.URL, 2*time.Second, "", WithCompression(enc))
+			if _, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}}); err != nil {
+				t.Fatalf("PostConnections: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_CompressionFallsBackOn415(t *testing.T) {
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := r.Header.Get("Content-Encoding")
+		seen = append(seen, enc)
+		if enc != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: 1, Status: "processing"})
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithCompression(EncodingZstd))
+	if _, err := c.PostMetrics(context.Background(), []MetricsSnapshot{{}}); err != nil {
+		t.Fatalf("PostMetrics: %v", err)
+	}
+	if want := []string{"zstd", "gzip", ""}; !slices.Equal(seen, want) {
+		t.Fatalf("expected encodings %q, got %q", want, seen)
+	}
+	if c.Encoding() != EncodingIdentity {
+		t.Fatalf("expected client to remember identity encoding, got %q", c.Encoding())
+	}
+
+	// Subsequent requests go straight to the accepted encoding.
+	seen = nil
+	if _, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}}); err != nil {
+		t.Fatalf("PostConnections: %v", err)
+	}
+	if len(seen) != 1 {
+		t.Fatalf("expected a single request after negotiation, got %d", len(seen))
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for in, want := range map[string]Encoding{"": EncodingIdentity, "none": EncodingIdentity, "GZIP": EncodingGzip, "zstd": EncodingZstd} {
+		got, err := ParseEncoding(in)
+		if err != nil || got != want {
+			t.Errorf("ParseEncoding(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseEncoding("brotli"); err == nil {
+		t.Errorf("expected error for unsupported encoding")
+	}
+}
+
+func decompressForTest(enc Encoding, r io.Reader) ([]byte, error) {
+	switch enc {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case EncodingZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return io.ReadAll(r)
+}
+
+type fixedSequence struct{ n uint64 }
+
+func (s *fixedSequence) Next() (uint64, error) {
+	s.n++
+	return s.n, nil
+}
+
+func TestClient_IdempotencyKeyStableAcrossRetries(t *testing.T) {
+	type request struct {
+		key     string
+		payload ConnectionsPayload
+	}
+	var requests []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p ConnectionsPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		requests = append(requests, request{key: r.Header.Get("Idempotency-Key"), payload: p})
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: 1, Status: "processing"})
+	}))
+	defer ts.Close()
+
+	seq := &fixedSequence{n: 41}
+	c, _ := NewClient(ts.URL, 2*time.Second, "",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}), WithSequence(seq))
+
+	for range 2 {
+		if _, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}}); err != nil {
+			t.Fatalf("PostConnections: %v", err)
+		}
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	first, retry, next := requests[0], requests[1], requests[2]
+	if first.key == "" || first.key != retry.key || first.key == next.key {
+		t.Fatalf("expected a stable key per call and a new key per batch, got %q %q %q", first.key, retry.key, next.key)
+	}
+	if first.payload.BatchID != first.key || first.payload.Sequence != 42 || next.payload.Sequence != 43 {
+		t.Fatalf("unexpected batch info: %+v / %+v", first.payload, next.payload)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials supplies the bearer token for backend requests.
+type Credentials interface {
+	// Token returns the token to send, which may be empty.
+	Token(ctx context.Context) (string, error)
+	// Invalidate is called when the backend rejected token with 401. It
+	// reports whether a retry with a fresh token is worthwhile.
+	Invalidate(token string) bool
+}
+
+// StaticCredentials is a fixed token, as given by --auth-token.
+type StaticCredentials string
+
+func (s StaticCredentials) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+func (StaticCredentials) Invalidate(string) bool {
+	return false
+}
+
+// FileCredentials reads the token from a file and re-reads it whenever the
+// file changes, so an external process can rotate it.
+type FileCredentials struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials reads the token file once so a missing or unreadable
+// file is reported at startup.
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	f := &FileCredentials{path: path}
+	if _, err := f.Token(context.Background()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileCredentials) Token(context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.readError(err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return f.readError(err)
+	}
+	f.token = strings.TrimSpace(string(data))
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return f.token, nil
+}
+
+// Invalidate re-reads the file and reports whether it now holds a different
+// token.
+func (f *FileCredentials) Invalidate(token string) bool {
+	f.mu.Lock()
+	f.token = ""
+	f.mu.Unlock()
+
+	fresh, err := f.Token(context.Background())
+	return err == nil && fresh != "" && fresh != token
+}
+
+// readError keeps a previously read token usable if the file briefly
+// disappears during a rotation.
+func (f *FileCredentials) readError(err error) (string, error) {
+	if f.token != "" {
+		return f.token, nil
+	}
+	return "", &RequestError{Kind: KindAuth, Err: fmt.Errorf("read token file: %w", err)}
+}
+
+// refreshFraction is the share of a token's lifetime left when
+// RefreshingCredentials fetches a new one.
+const refreshFraction = 5
+
+// RefreshingCredentials obtains short-lived client tokens from
+// POST /auth/client-token, authenticated with a long-lived enrolment
+// credential, and renews them before they expire.
+type RefreshingCredentials struct {
+	endpoint  string
+	hc        *http.Client
+	enrolment Credentials
+	tenantID  string
+	now       func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	issued  time.Time
+	expires time.Time
+}
+
+// NewRefreshingCredentials returns a provider that requests tokens from
+// baseURL through hc for tenantID, or the enrolment credential's default
+// tenant when tenantID is empty.
+func NewRefreshingCredentials(baseURL string, hc *http.Client, enrolment Credentials, tenantID string) (*RefreshingCredentials, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshingCredentials{
+		endpoint:  u.ResolveReference(&url.URL{Path: "/auth/client-token"}).String(),
+		hc:        hc,
+		enrolment: enrolment,
+		tenantID:  strings.TrimSpace(tenantID),
+		now:       time.Now,
+	}, nil
+}
+
+func (r *RefreshingCredentials) Token(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.token != "" && !r.needsRefresh(now) {
+		return r.token, nil
+	}
+
+	token, err := r.fetch(ctx)
+	if err != nil {
+		// Keep using the current token while it is still valid; the next
+		// request tries again.
+		if r.token != "" && now.Before(r.expires) {
+			return r.token, nil
+		}
+		return "", err
+	}
+
+	r.token, r.issued = token, now
+	r.expires = tokenExpiry(token)
+	return token, nil
+}
+
+// needsRefresh reports whether less than 1/refreshFraction of the token's
+// lifetime is left. Tokens without exp are only replaced after a 401.
+func (r *RefreshingCredentials) needsRefresh(now time.Time) bool {
+	if r.expires.IsZero() {
+		return false
+	}
+	margin := r.expires.Sub(r.issued) / refreshFraction
+	return !now.Before(r.expires.Add(-margin))
+}
+
+// Invalidate drops token so the next request fetches a new one.
+func (r *RefreshingCredentials) Invalidate(token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token == token {
+		r.token = ""
+	}
+	return true
+}
+
+type clientTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// fetch requests a new client token. Its failures are auth or retryable
+// errors, never permanent: they say nothing about the request waiting for
+// the token.
+func (r *RefreshingCredentials) fetch(ctx context.Context) (string, error) {
+	enrolment, err := r.enrolment.Token(ctx)
+	if err != nil {
+		if Kind(err) == KindPermanent {
+			err = &RequestError{Kind: KindRetryable, Err: fmt.Errorf("read enrolment token: %w", err)}
+		}
+		return "", err
+	}
+
+	var reqBody []byte
+	if r.tenantID != "" {
+		reqBody, _ = json.Marshal(map[string]string{"tenantId": r.tenantID})
+	} else {
+		reqBody = []byte("{}")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if enrolment != "" {
+		req.Header.Set("Authorization", "Bearer "+enrolment)
+	}
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return "", &RequestError{Kind: KindRetryable, Err: fmt.Errorf("refresh client token: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		err := statusError(resp.StatusCode, resp.Header, respBody)
+		if err.Kind != KindAuth {
+			err.Kind = KindRetryable
+		}
+		return "", err
+	}
+
+	var out clientTokenResponse
+	if err := json.Unmarshal(respBody, &out); err != nil || strings.TrimSpace(out.Token) == "" {
+		return "", &RequestError{Kind: KindRetryable, Err: fmt.Errorf("refresh client token: unexpected response %q", respBody)}
+	}
+	return strings.TrimSpace(out.Token), nil
+}
@@ -0,0 +1,252 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testToken builds an unsigned JWT for tenant with the given exp.
+func testToken(t *testing.T, tenant string, exp time.Time) string {
+	t.Helper()
+	claims, err := json.Marshal(map[string]any{"tenantId": tenant, "exp": exp.Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + base64.RawURLEncoding.EncodeToString(claims) + "."
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Unix(1_900_000_000, 0)
+	if got := tokenExpiry(testToken(t, "tenant-a", exp)); !got.Equal(exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if got := tokenExpiry(testJWTWithTenantID); !got.IsZero() {
+		t.Fatalf("expected zero expiry without exp, got %v", got)
+	}
+	if got := tokenExpiry("not-a-jwt"); !got.IsZero() {
+		t.Fatalf("expected zero expiry for opaque token, got %v", got)
+	}
+}
+
+func TestFileCredentials_RereadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Token(context.Background()); got != "first" {
+		t.Fatalf("expected first, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("second-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Token(context.Background()); got != "second-token" {
+		t.Fatalf("expected second-token after rewrite, got %q", got)
+	}
+
+	// A file removed mid-rotation keeps the last token.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.Token(context.Background()); err != nil || got != "second-token" {
+		t.Fatalf("expected last token to survive removal, got %q, %v", got, err)
+	}
+}
+
+func TestNewFileCredentials_Missing(t *testing.T) {
+	if _, err := NewFileCredentials(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error for missing token file")
+	}
+}
+
+// tokenServer issues tokens from /auth/client-token valid for ttl and
+// accepts /api/connections only with the latest one.
+type tokenServer struct {
+	*httptest.Server
+	issued  atomic.Int32
+	current atomic.Value
+}
+
+func newTokenServer(t *testing.T, ttl time.Duration) *tokenServer {
+	t.Helper()
+	s := &tokenServer{}
+	s.current.Store("")
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/client-token":
+			if r.Header.Get("Authorization") != "Bearer enrol" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var body struct {
+				TenantID string `json:"tenantId"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			s.issued.Add(1)
+			token := testToken(t, body.TenantID, time.Now().Add(ttl)) + string(rune('a'+s.issued.Load()))
+			s.current.Store(token)
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token, "expiresIn": ttl.String()})
+		case "/api/connections":
+			if r.Header.Get("Authorization") != "Bearer "+s.current.Load().(string) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("X-Tenant-Id") != "tenant-a" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"received":1,"status":"processing"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRefreshingCredentials_RefreshesBeforeExpiry(t *testing.T) {
+	ts := newTokenServer(t, time.Hour)
+	r, err := NewRefreshingCredentials(ts.URL, &http.Client{Timeout: time.Second}, StaticCredentials("enrol"), "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	first, err := r.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Token(context.Background()); got != first || ts.issued.Load() != 1 {
+		t.Fatalf("expected cached token, issued %d", ts.issued.Load())
+	}
+
+	// Inside the last fifth of the lifetime a new token is fetched.
+	now = now.Add(50 * time.Minute)
+	second, err := r.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || ts.issued.Load() != 2 {
+		t.Fatalf("expected refresh near expiry, issued %d", ts.issued.Load())
+	}
+}
+
+func TestRefreshingCredentials_KeepsValidTokenWhenRefreshFails(t *testing.T) {
+	ts := newTokenServer(t, time.Hour)
+	r, err := NewRefreshingCredentials(ts.URL, &http.Client{Timeout: time.Second}, StaticCredentials("enrol"), "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	first, err := r.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Close()
+	now = now.Add(55 * time.Minute)
+	if got, err := r.Token(context.Background()); err != nil || got != first {
+		t.Fatalf("expected current token while still valid, got %q, %v", got, err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	_, err = r.Token(context.Background())
+	if !IsRetryable(err) {
+		t.Fatalf("expected retryable error once expired, got %v", err)
+	}
+}
+
+func TestRefreshingCredentials_EnrolmentRejected(t *testing.T) {
+	ts := newTokenServer(t, time.Hour)
+	r, err := NewRefreshingCredentials(ts.URL, &http.Client{Timeout: time.Second}, StaticCredentials("wrong"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Token(context.Background()); Kind(err) != KindAuth {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+}
+
+func TestRefreshingCredentials_FailuresNeverPermanent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	r, err := NewRefreshingCredentials(ts.URL, &http.Client{Timeout: time.Second}, StaticCredentials("enrol"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Token(context.Background()); !IsRetryable(err) {
+		t.Fatalf("expected a retryable error for a 404, got %v", err)
+	}
+}
+
+func TestClient_RefreshesTokenOn401(t *testing.T) {
+	ts := newTokenServer(t, time.Hour)
+	r, err := NewRefreshingCredentials(ts.URL, &http.Client{Timeout: time.Second}, StaticCredentials("enrol"), "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(ts.URL, time.Second, "", WithCredentials(r), WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := []Connection{{ID: "a"}}
+	if _, err := c.PostConnections(context.Background(), conns); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend revokes the token; the next post fetches a new one and
+	// succeeds without going through the retry backoff.
+	ts.current.Store("revoked")
+	if _, err := c.PostConnections(context.Background(), conns); err != nil {
+		t.Fatalf("expected post to succeed after refresh, got %v", err)
+	}
+	if ts.issued.Load() != 2 {
+		t.Fatalf("expected 2 tokens issued, got %d", ts.issued.Load())
+	}
+}
+
+func TestClient_StaticToken401IsAuthError(t *testing.T) {
+	ts, calls := statusServer(t, nil, http.StatusUnauthorized)
+	c, err := NewClient(ts.URL, time.Second, "expired", WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+	if Kind(err) != KindAuth || calls.Load() != 1 {
+		t.Fatalf("expected one auth failure, got %v after %d calls", err, calls.Load())
+	}
+}
@@ -0,0 +1,103 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is an HTTP Content-Encoding applied to request bodies.
+type Encoding string
+
+const (
+	EncodingIdentity Encoding = "identity"
+	EncodingGzip     Encoding = "gzip"
+	EncodingZstd     Encoding = "zstd"
+)
+
+// ParseEncoding accepts "none"/"identity", "gzip" or "zstd".
+func ParseEncoding(s string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none", "identity":
+		return EncodingIdentity, nil
+	case "gzip":
+		return EncodingGzip, nil
+	case "zstd":
+		return EncodingZstd, nil
+	}
+	return "", fmt.Errorf("unsupported compression %q (expected none, gzip or zstd)", s)
+}
+
+// fallback is the encoding to try after the backend rejected e with 415.
+func (e Encoding) fallback() Encoding {
+	switch e {
+	case EncodingZstd:
+		return EncodingGzip
+	default:
+		return EncodingIdentity
+	}
+}
+
+// zstdEncoder is shared; EncodeAll is safe for concurrent use.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+// compressWriter is the streaming form of gzip and zstd.
+type compressWriter interface {
+	io.Writer
+	Flush() error
+	Reset(io.Writer)
+}
+
+// newCompressWriter returns a streaming compressor for enc writing to w, or
+// nil for the identity encoding.
+func newCompressWriter(enc Encoding, w io.Writer) compressWriter {
+	switch enc {
+	case EncodingGzip:
+		return gzip.NewWriter(w)
+	case EncodingZstd:
+		zw, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return zw
+	default:
+		return nil
+	}
+}
+
+func compress(enc Encoding, body []byte) ([]byte, error) {
+	switch enc {
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		return zstdEncoder.EncodeAll(body, make([]byte, 0, len(body)/4)), nil
+	default:
+		return body, nil
+	}
+}
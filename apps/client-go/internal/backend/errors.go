@@ -0,0 +1,142 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies a failed request by what the caller should do next.
+type ErrorKind int
+
+const (
+	// KindRetryable covers network failures, 408, 429 and 5xx responses.
+	KindRetryable ErrorKind = iota
+	// KindPermanent covers requests the backend will never accept as sent,
+	// such as 400, 413 and 422; retrying them is pointless.
+	KindPermanent
+	// KindAuth covers 401 and 403, which need new credentials.
+	KindAuth
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindRetryable:
+		return "retryable"
+	case KindPermanent:
+		return "permanent"
+	case KindAuth:
+		return "auth"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is wrapped by the RequestError returned while the circuit
+// breaker rejects requests after repeated backend failures.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// RequestError describes a request that did not get a 202 Accepted.
+type RequestError struct {
+	Kind ErrorKind
+	// StatusCode is 0 when no response was received.
+	StatusCode int
+	// RetryAfter is the delay requested by the backend (Retry-After) or,
+	// for ErrCircuitOpen, the time until the breaker lets a probe through.
+	RetryAfter time.Duration
+	Body       string
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("backend returned %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the classification of err, treating errors that did not come
+// from a backend request (such as encoding failures) as permanent.
+func Kind(err error) ErrorKind {
+	var re *RequestError
+	if errors.As(err, &re) {
+		return re.Kind
+	}
+	return KindPermanent
+}
+
+// IsRetryable reports whether err is worth retrying later.
+func IsRetryable(err error) bool {
+	return err != nil && Kind(err) == KindRetryable
+}
+
+// RetryAfter returns the backend-requested delay carried by err, if any.
+func RetryAfter(err error) time.Duration {
+	var re *RequestError
+	if errors.As(err, &re) {
+		return re.RetryAfter
+	}
+	return 0
+}
+
+func classifyStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return KindAuth
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return KindRetryable
+	case status >= 500 && status != http.StatusNotImplemented:
+		return KindRetryable
+	}
+	return KindPermanent
+}
+
+func statusError(status int, header http.Header, body []byte) *RequestError {
+	return &RequestError{
+		Kind:       classifyStatus(status),
+		StatusCode: status,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After"), time.Now()),
+		Body:       string(body),
+	}
+}
+
+// parseRetryAfter accepts delay-seconds or an HTTP-date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Health is the backend's answer to GET /health.
+type Health struct {
+	OK bool `json:"ok"`
+
+	// Date is the response's Date header, zero if it had none. RTT is the
+	// time the request took and TLS is nil for plain HTTP.
+	Date time.Time            `json:"-"`
+	RTT  time.Duration        `json:"-"`
+	TLS  *tls.ConnectionState `json:"-"`
+}
+
+// Health requests /health once, without credentials or retries.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL.ResolveReference(&url.URL{Path: "/health"}).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Health{RTT: time.Since(start), TLS: resp.TLS}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		h.Date = date
+	}
+	if resp.StatusCode != http.StatusOK {
+		return h, fmt.Errorf("health: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, h); err != nil {
+		return h, fmt.Errorf("health: %w", err)
+	}
+	return h, nil
+}
+
+// TokenClaims is what the agent reads from a bearer token. The signature is
+// not checked; only the backend can do that.
+type TokenClaims struct {
+	TenantID string
+	Expires  time.Time // zero without an exp claim
+}
+
+// DecodeToken reads the claims of a JWT bearer token, reporting false for
+// tokens that are not JWTs.
+func DecodeToken(token string) (TokenClaims, bool) {
+	if _, ok := decodeTokenClaims(token); !ok {
+		return TokenClaims{}, false
+	}
+	return TokenClaims{TenantID: extractTenantIDFromToken(token), Expires: tokenExpiry(token)}, true
+}
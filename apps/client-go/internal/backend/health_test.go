@@ -0,0 +1,77 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Health(t *testing.T) {
+	date := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Date", date.Format(http.TimeFormat))
+		_, _ = w.Write([]byte(`{"ok":true,"mongo":{"readyState":1}}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, time.Second, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := c.Health(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.OK || !h.Date.Equal(date) || h.TLS != nil {
+		t.Fatalf("unexpected health %+v", h)
+	}
+}
+
+func TestClient_Health_Non200(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, time.Second, "")
+	h, err := c.Health(context.Background())
+	if err == nil {
+		t.Fatal("expected error for 503")
+	}
+	if h == nil || h.Date.IsZero() {
+		t.Fatalf("expected the Date header to be read from an error response, got %+v", h)
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	exp := time.Unix(1_900_000_000, 0)
+	claims, ok := DecodeToken(testToken(t, "tenant-a", exp))
+	if !ok || claims.TenantID != "tenant-a" || !claims.Expires.Equal(exp) {
+		t.Fatalf("unexpected claims %+v (%v)", claims, ok)
+	}
+	if _, ok := DecodeToken("opaque-token"); ok {
+		t.Fatal("expected an opaque token not to decode")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries retryable failures within a
+// single Post call.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts per call, including the first; values
+	// below 1 mean a single attempt.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the full-jitter exponential backoff: the
+	// n-th retry sleeps a random duration in [0, min(MaxDelay, BaseDelay*2^n)).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerThreshold consecutive retryable failures open the circuit for
+	// BreakerCooldown; afterwards a single probe request decides whether it
+	// closes again. A threshold of 0 disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Each endpoint holds a retry budget of BudgetTokens; a retryable failure
+	// spends one token and a success earns BudgetRatio back. Retries are only
+	// made while more than half the budget is left, so a failing backend sees
+	// roughly first attempts only.
+	BudgetTokens float64
+	BudgetRatio  float64
+}
+
+// DefaultRetryPolicy is used unless WithRetryPolicy is given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      3,
+	BaseDelay:        250 * time.Millisecond,
+	MaxDelay:         10 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+	BudgetTokens:     10,
+	BudgetRatio:      0.1,
+}
+
+// Backoff returns the full-jitter delay before retry number attempt
+// (starting at 0), never shorter than retryAfter.
+func (p RetryPolicy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	return p.backoff(attempt, retryAfter, rand.Int64N)
+}
+
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration, randN func(int64) int64) time.Duration {
+	ceiling := p.MaxDelay
+	if p.BaseDelay > 0 && attempt < 32 {
+		if d := p.BaseDelay << attempt; d > 0 && (ceiling <= 0 || d < ceiling) {
+			ceiling = d
+		}
+	}
+	var d time.Duration
+	if ceiling > 0 {
+		d = time.Duration(randN(int64(ceiling)))
+	}
+	return max(d, retryAfter)
+}
+
+// retryBudget is a token bucket limiting retries per endpoint.
+type retryBudget struct {
+	tokens, max, ratio float64
+}
+
+func newRetryBudget(p RetryPolicy) *retryBudget {
+	return &retryBudget{tokens: p.BudgetTokens, max: p.BudgetTokens, ratio: p.BudgetRatio}
+}
+
+func (b *retryBudget) record(failed bool) {
+	if failed {
+		b.tokens = max(0, b.tokens-1)
+	} else {
+		b.tokens = min(b.max, b.tokens+b.ratio)
+	}
+}
+
+func (b *retryBudget) canRetry() bool {
+	return b.max <= 0 || b.tokens > b.max/2
+}
+
+// breaker is a consecutive-failure circuit breaker shared by all endpoints
+// of a Client, since they are served by the same backend.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow reports whether a request may be sent now, and otherwise how long
+// until the breaker will let a probe through.
+func (b *breaker) allow(now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return 0, true
+	}
+	if now.Before(b.openUntil) {
+		return b.openUntil.Sub(now), false
+	}
+	if b.probing {
+		return b.cooldown, false
+	}
+	b.probing = true
+	return 0, true
+}
+
+func (b *breaker) record(now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetry retries immediately so tests do not sleep.
+var fastRetry = RetryPolicy{MaxAttempts: 3, BudgetTokens: 10, BudgetRatio: 0.1}
+
+// statusServer answers with statuses in order, repeating the last one.
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		status := statuses[min(n, len(statuses)-1)]
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		if status == http.StatusAccepted {
+			_, _ = w.Write([]byte(`{"received":1,"status":"processing"}`))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+func TestClassifyStatus(t *testing.T) {
+	for status, want := range map[int]ErrorKind{
+		400: KindPermanent,
+		401: KindAuth,
+		403: KindAuth,
+		404: KindPermanent,
+		408: KindRetryable,
+		413: KindPermanent,
+		422: KindPermanent,
+		429: KindRetryable,
+		500: KindRetryable,
+		501: KindPermanent,
+		502: KindRetryable,
+		503: KindRetryable,
+	} {
+		if got := classifyStatus(status); got != want {
+			t.Errorf("classifyStatus(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Fri, 02 Jan 2026 03:04:35 GMT": 30 * time.Second,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+	}
+	for in, want := range cases {
+		if got := parseRetryAfter(in, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestRetryPolicy_FullJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	var ceilings []int64
+	randN := func(n int64) int64 {
+		ceilings = append(ceilings, n)
+		return n - 1
+	}
+
+	for attempt := range 6 {
+		p.backoff(attempt, 0, randN)
+	}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, got := range ceilings {
+		if time.Duration(got) != want[i]*time.Millisecond {
+			t.Errorf("attempt %d: ceiling %v, want %v", i, time.Duration(got), want[i]*time.Millisecond)
+		}
+	}
+
+	// Retry-After is a floor for the jittered delay.
+	zero := func(int64) int64 { return 0 }
+	if got := p.backoff(0, 3*time.Second, zero); got != 3*time.Second {
+		t.Errorf("expected Retry-After to win, got %v", got)
+	}
+}
+
+func TestClient_RetriesRetryableStatus(t *testing.T) {
+	ts, calls := statusServer(t, nil, 503, 502, 202)
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithRetryPolicy(fastRetry))
+	if _, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}}); err != nil {
+		t.Fatalf("PostConnections: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestClient_DoesNotRetryPermanentOrAuth(t *testing.T) {
+	for status, kind := range map[int]ErrorKind{400: KindPermanent, 422: KindPermanent, 401: KindAuth} {
+		ts, calls := statusServer(t, nil, status)
+
+		c, _ := NewClient(ts.URL, 2*time.Second, "", WithRetryPolicy(fastRetry))
+		_, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+
+		var re *RequestError
+		if !errors.As(err, &re) || re.Kind != kind || re.StatusCode != status {
+			t.Fatalf("status %d: expected %s RequestError, got %v", status, kind, err)
+		}
+		if Kind(err) != kind || IsRetryable(err) {
+			t.Fatalf("status %d: Kind = %s, IsRetryable = %v", status, Kind(err), IsRetryable(err))
+		}
+		if calls.Load() != 1 {
+			t.Fatalf("status %d: expected a single attempt, got %d", status, calls.Load())
+		}
+	}
+}
+
+func TestClient_LongRetryAfterIsLeftToCaller(t *testing.T) {
+	ts, calls := statusServer(t, http.Header{"Retry-After": {"120"}}, 429)
+
+	p := fastRetry
+	p.MaxDelay = time.Second
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithRetryPolicy(p))
+	_, err := c.PostMetrics(context.Background(), []MetricsSnapshot{{}})
+
+	if !IsRetryable(err) || RetryAfter(err) != 2*time.Minute {
+		t.Fatalf("expected retryable error with Retry-After 2m, got %v (%v)", err, RetryAfter(err))
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected no in-call retry past MaxDelay, got %d attempts", calls.Load())
+	}
+}
+
+func TestClient_NetworkErrorIsRetryable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	c, _ := NewClient(url, time.Second, "", WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	_, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+	if !IsRetryable(err) {
+		t.Fatalf("expected retryable network error, got %v", err)
+	}
+}
+
+func TestClient_CircuitBreakerOpensAndProbes(t *testing.T) {
+	ts, calls := statusServer(t, nil, 503, 503, 202)
+
+	p := RetryPolicy{MaxAttempts: 1, BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithRetryPolicy(p))
+	post := func() error {
+		_, err := c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+		return err
+	}
+
+	_ = post()
+	_ = post()
+	err := post()
+	if !errors.Is(err, ErrCircuitOpen) || !IsRetryable(err) || RetryAfter(err) <= 0 {
+		t.Fatalf("expected open circuit with a retry delay, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected the open circuit to block requests, got %d calls", calls.Load())
+	}
+
+	// After the cooldown a single probe goes through and closes the circuit.
+	c.breaker.openUntil = time.Now().Add(-time.Second)
+	if err := post(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := post(); err != nil || calls.Load() != 4 {
+		t.Fatalf("expected closed circuit after successful probe, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestClient_RetryBudgetIsPerEndpoint(t *testing.T) {
+	ts, calls := statusServer(t, nil, 503)
+
+	p := RetryPolicy{MaxAttempts: 10, BudgetTokens: 4, BudgetRatio: 0.1}
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithRetryPolicy(p))
+
+	// Failures drain the connections budget to half after two attempts.
+	_, _ = c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+	if calls.Load() != 2 {
+		t.Fatalf("expected the budget to stop retries after 2 attempts, got %d", calls.Load())
+	}
+	_, _ = c.PostConnections(context.Background(), []Connection{{ID: "a"}})
+	if calls.Load() != 3 {
+		t.Fatalf("expected no retries with an exhausted budget, got %d calls", calls.Load())
+	}
+
+	// The metrics endpoint has its own budget.
+	_, _ = c.PostMetrics(context.Background(), []MetricsSnapshot{{}})
+	if calls.Load() != 5 {
+		t.Fatalf("expected metrics to retry on its own budget, got %d calls", calls.Load())
+	}
+}
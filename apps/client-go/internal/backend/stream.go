@@ -0,0 +1,303 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamUnavailable is returned by Stream.Send while no stream is
+// connected; callers send the batch with PostBatch instead.
+var ErrStreamUnavailable = errors.New("stream not connected")
+
+// ErrStreamUnsupported is returned by Stream.Run when the backend has no
+// stream endpoint.
+var ErrStreamUnsupported = errors.New("backend does not support streaming")
+
+// errStreamClosed fails the batches in flight when a stream drops.
+var errStreamClosed = errors.New("stream closed before the batch was acknowledged")
+
+// streamPingInterval is how often the client pings an idle stream; a
+// stream silent for two intervals is considered dead and reconnected.
+const streamPingInterval = 30 * time.Second
+
+// streamReply is the backend's answer to one streamed batch.
+type streamReply struct {
+	Type      string `json:"type"` // "ack" or "nack"
+	BatchID   string `json:"batchId"`
+	Received  int    `json:"received"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	Retryable bool   `json:"retryable"`
+}
+
+// Stream keeps one WebSocket to /api/stream open and sends connection
+// batches over it, each acknowledged individually. Messages are the JSON
+// body PostBatch would send, so the backend deduplicates them by batchId
+// the same way.
+type Stream struct {
+	c          *Client
+	hc         *http.Client
+	ackTimeout time.Duration
+	// OnConnect and OnDisconnect, when set, are called when a stream is
+	// established and when an established stream drops.
+	OnConnect    func()
+	OnDisconnect func(error)
+
+	mu      sync.Mutex
+	conn    *wsConn
+	waiters map[string]chan streamReply
+}
+
+// NewStream returns a stream that shares the client's credentials and
+// transport. The client's timeout bounds the handshake and each ack. Call
+// Run to connect it.
+func (c *Client) NewStream() *Stream {
+	ackTimeout := c.hc.Timeout
+	if ackTimeout <= 0 {
+		ackTimeout = 30 * time.Second
+	}
+	return &Stream{
+		c:          c,
+		hc:         &http.Client{Transport: c.hc.Transport},
+		ackTimeout: ackTimeout,
+		waiters:    map[string]chan streamReply{},
+	}
+}
+
+// Connected reports whether a stream is currently open.
+func (s *Stream) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil
+}
+
+// Run connects the stream and reconnects it with backoff until ctx is
+// done. It returns ErrStreamUnsupported if the backend answers 404.
+func (s *Stream) Run(ctx context.Context) error {
+	failures := 0
+	for {
+		conn, cancel, err := s.dial(ctx)
+		if errors.Is(err, ErrStreamUnsupported) {
+			return err
+		}
+		if err == nil {
+			failures = 0
+			err = s.serve(ctx, conn)
+			cancel()
+			if ctx.Err() == nil && s.OnDisconnect != nil {
+				s.OnDisconnect(err)
+			}
+		} else {
+			failures++
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		timer := time.NewTimer(s.c.retry.Backoff(failures, RetryAfter(err)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// dial performs the upgrade, renewing the token once on 401. The returned
+// cancel func releases the connection's context and must be called once
+// the connection is done.
+func (s *Stream) dial(ctx context.Context) (*wsConn, context.CancelFunc, error) {
+	endpoint := s.c.baseURL.ResolveReference(&url.URL{Path: "/api/stream"}).String()
+
+	renewed := false
+	for {
+		token, err := s.c.credentials.Token(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		req := &http.Request{Header: http.Header{}}
+		s.c.applyAuth(req, token)
+
+		// Only the handshake is bounded; the connection lives on with ctx.
+		connCtx, cancel := context.WithCancel(ctx)
+		timer := time.AfterFunc(s.ackTimeout, cancel)
+		conn, resp, err := dialWebSocket(connCtx, s.hc, endpoint, req.Header)
+		if !timer.Stop() && err != nil {
+			err = fmt.Errorf("stream handshake timed out: %w", err)
+		}
+		if conn != nil {
+			return conn, cancel, nil
+		}
+		cancel()
+		if err != nil {
+			return nil, nil, &RequestError{Kind: KindRetryable, Err: err}
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && !renewed:
+			renewed = true
+			if s.c.credentials.Invalidate(token) {
+				continue
+			}
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, nil, ErrStreamUnsupported
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, statusError(resp.StatusCode, resp.Header, body)
+	}
+}
+
+// serve publishes conn and reads replies until the connection fails.
+func (s *Stream) serve(ctx context.Context, conn *wsConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	if s.OnConnect != nil {
+		s.OnConnect()
+	}
+
+	var lastRead atomic.Int64
+	lastRead.Store(time.Now().UnixNano())
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(streamPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastRead.Load())) > 2*streamPingInterval {
+					conn.rw.Close()
+					return
+				}
+				_ = conn.WriteMessage(opPing, nil)
+			}
+		}
+	}()
+
+	conn.onFrame = func() { lastRead.Store(time.Now().UnixNano()) }
+	err := s.readReplies(conn)
+
+	s.mu.Lock()
+	s.conn = nil
+	for id, ch := range s.waiters {
+		ch <- streamReply{Type: "closed"}
+		delete(s.waiters, id)
+	}
+	s.mu.Unlock()
+	conn.rw.Close()
+	return err
+}
+
+func (s *Stream) readReplies(conn *wsConn) error {
+	for {
+		op, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if op != opText {
+			continue
+		}
+		var reply streamReply
+		if err := json.Unmarshal(msg, &reply); err != nil || reply.BatchID == "" {
+			continue
+		}
+		s.mu.Lock()
+		if ch, ok := s.waiters[reply.BatchID]; ok {
+			ch <- reply
+			delete(s.waiters, reply.BatchID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Send streams the connections collected in b and waits for the backend to
+// acknowledge them. A nack is returned as a *RequestError whose kind says
+// whether the batch may be sent again; a dropped stream or a missing ack
+// is retryable.
+func (s *Stream) Send(ctx context.Context, b *BatchBuilder) (*AcceptedResponse, error) {
+	batch, err := b.batchInfo(s.c)
+	if err != nil {
+		return nil, err
+	}
+	body, err := b.Body(WireJSON, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan streamReply, 1)
+	s.mu.Lock()
+	conn := s.conn
+	if conn != nil {
+		s.waiters[batch.ID] = ch
+	}
+	s.mu.Unlock()
+	if conn == nil {
+		return nil, ErrStreamUnavailable
+	}
+	forget := func() {
+		s.mu.Lock()
+		delete(s.waiters, batch.ID)
+		s.mu.Unlock()
+	}
+
+	if err := conn.WriteMessage(opText, body); err != nil {
+		forget()
+		conn.rw.Close()
+		return nil, &RequestError{Kind: KindRetryable, Err: err}
+	}
+
+	timer := time.NewTimer(s.ackTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-ch:
+		switch reply.Type {
+		case "ack":
+			return &AcceptedResponse{Received: reply.Received, Status: reply.Status}, nil
+		case "nack":
+			kind := KindPermanent
+			if reply.Retryable {
+				kind = KindRetryable
+			}
+			return nil, &RequestError{Kind: kind, Err: fmt.Errorf("stream nack: %s", reply.Error)}
+		}
+		return nil, &RequestError{Kind: KindRetryable, Err: errStreamClosed}
+	case <-timer.C:
+		forget()
+		return nil, &RequestError{Kind: KindRetryable, Err: fmt.Errorf("no ack within %s", s.ackTimeout)}
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	}
+}
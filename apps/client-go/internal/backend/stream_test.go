@@ -0,0 +1,221 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// streamServer answers /api/stream upgrades and hands each connection to
+// serve.
+func streamServer(t *testing.T, serve func(n int, conn *wsConn, r *http.Request)) *httptest.Server {
+	t.Helper()
+	var conns atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stream" || r.Header.Get("Upgrade") != "websocket" {
+			http.NotFound(w, r)
+			return
+		}
+		netConn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		brw.Flush()
+		conn := newWSConn(netConn, brw.Reader, false)
+		defer conn.rw.Close()
+		serve(int(conns.Add(1)), conn, r)
+	}))
+}
+
+// readBatch reads one streamed batch. A read error, normally the client
+// going away at the end of a test, yields an empty payload.
+func readBatch(t *testing.T, conn *wsConn) ConnectionsPayload {
+	t.Helper()
+	op, msg, err := conn.ReadMessage()
+	if err != nil {
+		return ConnectionsPayload{}
+	}
+	if op != opText {
+		t.Errorf("expected a text message, got opcode %d", op)
+	}
+	var p ConnectionsPayload
+	if err := json.Unmarshal(msg, &p); err != nil {
+		t.Errorf("decode: %v", err)
+	}
+	return p
+}
+
+func reply(conn *wsConn, r streamReply) {
+	msg, _ := json.Marshal(r)
+	conn.WriteMessage(opText, msg)
+}
+
+func startStream(t *testing.T, url string) (*Stream, chan error) {
+	t.Helper()
+	policy := DefaultRetryPolicy
+	policy.BaseDelay, policy.MaxDelay = time.Millisecond, 10*time.Millisecond
+	c, err := NewClient(url, 2*time.Second, testToken(t, "tenant-a", time.Now().Add(time.Hour)), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.NewStream()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, done
+}
+
+func waitConnected(t *testing.T, s *Stream) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("stream did not connect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func batchOf(t *testing.T, ids ...string) *BatchBuilder {
+	t.Helper()
+	b := &BatchBuilder{format: WireJSON}
+	for _, id := range ids {
+		if _, err := b.Add(Connection{ID: id, SourceIP: "10.0.0.1", DestIP: "1.1.1.1", Protocol: "TCP"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestStream_AcksEachBatch(t *testing.T) {
+	var auth, tenant string
+	ts := streamServer(t, func(_ int, conn *wsConn, r *http.Request) {
+		auth, tenant = r.Header.Get("Authorization"), r.Header.Get("X-Tenant-Id")
+		for {
+			p := readBatch(t, conn)
+			if p.BatchID == "" {
+				return
+			}
+			reply(conn, streamReply{Type: "ack", BatchID: p.BatchID, Received: len(p.Connections), Status: "processing"})
+		}
+	})
+	defer ts.Close()
+
+	s, _ := startStream(t, ts.URL)
+	waitConnected(t, s)
+
+	for i := 0; i < 3; i++ {
+		accepted, err := s.Send(context.Background(), batchOf(t, "a", "b"))
+		if err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		if accepted.Received != 2 || accepted.Status != "processing" {
+			t.Fatalf("unexpected ack %+v", accepted)
+		}
+	}
+	if auth == "" || tenant != "tenant-a" {
+		t.Fatalf("expected auth and tenant headers on the upgrade, got %q / %q", auth, tenant)
+	}
+}
+
+func TestStream_NackKinds(t *testing.T) {
+	ts := streamServer(t, func(_ int, conn *wsConn, _ *http.Request) {
+		p := readBatch(t, conn)
+		reply(conn, streamReply{Type: "nack", BatchID: p.BatchID, Error: "invalid payload"})
+		p = readBatch(t, conn)
+		reply(conn, streamReply{Type: "nack", BatchID: p.BatchID, Error: "storage unavailable", Retryable: true})
+		conn.ReadMessage()
+	})
+	defer ts.Close()
+
+	s, _ := startStream(t, ts.URL)
+	waitConnected(t, s)
+
+	if _, err := s.Send(context.Background(), batchOf(t, "a")); Kind(err) != KindPermanent {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if _, err := s.Send(context.Background(), batchOf(t, "a")); Kind(err) != KindRetryable {
+		t.Fatalf("expected a retryable error, got %v", err)
+	}
+}
+
+func TestStream_ReconnectsAfterDrop(t *testing.T) {
+	ts := streamServer(t, func(n int, conn *wsConn, _ *http.Request) {
+		p := readBatch(t, conn)
+		if n == 1 {
+			// Drop the first connection with the batch in flight.
+			return
+		}
+		reply(conn, streamReply{Type: "ack", BatchID: p.BatchID, Received: len(p.Connections)})
+		conn.ReadMessage()
+	})
+	defer ts.Close()
+
+	s, _ := startStream(t, ts.URL)
+	waitConnected(t, s)
+
+	_, err := s.Send(context.Background(), batchOf(t, "a"))
+	if !IsRetryable(err) {
+		t.Fatalf("expected a retryable error for the dropped batch, got %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := s.Send(context.Background(), batchOf(t, "a"))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream did not recover: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStream_UnsupportedBackend(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	s, done := startStream(t, ts.URL)
+	select {
+	case err := <-done:
+		done <- err // for the cleanup
+		if !errors.Is(err, ErrStreamUnsupported) {
+			t.Fatalf("expected ErrStreamUnsupported, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not give up on a backend without a stream endpoint")
+	}
+	if _, err := s.Send(context.Background(), batchOf(t, "a")); !errors.Is(err, ErrStreamUnavailable) {
+		t.Fatalf("expected ErrStreamUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportConfig describes how connections to the backend are made.
+type TransportConfig struct {
+	// CAFile is a PEM bundle that replaces the system roots.
+	CAFile string
+	// CertFile and KeyFile hold a PEM client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" (the default) or "1.3".
+	MinVersion string
+	// ServerName overrides the name sent in SNI and checked against the
+	// server certificate.
+	ServerName string
+	// PinnedSPKI lists base64 SHA-256 hashes of SubjectPublicKeyInfo, with
+	// or without a "sha256/" prefix. When set, one of them must match a
+	// certificate in the verified chain.
+	PinnedSPKI []string
+
+	// Proxy is an http, https or socks5 URL, credentials included. When
+	// empty, HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the environment apply.
+	Proxy string
+	// NoProxy lists hosts reached directly despite Proxy, in NO_PROXY
+	// syntax.
+	NoProxy string
+
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// TCPKeepAlive is the keep-alive probe period; negative disables probes.
+	TCPKeepAlive time.Duration
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+}
+
+// NewTransport builds an http.Transport from tc.
+func NewTransport(tc TransportConfig) (*http.Transport, error) {
+	tlsConfig, err := tc.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if tc.Proxy != "" {
+		if proxy, err = proxyFunc(tc.Proxy, tc.NoProxy); err != nil {
+			return nil, err
+		}
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxy
+	t.TLSClientConfig = tlsConfig
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: tc.TCPKeepAlive}).DialContext
+	t.DisableKeepAlives = tc.DisableKeepAlives
+	if tc.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+	}
+	if tc.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = tc.IdleConnTimeout
+	}
+	return t, nil
+}
+
+func (tc TransportConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: tc.ServerName}
+	switch tc.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS version %q", tc.MinVersion)
+	}
+
+	if tc.CAFile != "" {
+		pem, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA bundle %s", tc.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(tc.PinnedSPKI) > 0 {
+		pins := make([][]byte, 0, len(tc.PinnedSPKI))
+		for _, p := range tc.PinnedSPKI {
+			pin, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(p, "sha256/"))
+			if err != nil || len(pin) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI pin %q (expected base64 SHA-256)", p)
+			}
+			pins = append(pins, pin)
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(cs.VerifiedChains, pins)
+		}
+	}
+	return cfg, nil
+}
+
+// errPinMismatch is returned by the TLS handshake when no certificate in
+// the verified chain matches a configured pin.
+var errPinMismatch = errors.New("server certificate chain does not match any pinned key")
+
+func checkPins(chains [][]*x509.Certificate, pins [][]byte) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return errPinMismatch
+}
+
+// proxyFunc routes every request through proxyURL except those whose host
+// matches noProxy.
+func proxyFunc(proxyURL, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q (expected http, https or socks5)", proxyURL)
+	}
+	bypass := parseNoProxy(noProxy)
+	return func(req *http.Request) (*url.URL, error) {
+		if bypass.match(req.URL) {
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+// noProxy holds parsed NO_PROXY entries. As with the standard library's
+// environment handling, "*" bypasses everything, IP and CIDR entries match
+// addresses, "example.com" matches the domain and its subdomains,
+// ".example.com" only subdomains, and an entry may name a port. Loopback
+// hosts are never proxied.
+type noProxy struct {
+	all      bool
+	nets     []*net.IPNet
+	ips      []noProxyEntry
+	suffixes []noProxyEntry
+}
+
+type noProxyEntry struct {
+	host string
+	port string
+	ip   net.IP
+	// exact is false for ".example.com" entries, which skip the bare
+	// domain.
+	exact bool
+}
+
+func parseNoProxy(s string) noProxy {
+	var np noProxy
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			np.all = true
+			continue
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			np.nets = append(np.nets, n)
+			continue
+		}
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+			np.ips = append(np.ips, noProxyEntry{ip: ip, port: port})
+			continue
+		}
+		exact := !strings.HasPrefix(host, ".")
+		np.suffixes = append(np.suffixes, noProxyEntry{host: strings.TrimPrefix(host, "."), port: port, exact: exact})
+	}
+	return np
+}
+
+func (np noProxy) match(u *url.URL) bool {
+	if np.all {
+		return true
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return true
+		}
+		for _, n := range np.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		for _, e := range np.ips {
+			if e.ip.Equal(ip) && (e.port == "" || e.port == port) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range np.suffixes {
+		if e.port != "" && e.port != port {
+			continue
+		}
+		if strings.HasSuffix(host, "."+e.host) || (e.exact && host == e.host) {
+			return true
+		}
+	}
+	return false
+}
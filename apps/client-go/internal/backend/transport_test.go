@@ -0,0 +1,200 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, name, kind string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clientCertificate writes a self-signed client certificate and its key.
+func clientCertificate(t *testing.T) (cert *x509.Certificate, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	return cert, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "PRIVATE KEY", keyDER)
+}
+
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func get(t *testing.T, tc TransportConfig, target string) error {
+	t.Helper()
+	tr, err := NewTransport(tc)
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+	defer tr.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get(target)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestNewTransport_MutualTLS(t *testing.T) {
+	clientCert, certFile, keyFile := clientCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	if err := get(t, TransportConfig{}, ts.URL); err == nil {
+		t.Fatal("expected the system roots to reject the test server")
+	}
+	if err := get(t, TransportConfig{CAFile: caFile}, ts.URL); err == nil {
+		t.Fatal("expected the server to require a client certificate")
+	}
+	if err := get(t, TransportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, ts.URL); err != nil {
+		t.Fatalf("mutual TLS: %v", err)
+	}
+}
+
+func TestNewTransport_ServerNameAndPins(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+	other, _, _ := clientCertificate(t)
+
+	// The httptest certificate is issued for example.com.
+	if err := get(t, TransportConfig{CAFile: caFile, ServerName: "example.com"}, ts.URL); err != nil {
+		t.Fatalf("server name override: %v", err)
+	}
+	if err := get(t, TransportConfig{CAFile: caFile, ServerName: "backend.test"}, ts.URL); err == nil {
+		t.Fatal("expected a name mismatch")
+	}
+
+	if err := get(t, TransportConfig{CAFile: caFile, PinnedSPKI: []string{spkiPin(other), spkiPin(ts.Certificate())}}, ts.URL); err != nil {
+		t.Fatalf("matching pin: %v", err)
+	}
+	err := get(t, TransportConfig{CAFile: caFile, PinnedSPKI: []string{spkiPin(other)}}, ts.URL)
+	if !errors.Is(err, errPinMismatch) {
+		t.Fatalf("expected pin mismatch, got %v", err)
+	}
+
+	if _, err := NewTransport(TransportConfig{PinnedSPKI: []string{"not-a-pin"}}); err == nil {
+		t.Fatal("expected an invalid pin to be rejected")
+	}
+	if _, err := NewTransport(TransportConfig{MinVersion: "1.1"}); err == nil {
+		t.Fatal("expected TLS 1.1 to be rejected")
+	}
+}
+
+func TestNewTransport_Proxy(t *testing.T) {
+	var gotURL, gotAuth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("agent", "secret")
+
+	if err := get(t, TransportConfig{Proxy: proxyURL.String(), NoProxy: "internal.test"}, "http://backend.test/api/connections"); err != nil {
+		t.Fatal(err)
+	}
+	if gotURL != "http://backend.test/api/connections" {
+		t.Fatalf("proxy saw %q", gotURL)
+	}
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("agent:secret")); gotAuth != want {
+		t.Fatalf("Proxy-Authorization = %q, want %q", gotAuth, want)
+	}
+
+	if _, err := NewTransport(TransportConfig{Proxy: "ftp://proxy.test"}); err == nil {
+		t.Fatal("expected an unsupported proxy scheme to be rejected")
+	}
+}
+
+func TestNoProxy_Match(t *testing.T) {
+	np := parseNoProxy("example.com, .internal.test, 10.0.0.0/8, 192.168.1.5, api.test:8443")
+	cases := map[string]bool{
+		"https://example.com/":          true,
+		"https://a.example.com/":        true,
+		"https://badexample.com/":       false,
+		"https://internal.test/":        false,
+		"https://db.internal.test/":     true,
+		"http://10.1.2.3/":              true,
+		"http://11.1.2.3/":              false,
+		"http://192.168.1.5:4000/":      true,
+		"https://api.test:8443/":        true,
+		"https://api.test/":             false,
+		"http://localhost:4000/":        true,
+		"http://127.0.0.1:4000/":        true,
+		"https://backend.byteroute.io/": false,
+	}
+	for raw, want := range cases {
+		u, _ := url.Parse(raw)
+		if got := np.match(u); got != want {
+			t.Errorf("match(%s) = %v, want %v", raw, got, want)
+		}
+	}
+	if u, _ := url.Parse("https://anything.test/"); !parseNoProxy("*").match(u) {
+		t.Error("* should bypass every host")
+	}
+}
@@ -28,6 +28,20 @@ type Connection struct {
 	Protocol   string `json:"protocol"`
 	Status     string `json:"status"`
 
+	// ConversationID is the same for every record of a flow key, across
+	// the separate flows (epochs) that reuse it; ID is unique per epoch.
+	ConversationID string `json:"conversationId,omitempty"`
+
+	// Direction is "out" when the local endpoint (SourceIP) sent the flow's
+	// first packet and "in" when the remote endpoint did. It is empty when
+	// neither or both endpoints are local.
+	Direction string `json:"direction,omitempty"`
+
+	// SamplingRate is N when the flow's packets were captured 1-in-N on
+	// average; byte and packet counters are already scaled up by it. It is
+	// zero when every packet was captured.
+	SamplingRate int `json:"samplingRate,omitempty"`
+
 	Country     *string  `json:"country,omitempty"`
 	CountryCode *string  `json:"countryCode,omitempty"`
 	City        *string  `json:"city,omitempty"`
@@ -46,10 +60,31 @@ type Connection struct {
 	StartTime    string `json:"startTime"`
 	LastActivity string `json:"lastActivity"`
 	DurationMs   *int64 `json:"duration,omitempty"`
+
+	// Per-interval counters: traffic observed between IntervalStart and
+	// IntervalEnd, i.e. since the previous acknowledged export of this flow.
+	// BytesIn/BytesOut/PacketsIn/PacketsOut above stay cumulative.
+	IntervalStart   string `json:"intervalStart,omitempty"`
+	IntervalEnd     string `json:"intervalEnd,omitempty"`
+	DeltaBytesIn    *int64 `json:"deltaBytesIn,omitempty"`
+	DeltaBytesOut   *int64 `json:"deltaBytesOut,omitempty"`
+	DeltaPacketsIn  *int64 `json:"deltaPacketsIn,omitempty"`
+	DeltaPacketsOut *int64 `json:"deltaPacketsOut,omitempty"`
 }
 
 type ConnectionsPayload struct {
 	Connections []Connection `json:"connections"`
+
+	BatchID  string `json:"batchId,omitempty"`
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// BatchInfo identifies one request payload. The backend deduplicates
+// requests by ID, which is also sent as the Idempotency-Key header; Sequence
+// increases per agent across restarts.
+type BatchInfo struct {
+	ID       string
+	Sequence uint64
 }
 
 // MetricsSnapshot represents aggregated interface metrics for a time period
@@ -59,10 +94,74 @@ type MetricsSnapshot struct {
 	BandwidthIn  int64  `json:"bandwidthIn"`
 	BandwidthOut int64  `json:"bandwidthOut"`
 	Inactive     int    `json:"inactive"`
+
+	EndTime     string                           `json:"endTime,omitempty"`
+	PacketsIn   int64                            `json:"packetsIn,omitempty"`
+	PacketsOut  int64                            `json:"packetsOut,omitempty"`
+	RateIn      float64                          `json:"rateIn,omitempty"`
+	RateOut     float64                          `json:"rateOut,omitempty"`
+	PeakRateIn  int64                            `json:"peakRateIn,omitempty"`
+	PeakRateOut int64                            `json:"peakRateOut,omitempty"`
+	Protocols   map[string]MetricsProtocolTotals `json:"protocols,omitempty"`
+
+	// Distributions of per-second samples within the period, and a fixed
+	// bucket packet size histogram: PacketSizes[i] counts packets of at most
+	// PacketSizeBounds[i] bytes, the final entry counts larger packets.
+	ThroughputIn     *RateSummary `json:"throughputIn,omitempty"`
+	ThroughputOut    *RateSummary `json:"throughputOut,omitempty"`
+	NewConnections   int64        `json:"newConnections,omitempty"`
+	NewConnsPerSec   *RateSummary `json:"newConnsPerSec,omitempty"`
+	PacketSizeBounds []int        `json:"packetSizeBounds,omitempty"`
+	PacketSizes      []int64      `json:"packetSizes,omitempty"`
+
+	OversizeRecords int64 `json:"oversizeRecords,omitempty"`
+
+	// SamplingRate is the average 1-in-N packet sampling rate of the
+	// period, zero when every packet was captured.
+	SamplingRate int `json:"samplingRate,omitempty"`
+
+	// Capture counts packets lost before they were counted; any drops mean
+	// the period's figures are incomplete.
+	Capture *CaptureStats `json:"capture,omitempty"`
+}
+
+// CaptureStats describes the health of the agent's packet capture over a
+// period. Policy is the capture channel's overflow policy: "block", "drop"
+// or "sample". ChannelDrops were dropped by the agent because its channel
+// was full, KernelDrops and IfDrops by the kernel and the interface.
+// QueuePeak is the channel's highest fill as a fraction of its capacity.
+type CaptureStats struct {
+	Policy       string  `json:"policy"`
+	Received     int64   `json:"received"`
+	ChannelDrops int64   `json:"channelDrops"`
+	KernelDrops  int64   `json:"kernelDrops"`
+	IfDrops      int64   `json:"ifDrops"`
+	QueuePeak    float64 `json:"queuePeak"`
+}
+
+// RateSummary is a compact min/mean/percentile/max summary of per-second samples
+type RateSummary struct {
+	Min  int64   `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  int64   `json:"p50"`
+	P95  int64   `json:"p95"`
+	P99  int64   `json:"p99"`
+	Max  int64   `json:"max"`
+}
+
+// MetricsProtocolTotals holds per-protocol packet-level counters for a period
+type MetricsProtocolTotals struct {
+	BytesIn    int64 `json:"bytesIn"`
+	BytesOut   int64 `json:"bytesOut"`
+	PacketsIn  int64 `json:"packetsIn"`
+	PacketsOut int64 `json:"packetsOut"`
 }
 
 type MetricsPayload struct {
 	Snapshots []MetricsSnapshot `json:"snapshots"`
+
+	BatchID  string `json:"batchId,omitempty"`
+	Sequence uint64 `json:"sequence,omitempty"`
 }
 
 type AcceptedResponse struct {
@@ -0,0 +1,253 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bufio"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A minimal RFC 6455 WebSocket implementation: enough to carry the text
+// messages of the ingest stream without pulling in a dependency.
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// errMessageTooLarge is returned when a peer sends a message larger than
+// the connection's read limit.
+var errMessageTooLarge = errors.New("websocket message too large")
+
+type wsConn struct {
+	rw       io.ReadWriteCloser
+	br       *bufio.Reader
+	isClient bool
+	maxRead  int
+	// onFrame, when set, is called for every frame read, control frames
+	// included.
+	onFrame func()
+
+	wmu sync.Mutex
+}
+
+func newWSConn(rw io.ReadWriteCloser, br *bufio.Reader, isClient bool) *wsConn {
+	if br == nil {
+		br = bufio.NewReader(rw)
+	}
+	return &wsConn{rw: rw, br: br, isClient: isClient, maxRead: 1 << 20}
+}
+
+// wsAccept is the Sec-WebSocket-Accept value for key.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// dialWebSocket upgrades a GET to u. hc's transport is used, so TLS and
+// proxy settings apply; hc must not have a Timeout, which would also bound
+// the life of the connection. On a refused upgrade the response is returned
+// with its body read and closed.
+func dialWebSocket(ctx context.Context, hc *http.Client, u string, header http.Header) (*wsConn, *http.Response, error) {
+	nonce := make([]byte, 16)
+	if _, err := cryptorand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(strings.NewReader(string(body)))
+		return nil, resp, nil
+	}
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok || !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		resp.Body.Close()
+		return nil, nil, errors.New("websocket handshake: invalid upgrade response")
+	}
+	return newWSConn(rw, nil, true), resp, nil
+}
+
+// WriteMessage sends one unfragmented message.
+func (c *wsConn) WriteMessage(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|op)
+	var maskBit byte
+	if c.isClient {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	frame := payload
+	if c.isClient {
+		var mask [4]byte
+		if _, err := cryptorand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+		frame = make([]byte, len(payload))
+		for i, b := range payload {
+			frame[i] = b ^ mask[i%4]
+		}
+	}
+	if _, err := c.rw.Write(append(header, frame...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next data message, answering pings and
+// reassembling fragments on the way. A close frame from the peer is
+// answered and reported as io.EOF.
+func (c *wsConn) ReadMessage() (op byte, payload []byte, err error) {
+	var msgOp byte
+	var msg []byte
+	for {
+		fin, frameOp, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOp {
+		case opPing:
+			if err := c.WriteMessage(opPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			_ = c.WriteMessage(opClose, data[:min(len(data), 2)])
+			return 0, nil, io.EOF
+		case opContinuation:
+			if msg == nil {
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+		case opText, opBinary:
+			if msg != nil {
+				return 0, nil, errors.New("websocket: interleaved data frames")
+			}
+			msgOp, msg = frameOp, []byte{}
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", frameOp)
+		}
+		if len(msg)+len(data) > c.maxRead {
+			return 0, nil, errMessageTooLarge
+		}
+		msg = append(msg, data...)
+		if fin {
+			return msgOp, msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		return false, 0, nil, err
+	}
+	if c.onFrame != nil {
+		c.onFrame()
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0F
+	masked := h[1]&0x80 != 0
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > uint64(c.maxRead) {
+		return false, 0, nil, errMessageTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// Close sends a normal-closure frame and closes the connection.
+func (c *wsConn) Close() error {
+	_ = c.WriteMessage(opClose, []byte{0x03, 0xE8})
+	return c.rw.Close()
+}
@@ -0,0 +1,354 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// WireFormat selects how request bodies are serialised.
+type WireFormat string
+
+const (
+	WireJSON     WireFormat = "json"
+	WireProtobuf WireFormat = "protobuf"
+)
+
+// Content types per wire format. The protobuf schema lives in
+// proto/byteroute/ingest/v1/ingest.proto at the repository root.
+const (
+	ContentTypeJSON           = "application/json"
+	ContentTypeIngestProtobuf = "application/vnd.byteroute.ingest.v1+protobuf"
+)
+
+// ParseWireFormat accepts "json" or "protobuf".
+func ParseWireFormat(s string) (WireFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "json":
+		return WireJSON, nil
+	case "protobuf", "proto":
+		return WireProtobuf, nil
+	}
+	return "", fmt.Errorf("unsupported wire format %q (expected json or protobuf)", s)
+}
+
+func (f WireFormat) contentType() string {
+	if f == WireProtobuf {
+		return ContentTypeIngestProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// marshal encodes a ConnectionsPayload or MetricsPayload in format f.
+func marshal(f WireFormat, payload any) ([]byte, error) {
+	if f != WireProtobuf {
+		return json.Marshal(payload)
+	}
+	switch p := payload.(type) {
+	case ConnectionsPayload:
+		b, err := MarshalConnectionsProto(p.Connections)
+		return appendBatchInfo(b, BatchInfo{ID: p.BatchID, Sequence: p.Sequence}), err
+	case MetricsPayload:
+		b, err := MarshalMetricsProto(p.Snapshots)
+		return appendBatchInfo(b, BatchInfo{ID: p.BatchID, Sequence: p.Sequence}), err
+	}
+	return nil, fmt.Errorf("no protobuf encoding for %T", payload)
+}
+
+// appendBatchInfo writes the batch_id and sequence fields shared by both
+// payload messages.
+func appendBatchInfo(b []byte, batch BatchInfo) []byte {
+	b = appendString(b, 2, batch.ID)
+	return appendVarint(b, 3, batch.Sequence)
+}
+
+// MarshalConnectionsProto encodes connections as a v1 ConnectionsPayload.
+func MarshalConnectionsProto(connections []Connection) ([]byte, error) {
+	b := make([]byte, 0, len(connections)*96)
+	var msg []byte
+	for i := range connections {
+		var err error
+		msg, err = appendConnection(msg[:0], &connections[i])
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+	return b, nil
+}
+
+// MarshalMetricsProto encodes snapshots as a v1 MetricsPayload.
+func MarshalMetricsProto(snapshots []MetricsSnapshot) ([]byte, error) {
+	var b, msg []byte
+	for i := range snapshots {
+		var err error
+		msg, err = appendSnapshot(msg[:0], &snapshots[i])
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+	return b, nil
+}
+
+var protocolEnum = map[string]uint64{"TCP": 1, "UDP": 2, "ICMP": 3, "OTHER": 4}
+
+var statusEnum = map[string]uint64{"active": 1, "inactive": 2}
+
+var directionEnum = map[string]uint64{"out": 1, "in": 2}
+
+func appendConnection(b []byte, c *Connection) ([]byte, error) {
+	b = appendString(b, 1, c.ID)
+	b = appendString(b, 22, c.ConversationID)
+	var err error
+	if b, err = appendIP(b, 2, c.SourceIP); err != nil {
+		return nil, err
+	}
+	if b, err = appendIP(b, 3, c.DestIP); err != nil {
+		return nil, err
+	}
+	b = appendVarint(b, 4, uint64(c.SourcePort))
+	b = appendVarint(b, 5, uint64(c.DestPort))
+	b = appendVarint(b, 6, protocolEnum[c.Protocol])
+	b = appendVarint(b, 7, statusEnum[c.Status])
+	b = appendVarint(b, 23, directionEnum[c.Direction])
+	b = appendVarint(b, 24, uint64(c.SamplingRate))
+
+	for _, ts := range []struct {
+		num   protowire.Number
+		value string
+	}{
+		{8, c.StartTime},
+		{9, c.LastActivity},
+		{16, c.IntervalStart},
+		{17, c.IntervalEnd},
+	} {
+		if b, err = appendTimestamp(b, ts.num, ts.value); err != nil {
+			return nil, err
+		}
+	}
+
+	b = appendOptInt(b, 10, c.DurationMs)
+	b = appendOptInt(b, 11, c.BytesIn)
+	b = appendOptInt(b, 12, c.BytesOut)
+	b = appendOptInt(b, 13, c.PacketsIn)
+	b = appendOptInt(b, 14, c.PacketsOut)
+	b = appendOptInt(b, 15, c.Bandwidth)
+	b = appendOptInt(b, 18, c.DeltaBytesIn)
+	b = appendOptInt(b, 19, c.DeltaBytesOut)
+	b = appendOptInt(b, 20, c.DeltaPacketsIn)
+	b = appendOptInt(b, 21, c.DeltaPacketsOut)
+
+	if c.Country != nil {
+		b = appendString(b, 30, *c.Country)
+	}
+	if c.CountryCode != nil {
+		b = appendString(b, 31, *c.CountryCode)
+	}
+	if c.City != nil {
+		b = appendString(b, 32, *c.City)
+	}
+	if c.Latitude != nil {
+		b = appendDouble(b, 33, *c.Latitude)
+	}
+	if c.Longitude != nil {
+		b = appendDouble(b, 34, *c.Longitude)
+	}
+	if c.ASN != nil {
+		b = protowire.AppendTag(b, 35, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*c.ASN))
+	}
+	if c.ASOrg != nil {
+		b = appendString(b, 36, *c.ASOrg)
+	}
+	if c.Enriched != nil {
+		b = protowire.AppendTag(b, 37, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*c.Enriched))
+	}
+	return b, nil
+}
+
+func appendSnapshot(b []byte, s *MetricsSnapshot) ([]byte, error) {
+	var err error
+	if b, err = appendTimestamp(b, 1, s.Timestamp); err != nil {
+		return nil, err
+	}
+	b = appendVarint(b, 2, uint64(s.Connections))
+	b = appendVarint(b, 3, uint64(s.BandwidthIn))
+	b = appendVarint(b, 4, uint64(s.BandwidthOut))
+	b = appendVarint(b, 5, uint64(s.Inactive))
+	if b, err = appendTimestamp(b, 6, s.EndTime); err != nil {
+		return nil, err
+	}
+	b = appendVarint(b, 7, uint64(s.PacketsIn))
+	b = appendVarint(b, 8, uint64(s.PacketsOut))
+	if s.RateIn != 0 {
+		b = appendDouble(b, 9, s.RateIn)
+	}
+	if s.RateOut != 0 {
+		b = appendDouble(b, 10, s.RateOut)
+	}
+	b = appendVarint(b, 11, uint64(s.PeakRateIn))
+	b = appendVarint(b, 12, uint64(s.PeakRateOut))
+
+	// Sorted so the encoding is deterministic.
+	protos := make([]string, 0, len(s.Protocols))
+	for proto := range s.Protocols {
+		protos = append(protos, proto)
+	}
+	slices.Sort(protos)
+	for _, proto := range protos {
+		t := s.Protocols[proto]
+		var totals []byte
+		totals = appendVarint(totals, 1, uint64(t.BytesIn))
+		totals = appendVarint(totals, 2, uint64(t.BytesOut))
+		totals = appendVarint(totals, 3, uint64(t.PacketsIn))
+		totals = appendVarint(totals, 4, uint64(t.PacketsOut))
+
+		var entry []byte
+		entry = appendString(entry, 1, proto)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, totals)
+
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	b = appendRateSummary(b, 14, s.ThroughputIn)
+	b = appendRateSummary(b, 15, s.ThroughputOut)
+	b = appendVarint(b, 16, uint64(s.NewConnections))
+	b = appendRateSummary(b, 17, s.NewConnsPerSec)
+
+	if len(s.PacketSizeBounds) > 0 {
+		var packed []byte
+		for _, v := range s.PacketSizeBounds {
+			packed = protowire.AppendVarint(packed, uint64(v))
+		}
+		b = protowire.AppendTag(b, 18, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	if len(s.PacketSizes) > 0 {
+		var packed []byte
+		for _, v := range s.PacketSizes {
+			packed = protowire.AppendVarint(packed, uint64(v))
+		}
+		b = protowire.AppendTag(b, 19, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	b = appendVarint(b, 20, uint64(s.OversizeRecords))
+	b = appendVarint(b, 21, uint64(s.SamplingRate))
+	if c := s.Capture; c != nil {
+		var msg []byte
+		msg = appendString(msg, 1, c.Policy)
+		msg = appendVarint(msg, 2, uint64(c.Received))
+		msg = appendVarint(msg, 3, uint64(c.ChannelDrops))
+		msg = appendVarint(msg, 4, uint64(c.KernelDrops))
+		msg = appendVarint(msg, 5, uint64(c.IfDrops))
+		if c.QueuePeak != 0 {
+			msg = appendDouble(msg, 6, c.QueuePeak)
+		}
+		b = protowire.AppendTag(b, 22, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+	return b, nil
+}
+
+func appendRateSummary(b []byte, num protowire.Number, r *RateSummary) []byte {
+	if r == nil {
+		return b
+	}
+	var msg []byte
+	msg = appendVarint(msg, 1, uint64(r.Min))
+	if r.Mean != 0 {
+		msg = appendDouble(msg, 2, r.Mean)
+	}
+	msg = appendVarint(msg, 3, uint64(r.P50))
+	msg = appendVarint(msg, 4, uint64(r.P95))
+	msg = appendVarint(msg, 5, uint64(r.P99))
+	msg = appendVarint(msg, 6, uint64(r.Max))
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendVarint writes a proto3 scalar, omitting the default (zero) value.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendOptInt writes an explicit-presence int64, including zero.
+func appendOptInt(b []byte, num protowire.Number, v *int64) []byte {
+	if v == nil {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(*v))
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendIP(b []byte, num protowire.Number, s string) ([]byte, error) {
+	if s == "" {
+		return b, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, ip), nil
+}
+
+func appendTimestamp(b []byte, num protowire.Number, s string) ([]byte, error) {
+	if s == "" {
+		return b, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, uint64(t.UnixNano())), nil
+}
@@ -0,0 +1,390 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fields decodes one message level into field number -> raw values. Varint
+// and fixed64 values are returned as uint64, length-delimited ones as []byte.
+func fields(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	out := map[protowire.Number][]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %d for field %d", typ, num)
+		}
+		if n < 0 {
+			t.Fatalf("bad value for field %d: %v", num, protowire.ParseError(n))
+		}
+		out[num] = append(out[num], v)
+		b = b[n:]
+	}
+	return out
+}
+
+func TestMarshalConnectionsProto(t *testing.T) {
+	zero, bytesIn := int64(0), int64(1500)
+	asn := 15169
+	conns := []Connection{{
+		ID:            "flow-1",
+		SourceIP:      "10.0.0.1",
+		DestIP:        "2001:db8::1",
+		SourcePort:    51000,
+		DestPort:      443,
+		Protocol:      "UDP",
+		Status:        "inactive",
+		StartTime:     "2026-01-02T03:04:05.5Z",
+		LastActivity:  "2026-01-02T03:04:06Z",
+		BytesIn:       &bytesIn,
+		DeltaBytesOut: &zero,
+		ASN:           &asn,
+	}}
+
+	b, err := MarshalConnectionsProto(conns)
+	if err != nil {
+		t.Fatalf("MarshalConnectionsProto: %v", err)
+	}
+	payload := fields(t, b)
+	if len(payload[1]) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(payload[1]))
+	}
+	c := fields(t, payload[1][0].([]byte))
+
+	if got := string(c[1][0].([]byte)); got != "flow-1" {
+		t.Errorf("id = %q", got)
+	}
+	if got := c[2][0].([]byte); len(got) != 4 || got[0] != 10 || got[3] != 1 {
+		t.Errorf("source_ip = %v, want 4-byte 10.0.0.1", got)
+	}
+	if got := c[3][0].([]byte); len(got) != 16 {
+		t.Errorf("dest_ip length = %d, want 16", len(got))
+	}
+	if c[4][0].(uint64) != 51000 || c[5][0].(uint64) != 443 {
+		t.Errorf("ports = %v/%v", c[4], c[5])
+	}
+	if c[6][0].(uint64) != 2 || c[7][0].(uint64) != 2 {
+		t.Errorf("protocol/status = %v/%v, want UDP(2)/INACTIVE(2)", c[6], c[7])
+	}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 5e8, time.UTC).UnixNano()
+	if got := int64(c[8][0].(uint64)); got != start {
+		t.Errorf("start_time_unix_nano = %d, want %d", got, start)
+	}
+	if c[11][0].(uint64) != 1500 {
+		t.Errorf("bytes_in = %v", c[11])
+	}
+	// Explicit presence: a zero delta is still sent, absent ones are not.
+	if len(c[19]) != 1 || c[19][0].(uint64) != 0 {
+		t.Errorf("expected delta_bytes_out=0 to be present, got %v", c[19])
+	}
+	if len(c[12]) != 0 || len(c[18]) != 0 || len(c[30]) != 0 {
+		t.Errorf("expected unset optional fields to be omitted")
+	}
+	if c[35][0].(uint64) != 15169 {
+		t.Errorf("asn = %v", c[35])
+	}
+}
+
+func TestMarshalConnectionsProto_ConversationID(t *testing.T) {
+	b, err := MarshalConnectionsProto([]Connection{{ID: "a", ConversationID: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := fields(t, fields(t, b)[1][0].([]byte))
+	if len(c[22]) != 1 || string(c[22][0].([]byte)) != "c" {
+		t.Fatalf("conversation_id = %v", c[22])
+	}
+	// The backend's decoder test uses this encoding.
+	if got := hex.EncodeToString(b); got != "0a070a0161b2010163" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+}
+
+func TestMarshalConnectionsProto_Direction(t *testing.T) {
+	b, err := MarshalConnectionsProto([]Connection{{ID: "a", Direction: "in"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := fields(t, fields(t, b)[1][0].([]byte))
+	if len(c[23]) != 1 || c[23][0].(uint64) != 2 {
+		t.Fatalf("direction = %v", c[23])
+	}
+	// The backend's decoder test uses this encoding.
+	if got := hex.EncodeToString(b); got != "0a060a0161b80102" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+}
+
+func TestMarshalConnectionsProto_SamplingRate(t *testing.T) {
+	b, err := MarshalConnectionsProto([]Connection{{ID: "a", SamplingRate: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backend's decoder test uses this encoding.
+	if got := hex.EncodeToString(b); got != "0a060a0161c0010a" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+}
+
+func TestMarshalConnectionsProto_InvalidInput(t *testing.T) {
+	if _, err := MarshalConnectionsProto([]Connection{{SourceIP: "not-an-ip"}}); err == nil {
+		t.Errorf("expected error for invalid IP")
+	}
+	if _, err := MarshalConnectionsProto([]Connection{{StartTime: "yesterday"}}); err == nil {
+		t.Errorf("expected error for invalid timestamp")
+	}
+}
+
+func TestMarshalMetricsProto(t *testing.T) {
+	snaps := []MetricsSnapshot{{
+		Timestamp:        "2026-01-02T03:04:05Z",
+		Connections:      3,
+		BandwidthIn:      1000,
+		RateIn:           16.5,
+		Protocols:        map[string]MetricsProtocolTotals{"UDP": {BytesIn: 1}, "TCP": {BytesIn: 2}},
+		ThroughputIn:     &RateSummary{Mean: 2.5, Max: 7},
+		PacketSizeBounds: []int{64, 1500},
+		PacketSizes:      []int64{1, 0, 4},
+		SamplingRate:     100,
+	}}
+
+	b, err := MarshalMetricsProto(snaps)
+	if err != nil {
+		t.Fatalf("MarshalMetricsProto: %v", err)
+	}
+	s := fields(t, fields(t, b)[1][0].([]byte))
+
+	if s[2][0].(uint64) != 3 || s[3][0].(uint64) != 1000 {
+		t.Errorf("connections/bandwidth_in = %v/%v", s[2], s[3])
+	}
+	if got := math.Float64frombits(s[9][0].(uint64)); got != 16.5 {
+		t.Errorf("rate_in = %v", got)
+	}
+	var protos []string
+	for _, entry := range s[13] {
+		protos = append(protos, string(fields(t, entry.([]byte))[1][0].([]byte)))
+	}
+	if !slices.Equal(protos, []string{"TCP", "UDP"}) {
+		t.Errorf("protocol map keys = %q, want sorted TCP, UDP", protos)
+	}
+	rs := fields(t, s[14][0].([]byte))
+	if math.Float64frombits(rs[2][0].(uint64)) != 2.5 || rs[6][0].(uint64) != 7 {
+		t.Errorf("throughput_in = %v", rs)
+	}
+	if len(s[15]) != 0 {
+		t.Errorf("expected nil throughput_out to be omitted")
+	}
+
+	var sizes []uint64
+	for packed := s[19][0].([]byte); len(packed) > 0; {
+		v, n := protowire.ConsumeVarint(packed)
+		sizes = append(sizes, v)
+		packed = packed[n:]
+	}
+	if !slices.Equal(sizes, []uint64{1, 0, 4}) {
+		t.Errorf("packet_sizes = %v", sizes)
+	}
+	if s[21][0].(uint64) != 100 {
+		t.Errorf("sampling_rate = %v", s[21])
+	}
+}
+
+func TestMarshalMetricsProto_Capture(t *testing.T) {
+	b, err := MarshalMetricsProto([]MetricsSnapshot{{
+		Timestamp: "2026-01-02T03:04:05Z",
+		Capture:   &CaptureStats{Policy: "drop", Received: 10, ChannelDrops: 2, QueuePeak: 0.5},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := fields(t, fields(t, fields(t, b)[1][0].([]byte))[22][0].([]byte))
+	if string(c[1][0].([]byte)) != "drop" || c[2][0].(uint64) != 10 || c[3][0].(uint64) != 2 || len(c[4]) != 0 {
+		t.Fatalf("capture = %v", c)
+	}
+	// The backend's decoder test uses this encoding.
+	if got := hex.EncodeToString(b); got != "0a1f090032961cf2ca8618b201130a0464726f70100a180231000000000000e03f" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+}
+
+func TestClient_ProtobufContentType(t *testing.T) {
+	var gotType string
+	var gotBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: 1, Status: "processing"})
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithWireFormat(WireProtobuf))
+	conns := []Connection{{ID: "a", SourceIP: "10.0.0.1", DestIP: "10.0.0.2", Protocol: "TCP"}}
+	if _, err := c.PostConnections(context.Background(), conns); err != nil {
+		t.Fatalf("PostConnections: %v", err)
+	}
+	if gotType != ContentTypeIngestProtobuf {
+		t.Fatalf("expected Content-Type %q, got %q", ContentTypeIngestProtobuf, gotType)
+	}
+	want, _ := MarshalConnectionsProto(conns)
+	if !bytes.HasPrefix(gotBody, want) {
+		t.Fatalf("body does not start with the encoded connections")
+	}
+	if batch := fields(t, gotBody); len(batch[2]) != 1 || batch[3][0].(uint64) != 1 {
+		t.Fatalf("expected batch_id and sequence=1, got %v", batch)
+	}
+}
+
+func TestClient_ProtobufFallsBackToJSONOn415(t *testing.T) {
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, fmt.Sprintf("%s|%s", r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding")))
+		if r.Header.Get("Content-Type") != ContentTypeJSON || r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(AcceptedResponse{Received: 1, Status: "processing"})
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL, 2*time.Second, "", WithCompression(EncodingGzip), WithWireFormat(WireProtobuf))
+	if _, err := c.PostMetrics(context.Background(), []MetricsSnapshot{{}}); err != nil {
+		t.Fatalf("PostMetrics: %v", err)
+	}
+	want := []string{
+		ContentTypeIngestProtobuf + "|gzip",
+		ContentTypeIngestProtobuf + "|",
+		ContentTypeJSON + "|",
+	}
+	if !slices.Equal(seen, want) {
+		t.Fatalf("expected attempts %q, got %q", want, seen)
+	}
+	if c.WireFormat() != WireJSON {
+		t.Fatalf("expected client to remember json, got %q", c.WireFormat())
+	}
+}
+
+func TestParseWireFormat(t *testing.T) {
+	for in, want := range map[string]WireFormat{"": WireJSON, "json": WireJSON, "Protobuf": WireProtobuf} {
+		got, err := ParseWireFormat(in)
+		if err != nil || got != want {
+			t.Errorf("ParseWireFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseWireFormat("msgpack"); err == nil {
+		t.Errorf("expected error for unsupported wire format")
+	}
+}
+
+// benchConnections is a realistic batch: geo-enriched flows with counters
+// and deltas, as the agent posts them after enrichment.
+func benchConnections(n int) []Connection {
+	conns := make([]Connection, n)
+	for i := range conns {
+		v := int64(i * 1337)
+		country, code, city := "United States", "US", "Mountain View"
+		lat, lon := 37.4056, -122.0775
+		asn, org := 15169, "Google LLC"
+		conns[i] = Connection{
+			ID:              fmt.Sprintf("host1-%016x", i*7919),
+			SourceIP:        fmt.Sprintf("192.168.%d.%d", i/250, i%250+1),
+			DestIP:          fmt.Sprintf("142.250.%d.%d", i%200, i%250+1),
+			SourcePort:      40000 + i%20000,
+			DestPort:        443,
+			Protocol:        "TCP",
+			Status:          "active",
+			StartTime:       "2026-01-02T03:04:05.123456789Z",
+			LastActivity:    "2026-01-02T03:05:05.987654321Z",
+			DurationMs:      &v,
+			BytesIn:         &v,
+			BytesOut:        &v,
+			PacketsIn:       &v,
+			PacketsOut:      &v,
+			Bandwidth:       &v,
+			IntervalStart:   "2026-01-02T03:05:00Z",
+			IntervalEnd:     "2026-01-02T03:05:05.987654321Z",
+			DeltaBytesIn:    &v,
+			DeltaBytesOut:   &v,
+			DeltaPacketsIn:  &v,
+			DeltaPacketsOut: &v,
+			Country:         &country,
+			CountryCode:     &code,
+			City:            &city,
+			Latitude:        &lat,
+			Longitude:       &lon,
+			ASN:             &asn,
+			ASOrg:           &org,
+		}
+	}
+	return conns
+}
+
+func benchmarkEncode(b *testing.B, format WireFormat, enc Encoding) {
+	conns := benchConnections(200)
+	payload := ConnectionsPayload{Connections: conns}
+	var size int
+	b.ReportAllocs()
+	for b.Loop() {
+		body, err := marshal(format, payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if body, err = compress(enc, body); err != nil {
+			b.Fatal(err)
+		}
+		size = len(body)
+	}
+	b.ReportMetric(float64(size), "bytes/batch")
+}
+
+func BenchmarkEncodeConnections_JSON(b *testing.B)     { benchmarkEncode(b, WireJSON, EncodingIdentity) }
+func BenchmarkEncodeConnections_JSONGzip(b *testing.B) { benchmarkEncode(b, WireJSON, EncodingGzip) }
+func BenchmarkEncodeConnections_Protobuf(b *testing.B) {
+	benchmarkEncode(b, WireProtobuf, EncodingIdentity)
+}
+func BenchmarkEncodeConnections_ProtobufGzip(b *testing.B) {
+	benchmarkEncode(b, WireProtobuf, EncodingGzip)
+}
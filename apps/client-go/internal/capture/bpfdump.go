@@ -0,0 +1,165 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// Classic BPF opcode fields, as in <linux/filter.h>.
+const (
+	bpfClass = 0x07
+	bpfSize  = 0x18
+	bpfMode  = 0xe0
+	bpfOp    = 0xf0
+	bpfSrcX  = 0x08
+
+	bpfLD   = 0x00
+	bpfLDX  = 0x01
+	bpfST   = 0x02
+	bpfSTX  = 0x03
+	bpfALU  = 0x04
+	bpfJMP  = 0x05
+	bpfRET  = 0x06
+	bpfMISC = 0x07
+
+	bpfIMM = 0x00
+	bpfABS = 0x20
+	bpfIND = 0x40
+	bpfMEM = 0x60
+	bpfLEN = 0x80
+	bpfMSH = 0xa0
+)
+
+var (
+	bpfSizeSuffix = map[uint16]string{0x00: "", 0x08: "h", 0x10: "b"}
+	bpfALUOps     = map[uint16]string{0x00: "add", 0x10: "sub", 0x20: "mul", 0x30: "div", 0x40: "or", 0x50: "and", 0x60: "lsh", 0x70: "rsh", 0x80: "neg", 0x90: "mod", 0xa0: "xor"}
+	bpfJumpOps    = map[uint16]string{0x00: "ja", 0x10: "jeq", 0x20: "jgt", 0x30: "jge", 0x40: "jset"}
+)
+
+// Disassemble renders compiled instructions one per line, in the format of
+// tcpdump -d.
+func Disassemble(prog []pcap.BPFInstruction) []string {
+	lines := make([]string, len(prog))
+	for i, ins := range prog {
+		op, arg := disassemble(i, ins)
+		lines[i] = fmt.Sprintf("(%03d) %-8s %s", i, op, arg)
+	}
+	return lines
+}
+
+func disassemble(pc int, ins pcap.BPFInstruction) (op, arg string) {
+	code := ins.Code
+	switch code & bpfClass {
+	case bpfLD, bpfLDX:
+		op = "ld"
+		if code&bpfClass == bpfLDX {
+			op = "ldx"
+		}
+		op += bpfSizeSuffix[code&bpfSize]
+		switch code & bpfMode {
+		case bpfIMM:
+			return op, fmt.Sprintf("#%#x", ins.K)
+		case bpfABS:
+			return op, fmt.Sprintf("[%d]", ins.K)
+		case bpfIND:
+			return op, fmt.Sprintf("[x + %d]", ins.K)
+		case bpfMEM:
+			return op, fmt.Sprintf("M[%d]", ins.K)
+		case bpfLEN:
+			return op, "#pktlen"
+		case bpfMSH:
+			return op, fmt.Sprintf("4*([%d]&0xf)", ins.K)
+		}
+	case bpfST:
+		return "st", fmt.Sprintf("M[%d]", ins.K)
+	case bpfSTX:
+		return "stx", fmt.Sprintf("M[%d]", ins.K)
+	case bpfALU:
+		op = bpfALUOps[code&bpfOp]
+		if op == "neg" {
+			return op, ""
+		}
+		if code&bpfSrcX != 0 {
+			return op, "x"
+		}
+		return op, fmt.Sprintf("#%#x", ins.K)
+	case bpfJMP:
+		op = bpfJumpOps[code&bpfOp]
+		if op == "ja" {
+			return op, fmt.Sprintf("%d", pc+1+int(ins.K))
+		}
+		src := fmt.Sprintf("#%#x", ins.K)
+		if code&bpfSrcX != 0 {
+			src = "x"
+		}
+		return op, fmt.Sprintf("%-16s jt %d\tjf %d", src, pc+1+int(ins.Jt), pc+1+int(ins.Jf))
+	case bpfRET:
+		switch code & bpfSize {
+		case 0x08:
+			return "ret", "x"
+		case 0x10:
+			return "ret", "a"
+		}
+		return "ret", fmt.Sprintf("#%d", ins.K)
+	case bpfMISC:
+		if code&0xf8 == 0 {
+			return "tax", ""
+		}
+		return "txa", ""
+	}
+	return fmt.Sprintf(".code %#x", code), fmt.Sprintf("jt %d jf %d k %#x", ins.Jt, ins.Jf, ins.K)
+}
+
+// FilterFileResult counts the packets in a capture file a filter matches.
+type FilterFileResult struct {
+	Packets int
+	Matched int
+}
+
+// FilterFile runs expr over every packet in a pcap file, compiled for the
+// file's link type.
+func FilterFile(path, expr string) (FilterFileResult, error) {
+	var res FilterFileResult
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return res, err
+	}
+	defer handle.Close()
+
+	bpf, err := handle.NewBPF(expr)
+	if err != nil {
+		return res, fmt.Errorf("compile %q: %w", expr, err)
+	}
+	for {
+		data, ci, err := handle.ReadPacketData()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, fmt.Errorf("read %s: %w", path, err)
+		}
+		res.Packets++
+		if bpf.Matches(ci, data) {
+			res.Matched++
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/pcap"
+)
+
+func TestDisassemble(t *testing.T) {
+	// tcpdump -d ip
+	prog := []pcap.BPFInstruction{
+		{Code: 0x28, K: 12},
+		{Code: 0x15, Jt: 0, Jf: 1, K: 0x800},
+		{Code: 0x06, K: 262144},
+		{Code: 0x06, K: 0},
+	}
+	want := []string{
+		"(000) ldh      [12]",
+		"(001) jeq      #0x800           jt 2\tjf 3",
+		"(002) ret      #262144",
+		"(003) ret      #0",
+	}
+	got := Disassemble(prog)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDisassemble_Modes(t *testing.T) {
+	for _, tc := range []struct {
+		ins  pcap.BPFInstruction
+		want string
+	}{
+		{pcap.BPFInstruction{Code: 0xb1, K: 14}, "(000) ldxb     4*([14]&0xf)"},
+		{pcap.BPFInstruction{Code: 0x48, K: 16}, "(000) ldh      [x + 16]"},
+		{pcap.BPFInstruction{Code: 0x54, K: 0x1fff}, "(000) and      #0x1fff"},
+		{pcap.BPFInstruction{Code: 0x45, Jt: 3, K: 0x1fff}, "(000) jset     #0x1fff          jt 4\tjf 1"},
+		{pcap.BPFInstruction{Code: 0x02, K: 1}, "(000) st       M[1]"},
+	} {
+		if got := Disassemble([]pcap.BPFInstruction{tc.ins})[0]; got != tc.want {
+			t.Errorf("%#x: got %q, want %q", tc.ins.Code, got, tc.want)
+		}
+	}
+}
@@ -35,6 +35,8 @@ type PacketEvent struct {
 	DstPort   uint16
 	Protocol  string
 	Length    int
+	// SampleRate is N when the packet stands for 1 in N; see Sampler.
+	SampleRate int
 }
 
 func ListIfaces() ([]net.Interface, error) {
@@ -67,7 +69,79 @@ func LocalIPsForInterface(name string) (map[string]struct{}, error) {
 	return set, nil
 }
 
-func Start(iface, bpf string, snapLen int, promisc bool) (*pcap.Handle, <-chan PacketEvent, error) {
+// DefaultQueueSize is the capacity of the channel Start returns.
+const DefaultQueueSize = 2048
+
+// Overflow policies: what Start does with a packet when its channel is
+// full.
+const (
+	// OverflowBlock stops reading until there is room, leaving the kernel
+	// to drop packets once its buffer fills.
+	OverflowBlock = "block"
+	// OverflowDrop drops the packet and counts it.
+	OverflowDrop = "drop"
+	// OverflowSample drops and counts the packet like OverflowDrop, and
+	// makes packet sampling adaptive so that a backlog raises the sampling
+	// rate instead of losing packets.
+	OverflowSample = "sample"
+)
+
+// spillMaxRate bounds the packet sampling rate OverflowSample may reach,
+// relative to the configured rate.
+const spillMaxRate = 1024
+
+// Option configures Start.
+type Option func(*options)
+
+type options struct {
+	sampler   *Sampler
+	overflow  string
+	queueSize int
+	counters  *Counters
+}
+
+// WithSampler samples packets as they are captured; a nil Sampler keeps
+// every packet.
+func WithSampler(s *Sampler) Option {
+	return func(o *options) { o.sampler = s }
+}
+
+// WithOverflow sets the overflow policy; the default is OverflowBlock.
+func WithOverflow(policy string) Option {
+	return func(o *options) { o.overflow = policy }
+}
+
+// WithQueueSize sets the capacity of the returned channel; zero keeps
+// DefaultQueueSize.
+func WithQueueSize(n int) Option {
+	return func(o *options) { o.queueSize = n }
+}
+
+// WithCounters makes Start keep c up to date, for Counters.Stats.
+func WithCounters(c *Counters) Option {
+	return func(o *options) { o.counters = c }
+}
+
+func Start(iface, bpf string, snapLen int, promisc bool, opts ...Option) (*pcap.Handle, <-chan PacketEvent, error) {
+	o := options{overflow: OverflowBlock, queueSize: DefaultQueueSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch o.overflow {
+	case "":
+		o.overflow = OverflowBlock
+	case OverflowBlock, OverflowDrop:
+	case OverflowSample:
+		o.sampler = o.sampler.spill()
+	default:
+		return nil, nil, fmt.Errorf("unknown overflow policy %q", o.overflow)
+	}
+	c := o.counters
+	if c == nil {
+		c = &Counters{}
+	}
+	c.policy, c.sampler = o.overflow, o.sampler
+
 	handle, err := pcap.OpenLive(iface, int32(snapLen), promisc, pcap.BlockForever)
 	if err != nil {
 		return nil, nil, err
@@ -80,60 +154,120 @@ func Start(iface, bpf string, snapLen int, promisc bool) (*pcap.Handle, <-chan P
 		}
 	}
 
-	out := make(chan PacketEvent, 2048)
+	if o.queueSize <= 0 {
+		o.queueSize = DefaultQueueSize
+	}
+	out := make(chan PacketEvent, o.queueSize)
 	src := gopacket.NewPacketSource(handle, handle.LinkType())
+	// Decode on first access, so packets dropped by the sampler cost no
+	// decoding.
+	src.DecodeOptions.Lazy = true
 
 	go func() {
 		defer close(out)
+		s := o.sampler
 		for packet := range src.Packets() {
-			nl := packet.NetworkLayer()
-			if nl == nil {
-				continue
+			c.received.Add(1)
+			rate := 1
+			if s != nil {
+				var keep bool
+				if rate, keep = s.keepPacket(); !keep {
+					continue
+				}
 			}
 
-			var srcIP, dstIP net.IP
-			switch v := nl.(type) {
-			case *layers.IPv4:
-				srcIP = v.SrcIP
-				dstIP = v.DstIP
-			case *layers.IPv6:
-				srcIP = v.SrcIP
-				dstIP = v.DstIP
-			default:
+			ev, ok := decode(packet)
+			if !ok {
 				continue
 			}
-
-			var srcPort, dstPort uint16
-			proto := "OTHER"
-
-			if tl := packet.TransportLayer(); tl != nil {
-				switch t := tl.(type) {
-				case *layers.TCP:
-					proto = "TCP"
-					srcPort = uint16(t.SrcPort)
-					dstPort = uint16(t.DstPort)
-				case *layers.UDP:
-					proto = "UDP"
-					srcPort = uint16(t.SrcPort)
-					dstPort = uint16(t.DstPort)
+			if s != nil {
+				if !s.keepFlow(&ev) {
+					continue
 				}
+				ev.SampleRate = rate * int(s.flowRate)
+				s.adapt(len(out), cap(out))
 			}
-
-			if packet.Layer(layers.LayerTypeICMPv4) != nil || packet.Layer(layers.LayerTypeICMPv6) != nil {
-				proto = "ICMP"
-			}
-
-			out <- PacketEvent{
-				Timestamp: packet.Metadata().Timestamp,
-				SrcIP:     srcIP,
-				DstIP:     dstIP,
-				SrcPort:   srcPort,
-				DstPort:   dstPort,
-				Protocol:  proto,
-				Length:    len(packet.Data()),
+			if o.overflow == OverflowBlock {
+				out <- ev
+			} else {
+				select {
+				case out <- ev:
+				default:
+					c.dropped.Add(1)
+				}
 			}
+			c.observe(len(out))
 		}
 	}()
 
 	return handle, out, nil
 }
+
+// decode extracts the flow fields of packet. It reports false for packets
+// without an IPv4 or IPv6 layer.
+func decode(packet gopacket.Packet) (PacketEvent, bool) {
+	nl := packet.NetworkLayer()
+	if nl == nil {
+		return PacketEvent{}, false
+	}
+
+	var srcIP, dstIP net.IP
+	switch v := nl.(type) {
+	case *layers.IPv4:
+		srcIP = v.SrcIP
+		dstIP = v.DstIP
+	case *layers.IPv6:
+		srcIP = v.SrcIP
+		dstIP = v.DstIP
+	default:
+		return PacketEvent{}, false
+	}
+
+	var srcPort, dstPort uint16
+	proto := "OTHER"
+
+	if tl := packet.TransportLayer(); tl != nil {
+		switch t := tl.(type) {
+		case *layers.TCP:
+			proto = "TCP"
+			srcPort = uint16(t.SrcPort)
+			dstPort = uint16(t.DstPort)
+		case *layers.UDP:
+			proto = "UDP"
+			srcPort = uint16(t.SrcPort)
+			dstPort = uint16(t.DstPort)
+		}
+	}
+
+	if packet.Layer(layers.LayerTypeICMPv4) != nil || packet.Layer(layers.LayerTypeICMPv6) != nil {
+		proto = "ICMP"
+	}
+
+	return PacketEvent{
+		Timestamp:  packet.Metadata().Timestamp,
+		SrcIP:      srcIP,
+		DstIP:      dstIP,
+		SrcPort:    srcPort,
+		DstPort:    dstPort,
+		Protocol:   proto,
+		Length:     len(packet.Data()),
+		SampleRate: 1,
+	}, true
+}
+
+// Probe opens iface as Start does and closes it again, reporting the link
+// type. It checks capture permissions without capturing.
+func Probe(iface string, snapLen int, promisc bool) (layers.LinkType, error) {
+	handle, err := pcap.OpenLive(iface, int32(snapLen), promisc, time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+	return handle.LinkType(), nil
+}
+
+// CompileBPF compiles expr for the link type as SetBPFFilter would, so a
+// filter can be checked without opening the interface.
+func CompileBPF(linkType layers.LinkType, snapLen int, expr string) ([]pcap.BPFInstruction, error) {
+	return pcap.CompileBPFFilter(linkType, snapLen, expr)
+}
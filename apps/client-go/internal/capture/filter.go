@@ -0,0 +1,121 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Filter is a capture filter given as lists rather than a BPF expression.
+// Nets and ports match either endpoint; an empty list does not restrict.
+type Filter struct {
+	Protocols    []string // tcp, udp, icmp, icmp6; default tcp, udp and icmp
+	IncludeNets  []string // CIDRs, e.g. 10.0.0.0/8 or 2001:db8::/32
+	ExcludeNets  []string
+	IncludePorts []string // ports or ranges, e.g. 443 or 8000-8080
+	ExcludePorts []string
+}
+
+var filterProtocols = map[string]bool{"tcp": true, "udp": true, "icmp": true, "icmp6": true}
+
+// Expr compiles f to a BPF expression for BuildDefaultBPF's baseExpr.
+func (f Filter) Expr() (string, error) {
+	protos := append([]string(nil), f.Protocols...)
+	if len(protos) == 0 {
+		protos = []string{"tcp", "udp", "icmp"}
+	}
+	for i, p := range protos {
+		p = strings.ToLower(p)
+		if !filterProtocols[p] {
+			return "", fmt.Errorf("invalid protocol %q (expected tcp, udp, icmp or icmp6)", protos[i])
+		}
+		protos[i] = p
+	}
+	clauses := []string{strings.Join(protos, " or ")}
+
+	for _, list := range []struct {
+		items   []string
+		exclude bool
+		prim    func(string) (string, error)
+	}{
+		{f.IncludeNets, false, netPrimitive},
+		{f.ExcludeNets, true, netPrimitive},
+		{f.IncludePorts, false, portPrimitive},
+		{f.ExcludePorts, true, portPrimitive},
+	} {
+		if len(list.items) == 0 {
+			continue
+		}
+		prims := make([]string, 0, len(list.items))
+		for _, item := range list.items {
+			p, err := list.prim(strings.TrimSpace(item))
+			if err != nil {
+				return "", err
+			}
+			prims = append(prims, p)
+		}
+		clause := "(" + strings.Join(prims, " or ") + ")"
+		if list.exclude {
+			clause = "not " + clause
+		}
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	clauses[0] = "(" + clauses[0] + ")"
+	return strings.Join(clauses, " and "), nil
+}
+
+// netPrimitive uses the network address, since pcap refuses a CIDR with
+// host bits set.
+func netPrimitive(cidr string) (string, error) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid network %q (expected a CIDR such as 10.0.0.0/8)", cidr)
+	}
+	return "net " + n.String(), nil
+}
+
+func portPrimitive(s string) (string, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	first, err := parsePort(lo)
+	if err != nil {
+		return "", fmt.Errorf("invalid port %q", s)
+	}
+	if !isRange {
+		return "port " + strconv.Itoa(first), nil
+	}
+	last, err := parsePort(hi)
+	if err != nil || last < first {
+		return "", fmt.Errorf("invalid port range %q", s)
+	}
+	return fmt.Sprintf("portrange %d-%d", first, last), nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return p, nil
+}
@@ -0,0 +1,65 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import "testing"
+
+func TestFilterExpr_Default(t *testing.T) {
+	got, err := Filter{}.Expr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "tcp or udp or icmp" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestFilterExpr_Lists(t *testing.T) {
+	f := Filter{
+		Protocols:    []string{"TCP", "udp"},
+		IncludeNets:  []string{"10.1.2.3/16", "2001:db8::/32"},
+		ExcludeNets:  []string{"10.1.99.0/24"},
+		IncludePorts: []string{"443", "8000-8080"},
+		ExcludePorts: []string{"22"},
+	}
+	got, err := f.Expr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "(tcp or udp) and (net 10.1.0.0/16 or net 2001:db8::/32) and not (net 10.1.99.0/24) and (port 443 or portrange 8000-8080) and not (port 22)"
+	if got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+	if f.Protocols[0] != "TCP" {
+		t.Fatalf("Expr modified the filter: %q", f.Protocols)
+	}
+}
+
+func TestFilterExpr_Invalid(t *testing.T) {
+	for _, f := range []Filter{
+		{Protocols: []string{"sctp"}},
+		{IncludeNets: []string{"10.0.0.1"}},
+		{ExcludePorts: []string{"0"}},
+		{IncludePorts: []string{"9000-8000"}},
+		{IncludePorts: []string{"http"}},
+	} {
+		if _, err := f.Expr(); err == nil {
+			t.Errorf("expected error for %+v", f)
+		}
+	}
+}
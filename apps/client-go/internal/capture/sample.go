@@ -0,0 +1,153 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// adaptInterval is the minimum time between two packet rate changes.
+const adaptInterval = time.Second
+
+// Sampler thins the packets Start delivers. Packet sampling keeps every Nth
+// packet. Flow sampling keeps 1 in FlowRate flows, chosen by a hash of the
+// 5-tuple that is the same in both directions, so a kept flow is complete.
+// Each PacketEvent carries the combined rate so counters can be scaled back
+// up.
+type Sampler struct {
+	flowRate uint64
+	minRate  uint64
+	maxRate  uint64
+	rate     atomic.Uint64 // current packet rate
+
+	// Only touched by the capture goroutine.
+	seen     uint64
+	adjusted time.Time
+	now      func() time.Time
+}
+
+// NewSampler returns a Sampler keeping 1 in packetRate packets of 1 in
+// flowRate flows. With maxPacketRate above packetRate, the packet rate
+// doubles, up to maxPacketRate, while the capture channel is at least 3/4
+// full, and halves back towards packetRate once it drains. It returns nil
+// when nothing would be sampled.
+func NewSampler(packetRate, flowRate, maxPacketRate int) *Sampler {
+	packetRate, flowRate = max(packetRate, 1), max(flowRate, 1)
+	maxPacketRate = max(maxPacketRate, packetRate)
+	if packetRate == 1 && flowRate == 1 && maxPacketRate == 1 {
+		return nil
+	}
+	s := &Sampler{flowRate: uint64(flowRate), minRate: uint64(packetRate), maxRate: uint64(maxPacketRate), now: time.Now}
+	s.rate.Store(uint64(packetRate))
+	return s
+}
+
+// spill makes packet sampling adaptive for OverflowSample, creating a
+// Sampler that keeps every packet until the channel backs up if s is nil.
+func (s *Sampler) spill() *Sampler {
+	if s == nil {
+		return NewSampler(1, 1, spillMaxRate)
+	}
+	if s.maxRate == s.minRate {
+		s.maxRate = s.minRate * spillMaxRate
+	}
+	return s
+}
+
+// PacketRate returns the current 1-in-N packet sampling rate.
+func (s *Sampler) PacketRate() int {
+	if s == nil {
+		return 1
+	}
+	return int(s.rate.Load())
+}
+
+// FlowRate returns the 1-in-N flow sampling rate.
+func (s *Sampler) FlowRate() int {
+	if s == nil {
+		return 1
+	}
+	return int(s.flowRate)
+}
+
+// keepPacket decides on a packet before it is decoded and returns the
+// packet rate it was kept at.
+func (s *Sampler) keepPacket() (rate int, ok bool) {
+	s.seen++
+	r := s.rate.Load()
+	return int(r), s.seen%r == 0
+}
+
+// keepFlow decides on a decoded packet by its flow.
+func (s *Sampler) keepFlow(ev *PacketEvent) bool {
+	if s.flowRate == 1 {
+		return true
+	}
+	return flowHash(ev)%s.flowRate == 0
+}
+
+// adapt adjusts the packet rate to the capture channel's fill level.
+func (s *Sampler) adapt(queued, capacity int) {
+	if s.maxRate == s.minRate {
+		return
+	}
+	now := s.now()
+	if now.Sub(s.adjusted) < adaptInterval {
+		return
+	}
+	rate := s.rate.Load()
+	switch {
+	case queued*4 >= capacity*3 && rate < s.maxRate:
+		rate = min(rate*2, s.maxRate)
+	case queued*10 <= capacity && rate > s.minRate:
+		rate = max(rate/2, s.minRate)
+	default:
+		return
+	}
+	s.rate.Store(rate)
+	s.adjusted = now
+}
+
+// flowHash hashes the 5-tuple with the endpoints in a fixed order, so both
+// directions of a flow hash alike.
+func flowHash(ev *PacketEvent) uint64 {
+	a, b := endpoint(ev.SrcIP, ev.SrcPort), endpoint(ev.DstIP, ev.DstPort)
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	h := fnv.New64a()
+	h.Write([]byte(ev.Protocol))
+	h.Write(a)
+	h.Write(b)
+	// FNV's low bits mix poorly; finish with the splitmix64 finaliser.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func endpoint(ip net.IP, port uint16) []byte {
+	return binary.BigEndian.AppendUint16(append([]byte(nil), ip.To16()...), port)
+}
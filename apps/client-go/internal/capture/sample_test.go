@@ -0,0 +1,123 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewSampler_Disabled(t *testing.T) {
+	if s := NewSampler(1, 1, 0); s != nil {
+		t.Fatal("expected no sampler")
+	}
+	if got := (*Sampler)(nil).PacketRate(); got != 1 {
+		t.Fatalf("nil PacketRate = %d", got)
+	}
+	if got := (*Sampler)(nil).FlowRate(); got != 1 {
+		t.Fatalf("nil FlowRate = %d", got)
+	}
+}
+
+func TestSampler_KeepPacket(t *testing.T) {
+	s := NewSampler(4, 1, 0)
+	var kept []int
+	for i := 1; i <= 12; i++ {
+		if rate, ok := s.keepPacket(); ok {
+			if rate != 4 {
+				t.Fatalf("rate = %d", rate)
+			}
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) != 3 || kept[0] != 4 || kept[2] != 12 {
+		t.Fatalf("kept packets %v", kept)
+	}
+}
+
+func TestSampler_KeepFlow(t *testing.T) {
+	s := NewSampler(1, 8, 0)
+	kept := 0
+	for port := uint16(1024); port < 1024+8000; port++ {
+		out := PacketEvent{SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.IPv4(192, 0, 2, 1), SrcPort: port, DstPort: 443, Protocol: "TCP"}
+		in := PacketEvent{SrcIP: out.DstIP, DstIP: out.SrcIP, SrcPort: 443, DstPort: port, Protocol: "TCP"}
+		keep := s.keepFlow(&out)
+		if keep != s.keepFlow(&in) {
+			t.Fatalf("port %d: directions sampled differently", port)
+		}
+		if keep {
+			kept++
+		}
+	}
+	// 1000 expected; allow for the hash's spread.
+	if kept < 850 || kept > 1150 {
+		t.Fatalf("kept %d of 8000 flows at 1 in 8", kept)
+	}
+}
+
+func TestSampler_Adapt(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewSampler(2, 1, 16)
+	s.now = func() time.Time { return now }
+
+	s.adapt(768, 1024)
+	if got := s.PacketRate(); got != 4 {
+		t.Fatalf("rate after backlog = %d, want 4", got)
+	}
+	// At most one change per adaptInterval.
+	s.adapt(1024, 1024)
+	if got := s.PacketRate(); got != 4 {
+		t.Fatalf("rate changed within interval: %d", got)
+	}
+	for range 5 {
+		now = now.Add(adaptInterval)
+		s.adapt(1024, 1024)
+	}
+	if got := s.PacketRate(); got != 16 {
+		t.Fatalf("rate = %d, want capped at 16", got)
+	}
+
+	now = now.Add(adaptInterval)
+	s.adapt(500, 1024)
+	if got := s.PacketRate(); got != 16 {
+		t.Fatalf("rate changed at half full: %d", got)
+	}
+	for range 5 {
+		now = now.Add(adaptInterval)
+		s.adapt(0, 1024)
+	}
+	if got := s.PacketRate(); got != 2 {
+		t.Fatalf("rate = %d, want back at 2", got)
+	}
+}
+
+func TestSampler_Spill(t *testing.T) {
+	s := (*Sampler)(nil).spill()
+	if s == nil || s.PacketRate() != 1 || s.maxRate != spillMaxRate {
+		t.Fatalf("spill from nil = %+v", s)
+	}
+	fixed := NewSampler(4, 1, 0)
+	if got := fixed.spill(); got != fixed || got.maxRate != 4*spillMaxRate {
+		t.Fatalf("spill of a fixed sampler: max %d", got.maxRate)
+	}
+	adaptive := NewSampler(4, 1, 64)
+	if got := adaptive.spill(); got.maxRate != 64 {
+		t.Fatalf("spill changed an adaptive maximum to %d", got.maxRate)
+	}
+}
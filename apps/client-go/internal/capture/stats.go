@@ -0,0 +1,98 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import (
+	"sync/atomic"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// Counters tracks a capture started with WithCounters.
+type Counters struct {
+	received atomic.Uint64
+	dropped  atomic.Uint64
+	peak     atomic.Int64
+
+	// Set by Start before capturing.
+	policy  string
+	sampler *Sampler
+}
+
+// Stats reports the health of a capture. Counts are cumulative since the
+// capture started.
+type Stats struct {
+	Policy string
+	// Received counts packets read from the handle, before sampling.
+	Received uint64
+	// ChannelDrops counts packets dropped because the channel was full.
+	ChannelDrops uint64
+	// KernelDrops and IfDrops are pcap's counts of packets dropped by the
+	// kernel for lack of buffer space and by the interface or its driver.
+	// They are zero when KernelStats is false.
+	KernelDrops uint64
+	IfDrops     uint64
+	KernelStats bool
+	// Queued and Capacity describe the channel now; PeakQueued is its
+	// highest fill since the previous call to Stats.
+	Queued     int
+	Capacity   int
+	PeakQueued int
+	// PacketRate is the current 1-in-N packet sampling rate.
+	PacketRate int
+}
+
+// observe records the channel fill after a send. Only the capture
+// goroutine calls it.
+func (c *Counters) observe(queued int) {
+	if int64(queued) > c.peak.Load() {
+		c.peak.Store(int64(queued))
+	}
+}
+
+// Stats reads the counters together with handle's kernel statistics and
+// resets the peak fill. A failure to read the kernel statistics leaves
+// KernelStats false.
+func (c *Counters) Stats(handle *pcap.Handle, packets <-chan PacketEvent) Stats {
+	st := Stats{
+		Policy:       c.policy,
+		Received:     c.received.Load(),
+		ChannelDrops: c.dropped.Load(),
+		Queued:       len(packets),
+		Capacity:     cap(packets),
+		PeakQueued:   int(c.peak.Swap(0)),
+		PacketRate:   c.sampler.PacketRate(),
+	}
+	st.PeakQueued = max(st.PeakQueued, st.Queued)
+	if ps, err := handle.Stats(); err == nil {
+		st.KernelDrops = uint64(ps.PacketsDropped)
+		st.IfDrops = uint64(ps.PacketsIfDropped)
+		st.KernelStats = true
+	}
+	return st
+}
+
+// Sub returns the counts accumulated since prev; the channel fill and
+// rate are s's.
+func (s Stats) Sub(prev Stats) Stats {
+	s.Received -= prev.Received
+	s.ChannelDrops -= prev.ChannelDrops
+	s.KernelDrops -= min(prev.KernelDrops, s.KernelDrops)
+	s.IfDrops -= min(prev.IfDrops, s.IfDrops)
+	return s
+}
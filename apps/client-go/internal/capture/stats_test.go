@@ -0,0 +1,48 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capture
+
+import "testing"
+
+func TestCounters_Peak(t *testing.T) {
+	var c Counters
+	for _, q := range []int{3, 9, 4} {
+		c.observe(q)
+	}
+	if got := c.peak.Swap(0); got != 9 {
+		t.Fatalf("peak = %d, want 9", got)
+	}
+}
+
+func TestStats_Sub(t *testing.T) {
+	prev := Stats{Received: 100, ChannelDrops: 5, KernelDrops: 10, IfDrops: 2}
+	cur := Stats{Received: 250, ChannelDrops: 5, KernelDrops: 40, IfDrops: 1, PeakQueued: 7, Capacity: 16}
+
+	d := cur.Sub(prev)
+	if d.Received != 150 || d.ChannelDrops != 0 || d.KernelDrops != 30 {
+		t.Fatalf("delta = %+v", d)
+	}
+	// A counter that went backwards (pcap's 32-bit counters wrap) counts
+	// as zero rather than underflowing.
+	if d.IfDrops != 0 {
+		t.Fatalf("IfDrops = %d", d.IfDrops)
+	}
+	if d.PeakQueued != 7 || d.Capacity != 16 {
+		t.Fatalf("fill not kept: %+v", d)
+	}
+}
@@ -80,6 +80,33 @@ func TestParse_Defaults(t *testing.T) {
 	if cfg.Direction != "out" {
 		t.Fatalf("expected direction out, got %q", cfg.Direction)
 	}
+	if cfg.MetricsInterval != time.Minute {
+		t.Fatalf("expected metrics-interval 1m, got %v", cfg.MetricsInterval)
+	}
+	if cfg.MetricsRetention != 168 {
+		t.Fatalf("expected metrics-retention 168, got %d", cfg.MetricsRetention)
+	}
+	if cfg.Compression != "gzip" {
+		t.Fatalf("expected compression gzip, got %q", cfg.Compression)
+	}
+	if cfg.WireFormat != "json" {
+		t.Fatalf("expected wire-format json, got %q", cfg.WireFormat)
+	}
+	if cfg.RetryMaxAttempts != 3 || cfg.RetryMaxDelay != 10*time.Second {
+		t.Fatalf("expected retry defaults 3/10s, got %d/%v", cfg.RetryMaxAttempts, cfg.RetryMaxDelay)
+	}
+	if cfg.RemoteConfigInterval != time.Minute || len(cfg.LockedSettings) != 0 {
+		t.Fatalf("expected remote config defaults 1m/none, got %v/%v", cfg.RemoteConfigInterval, cfg.LockedSettings)
+	}
+	if cfg.StateDir != "/var/lib/byteroute-client" {
+		t.Fatalf("expected default state dir, got %q", cfg.StateDir)
+	}
+	if cfg.Transport != "post" || cfg.StreamInterval != time.Second {
+		t.Fatalf("expected transport defaults post/1s, got %q/%v", cfg.Transport, cfg.StreamInterval)
+	}
+	if cfg.TLSMinVersion != "1.2" || cfg.MaxIdleConnsPerHost != 4 || cfg.IdleConnTimeout != 90*time.Second || cfg.TCPKeepAlive != 30*time.Second {
+		t.Fatalf("unexpected transport defaults: %+v", cfg)
+	}
 }
 
 func TestParse_FlagsOverrideDefaults(t *testing.T) {
@@ -232,3 +259,280 @@ func TestParse_LegacyFlowEnv_Integer(t *testing.T) {
 		t.Fatalf("expected flush=12s via BYTEROUTE_FLOW integer env, got %v", cfg.FlushInterval)
 	}
 }
+
+func TestParse_MetricsFlags(t *testing.T) {
+	resetFlags([]string{"cmd", "--metrics-interval", "10s", "--metrics-retention", "720"})
+	cfg := Parse()
+	if cfg.MetricsInterval != 10*time.Second {
+		t.Fatalf("expected metrics-interval=10s, got %v", cfg.MetricsInterval)
+	}
+	if cfg.MetricsRetention != 720 {
+		t.Fatalf("expected metrics-retention=720, got %d", cfg.MetricsRetention)
+	}
+}
+
+func TestParse_CredentialFlags(t *testing.T) {
+	t.Setenv("BYTEROUTE_ENROLMENT_TOKEN_FILE", "/etc/byteroute/enrolment")
+	resetFlags([]string{"cmd", "--auth-token-file", "/run/token", "--tenant-id", "tenant-a"})
+	cfg := Parse()
+	if cfg.AuthTokenFile != "/run/token" {
+		t.Fatalf("expected auth-token-file=/run/token, got %q", cfg.AuthTokenFile)
+	}
+	if cfg.EnrolmentTokenFile != "/etc/byteroute/enrolment" {
+		t.Fatalf("expected enrolment token file from env, got %q", cfg.EnrolmentTokenFile)
+	}
+	if cfg.TenantID != "tenant-a" {
+		t.Fatalf("expected tenant-id=tenant-a, got %q", cfg.TenantID)
+	}
+}
+
+func TestParse_RemoteConfigFlags(t *testing.T) {
+	resetFlags([]string{"cmd", "--remote-config-interval", "30s", "--locked-settings", "bpf, flush"})
+	cfg := Parse()
+	if cfg.RemoteConfigInterval != 30*time.Second {
+		t.Fatalf("expected remote-config-interval=30s, got %v", cfg.RemoteConfigInterval)
+	}
+	if len(cfg.LockedSettings) != 2 || cfg.LockedSettings[0] != "bpf" || cfg.LockedSettings[1] != "flush" {
+		t.Fatalf("expected locked settings [bpf flush], got %v", cfg.LockedSettings)
+	}
+}
+
+func TestParse_TransportFlags(t *testing.T) {
+	t.Setenv("NO_PROXY", "localhost,10.0.0.0/8")
+	resetFlags([]string{"cmd",
+		"--ca-file", "/etc/byteroute/ca.pem",
+		"--client-cert", "/etc/byteroute/agent.pem",
+		"--client-key", "/etc/byteroute/agent-key.pem",
+		"--tls-min-version", "1.3",
+		"--tls-pin-spki", "sha256/AAAA, sha256/BBBB",
+		"--proxy", "http://proxy.corp:3128",
+	})
+	cfg := Parse()
+	if cfg.CAFile != "/etc/byteroute/ca.pem" || cfg.ClientCert != "/etc/byteroute/agent.pem" || cfg.ClientKey != "/etc/byteroute/agent-key.pem" {
+		t.Fatalf("unexpected TLS files: %q %q %q", cfg.CAFile, cfg.ClientCert, cfg.ClientKey)
+	}
+	if cfg.TLSMinVersion != "1.3" {
+		t.Fatalf("expected tls-min-version=1.3, got %q", cfg.TLSMinVersion)
+	}
+	if len(cfg.PinnedSPKI) != 2 || cfg.PinnedSPKI[1] != "sha256/BBBB" {
+		t.Fatalf("expected two pins, got %v", cfg.PinnedSPKI)
+	}
+	if cfg.Proxy != "http://proxy.corp:3128" || cfg.NoProxy != "localhost,10.0.0.0/8" {
+		t.Fatalf("expected proxy with NO_PROXY from env, got %q / %q", cfg.Proxy, cfg.NoProxy)
+	}
+}
+
+func TestValidate_ClientCertNeedsKey(t *testing.T) {
+	cfg := localConfig()
+	cfg.ClientCert = "/etc/byteroute/agent.pem"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for --client-cert without --client-key")
+	}
+}
+
+func TestParse_TransportStream(t *testing.T) {
+	t.Setenv("BYTEROUTE_TRANSPORT", "stream")
+	resetFlags([]string{"cmd", "--stream-interval", "250ms"})
+	cfg := Parse()
+	if cfg.Transport != "stream" || cfg.StreamInterval != 250*time.Millisecond {
+		t.Fatalf("expected stream/250ms, got %q/%v", cfg.Transport, cfg.StreamInterval)
+	}
+}
+
+func TestValidate_Transport(t *testing.T) {
+	cfg := localConfig()
+	cfg.Transport = "grpc"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an unknown transport")
+	}
+}
+
+func TestParse_OTLPFlags(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=abc")
+	resetFlags([]string{"cmd", "--otlp-protocol", "http/json", "--otlp-compression", "gzip"})
+	cfg := Parse()
+	if cfg.OTLPEndpoint != "http://collector:4318" || cfg.OTLPHeaders != "api-key=abc" {
+		t.Fatalf("expected OTLP settings from env, got %q / %q", cfg.OTLPEndpoint, cfg.OTLPHeaders)
+	}
+	if cfg.OTLPProtocol != "http/json" || cfg.OTLPCompression != "gzip" {
+		t.Fatalf("expected http/json with gzip, got %q / %q", cfg.OTLPProtocol, cfg.OTLPCompression)
+	}
+}
+
+func TestValidate_OTLPProtocol(t *testing.T) {
+	cfg := localConfig()
+	cfg.OTLPProtocol = "grpc"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for OTLP over gRPC")
+	}
+}
+
+func TestParse_AnonFlags(t *testing.T) {
+	t.Setenv("BYTEROUTE_ANON_REMOTE", "cryptopan")
+	resetFlags([]string{"cmd", "--anon-local", "truncate", "--anon-ipv4-prefix", "16", "--anon-secret-file", "/etc/byteroute/anon.key"})
+	cfg := Parse()
+	if cfg.AnonLocal != "truncate" || cfg.AnonRemote != "cryptopan" {
+		t.Fatalf("expected truncate/cryptopan, got %q/%q", cfg.AnonLocal, cfg.AnonRemote)
+	}
+	if cfg.AnonIPv4Prefix != 16 || cfg.AnonIPv6Prefix != 48 || cfg.AnonSecretFile != "/etc/byteroute/anon.key" {
+		t.Fatalf("unexpected anonymisation settings %+v", cfg)
+	}
+}
+
+func TestValidate_Anon(t *testing.T) {
+	cfg := localConfig()
+	cfg.AnonRemote = "scramble"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an unknown anonymisation mode")
+	}
+	cfg = localConfig()
+	cfg.AnonIPv6Prefix = 129
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an IPv6 prefix over 128")
+	}
+}
+
+func TestParse_FlowIDScheme(t *testing.T) {
+	resetFlags([]string{"cmd"})
+	if cfg := Parse(); cfg.FlowIDScheme != "hmac" || !cfg.FlowIDEpochs {
+		t.Fatalf("expected hmac flow IDs with epochs by default, got %q/%v", cfg.FlowIDScheme, cfg.FlowIDEpochs)
+	}
+	t.Setenv("BYTEROUTE_FLOW_ID_SCHEME", "sha1")
+	resetFlags([]string{"cmd", "--flow-id-secret-file", "/etc/byteroute/flow-id.key", "--flow-id-epochs=false"})
+	cfg := Parse()
+	if cfg.FlowIDScheme != "sha1" || cfg.FlowIDSecretFile != "/etc/byteroute/flow-id.key" || cfg.FlowIDEpochs {
+		t.Fatalf("unexpected flow ID settings %q / %q", cfg.FlowIDScheme, cfg.FlowIDSecretFile)
+	}
+	t.Setenv("BYTEROUTE_FLOW_ID_EPOCHS", "false")
+	resetFlags([]string{"cmd"})
+	if Parse().FlowIDEpochs {
+		t.Fatal("expected BYTEROUTE_FLOW_ID_EPOCHS=false to disable epochs")
+	}
+
+	cfg.FlowIDScheme = "md5"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an unknown flow ID scheme")
+	}
+}
+
+func TestParse_PrivilegeFlags(t *testing.T) {
+	t.Setenv("BYTEROUTE_USER", "byteroute")
+	resetFlags([]string{"cmd", "--keep-caps", "net_raw, net_admin", "--seccomp"})
+	cfg := Parse()
+	if cfg.User != "byteroute" || cfg.Group != "" || !cfg.Seccomp {
+		t.Fatalf("unexpected privilege settings %q / %q / %v", cfg.User, cfg.Group, cfg.Seccomp)
+	}
+	if len(cfg.KeepCaps) != 2 || cfg.KeepCaps[0] != "net_raw" || cfg.KeepCaps[1] != "net_admin" {
+		t.Fatalf("unexpected keep-caps %q", cfg.KeepCaps)
+	}
+}
+
+func TestParse_BPFFilterLists(t *testing.T) {
+	t.Setenv("BYTEROUTE_BPF_EXCLUDE_NETS", "10.0.0.0/8, 192.168.0.0/16")
+	resetFlags([]string{"cmd", "--bpf-protocols", "tcp", "--bpf-include-ports", "443,8000-8080"})
+	cfg := Parse()
+	if len(cfg.BPFProtocols) != 1 || len(cfg.BPFExcludeNets) != 2 || cfg.BPFExcludeNets[1] != "192.168.0.0/16" {
+		t.Fatalf("unexpected filter lists %q / %q", cfg.BPFProtocols, cfg.BPFExcludeNets)
+	}
+	if len(cfg.BPFIncludePorts) != 2 || cfg.BPFIncludeNets != nil || cfg.BPFExcludePorts != nil {
+		t.Fatalf("unexpected port lists %q / %q", cfg.BPFIncludePorts, cfg.BPFExcludePorts)
+	}
+}
+
+func TestValidate_BPFIPv6(t *testing.T) {
+	cfg := localConfig()
+	cfg.Direction = "out"
+	cfg.BPFIncludeNets = []string{"10.0.0.0/8", "2001:db8::/32"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an IPv6 net with --direction out")
+	}
+	cfg.BPFIncludeNets = nil
+	cfg.BPFProtocols = []string{"tcp", "icmp6"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for icmp6 with --direction out")
+	}
+	cfg.Direction = "both"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("icmp6 with --direction both: %v", err)
+	}
+	cfg.Direction = "in"
+	cfg.BPF = "icmp6"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("icmp6 with --bpf: %v", err)
+	}
+}
+
+func TestParse_RulesFile(t *testing.T) {
+	t.Setenv("BYTEROUTE_RULES_FILE", "/etc/byteroute/rules.json")
+	resetFlags([]string{"cmd"})
+	if cfg := Parse(); cfg.RulesFile != "/etc/byteroute/rules.json" {
+		t.Fatalf("RulesFile = %q", cfg.RulesFile)
+	}
+}
+
+func TestParse_Sampling(t *testing.T) {
+	resetFlags([]string{"cmd", "--sample-packets", "10", "--sample-flows", "4", "--sample-packets-max", "100"})
+	cfg := Parse()
+	if cfg.SamplePackets != 10 || cfg.SampleFlows != 4 || cfg.SamplePacketsMax != 100 {
+		t.Fatalf("sampling = %d/%d/%d", cfg.SamplePackets, cfg.SampleFlows, cfg.SamplePacketsMax)
+	}
+}
+
+func TestValidate_SamplePacketsMax(t *testing.T) {
+	cfg := localConfig()
+	cfg.SamplePackets = 10
+	cfg.SamplePacketsMax = 5
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for a maximum below --sample-packets")
+	}
+}
+
+func TestParse_CaptureOverflow(t *testing.T) {
+	t.Setenv("BYTEROUTE_CAPTURE_OVERFLOW", "drop")
+	resetFlags([]string{"cmd", "--capture-queue", "8192"})
+	cfg := Parse()
+	if cfg.CaptureOverflow != "drop" || cfg.CaptureQueue != 8192 {
+		t.Fatalf("overflow = %q, queue = %d", cfg.CaptureOverflow, cfg.CaptureQueue)
+	}
+}
+
+func TestValidate_CaptureOverflow(t *testing.T) {
+	cfg := localConfig()
+	cfg.CaptureOverflow = "spill"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for an unknown overflow policy")
+	}
+}
+
+func TestValidate_APIListen(t *testing.T) {
+	cfg := localConfig()
+	for _, addr := range []string{"127.0.0.1:9099", "[::1]:9099", "localhost:9099", "unix:/run/byteroute.sock"} {
+		cfg.APIListen = addr
+		if err := Validate(cfg); err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{":9099", "0.0.0.0:9099", "10.0.0.1:9099"} {
+		cfg.APIListen = addr
+		if err := Validate(cfg); err == nil {
+			t.Fatalf("%s: expected error without --api-token", addr)
+		}
+	}
+	cfg.APIToken = "secret"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a token to allow %s: %v", cfg.APIListen, err)
+	}
+}
+
+func TestValidate_OTLPOnly(t *testing.T) {
+	cfg := localConfig()
+	cfg.BackendURL = ""
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error without a backend or an OTLP endpoint")
+	}
+	cfg.OTLPEndpoint = "http://collector:4318"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected OTLP-only config to be valid: %v", err)
+	}
+}
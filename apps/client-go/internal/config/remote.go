@@ -0,0 +1,117 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Remote is a configuration document served by the backend. Settings are
+// keyed by flag name; durations are strings such as "10s".
+type Remote struct {
+	Version  string                     `json:"version"`
+	Settings map[string]json.RawMessage `json:"settings"`
+}
+
+// remoteSettings are the settings the backend may change, each with the
+// parser used for its flag.
+var remoteSettings = map[string]func(*Config, string) error{
+	"bpf":              func(c *Config, v string) error { c.BPF = v; return nil },
+	"direction":        func(c *Config, v string) error { c.Direction = v; return nil },
+	"dedupe":           func(c *Config, v string) error { c.DedupMode = v; return nil },
+	"compression":      func(c *Config, v string) error { c.Compression = v; return nil },
+	"wire-format":      func(c *Config, v string) error { c.WireFormat = v; return nil },
+	"flush":            durationSetting(func(c *Config) *time.Duration { return &c.FlushInterval }),
+	"idle-ttl":         durationSetting(func(c *Config) *time.Duration { return &c.IdleTTL }),
+	"metrics-interval": durationSetting(func(c *Config) *time.Duration { return &c.MetricsInterval }),
+	"max-batch-conns":  intSetting(func(c *Config) *int { return &c.MaxBatchConns }),
+	"max-batch-bytes":  intSetting(func(c *Config) *int { return &c.MaxBatchBytes }),
+}
+
+func durationSetting(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func intSetting(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// ApplyRemote returns cfg with the document's settings applied, skipping
+// the locked ones, and validated like the command line. cfg should be the
+// local configuration, so a setting removed on the server reverts. ignored
+// lists locked and unknown settings that were not applied.
+func (cfg Config) ApplyRemote(doc Remote) (next Config, ignored []string, err error) {
+	next = cfg
+	names := make([]string, 0, len(doc.Settings))
+	for name := range doc.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		set, ok := remoteSettings[name]
+		if !ok || slices.Contains(cfg.LockedSettings, name) {
+			ignored = append(ignored, name)
+			continue
+		}
+		v, err := settingValue(doc.Settings[name])
+		if err != nil {
+			return cfg, nil, fmt.Errorf("setting %s: %w", name, err)
+		}
+		if err := set(&next, v); err != nil {
+			return cfg, nil, fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+	if err := Validate(next); err != nil {
+		return cfg, nil, err
+	}
+	return next, ignored, nil
+}
+
+// settingValue accepts a JSON string or number and returns it in the form
+// the flag parser expects.
+func settingValue(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), nil
+	}
+	return "", fmt.Errorf("expected a string or number, got %s", raw)
+}
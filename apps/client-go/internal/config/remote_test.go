@@ -0,0 +1,137 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func localConfig() Config {
+	return Config{
+		BackendURL:       "http://localhost:4000",
+		Direction:        "out",
+		DedupMode:        "flow",
+		FlushInterval:    5 * time.Second,
+		MaxBatchConns:    200,
+		MaxBatchBytes:    1500000,
+		Compression:      "gzip",
+		WireFormat:       "json",
+		Transport:        "post",
+		StreamInterval:   time.Second,
+		RetryMaxAttempts: 3,
+		MetricsInterval:  time.Minute,
+		IdleTTL:          2 * time.Minute,
+	}
+}
+
+func remoteDoc(t *testing.T, settings map[string]any) Remote {
+	t.Helper()
+	doc := Remote{Version: "v1", Settings: map[string]json.RawMessage{}}
+	for k, v := range settings {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.Settings[k] = raw
+	}
+	return doc
+}
+
+func TestApplyRemote(t *testing.T) {
+	next, ignored, err := localConfig().ApplyRemote(remoteDoc(t, map[string]any{
+		"flush":           "10s",
+		"max-batch-conns": 50,
+		"dedupe":          "ip",
+		"bpf":             "tcp port 443",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ignored) != 0 {
+		t.Fatalf("expected nothing ignored, got %v", ignored)
+	}
+	if next.FlushInterval != 10*time.Second || next.MaxBatchConns != 50 || next.DedupMode != "ip" || next.BPF != "tcp port 443" {
+		t.Fatalf("settings not applied: %+v", next)
+	}
+}
+
+func TestApplyRemote_LockedAndUnknownIgnored(t *testing.T) {
+	cfg := localConfig()
+	cfg.LockedSettings = []string{"bpf"}
+	next, ignored, err := cfg.ApplyRemote(remoteDoc(t, map[string]any{
+		"bpf":         "udp",
+		"iface":       "eth1",
+		"wire-format": "protobuf",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.BPF != "" || next.Iface != "" {
+		t.Fatalf("locked or unknown setting applied: %+v", next)
+	}
+	if next.WireFormat != "protobuf" {
+		t.Fatalf("expected wire-format protobuf, got %q", next.WireFormat)
+	}
+	if !slices.Equal(ignored, []string{"bpf", "iface"}) {
+		t.Fatalf("expected bpf and iface ignored, got %v", ignored)
+	}
+}
+
+func TestApplyRemote_InvalidRejected(t *testing.T) {
+	cases := []map[string]any{
+		{"compression": "brotli"},
+		{"flush": "soon"},
+		{"flush": "0s"},
+		{"max-batch-conns": 0},
+		{"direction": "sideways"},
+		{"dedupe": []string{"ip"}},
+	}
+	for _, settings := range cases {
+		cfg := localConfig()
+		next, _, err := cfg.ApplyRemote(remoteDoc(t, settings))
+		if err == nil {
+			t.Fatalf("expected %v to be rejected", settings)
+		}
+		if next.FlushInterval != cfg.FlushInterval || next.Compression != cfg.Compression {
+			t.Fatalf("rejected document changed the config: %+v", next)
+		}
+	}
+}
+
+func TestApplyRemote_RemovedSettingReverts(t *testing.T) {
+	local := localConfig()
+	first, _, err := local.ApplyRemote(remoteDoc(t, map[string]any{"flush": "30s"}))
+	if err != nil || first.FlushInterval != 30*time.Second {
+		t.Fatalf("expected flush 30s, got %v (%v)", first.FlushInterval, err)
+	}
+	second, _, err := local.ApplyRemote(remoteDoc(t, map[string]any{}))
+	if err != nil || second.FlushInterval != local.FlushInterval {
+		t.Fatalf("expected flush to revert to %v, got %v (%v)", local.FlushInterval, second.FlushInterval, err)
+	}
+}
+
+func TestValidate_LockedSettings(t *testing.T) {
+	cfg := localConfig()
+	cfg.LockedSettings = []string{"flush", "auth-token"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("expected error for a setting that cannot be configured remotely")
+	}
+}
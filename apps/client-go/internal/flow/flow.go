@@ -18,12 +18,13 @@
 package flow
 
 import (
-	"encoding/json"
+	"cmp"
 	"net"
-	"sort"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/byteroute/client-go/internal/anon"
 	"github.com/byteroute/client-go/internal/backend"
 	"github.com/byteroute/client-go/internal/util"
 )
@@ -36,28 +37,88 @@ type Key struct {
 	Protocol string
 }
 
+func (k Key) compare(o Key) int {
+	return cmp.Or(
+		cmp.Compare(k.SrcIP, o.SrcIP),
+		cmp.Compare(k.DstIP, o.DstIP),
+		cmp.Compare(k.SrcPort, o.SrcPort),
+		cmp.Compare(k.DstPort, o.DstPort),
+		cmp.Compare(k.Protocol, o.Protocol),
+	)
+}
+
 type entry struct {
 	key        Key
 	id         string
+	conv       string // conversation ID
+	dir        string // "out", "in" or "" as in backend.Connection
 	firstSeen  time.Time
 	lastSeen   time.Time
 	bytesIn    int64
 	bytesOut   int64
 	packetsIn  int64
 	packetsOut int64
+	sampled    int64 // packets captured, before scaling by the sampling rate
 	dirty      bool
 	pending    bool
 	inactive   bool
+
+	// origSrc and origDst are the endpoints of the first packet before
+	// anonymisation, oriented like key; empty without an anonymiser.
+	origSrc string
+	origDst string
+
+	// acked holds the cumulative counters as of the last acknowledged export
+	// and ackedAt the end of that export's interval; the difference to the
+	// live counters is the per-interval delta. inflight/inflightAt capture the
+	// values handed out by ExportBatch until the batch is Acked or Nacked.
+	acked      counters
+	ackedAt    time.Time
+	inflight   counters
+	inflightAt time.Time
+
+	// changed, seen and seenAt are the same for Changes, which exports
+	// without waiting for the backend; next/nextAt are handed out by
+	// Changes until MarkSeen.
+	changed bool
+	seen    counters
+	seenAt  time.Time
+	next    counters
+	nextAt  time.Time
+}
+
+type counters struct {
+	bytesIn    int64
+	bytesOut   int64
+	packetsIn  int64
+	packetsOut int64
+}
+
+func (e *entry) cumulative() counters {
+	return counters{bytesIn: e.bytesIn, bytesOut: e.bytesOut, packetsIn: e.packetsIn, packetsOut: e.packetsOut}
+}
+
+func (c counters) sub(o counters) counters {
+	return counters{
+		bytesIn:    c.bytesIn - o.bytesIn,
+		bytesOut:   c.bytesOut - o.bytesOut,
+		packetsIn:  c.packetsIn - o.packetsIn,
+		packetsOut: c.packetsOut - o.packetsOut,
+	}
 }
 
 type Aggregator struct {
-	hostID   string
+	ids      util.FlowIDs
+	epochs   bool
 	dedup    string
 	idleTTL  time.Duration
 	localIPs map[string]struct{}
+	anon     *anon.Anonymizer
 
 	mu    sync.Mutex
 	flows map[Key]*entry
+
+	dirty chan struct{}
 }
 
 // ResetPending clears the internal pending state for all flows.
@@ -79,15 +140,54 @@ func New(hostID, dedupMode string, idleTTL time.Duration, localIPs map[string]st
 		localIPs = map[string]struct{}{}
 	}
 	return &Aggregator{
-		hostID:   hostID,
+		ids:      util.LegacyIDs{HostID: hostID},
 		dedup:    dedupMode,
 		idleTTL:  idleTTL,
 		localIPs: localIPs,
 		flows:    map[Key]*entry{},
+		dirty:    make(chan struct{}, 1),
 	}
 }
 
-func (a *Aggregator) keyFor(srcIP, dstIP net.IP, srcPort, dstPort uint16, proto string) Key {
+// Dirty returns a channel that receives a value after Update changed a
+// flow. Signals are coalesced: one receive may stand for many updates.
+func (a *Aggregator) Dirty() <-chan struct{} {
+	return a.dirty
+}
+
+// SetAnonymizer makes flows keyed by anonymised endpoint addresses, so
+// original addresses are neither exported nor used to derive flow IDs.
+// Flows that map to the same anonymised key are merged. Call it before the
+// first Update.
+func (a *Aggregator) SetAnonymizer(an *anon.Anonymizer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.anon = an
+}
+
+// SetFlowIDs replaces the legacy SHA-1 flow IDs derived from the host ID.
+// With epochs, a flow's ID also covers its first-seen time, so a key that
+// is reused after the flow was pruned starts a new record; the
+// conversation ID stays derived from the key alone. Call it before the
+// first Update.
+func (a *Aggregator) SetFlowIDs(ids util.FlowIDs, epochs bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ids = ids
+	a.epochs = epochs
+}
+
+// Reconfigure changes the dedup mode and idle TTL of a running aggregator.
+// Flows already tracked keep their keys and age out under the new TTL.
+func (a *Aggregator) Reconfigure(dedupMode string, idleTTL time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dedup = dedupMode
+	a.idleTTL = idleTTL
+}
+
+// keyFor also returns the original endpoints oriented like the key.
+func (a *Aggregator) keyFor(srcIP, dstIP net.IP, srcPort, dstPort uint16, proto string) (k Key, origSrc, origDst string) {
 	src := srcIP.String()
 	dst := dstIP.String()
 
@@ -98,30 +198,67 @@ func (a *Aggregator) keyFor(srcIP, dstIP net.IP, srcPort, dstPort uint16, proto
 	if dstLocal && !srcLocal {
 		src, dst = dst, src
 		srcPort, dstPort = dstPort, srcPort
+		srcLocal, dstLocal = dstLocal, srcLocal
+	}
+	origSrc, origDst = src, dst
+	if a.anon != nil {
+		src = a.anon.Addr(src, srcLocal)
+		dst = a.anon.Addr(dst, dstLocal)
 	}
 
-	k := Key{SrcIP: src, DstIP: dst, SrcPort: srcPort, DstPort: dstPort, Protocol: proto}
+	k = Key{SrcIP: src, DstIP: dst, SrcPort: srcPort, DstPort: dstPort, Protocol: proto}
 	if a.dedup == "ip" {
 		k.SrcPort = 0
 		k.DstPort = 0
 	}
-	return k
+	return k, origSrc, origDst
+}
+
+// direction tells who sent a flow's first packet: "out" for a local
+// endpoint talking to a remote one, "in" for the reverse.
+func (a *Aggregator) direction(srcIP, dstIP net.IP) string {
+	_, srcLocal := a.localIPs[srcIP.String()]
+	_, dstLocal := a.localIPs[dstIP.String()]
+	switch {
+	case srcLocal && !dstLocal:
+		return "out"
+	case dstLocal && !srcLocal:
+		return "in"
+	}
+	return ""
 }
 
-func (a *Aggregator) Update(ts time.Time, srcIP, dstIP net.IP, srcPort, dstPort uint16, proto string, length int) {
-	k := a.keyFor(srcIP, dstIP, srcPort, dstPort, proto)
+// Update accounts a packet to its flow and reports whether it started a new flow.
+func (a *Aggregator) Update(ts time.Time, srcIP, dstIP net.IP, srcPort, dstPort uint16, proto string, length int) bool {
+	return a.UpdateSampled(ts, srcIP, dstIP, srcPort, dstPort, proto, length, 1)
+}
 
+// UpdateSampled is Update for a packet captured at a 1-in-rate sampling
+// rate: it counts as rate packets of length bytes.
+func (a *Aggregator) UpdateSampled(ts time.Time, srcIP, dstIP net.IP, srcPort, dstPort uint16, proto string, length, rate int) bool {
+	rate = max(rate, 1)
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	k, origSrc, origDst := a.keyFor(srcIP, dstIP, srcPort, dstPort, proto)
+
 	e := a.flows[k]
-	if e == nil {
-		id := util.StableID(a.hostID, k.Protocol, k.SrcIP, k.DstIP, k.SrcPort, k.DstPort)
-		e = &entry{key: k, id: id, firstSeen: ts, lastSeen: ts, dirty: true, inactive: false}
+	created := e == nil
+	if created {
+		conv := a.ids.ID(k.Protocol, k.SrcIP, k.DstIP, k.SrcPort, k.DstPort)
+		id := conv
+		if a.epochs {
+			id = a.ids.ID(k.Protocol, k.SrcIP, k.DstIP, k.SrcPort, k.DstPort, ts.UnixNano())
+		}
+		e = &entry{key: k, id: id, conv: conv, dir: a.direction(srcIP, dstIP), firstSeen: ts, lastSeen: ts, ackedAt: ts, seenAt: ts, dirty: true, changed: true, inactive: false}
+		if a.anon != nil {
+			e.origSrc, e.origDst = origSrc, origDst
+		}
 		a.flows[k] = e
 	} else {
 		e.lastSeen = ts
 		e.dirty = true
+		e.changed = true
 		// Mark as active if it was inactive
 		if e.inactive {
 			e.inactive = false
@@ -130,21 +267,41 @@ func (a *Aggregator) Update(ts time.Time, srcIP, dstIP net.IP, srcPort, dstPort
 
 	// Direction is based on the original packet direction (pre-canonicalization).
 	_, srcLocal := a.localIPs[srcIP.String()]
+	n := int64(rate)
 	if srcLocal {
-		e.bytesOut += int64(length)
-		e.packetsOut++
+		e.bytesOut += int64(length) * n
+		e.packetsOut += n
 	} else {
-		e.bytesIn += int64(length)
-		e.packetsIn++
+		e.bytesIn += int64(length) * n
+		e.packetsIn += n
+	}
+	e.sampled++
+
+	select {
+	case a.dirty <- struct{}{}:
+	default:
+	}
+	return created
+}
+
+// Endpoints returns the source and destination addresses of k's flow as
+// captured, before anonymisation. Flows merged under one anonymised key
+// report the endpoints of the first one. They are never exported.
+func (a *Aggregator) Endpoints(k Key) (src, dst string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e := a.flows[k]; e != nil && e.origSrc != "" {
+		return e.origSrc, e.origDst
 	}
+	return k.SrcIP, k.DstIP
 }
 
 func (a *Aggregator) Prune(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.idleTTL <= 0 {
 		return
 	}
-	a.mu.Lock()
-	defer a.mu.Unlock()
 	for k, e := range a.flows {
 		idle := now.Sub(e.lastSeen)
 
@@ -152,6 +309,7 @@ func (a *Aggregator) Prune(now time.Time) {
 		if idle > a.idleTTL && !e.inactive {
 			e.inactive = true
 			e.dirty = true // Mark dirty so it gets sent with new status
+			e.changed = true
 		}
 
 		// After 2x idleTTL: delete
@@ -163,6 +321,10 @@ func (a *Aggregator) Prune(now time.Time) {
 
 // ExportBatch returns up to max items to send.
 // It marks selected entries as pending so they won't be selected again until Ack/Nack.
+//
+// Each record carries both the cumulative counters since firstSeen and the
+// delta since the last acknowledged export, together with the interval the
+// delta covers. A Nack keeps the delta so it is folded into the next export.
 func (a *Aggregator) ExportBatch(max int) ([]backend.Connection, []Key) {
 	if max <= 0 {
 		return nil, nil
@@ -179,11 +341,7 @@ func (a *Aggregator) ExportBatch(max int) ([]backend.Connection, []Key) {
 	}
 
 	// stable ordering for deterministic behavior
-	sort.Slice(keys, func(i, j int) bool {
-		aBytes, _ := json.Marshal(keys[i])
-		bBytes, _ := json.Marshal(keys[j])
-		return string(aBytes) < string(bBytes)
-	})
+	slices.SortFunc(keys, Key.compare)
 
 	if len(keys) > max {
 		keys = keys[:max]
@@ -199,42 +357,128 @@ func (a *Aggregator) ExportBatch(max int) ([]backend.Connection, []Key) {
 		}
 		e.pending = true
 
-		start := e.firstSeen.UTC().Format(time.RFC3339Nano)
-		last := e.lastSeen.UTC().Format(time.RFC3339Nano)
-		dur := int64(e.lastSeen.Sub(e.firstSeen).Milliseconds())
-		bytesIn := e.bytesIn
-		bytesOut := e.bytesOut
-		packetsIn := e.packetsIn
-		packetsOut := e.packetsOut
+		e.inflight = e.cumulative()
+		e.inflightAt = e.lastSeen
 
-		// Set status based on inactive flag
-		status := "active"
-		if e.inactive {
-			status = "inactive"
+		out = append(out, e.connection())
+		picked = append(picked, k)
+	}
+
+	return out, picked
+}
+
+// Changes returns every flow that changed since it was last marked seen,
+// with deltas since then. It is a second export state next to
+// ExportBatch/Ack for a consumer that does not depend on the backend, so
+// neither waits for the other.
+func (a *Aggregator) Changes() ([]backend.Connection, []Key) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var keys []Key
+	for k, e := range a.flows {
+		if e.changed {
+			keys = append(keys, k)
 		}
+	}
+	slices.SortFunc(keys, Key.compare)
 
-		c := backend.Connection{
-			ID:           e.id,
-			SourceIP:     e.key.SrcIP,
-			DestIP:       e.key.DstIP,
-			SourcePort:   int(e.key.SrcPort),
-			DestPort:     int(e.key.DstPort),
-			Protocol:     e.key.Protocol,
-			Status:       status,
-			StartTime:    start,
-			LastActivity: last,
-			DurationMs:   &dur,
-			BytesIn:      &bytesIn,
-			BytesOut:     &bytesOut,
-			PacketsIn:    &packetsIn,
-			PacketsOut:   &packetsOut,
+	out := make([]backend.Connection, 0, len(keys))
+	for _, k := range keys {
+		e := a.flows[k]
+		e.next, e.nextAt = e.cumulative(), e.lastSeen
+		out = append(out, e.connectionSince(e.seen, e.seenAt))
+	}
+	return out, keys
+}
+
+// MarkSeen records the flows of keys as exported by Changes. Flows not
+// marked are returned again, their deltas still covering the whole time.
+func (a *Aggregator) MarkSeen(keys []Key) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range keys {
+		if e := a.flows[k]; e != nil {
+			e.seen, e.seenAt = e.next, e.nextAt
+			e.changed = e.cumulative() != e.seen
 		}
+	}
+}
 
-		out = append(out, c)
-		picked = append(picked, k)
+// Flows returns a point-in-time view of every tracked flow without touching
+// export state. Deltas are relative to the last acknowledged export.
+func (a *Aggregator) Flows() []backend.Connection {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]backend.Connection, 0, len(a.flows))
+	for _, e := range a.flows {
+		out = append(out, e.connection())
 	}
+	return out
+}
 
-	return out, picked
+// connection converts the entry into its wire representation, with deltas
+// since the last acknowledged export. Callers must hold the aggregator lock.
+func (e *entry) connection() backend.Connection {
+	return e.connectionSince(e.acked, e.ackedAt)
+}
+
+// connectionSince is connection with deltas since base, taken at since.
+func (e *entry) connectionSince(base counters, since time.Time) backend.Connection {
+	start := e.firstSeen.UTC().Format(time.RFC3339Nano)
+	last := e.lastSeen.UTC().Format(time.RFC3339Nano)
+	dur := int64(e.lastSeen.Sub(e.firstSeen).Milliseconds())
+	bytesIn := e.bytesIn
+	bytesOut := e.bytesOut
+	packetsIn := e.packetsIn
+	packetsOut := e.packetsOut
+
+	delta := e.cumulative().sub(base)
+	intervalStart := since.UTC().Format(time.RFC3339Nano)
+
+	// Set status based on inactive flag
+	status := "active"
+	if e.inactive {
+		status = "inactive"
+	}
+
+	return backend.Connection{
+		ID:           e.id,
+		SourceIP:     e.key.SrcIP,
+		DestIP:       e.key.DstIP,
+		SourcePort:   int(e.key.SrcPort),
+		DestPort:     int(e.key.DstPort),
+		Protocol:     e.key.Protocol,
+		Status:       status,
+		StartTime:    start,
+		LastActivity: last,
+		DurationMs:   &dur,
+		BytesIn:      &bytesIn,
+		BytesOut:     &bytesOut,
+		PacketsIn:    &packetsIn,
+		PacketsOut:   &packetsOut,
+
+		ConversationID: e.conv,
+		Direction:      e.dir,
+		SamplingRate:   samplingRate(packetsIn+packetsOut, e.sampled),
+
+		IntervalStart:   intervalStart,
+		IntervalEnd:     last,
+		DeltaBytesIn:    &delta.bytesIn,
+		DeltaBytesOut:   &delta.bytesOut,
+		DeltaPacketsIn:  &delta.packetsIn,
+		DeltaPacketsOut: &delta.packetsOut,
+	}
+}
+
+// samplingRate is the average 1-in-N rate behind estimated packets, or 0
+// when every packet was captured.
+func samplingRate(estimated, sampled int64) int {
+	if sampled == 0 || estimated <= sampled {
+		return 0
+	}
+	return int((estimated + sampled/2) / sampled)
 }
 
 func (a *Aggregator) Ack(keys []Key) {
@@ -245,6 +489,12 @@ func (a *Aggregator) Ack(keys []Key) {
 			// Keep pending=true until the next flush interval to avoid immediately
 			// re-exporting the same flow within the same flush tick.
 			e.dirty = false
+			e.acked = e.inflight
+			e.ackedAt = e.inflightAt
+			// Traffic that arrived after the export belongs to the next interval.
+			if e.cumulative() != e.acked {
+				e.dirty = true
+			}
 		}
 	}
 }
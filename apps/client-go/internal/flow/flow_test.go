@@ -21,6 +21,9 @@ import (
 	"net"
 	"testing"
 	"time"
+
+	"github.com/byteroute/client-go/internal/anon"
+	"github.com/byteroute/client-go/internal/util"
 )
 
 func TestAggregator_DirectionAccounting(t *testing.T) {
@@ -45,6 +48,9 @@ func TestAggregator_DirectionAccounting(t *testing.T) {
 	if batch[0].BytesIn == nil || *batch[0].BytesIn != 60 {
 		t.Fatalf("expected bytesIn=60")
 	}
+	if batch[0].Direction != "out" {
+		t.Fatalf("expected direction out, got %q", batch[0].Direction)
+	}
 
 	agg.Ack(keys)
 	batch2, _ := agg.ExportBatch(10)
@@ -67,6 +73,23 @@ func TestAggregator_DedupeByIP(t *testing.T) {
 	}
 }
 
+func TestAggregator_Reconfigure(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	agg.Reconfigure("ip", time.Minute)
+
+	now := time.Now()
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 1111, 80, "TCP", 10)
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 2222, 443, "TCP", 20)
+	if flows := agg.Flows(); len(flows) != 1 {
+		t.Fatalf("expected ip dedupe after Reconfigure, got %d flows", len(flows))
+	}
+
+	agg.Prune(now.Add(3 * time.Minute))
+	if flows := agg.Flows(); len(flows) != 0 {
+		t.Fatalf("expected the new idle TTL to prune the flow, got %d flows", len(flows))
+	}
+}
+
 func TestAggregator_DoesNotReExportWithinInterval(t *testing.T) {
 	localIPs := map[string]struct{}{"10.0.0.1": {}}
 	agg := New("host", "flow", 0, localIPs)
@@ -246,4 +269,308 @@ func TestAggregator_PacketCounts(t *testing.T) {
 	if *batch[0].BytesIn != 120 {
 		t.Fatalf("expected bytesIn=120, got %d", *batch[0].BytesIn)
 	}
+	if batch[0].SamplingRate != 0 {
+		t.Fatalf("expected no sampling rate, got %d", batch[0].SamplingRate)
+	}
+}
+
+func TestAggregator_SampledCounts(t *testing.T) {
+	agg := New("host", "flow", 0, map[string]struct{}{"10.0.0.1": {}})
+
+	now := time.Now()
+	agg.UpdateSampled(now, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 53, "UDP", 100, 10)
+	agg.UpdateSampled(now.Add(time.Millisecond), net.ParseIP("8.8.8.8"), net.ParseIP("10.0.0.1"), 53, 1234, "UDP", 60, 20)
+
+	batch, _ := agg.ExportBatch(10)
+	c := batch[0]
+	if *c.PacketsOut != 10 || *c.BytesOut != 1000 || *c.PacketsIn != 20 || *c.BytesIn != 1200 {
+		t.Fatalf("unexpected scaled counters out=%d/%d in=%d/%d", *c.PacketsOut, *c.BytesOut, *c.PacketsIn, *c.BytesIn)
+	}
+	if *c.DeltaPacketsIn != 20 {
+		t.Fatalf("expected scaled delta, got %d", *c.DeltaPacketsIn)
+	}
+	if c.SamplingRate != 15 {
+		t.Fatalf("expected average sampling rate 15, got %d", c.SamplingRate)
+	}
+}
+
+func TestAggregator_DeltaCountersPerInterval(t *testing.T) {
+	localIPs := map[string]struct{}{"10.0.0.1": {}}
+	agg := New("host", "flow", 0, localIPs)
+
+	now := time.Now()
+	agg.Update(now, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 443, "TCP", 100)
+	agg.Update(now.Add(time.Second), net.ParseIP("8.8.8.8"), net.ParseIP("10.0.0.1"), 443, 1234, "TCP", 1000)
+
+	batch, keys := agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(batch))
+	}
+	if *batch[0].DeltaBytesOut != 100 || *batch[0].DeltaBytesIn != 1000 {
+		t.Fatalf("expected first delta to equal cumulative, got out=%d in=%d", *batch[0].DeltaBytesOut, *batch[0].DeltaBytesIn)
+	}
+	if batch[0].IntervalStart != batch[0].StartTime {
+		t.Fatalf("expected first interval to start at firstSeen, got %q", batch[0].IntervalStart)
+	}
+	agg.Ack(keys)
+	agg.ResetPending()
+
+	agg.Update(now.Add(2*time.Second), net.ParseIP("8.8.8.8"), net.ParseIP("10.0.0.1"), 443, 1234, "TCP", 500)
+
+	batch, keys = agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(batch))
+	}
+	c := batch[0]
+	if *c.BytesIn != 1500 {
+		t.Fatalf("expected cumulative bytesIn=1500, got %d", *c.BytesIn)
+	}
+	if *c.DeltaBytesIn != 500 || *c.DeltaBytesOut != 0 || *c.DeltaPacketsIn != 1 {
+		t.Fatalf("expected delta in=500 out=0 packetsIn=1, got in=%d out=%d packetsIn=%d", *c.DeltaBytesIn, *c.DeltaBytesOut, *c.DeltaPacketsIn)
+	}
+	if want := now.Add(time.Second).UTC().Format(time.RFC3339Nano); c.IntervalStart != want {
+		t.Fatalf("expected interval start %q, got %q", want, c.IntervalStart)
+	}
+	if c.IntervalEnd != c.LastActivity {
+		t.Fatalf("expected interval end to match last activity, got %q", c.IntervalEnd)
+	}
+	agg.Ack(keys)
+}
+
+func TestAggregator_ChangesIndependentOfExport(t *testing.T) {
+	localIPs := map[string]struct{}{"10.0.0.1": {}}
+	agg := New("host", "flow", 0, localIPs)
+
+	now := time.Now()
+	agg.Update(now, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 443, "TCP", 100)
+
+	// A backend export that is never acknowledged does not hold back
+	// Changes, and Changes does not consume the backend's delta.
+	_, backendKeys := agg.ExportBatch(10)
+	conns, keys := agg.Changes()
+	if len(conns) != 1 || *conns[0].DeltaBytesOut != 100 {
+		t.Fatalf("expected the new flow with delta 100, got %+v", conns)
+	}
+	agg.MarkSeen(keys)
+	if conns, _ := agg.Changes(); len(conns) != 0 {
+		t.Fatalf("expected no changes after MarkSeen, got %d", len(conns))
+	}
+
+	agg.Update(now.Add(time.Second), net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 443, "TCP", 50)
+	conns, _ = agg.Changes()
+	if len(conns) != 1 || *conns[0].DeltaBytesOut != 50 {
+		t.Fatalf("expected delta 50 since the last change, got %+v", conns)
+	}
+
+	// Unmarked changes fold into the next call.
+	agg.Update(now.Add(2*time.Second), net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 443, "TCP", 25)
+	conns, _ = agg.Changes()
+	if len(conns) != 1 || *conns[0].DeltaBytesOut != 75 {
+		t.Fatalf("expected unmarked delta to accumulate to 75, got %+v", conns)
+	}
+
+	agg.Nack(backendKeys)
+	batch, _ := agg.ExportBatch(10)
+	if len(batch) != 1 || *batch[0].DeltaBytesOut != 175 {
+		t.Fatalf("expected backend delta 175, got %+v", batch)
+	}
+}
+
+func TestAggregator_NackKeepsDelta(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	now := time.Now()
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 100)
+
+	_, keys := agg.ExportBatch(10)
+	agg.Nack(keys)
+
+	agg.Update(now.Add(time.Second), net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 50)
+
+	batch, _ := agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(batch))
+	}
+	if got := *batch[0].DeltaBytesIn; got != 150 {
+		t.Fatalf("expected nacked delta to carry over (150), got %d", got)
+	}
+}
+
+func TestAggregator_TrafficBetweenExportAndAckStaysDirty(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	now := time.Now()
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 100)
+
+	_, keys := agg.ExportBatch(10)
+	agg.Update(now.Add(time.Second), net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 70)
+	agg.Ack(keys)
+	agg.ResetPending()
+
+	batch, _ := agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected in-flight traffic to be exported next interval, got %d", len(batch))
+	}
+	if got := *batch[0].DeltaBytesIn; got != 70 {
+		t.Fatalf("expected delta 70, got %d", got)
+	}
+}
+
+func TestAggregator_UpdateReportsNewFlow(t *testing.T) {
+	agg := New("host", "flow", 0, map[string]struct{}{"1.2.3.4": {}})
+	now := time.Now()
+
+	if !agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 100) {
+		t.Fatalf("expected first packet to start a new flow")
+	}
+	if agg.Update(now, net.ParseIP("5.6.7.8"), net.ParseIP("1.2.3.4"), 80, 100, "TCP", 100) {
+		t.Fatalf("expected reply packet to reuse the existing flow")
+	}
+}
+
+func TestAggregator_FlowsDoesNotAffectExport(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	now := time.Now()
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 100, 80, "TCP", 100)
+
+	flows := agg.Flows()
+	if len(flows) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(flows))
+	}
+
+	batch, _ := agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected listing to leave the flow exportable, got %d", len(batch))
+	}
+}
+
+func TestAggregator_DirtySignal(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	select {
+	case <-agg.Dirty():
+		t.Fatal("unexpected signal before any update")
+	default:
+	}
+
+	now := time.Now()
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 1111, 80, "TCP", 10)
+	agg.Update(now, net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), 1111, 80, "TCP", 10)
+	select {
+	case <-agg.Dirty():
+	default:
+		t.Fatal("expected a signal after Update")
+	}
+	select {
+	case <-agg.Dirty():
+		t.Fatal("expected updates to coalesce into one signal")
+	default:
+	}
+}
+
+func TestAggregator_Anonymizer(t *testing.T) {
+	localIPs := map[string]struct{}{"10.0.0.1": {}, "10.0.0.2": {}}
+	agg := New("host", "flow", 0, localIPs)
+	an, err := anon.New(anon.Config{Local: anon.ModeDrop, Remote: anon.ModeTruncate, IPv4Prefix: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.SetAnonymizer(an)
+
+	now := time.Now()
+	// Inbound packet: the local side still ends up as the source.
+	agg.Update(now, net.ParseIP("203.0.113.9"), net.ParseIP("10.0.0.1"), 443, 5000, "TCP", 100)
+	// A second local host with the same ports maps to the same anonymised key.
+	agg.Update(now, net.ParseIP("10.0.0.2"), net.ParseIP("203.0.113.77"), 5000, 443, "TCP", 40)
+
+	batch, _ := agg.ExportBatch(10)
+	if len(batch) != 1 {
+		t.Fatalf("expected the flows to merge under one anonymised key, got %d", len(batch))
+	}
+	c := batch[0]
+	if c.SourceIP != "0.0.0.0" || c.DestIP != "203.0.113.0" {
+		t.Fatalf("expected anonymised endpoints, got %s -> %s", c.SourceIP, c.DestIP)
+	}
+	if want := util.StableID("host", "TCP", "0.0.0.0", "203.0.113.0", uint16(5000), uint16(443)); c.ID != want {
+		t.Fatalf("expected the ID to derive from the anonymised key, got %s", c.ID)
+	}
+	if *c.BytesIn != 100 || *c.BytesOut != 40 {
+		t.Fatalf("expected direction accounting on original addresses, got in=%d out=%d", *c.BytesIn, *c.BytesOut)
+	}
+}
+
+// Export rules see one pair of original endpoints per record: those of the
+// first flow merged under an anonymised key, whatever traffic follows.
+func TestAggregator_EndpointsOfMergedFlows(t *testing.T) {
+	localIPs := map[string]struct{}{"10.0.0.1": {}, "10.0.0.2": {}}
+	agg := New("host", "flow", 0, localIPs)
+	an, err := anon.New(anon.Config{Local: anon.ModeDrop, Remote: anon.ModeTruncate, IPv4Prefix: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.SetAnonymizer(an)
+
+	now := time.Now()
+	agg.Update(now, net.ParseIP("10.0.0.1"), net.ParseIP("203.0.113.9"), 5000, 443, "TCP", 100)
+	for range 3 {
+		now = now.Add(time.Second)
+		agg.Update(now, net.ParseIP("10.0.0.2"), net.ParseIP("203.0.113.77"), 5000, 443, "TCP", 1000)
+	}
+
+	_, keys := agg.ExportBatch(10)
+	if len(keys) != 1 {
+		t.Fatalf("expected one merged flow, got %d", len(keys))
+	}
+	if src, dst := agg.Endpoints(keys[0]); src != "10.0.0.1" || dst != "203.0.113.9" {
+		t.Fatalf("expected the original endpoints of the first flow, got %s -> %s", src, dst)
+	}
+
+	// Without anonymisation the key holds the original endpoints.
+	plain := New("host", "flow", 0, localIPs)
+	plain.Update(now, net.ParseIP("203.0.113.9"), net.ParseIP("10.0.0.1"), 443, 5000, "TCP", 100)
+	_, keys = plain.ExportBatch(10)
+	if src, dst := plain.Endpoints(keys[0]); src != "10.0.0.1" || dst != "203.0.113.9" {
+		t.Fatalf("expected the key's endpoints, got %s -> %s", src, dst)
+	}
+}
+
+func TestAggregator_KeyedFlowIDs(t *testing.T) {
+	agg := New("host", "flow", 0, nil)
+	ids := util.NewKeyedIDs("host", []byte("secret"))
+	agg.SetFlowIDs(ids, false)
+
+	agg.Update(time.Now(), net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 1234, 53, "UDP", 100)
+	batch, _ := agg.ExportBatch(10)
+	if want := ids.ID("UDP", "10.0.0.1", "8.8.8.8", uint16(1234), uint16(53)); batch[0].ID != want {
+		t.Fatalf("expected keyed ID %s, got %s", want, batch[0].ID)
+	}
+}
+
+func TestAggregator_FlowEpochs(t *testing.T) {
+	agg := New("host", "flow", time.Second, nil)
+	ids := util.NewKeyedIDs("host", []byte("secret"))
+	agg.SetFlowIDs(ids, true)
+
+	t0 := time.Now()
+	agg.Update(t0, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 5353, 53, "UDP", 100)
+	first, keys := agg.ExportBatch(10)
+	agg.Ack(keys)
+	agg.ResetPending()
+
+	// The flow ages out and the same 5-tuple is used again.
+	agg.Prune(t0.Add(3 * time.Second))
+	t1 := t0.Add(4 * time.Second)
+	agg.Update(t1, net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8"), 5353, 53, "UDP", 80)
+	second, _ := agg.ExportBatch(10)
+
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("expected one flow per epoch, got %d and %d", len(first), len(second))
+	}
+	if first[0].ID == second[0].ID {
+		t.Fatal("expected a reused key to get a new flow ID")
+	}
+	conv := ids.ID("UDP", "10.0.0.1", "8.8.8.8", uint16(5353), uint16(53))
+	if first[0].ConversationID != conv || second[0].ConversationID != conv {
+		t.Fatalf("expected both epochs in conversation %s, got %s and %s", conv, first[0].ConversationID, second[0].ConversationID)
+	}
+	if want := ids.ID("UDP", "10.0.0.1", "8.8.8.8", uint16(5353), uint16(53), t1.UnixNano()); second[0].ID != want {
+		t.Fatalf("expected the ID to cover the first-seen time, got %s", second[0].ID)
+	}
 }
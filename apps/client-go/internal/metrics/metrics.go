@@ -18,17 +18,97 @@
 package metrics
 
 import (
+	"math"
+	"slices"
 	"sync"
 	"time"
 )
 
+// PacketSizeBounds are the inclusive upper bounds (bytes) of the packet size
+// histogram buckets. Snapshot.PacketSizes has one extra trailing bucket for
+// packets larger than the last bound (jumbo frames, GRO/TSO aggregates).
+var PacketSizeBounds = []int{64, 128, 256, 512, 1024, 1500}
+
 // Snapshot represents aggregated metrics for a time period
 type Snapshot struct {
 	Timestamp    time.Time `json:"timestamp"`
+	EndTime      time.Time `json:"endTime"`
 	Connections  int       `json:"connections"`
 	BandwidthIn  int64     `json:"bandwidthIn"`
 	BandwidthOut int64     `json:"bandwidthOut"`
 	Inactive     int       `json:"inactive"`
+
+	// Packet-level counters, fed from the capture loop.
+	PacketsIn  int64 `json:"packetsIn"`
+	PacketsOut int64 `json:"packetsOut"`
+	// Average and peak throughput in bytes per second. Peaks are the busiest
+	// one-second bucket observed during the period.
+	RateIn      float64                  `json:"rateIn"`
+	RateOut     float64                  `json:"rateOut"`
+	PeakRateIn  int64                    `json:"peakRateIn"`
+	PeakRateOut int64                    `json:"peakRateOut"`
+	Protocols   map[string]ProtocolStats `json:"protocols,omitempty"`
+
+	// Distribution of per-second samples taken inside the period. Seconds
+	// without traffic count as zero so bursts are not averaged away.
+	ThroughputIn   RateStats `json:"throughputIn"`
+	ThroughputOut  RateStats `json:"throughputOut"`
+	NewConnections int64     `json:"newConnections"`
+	NewConnsPerSec RateStats `json:"newConnsPerSec"`
+	// PacketSizes counts packets per PacketSizeBounds bucket.
+	PacketSizes []int64 `json:"packetSizes"`
+
+	// OversizeRecords counts flow records skipped because a single record
+	// did not fit the maximum request body size.
+	OversizeRecords int64 `json:"oversizeRecords"`
+
+	// SamplingRate is the average 1-in-N packet sampling rate of the
+	// period; packet and byte counters are already scaled up by it. It is
+	// zero when every packet was captured.
+	SamplingRate int `json:"samplingRate,omitempty"`
+
+	// Capture reports packets lost before they were counted, so the
+	// period's figures can be flagged as incomplete.
+	Capture *CaptureStats `json:"capture,omitempty"`
+}
+
+// CaptureStats describes the health of the packet capture over a period.
+type CaptureStats struct {
+	// Policy is the capture channel's overflow policy.
+	Policy   string `json:"policy"`
+	Received int64  `json:"received"`
+	// ChannelDrops were dropped by the agent because its capture channel
+	// was full; KernelDrops and IfDrops by the kernel and the interface.
+	ChannelDrops int64 `json:"channelDrops"`
+	KernelDrops  int64 `json:"kernelDrops"`
+	IfDrops      int64 `json:"ifDrops"`
+	// QueuePeak is the channel's highest fill as a fraction of capacity.
+	QueuePeak float64 `json:"queuePeak"`
+}
+
+// RateStats summarises per-second samples over a period
+type RateStats struct {
+	Min  int64   `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  int64   `json:"p50"`
+	P95  int64   `json:"p95"`
+	P99  int64   `json:"p99"`
+	Max  int64   `json:"max"`
+}
+
+// sample holds the counters of one wall-clock second of packet timestamps
+type sample struct {
+	bytesIn  int64
+	bytesOut int64
+	newConns int64
+}
+
+// ProtocolStats holds per-protocol packet-level counters for a period
+type ProtocolStats struct {
+	BytesIn    int64 `json:"bytesIn"`
+	BytesOut   int64 `json:"bytesOut"`
+	PacketsIn  int64 `json:"packetsIn"`
+	PacketsOut int64 `json:"packetsOut"`
 }
 
 // Collector aggregates network interface metrics over time
@@ -36,15 +116,30 @@ type Collector struct {
 	mu sync.Mutex
 
 	// Current period metrics
-	startTime      time.Time
-	activeConns    map[string]struct{} // Track unique connection IDs
-	totalBytesIn   int64
-	totalBytesOut  int64
-	inactiveCount  int
+	startTime     time.Time
+	activeConns   map[string]struct{} // Track unique connection IDs
+	totalBytesIn  int64
+	totalBytesOut int64
+	inactiveCount int
+
+	packetsIn   int64
+	packetsOut  int64
+	protocols   map[string]*ProtocolStats
+	packetSizes []int64
+	newConns    int64
+	oversize    int64
+	sampled     int64 // packets captured, before scaling
+	capture     *CaptureStats
+
+	// Per-second samples for rate distributions; sec is the bucket being
+	// filled for second.
+	second  int64
+	sec     sample
+	samples []sample
 
 	// Historical snapshots
-	snapshots      []Snapshot
-	maxSnapshots   int
+	snapshots    []Snapshot
+	maxSnapshots int
 }
 
 // New creates a new metrics collector
@@ -52,9 +147,12 @@ func New(maxSnapshots int) *Collector {
 	if maxSnapshots <= 0 {
 		maxSnapshots = 168 // 7 days of hourly data
 	}
+
 	return &Collector{
 		startTime:    time.Now(),
 		activeConns:  make(map[string]struct{}),
+		protocols:    make(map[string]*ProtocolStats),
+		packetSizes:  make([]int64, len(PacketSizeBounds)+1),
 		snapshots:    make([]Snapshot, 0, maxSnapshots),
 		maxSnapshots: maxSnapshots,
 	}
@@ -74,19 +172,217 @@ func (c *Collector) RecordConnection(connID string, bytesIn, bytesOut int64, ina
 	}
 }
 
-// TakeSnapshot captures current metrics and resets counters
-func (c *Collector) TakeSnapshot() Snapshot {
+// RecordFlow counts a connection in the current period without adding
+// bandwidth. Use it when bytes are already accounted for by RecordPacket.
+func (c *Collector) RecordFlow(connID string, inactive bool) {
+	c.RecordConnection(connID, 0, 0, inactive)
+}
+
+// RecordPacket records a single captured packet. It is independent of whether
+// the corresponding flow is ever exported, so it also covers traffic dropped
+// before reaching the backend.
+func (c *Collector) RecordPacket(ts time.Time, proto string, length int, outbound bool) {
+	c.RecordSampledPacket(ts, proto, length, outbound, 1)
+}
+
+// RecordSampledPacket records a packet captured at a 1-in-rate sampling
+// rate as rate packets of length bytes.
+func (c *Collector) RecordSampledPacket(ts time.Time, proto string, length int, outbound bool, rate int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := int64(max(rate, 1))
+	n := int64(length) * w
+	c.advance(ts)
+	c.packetSizes[sizeBucket(length)] += w
+	c.sampled++
+
+	ps := c.protocols[proto]
+	if ps == nil {
+		ps = &ProtocolStats{}
+		c.protocols[proto] = ps
+	}
+
+	if outbound {
+		c.totalBytesOut += n
+		c.packetsOut += w
+		c.sec.bytesOut += n
+		ps.BytesOut += n
+		ps.PacketsOut += w
+	} else {
+		c.totalBytesIn += n
+		c.packetsIn += w
+		c.sec.bytesIn += n
+		ps.BytesIn += n
+		ps.PacketsIn += w
+	}
+}
+
+// RecordNewConnection counts a flow that was first seen at ts.
+func (c *Collector) RecordNewConnection(ts time.Time) {
+	c.RecordSampledConnection(ts, 1)
+}
+
+// RecordSampledConnection counts a flow kept at a 1-in-rate flow sampling
+// rate as rate new flows.
+func (c *Collector) RecordSampledConnection(ts time.Time, rate int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := int64(max(rate, 1))
+	c.advance(ts)
+	c.newConns += w
+	c.sec.newConns += w
+}
+
+// RecordOversize counts flow records that could not be exported because they
+// exceed the request body limit on their own.
+func (c *Collector) RecordOversize(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.oversize += int64(n)
+}
+
+// RecordCapture adds capture statistics covering part of the period.
+func (c *Collector) RecordCapture(s CaptureStats) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.capture == nil {
+		c.capture = &CaptureStats{}
+	}
+	c.capture.Policy = s.Policy
+	c.capture.Received += s.Received
+	c.capture.ChannelDrops += s.ChannelDrops
+	c.capture.KernelDrops += s.KernelDrops
+	c.capture.IfDrops += s.IfDrops
+	c.capture.QueuePeak = max(c.capture.QueuePeak, s.QueuePeak)
+}
+
+// advance moves the per-second bucket to the second containing ts.
+func (c *Collector) advance(ts time.Time) {
+	sec := ts.Unix()
+	if sec == c.second {
+		return
+	}
+	if c.sec != (sample{}) {
+		c.samples = append(c.samples, c.sec)
+	}
+	c.second = sec
+	c.sec = sample{}
+}
+
+func sizeBucket(length int) int {
+	for i, bound := range PacketSizeBounds {
+		if length <= bound {
+			return i
+		}
+	}
+	return len(PacketSizeBounds)
+}
+
+// summarize computes RateStats over values, padded with zeros up to n
+// samples for seconds that saw no traffic.
+func summarize(values []int64, n int) RateStats {
+	if n < len(values) {
+		n = len(values)
+	}
+	if n == 0 {
+		return RateStats{}
+	}
+
+	sorted := make([]int64, n)
+	copy(sorted[n-len(values):], values)
+	slices.Sort(sorted)
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	// Nearest-rank percentile.
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(n))) - 1
+		return sorted[max(i, 0)]
+	}
+
+	return RateStats{
+		Min:  sorted[0],
+		Mean: float64(sum) / float64(n),
+		P50:  rank(0.50),
+		P95:  rank(0.95),
+		P99:  rank(0.99),
+		Max:  sorted[n-1],
+	}
+}
+
+// current builds a snapshot of the running period ending at now.
+func (c *Collector) current(now time.Time) Snapshot {
 	snapshot := Snapshot{
-		Timestamp:    c.startTime,
-		Connections:  len(c.activeConns),
-		BandwidthIn:  c.totalBytesIn,
-		BandwidthOut: c.totalBytesOut,
-		Inactive:     c.inactiveCount,
+		Timestamp:      c.startTime,
+		EndTime:        now,
+		Connections:    len(c.activeConns),
+		BandwidthIn:    c.totalBytesIn,
+		BandwidthOut:   c.totalBytesOut,
+		Inactive:       c.inactiveCount,
+		PacketsIn:      c.packetsIn,
+		PacketsOut:     c.packetsOut,
+		NewConnections: c.newConns,
+		PacketSizes:    slices.Clone(c.packetSizes),
+
+		OversizeRecords: c.oversize,
+	}
+	if c.capture != nil {
+		capture := *c.capture
+		snapshot.Capture = &capture
+	}
+	if est := c.packetsIn + c.packetsOut; c.sampled > 0 && est > c.sampled {
+		snapshot.SamplingRate = int((est + c.sampled/2) / c.sampled)
+	}
+
+	secs := now.Sub(c.startTime).Seconds()
+	if secs > 0 {
+		snapshot.RateIn = float64(c.totalBytesIn) / secs
+		snapshot.RateOut = float64(c.totalBytesOut) / secs
+	}
+
+	samples := c.samples
+	if c.sec != (sample{}) {
+		samples = append(slices.Clip(samples), c.sec)
+	}
+	in := make([]int64, len(samples))
+	out := make([]int64, len(samples))
+	conns := make([]int64, len(samples))
+	for i, s := range samples {
+		in[i] = s.bytesIn
+		out[i] = s.bytesOut
+		conns[i] = s.newConns
+	}
+	n := int(math.Ceil(secs))
+	snapshot.ThroughputIn = summarize(in, n)
+	snapshot.ThroughputOut = summarize(out, n)
+	snapshot.NewConnsPerSec = summarize(conns, n)
+	snapshot.PeakRateIn = snapshot.ThroughputIn.Max
+	snapshot.PeakRateOut = snapshot.ThroughputOut.Max
+
+	if len(c.protocols) > 0 {
+		snapshot.Protocols = make(map[string]ProtocolStats, len(c.protocols))
+		for proto, ps := range c.protocols {
+			snapshot.Protocols[proto] = *ps
+		}
 	}
 
+	return snapshot
+}
+
+// TakeSnapshot captures current metrics and resets counters
+func (c *Collector) TakeSnapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	snapshot := c.current(now)
+
 	// Store snapshot
 	c.snapshots = append(c.snapshots, snapshot)
 
@@ -96,11 +392,21 @@ func (c *Collector) TakeSnapshot() Snapshot {
 	}
 
 	// Reset counters for next period
-	c.startTime = time.Now()
+	c.startTime = now
 	c.activeConns = make(map[string]struct{})
 	c.totalBytesIn = 0
 	c.totalBytesOut = 0
 	c.inactiveCount = 0
+	c.packetsIn = 0
+	c.packetsOut = 0
+	c.protocols = make(map[string]*ProtocolStats)
+	c.packetSizes = make([]int64, len(PacketSizeBounds)+1)
+	c.newConns = 0
+	c.oversize = 0
+	c.sampled = 0
+	c.capture = nil
+	c.sec = sample{}
+	c.samples = nil
 
 	return snapshot
 }
@@ -120,11 +426,5 @@ func (c *Collector) GetCurrentMetrics() Snapshot {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return Snapshot{
-		Timestamp:    c.startTime,
-		Connections:  len(c.activeConns),
-		BandwidthIn:  c.totalBytesIn,
-		BandwidthOut: c.totalBytesOut,
-		Inactive:     c.inactiveCount,
-	}
+	return c.current(time.Now())
 }
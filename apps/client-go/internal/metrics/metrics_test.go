@@ -307,3 +307,187 @@ func TestGetCurrentMetrics(t *testing.T) {
 		t.Errorf("second call Connections = %d, want 2", current2.Connections)
 	}
 }
+
+func TestRecordPacket(t *testing.T) {
+	c := New(10)
+	base := time.Unix(1700000000, 0)
+
+	c.RecordPacket(base, "TCP", 100, true)
+	c.RecordPacket(base.Add(200*time.Millisecond), "TCP", 300, true)
+	c.RecordPacket(base.Add(500*time.Millisecond), "UDP", 50, false)
+	c.RecordPacket(base.Add(2*time.Second), "TCP", 150, true)
+
+	snap := c.TakeSnapshot()
+
+	if snap.BandwidthOut != 550 || snap.PacketsOut != 3 {
+		t.Errorf("out = %d bytes / %d packets, want 550 / 3", snap.BandwidthOut, snap.PacketsOut)
+	}
+	if snap.BandwidthIn != 50 || snap.PacketsIn != 1 {
+		t.Errorf("in = %d bytes / %d packets, want 50 / 1", snap.BandwidthIn, snap.PacketsIn)
+	}
+	if snap.PeakRateOut != 400 {
+		t.Errorf("PeakRateOut = %d, want 400", snap.PeakRateOut)
+	}
+	if snap.PeakRateIn != 50 {
+		t.Errorf("PeakRateIn = %d, want 50", snap.PeakRateIn)
+	}
+	if got := snap.Protocols["TCP"]; got.BytesOut != 550 || got.PacketsOut != 3 {
+		t.Errorf("TCP stats = %+v, want 550 bytes out / 3 packets out", got)
+	}
+	if got := snap.Protocols["UDP"]; got.BytesIn != 50 || got.PacketsIn != 1 {
+		t.Errorf("UDP stats = %+v, want 50 bytes in / 1 packet in", got)
+	}
+	if snap.RateOut <= 0 {
+		t.Errorf("RateOut = %f, want > 0", snap.RateOut)
+	}
+
+	next := c.GetCurrentMetrics()
+	if next.PacketsOut != 0 || next.PeakRateOut != 0 || len(next.Protocols) != 0 {
+		t.Errorf("expected packet counters reset after snapshot, got %+v", next)
+	}
+}
+
+func TestRecordSampledPacket(t *testing.T) {
+	c := New(10)
+	base := time.Unix(1700000000, 0)
+
+	c.RecordSampledPacket(base, "TCP", 100, true, 10)
+	c.RecordSampledPacket(base, "TCP", 1000, false, 20)
+	c.RecordPacket(base, "UDP", 50, false)
+
+	snap := c.TakeSnapshot()
+	if snap.BandwidthOut != 1000 || snap.PacketsOut != 10 {
+		t.Errorf("out = %d bytes / %d packets, want 1000 / 10", snap.BandwidthOut, snap.PacketsOut)
+	}
+	if snap.BandwidthIn != 20050 || snap.PacketsIn != 21 {
+		t.Errorf("in = %d bytes / %d packets, want 20050 / 21", snap.BandwidthIn, snap.PacketsIn)
+	}
+	if snap.PacketSizes[0] != 1 || snap.PacketSizes[1] != 10 || snap.PacketSizes[4] != 20 {
+		t.Errorf("PacketSizes = %v", snap.PacketSizes)
+	}
+	// 31 estimated packets from 3 captured.
+	if snap.SamplingRate != 10 {
+		t.Errorf("SamplingRate = %d, want 10", snap.SamplingRate)
+	}
+
+	c.RecordPacket(base, "UDP", 50, false)
+	if snap := c.TakeSnapshot(); snap.SamplingRate != 0 {
+		t.Errorf("SamplingRate = %d for an unsampled period", snap.SamplingRate)
+	}
+}
+
+func TestRecordSampledConnection(t *testing.T) {
+	c := New(10)
+	base := time.Unix(1700000000, 0)
+
+	c.RecordSampledConnection(base, 4)
+	c.RecordNewConnection(base)
+
+	if snap := c.TakeSnapshot(); snap.NewConnections != 5 || snap.NewConnsPerSec.Max != 5 {
+		t.Errorf("NewConnections = %d, NewConnsPerSec.Max = %d, want 5 and 5", snap.NewConnections, snap.NewConnsPerSec.Max)
+	}
+}
+
+func TestRecordCapture(t *testing.T) {
+	c := New(10)
+	if snap := c.GetCurrentMetrics(); snap.Capture != nil {
+		t.Fatalf("expected no capture stats before any were recorded")
+	}
+
+	c.RecordCapture(CaptureStats{Policy: "drop", Received: 100, ChannelDrops: 3, KernelDrops: 1, QueuePeak: 0.9})
+	c.RecordCapture(CaptureStats{Policy: "drop", Received: 50, IfDrops: 2, QueuePeak: 0.2})
+
+	snap := c.TakeSnapshot()
+	want := CaptureStats{Policy: "drop", Received: 150, ChannelDrops: 3, KernelDrops: 1, IfDrops: 2, QueuePeak: 0.9}
+	if snap.Capture == nil || *snap.Capture != want {
+		t.Fatalf("Capture = %+v, want %+v", snap.Capture, want)
+	}
+	if snap := c.GetCurrentMetrics(); snap.Capture != nil {
+		t.Fatalf("expected capture stats reset after snapshot")
+	}
+}
+
+func TestRecordFlow_DoesNotAddBandwidth(t *testing.T) {
+	c := New(10)
+	c.RecordFlow("conn1", false)
+	c.RecordFlow("conn2", true)
+
+	snap := c.GetCurrentMetrics()
+	if snap.Connections != 2 || snap.Inactive != 1 {
+		t.Errorf("Connections/Inactive = %d/%d, want 2/1", snap.Connections, snap.Inactive)
+	}
+	if snap.BandwidthIn != 0 || snap.BandwidthOut != 0 {
+		t.Errorf("expected no bandwidth from RecordFlow, got %d/%d", snap.BandwidthIn, snap.BandwidthOut)
+	}
+}
+
+func TestRecordOversize(t *testing.T) {
+	c := New(10)
+	c.RecordOversize(2)
+	c.RecordOversize(1)
+
+	if snap := c.TakeSnapshot(); snap.OversizeRecords != 3 {
+		t.Errorf("OversizeRecords = %d, want 3", snap.OversizeRecords)
+	}
+	if snap := c.GetCurrentMetrics(); snap.OversizeRecords != 0 {
+		t.Errorf("expected counter reset after snapshot, got %d", snap.OversizeRecords)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	values := make([]int64, 0, 100)
+	for i := int64(1); i <= 100; i++ {
+		values = append(values, i)
+	}
+
+	got := summarize(values, 100)
+	want := RateStats{Min: 1, Mean: 50.5, P50: 50, P95: 95, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("summarize = %+v, want %+v", got, want)
+	}
+
+	// Idle seconds are padded with zeros.
+	got = summarize([]int64{1000}, 4)
+	if got.Min != 0 || got.P50 != 0 || got.Max != 1000 || got.Mean != 250 {
+		t.Errorf("summarize with idle seconds = %+v", got)
+	}
+
+	if got := summarize(nil, 0); got != (RateStats{}) {
+		t.Errorf("summarize(nil, 0) = %+v, want zero", got)
+	}
+}
+
+func TestSnapshot_RateDistributions(t *testing.T) {
+	c := New(10)
+	base := time.Unix(1700000000, 0)
+
+	// A one-second burst followed by a quieter second.
+	c.RecordPacket(base, "TCP", 1500, true)
+	c.RecordPacket(base, "TCP", 1500, true)
+	c.RecordNewConnection(base)
+	c.RecordPacket(base.Add(time.Second), "TCP", 40, true)
+	c.RecordNewConnection(base.Add(time.Second))
+	c.RecordNewConnection(base.Add(time.Second))
+
+	snap := c.TakeSnapshot()
+
+	if snap.ThroughputOut.Max != 3000 {
+		t.Errorf("ThroughputOut.Max = %d, want 3000", snap.ThroughputOut.Max)
+	}
+	if snap.ThroughputOut.Max != snap.PeakRateOut {
+		t.Errorf("PeakRateOut = %d, want it to match ThroughputOut.Max", snap.PeakRateOut)
+	}
+	if snap.NewConnections != 3 || snap.NewConnsPerSec.Max != 2 {
+		t.Errorf("NewConnections = %d, NewConnsPerSec.Max = %d, want 3 and 2", snap.NewConnections, snap.NewConnsPerSec.Max)
+	}
+
+	if len(snap.PacketSizes) != len(PacketSizeBounds)+1 {
+		t.Fatalf("len(PacketSizes) = %d, want %d", len(snap.PacketSizes), len(PacketSizeBounds)+1)
+	}
+	if snap.PacketSizes[0] != 1 {
+		t.Errorf("PacketSizes[<=64] = %d, want 1", snap.PacketSizes[0])
+	}
+	if snap.PacketSizes[len(PacketSizeBounds)-1] != 2 {
+		t.Errorf("PacketSizes[<=1500] = %d, want 2", snap.PacketSizes[len(PacketSizeBounds)-1])
+	}
+}
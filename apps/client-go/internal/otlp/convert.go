@@ -0,0 +1,237 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/metrics"
+)
+
+// Attribute keys. The network.* keys follow the OpenTelemetry semantic
+// conventions; flow details without a convention use the byteroute.
+// namespace.
+const (
+	attrInterface    = "network.interface.name"
+	attrDirection    = "network.io.direction"
+	attrTransport    = "network.transport"
+	attrNetworkType  = "network.type"
+	attrLocalAddress = "network.local.address"
+	attrLocalPort    = "network.local.port"
+	attrPeerAddress  = "network.peer.address"
+	attrPeerPort     = "network.peer.port"
+)
+
+// flowEvent is the event name of flow log records.
+const flowEvent = "byteroute.flow"
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// transport maps a capture protocol name (TCP, UDP, ICMP) to the lower-case
+// form used by network.transport.
+func transport(proto string) string {
+	return strings.ToLower(proto)
+}
+
+// snapshotMetrics converts a metrics snapshot into OTLP metrics. Counters
+// covering the snapshot period are delta sums; point-in-time values are
+// gauges stamped with the end of the period.
+func snapshotMetrics(s metrics.Snapshot, iface string) []metric {
+	start, end := unixNano(s.Timestamp), unixNano(s.EndTime)
+	attrs := func(extra ...keyValue) []keyValue {
+		if iface == "" {
+			return extra
+		}
+		return append([]keyValue{stringAttr(attrInterface, iface)}, extra...)
+	}
+	point := func(v int64, extra ...keyValue) numberDataPoint {
+		return numberDataPoint{Attributes: attrs(extra...), StartTimeUnixNano: start, TimeUnixNano: end, AsInt: &v}
+	}
+	gaugePoint := func(v int64, extra ...keyValue) numberDataPoint {
+		return numberDataPoint{Attributes: attrs(extra...), TimeUnixNano: end, AsInt: &v}
+	}
+	delta := func(points ...numberDataPoint) *sum {
+		return &sum{DataPoints: points, AggregationTemporality: temporalityDelta, IsMonotonic: true}
+	}
+	receive, transmit := stringAttr(attrDirection, "receive"), stringAttr(attrDirection, "transmit")
+
+	// Traffic is split by protocol when the snapshot has the breakdown, so
+	// summing over network.transport gives the interface totals.
+	var bytes, packets []numberDataPoint
+	if len(s.Protocols) == 0 {
+		bytes = []numberDataPoint{point(s.BandwidthIn, receive), point(s.BandwidthOut, transmit)}
+		packets = []numberDataPoint{point(s.PacketsIn, receive), point(s.PacketsOut, transmit)}
+	}
+	protos := make([]string, 0, len(s.Protocols))
+	for proto := range s.Protocols {
+		protos = append(protos, proto)
+	}
+	slices.Sort(protos)
+	for _, proto := range protos {
+		ps := s.Protocols[proto]
+		tr := stringAttr(attrTransport, transport(proto))
+		bytes = append(bytes, point(ps.BytesIn, receive, tr), point(ps.BytesOut, transmit, tr))
+		packets = append(packets, point(ps.PacketsIn, receive, tr), point(ps.PacketsOut, transmit, tr))
+	}
+
+	out := []metric{
+		{Name: "system.network.io", Description: "Bytes captured on the interface.", Unit: "By", Sum: delta(bytes...)},
+		{Name: "system.network.packets", Description: "Packets captured on the interface.", Unit: "{packet}", Sum: delta(packets...)},
+		{Name: "byteroute.flows", Description: "Flows exported during the period.", Unit: "{flow}", Gauge: &gauge{DataPoints: []numberDataPoint{gaugePoint(int64(s.Connections))}}},
+		{Name: "byteroute.flows.inactive", Description: "Exported flows that had gone idle.", Unit: "{flow}", Gauge: &gauge{DataPoints: []numberDataPoint{gaugePoint(int64(s.Inactive))}}},
+		{Name: "byteroute.flows.new", Description: "Flows first seen during the period.", Unit: "{flow}", Sum: delta(point(s.NewConnections))},
+		{Name: "byteroute.network.throughput.peak", Description: "Busiest one-second throughput during the period.", Unit: "By/s", Gauge: &gauge{DataPoints: []numberDataPoint{gaugePoint(s.PeakRateIn, receive), gaugePoint(s.PeakRateOut, transmit)}}},
+		{Name: "byteroute.export.oversize_records", Description: "Flow records dropped for exceeding the request size limit.", Unit: "{record}", Sum: delta(point(s.OversizeRecords))},
+	}
+	if c := s.Capture; c != nil {
+		reason := func(r string) keyValue { return stringAttr("byteroute.capture.drop_reason", r) }
+		out = append(out, metric{
+			Name:        "byteroute.capture.dropped",
+			Description: "Packets lost before they were counted, by where they were dropped.",
+			Unit:        "{packet}",
+			Sum:         delta(point(c.ChannelDrops, reason("queue")), point(c.KernelDrops, reason("kernel")), point(c.IfDrops, reason("interface"))),
+		})
+	}
+	if len(s.PacketSizes) == len(metrics.PacketSizeBounds)+1 {
+		out = append(out, metric{
+			Name:        "byteroute.network.packet.size",
+			Description: "Distribution of captured packet sizes.",
+			Unit:        "By",
+			Histogram: &histogram{
+				DataPoints:             []histogramDataPoint{packetSizes(s, attrs(), start, end)},
+				AggregationTemporality: temporalityDelta,
+			},
+		})
+	}
+	return out
+}
+
+func packetSizes(s metrics.Snapshot, attrs []keyValue, start, end uint64) histogramDataPoint {
+	p := histogramDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		BucketCounts:      make(uint64s, len(s.PacketSizes)),
+		ExplicitBounds:    make([]float64, len(metrics.PacketSizeBounds)),
+	}
+	for i, n := range s.PacketSizes {
+		p.BucketCounts[i] = uint64(n)
+		p.Count += uint64(n)
+	}
+	for i, bound := range metrics.PacketSizeBounds {
+		p.ExplicitBounds[i] = float64(bound)
+	}
+	return p
+}
+
+// flowRecord converts an exported flow into a log record. The flow's source
+// is the local endpoint whenever one side is local, so it maps to
+// network.local.* and the destination to network.peer.*.
+func flowRecord(c *backend.Connection, iface string, observed time.Time) logRecord {
+	attrs := []keyValue{
+		stringAttr("byteroute.flow.id", c.ID),
+		stringAttr("byteroute.flow.conversation_id", c.ConversationID),
+		stringAttr("byteroute.flow.status", c.Status),
+		stringAttr(attrTransport, transport(c.Protocol)),
+		stringAttr(attrLocalAddress, c.SourceIP),
+		stringAttr(attrPeerAddress, c.DestIP),
+	}
+	if ip := net.ParseIP(c.SourceIP); ip != nil {
+		typ := "ipv6"
+		if ip.To4() != nil {
+			typ = "ipv4"
+		}
+		attrs = append(attrs, stringAttr(attrNetworkType, typ))
+	}
+	// Ports are zero when flows are deduplicated by IP.
+	if c.SourcePort != 0 {
+		attrs = append(attrs, intAttr(attrLocalPort, int64(c.SourcePort)))
+	}
+	if c.DestPort != 0 {
+		attrs = append(attrs, intAttr(attrPeerPort, int64(c.DestPort)))
+	}
+	if iface != "" {
+		attrs = append(attrs, stringAttr(attrInterface, iface))
+	}
+	if c.Direction != "" {
+		attrs = append(attrs, stringAttr("byteroute.flow.direction", c.Direction))
+	}
+	if c.SamplingRate > 0 {
+		attrs = append(attrs, intAttr("byteroute.flow.sampling_rate", int64(c.SamplingRate)))
+	}
+	attrs = appendTime(attrs, "byteroute.flow.start", c.StartTime)
+	attrs = appendTime(attrs, "byteroute.flow.interval.start", c.IntervalStart)
+	attrs = appendInt(attrs, "byteroute.flow.duration_ms", c.DurationMs)
+	attrs = appendInt(attrs, "byteroute.flow.bytes_in", c.BytesIn)
+	attrs = appendInt(attrs, "byteroute.flow.bytes_out", c.BytesOut)
+	attrs = appendInt(attrs, "byteroute.flow.packets_in", c.PacketsIn)
+	attrs = appendInt(attrs, "byteroute.flow.packets_out", c.PacketsOut)
+	attrs = appendInt(attrs, "byteroute.flow.delta.bytes_in", c.DeltaBytesIn)
+	attrs = appendInt(attrs, "byteroute.flow.delta.bytes_out", c.DeltaBytesOut)
+	attrs = appendInt(attrs, "byteroute.flow.delta.packets_in", c.DeltaPacketsIn)
+	attrs = appendInt(attrs, "byteroute.flow.delta.packets_out", c.DeltaPacketsOut)
+
+	body := fmt.Sprintf("%s %s -> %s %s", c.Protocol, endpoint(c.SourceIP, c.SourcePort), endpoint(c.DestIP, c.DestPort), c.Status)
+	rec := logRecord{
+		ObservedTimeUnixNano: unixNano(observed),
+		SeverityNumber:       severityInfo,
+		SeverityText:         "INFO",
+		Body:                 &anyValue{StringValue: &body},
+		Attributes:           attrs,
+		EventName:            flowEvent,
+	}
+	end := c.IntervalEnd
+	if end == "" {
+		end = c.LastActivity
+	}
+	if t, err := time.Parse(time.RFC3339Nano, end); err == nil {
+		rec.TimeUnixNano = unixNano(t)
+	}
+	return rec
+}
+
+func endpoint(ip string, port int) string {
+	if port == 0 {
+		return ip
+	}
+	return net.JoinHostPort(ip, fmt.Sprint(port))
+}
+
+func appendInt(attrs []keyValue, key string, v *int64) []keyValue {
+	if v == nil {
+		return attrs
+	}
+	return append(attrs, intAttr(key, *v))
+}
+
+func appendTime(attrs []keyValue, key, v string) []keyValue {
+	if v == "" {
+		return attrs
+	}
+	return append(attrs, stringAttr(key, v))
+}
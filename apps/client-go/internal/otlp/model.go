@@ -0,0 +1,353 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The types below mirror the OTLP request messages this package sends. Their
+// JSON tags follow the OTLP/JSON mapping (lowerCamelCase names, 64-bit
+// integers as decimal strings); appendProto encodes the same message per
+// opentelemetry/proto/collector/{metrics,logs}/v1.
+
+// AggregationTemporality values.
+const temporalityDelta = 1
+
+// Severity of flow log records (SEVERITY_NUMBER_INFO).
+const severityInfo = 9
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *int64  `json:"intValue,omitempty,string"`
+}
+
+func stringAttr(key, v string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &v}}
+}
+
+func intAttr(key string, v int64) keyValue {
+	return keyValue{Key: key, Value: anyValue{IntValue: &v}}
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type metricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic,omitempty"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,omitempty,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	AsInt             *int64     `json:"asInt,omitempty,string"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,omitempty,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	Count             uint64     `json:"count,string"`
+	BucketCounts      uint64s    `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+// uint64s marshals as a JSON array of decimal strings.
+type uint64s []uint64
+
+func (u uint64s) MarshalJSON() ([]byte, error) {
+	out := make([]string, len(u))
+	for i, v := range u {
+		out[i] = strconv.FormatUint(v, 10)
+	}
+	return json.Marshal(out)
+}
+
+type logsRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type logRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,omitempty,string"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,omitempty,string"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 *anyValue  `json:"body,omitempty"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	EventName            string     `json:"eventName,omitempty"`
+}
+
+// appendMessage writes the message built by fn as field num.
+func appendMessage(b []byte, num protowire.Number, fn func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, fn(nil))
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendAttributes(b []byte, num protowire.Number, attrs []keyValue) []byte {
+	for i := range attrs {
+		b = appendMessage(b, num, attrs[i].appendProto)
+	}
+	return b
+}
+
+func (kv *keyValue) appendProto(b []byte) []byte {
+	b = appendString(b, 1, kv.Key)
+	return appendMessage(b, 2, kv.Value.appendProto)
+}
+
+func (v *anyValue) appendProto(b []byte) []byte {
+	switch {
+	case v.StringValue != nil:
+		// Written even when empty: the oneof case carries meaning.
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, *v.StringValue)
+	case v.IntValue != nil:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*v.IntValue))
+	}
+	return b
+}
+
+func (r *resource) appendProto(b []byte) []byte {
+	return appendAttributes(b, 1, r.Attributes)
+}
+
+func (s *scope) appendProto(b []byte) []byte {
+	b = appendString(b, 1, s.Name)
+	return appendString(b, 2, s.Version)
+}
+
+func (r *metricsRequest) appendProto(b []byte) []byte {
+	for i := range r.ResourceMetrics {
+		b = appendMessage(b, 1, r.ResourceMetrics[i].appendProto)
+	}
+	return b
+}
+
+func (r *resourceMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, r.Resource.appendProto)
+	for i := range r.ScopeMetrics {
+		b = appendMessage(b, 2, r.ScopeMetrics[i].appendProto)
+	}
+	return b
+}
+
+func (s *scopeMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, s.Scope.appendProto)
+	for i := range s.Metrics {
+		b = appendMessage(b, 2, s.Metrics[i].appendProto)
+	}
+	return b
+}
+
+func (m *metric) appendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Name)
+	b = appendString(b, 2, m.Description)
+	b = appendString(b, 3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		b = appendMessage(b, 5, m.Gauge.appendProto)
+	case m.Sum != nil:
+		b = appendMessage(b, 7, m.Sum.appendProto)
+	case m.Histogram != nil:
+		b = appendMessage(b, 9, m.Histogram.appendProto)
+	}
+	return b
+}
+
+func (g *gauge) appendProto(b []byte) []byte {
+	for i := range g.DataPoints {
+		b = appendMessage(b, 1, g.DataPoints[i].appendProto)
+	}
+	return b
+}
+
+func (s *sum) appendProto(b []byte) []byte {
+	for i := range s.DataPoints {
+		b = appendMessage(b, 1, s.DataPoints[i].appendProto)
+	}
+	b = appendVarint(b, 2, uint64(s.AggregationTemporality))
+	if s.IsMonotonic {
+		b = appendVarint(b, 3, 1)
+	}
+	return b
+}
+
+func (h *histogram) appendProto(b []byte) []byte {
+	for i := range h.DataPoints {
+		b = appendMessage(b, 1, h.DataPoints[i].appendProto)
+	}
+	return appendVarint(b, 2, uint64(h.AggregationTemporality))
+}
+
+func (p *numberDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64(b, 2, p.StartTimeUnixNano)
+	b = appendFixed64(b, 3, p.TimeUnixNano)
+	switch {
+	case p.AsDouble != nil:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*p.AsDouble))
+	case p.AsInt != nil:
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(*p.AsInt))
+	}
+	return appendAttributes(b, 7, p.Attributes)
+}
+
+func (p *histogramDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64(b, 2, p.StartTimeUnixNano)
+	b = appendFixed64(b, 3, p.TimeUnixNano)
+	b = appendFixed64(b, 4, p.Count)
+	if len(p.BucketCounts) > 0 {
+		var packed []byte
+		for _, c := range p.BucketCounts {
+			packed = protowire.AppendFixed64(packed, c)
+		}
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	if len(p.ExplicitBounds) > 0 {
+		var packed []byte
+		for _, v := range p.ExplicitBounds {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+		}
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return appendAttributes(b, 9, p.Attributes)
+}
+
+func (r *logsRequest) appendProto(b []byte) []byte {
+	for i := range r.ResourceLogs {
+		b = appendMessage(b, 1, r.ResourceLogs[i].appendProto)
+	}
+	return b
+}
+
+func (r *resourceLogs) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, r.Resource.appendProto)
+	for i := range r.ScopeLogs {
+		b = appendMessage(b, 2, r.ScopeLogs[i].appendProto)
+	}
+	return b
+}
+
+func (s *scopeLogs) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, s.Scope.appendProto)
+	for i := range s.LogRecords {
+		b = appendMessage(b, 2, s.LogRecords[i].appendProto)
+	}
+	return b
+}
+
+func (l *logRecord) appendProto(b []byte) []byte {
+	b = appendFixed64(b, 1, l.TimeUnixNano)
+	b = appendVarint(b, 2, uint64(l.SeverityNumber))
+	b = appendString(b, 3, l.SeverityText)
+	if l.Body != nil {
+		b = appendMessage(b, 5, l.Body.appendProto)
+	}
+	b = appendAttributes(b, 6, l.Attributes)
+	b = appendFixed64(b, 11, l.ObservedTimeUnixNano)
+	return appendString(b, 12, l.EventName)
+}
@@ -0,0 +1,267 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package otlp publishes interface metrics and flow records to an
+// OpenTelemetry collector over OTLP/HTTP, encoded as protobuf or JSON.
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/metrics"
+)
+
+// Protocol is an OTLP/HTTP encoding, named as in OTEL_EXPORTER_OTLP_PROTOCOL.
+type Protocol string
+
+const (
+	ProtocolProtobuf Protocol = "http/protobuf"
+	ProtocolJSON     Protocol = "http/json"
+)
+
+// ParseProtocol accepts "http/protobuf" or "http/json".
+func ParseProtocol(s string) (Protocol, error) {
+	switch Protocol(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ProtocolProtobuf:
+		return ProtocolProtobuf, nil
+	case ProtocolJSON:
+		return ProtocolJSON, nil
+	}
+	return "", fmt.Errorf("unsupported OTLP protocol %q (expected http/protobuf or http/json)", s)
+}
+
+// Signal paths appended to the endpoint, as for OTEL_EXPORTER_OTLP_ENDPOINT.
+const (
+	metricsPath = "/v1/metrics"
+	logsPath    = "/v1/logs"
+)
+
+const scopeName = "github.com/byteroute/client-go"
+
+// Resource describes the agent in every export.
+type Resource struct {
+	ServiceVersion string
+	HostName       string
+	// InstanceID is the agent ID, reported as service.instance.id.
+	InstanceID string
+}
+
+func (r Resource) attributes() []keyValue {
+	attrs := []keyValue{stringAttr("service.name", "byteroute-client")}
+	if r.ServiceVersion != "" {
+		attrs = append(attrs, stringAttr("service.version", r.ServiceVersion))
+	}
+	if r.InstanceID != "" {
+		attrs = append(attrs, stringAttr("service.instance.id", r.InstanceID))
+	}
+	if r.HostName != "" {
+		attrs = append(attrs, stringAttr("host.name", r.HostName))
+	}
+	return attrs
+}
+
+// Exporter sends OTLP export requests. It does not retry: a failed export is
+// reported to the caller and the next one carries the next period.
+type Exporter struct {
+	baseURL  string
+	hc       *http.Client
+	protocol Protocol
+	headers  map[string]string
+	gzip     bool
+	resource Resource
+	iface    string
+	now      func() time.Time
+}
+
+// Option configures optional Exporter behaviour.
+type Option func(*Exporter)
+
+// WithHeaders adds headers, such as an API key, to every request.
+func WithHeaders(h map[string]string) Option {
+	return func(e *Exporter) {
+		e.headers = h
+	}
+}
+
+// WithGzip compresses request bodies.
+func WithGzip() Option {
+	return func(e *Exporter) {
+		e.gzip = true
+	}
+}
+
+// WithResource sets the resource attributes describing the agent.
+func WithResource(r Resource) Option {
+	return func(e *Exporter) {
+		e.resource = r
+	}
+}
+
+// WithInterface records the capture interface on every data point and
+// flow record as network.interface.name.
+func WithInterface(name string) Option {
+	return func(e *Exporter) {
+		e.iface = name
+	}
+}
+
+// WithTransport sends requests through rt.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(e *Exporter) {
+		e.hc.Transport = rt
+	}
+}
+
+// New creates an exporter for the collector at endpoint, the base URL the
+// signal paths (/v1/metrics, /v1/logs) are appended to.
+func New(endpoint string, protocol Protocol, timeout time.Duration, opts ...Option) (*Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+	e := &Exporter{
+		baseURL:  strings.TrimSuffix(u.String(), "/"),
+		hc:       &http.Client{Timeout: timeout},
+		protocol: protocol,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e, nil
+}
+
+// ParseHeaders parses a comma-separated list of key=value pairs with
+// URL-encoded values, the OTEL_EXPORTER_OTLP_HEADERS format.
+func ParseHeaders(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (expected key=value)", pair)
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", pair, err)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// ExportMetrics publishes a metrics snapshot.
+func (e *Exporter) ExportMetrics(ctx context.Context, s metrics.Snapshot) error {
+	req := &metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource: resource{Attributes: e.resource.attributes()},
+		ScopeMetrics: []scopeMetrics{{
+			Scope:   e.scope(),
+			Metrics: snapshotMetrics(s, e.iface),
+		}},
+	}}}
+	return e.post(ctx, metricsPath, req, req.appendProto)
+}
+
+// ExportFlows publishes flow records as log records, one per connection.
+func (e *Exporter) ExportFlows(ctx context.Context, conns []backend.Connection) error {
+	if len(conns) == 0 {
+		return nil
+	}
+	now := e.now()
+	records := make([]logRecord, len(conns))
+	for i := range conns {
+		records[i] = flowRecord(&conns[i], e.iface, now)
+	}
+	req := &logsRequest{ResourceLogs: []resourceLogs{{
+		Resource: resource{Attributes: e.resource.attributes()},
+		ScopeLogs: []scopeLogs{{
+			Scope:      e.scope(),
+			LogRecords: records,
+		}},
+	}}}
+	return e.post(ctx, logsPath, req, req.appendProto)
+}
+
+func (e *Exporter) scope() scope {
+	return scope{Name: scopeName, Version: e.resource.ServiceVersion}
+}
+
+// post encodes msg in the configured protocol and sends it to path.
+func (e *Exporter) post(ctx context.Context, path string, msg any, appendProto func([]byte) []byte) error {
+	var body []byte
+	contentType := "application/x-protobuf"
+	if e.protocol == ProtocolJSON {
+		var err error
+		if body, err = json.Marshal(msg); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	} else {
+		body = appendProto(nil)
+	}
+
+	if e.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP export to %s: %s: %s", path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/metrics"
+)
+
+// receiver is an OTLP/HTTP receiver stub that keeps the last request per
+// signal path.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   map[string][]byte
+	types    map[string]string
+	headers  http.Header
+	failWith int
+}
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+	r := &receiver{bodies: map[string][]byte{}, types: map[string]string{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		b, _ := io.ReadAll(body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies[req.URL.Path] = b
+		r.types[req.URL.Path] = req.Header.Get("Content-Type")
+		r.headers = req.Header.Clone()
+		if r.failWith != 0 {
+			w.WriteHeader(r.failWith)
+			return
+		}
+		w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) body(path string) ([]byte, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bodies[path], r.types[path]
+}
+
+// message is a decoded protobuf message: raw values by field number.
+type message map[protowire.Number][]any
+
+// decode walks a protobuf message without a schema. Length-delimited
+// fields are kept as []byte.
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+	m := message{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			v, n = protowire.ConsumeFixed32(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		m[num] = append(m[num], v)
+	}
+	return m
+}
+
+func (m message) msgs(t *testing.T, num protowire.Number) []message {
+	t.Helper()
+	var out []message
+	for _, v := range m[num] {
+		out = append(out, decode(t, v.([]byte)))
+	}
+	return out
+}
+
+func (m message) str(num protowire.Number) string {
+	if len(m[num]) == 0 {
+		return ""
+	}
+	return string(m[num][0].([]byte))
+}
+
+// attrs decodes repeated KeyValue field num into strings and ints.
+func (m message) attrs(t *testing.T, num protowire.Number) map[string]any {
+	t.Helper()
+	out := map[string]any{}
+	for _, kv := range m.msgs(t, num) {
+		val := kv.msgs(t, 2)[0]
+		switch {
+		case len(val[1]) > 0:
+			out[kv.str(1)] = val.str(1)
+		case len(val[3]) > 0:
+			out[kv.str(1)] = int64(val[3][0].(uint64))
+		}
+	}
+	return out
+}
+
+func testSnapshot() metrics.Snapshot {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return metrics.Snapshot{
+		Timestamp:    start,
+		EndTime:      start.Add(time.Minute),
+		Connections:  12,
+		Inactive:     2,
+		BandwidthIn:  1500,
+		BandwidthOut: 700,
+		PacketsIn:    10,
+		PacketsOut:   6,
+		PeakRateIn:   900,
+		PeakRateOut:  400,
+		Protocols: map[string]metrics.ProtocolStats{
+			"UDP": {BytesIn: 500, BytesOut: 200, PacketsIn: 4, PacketsOut: 2},
+			"TCP": {BytesIn: 1000, BytesOut: 500, PacketsIn: 6, PacketsOut: 4},
+		},
+		NewConnections: 3,
+		PacketSizes:    []int64{4, 2, 0, 0, 3, 7, 0},
+		Capture:        &metrics.CaptureStats{Policy: "drop", ChannelDrops: 5, KernelDrops: 2},
+	}
+}
+
+func testConnection() backend.Connection {
+	dur, in, out := int64(1500), int64(4096), int64(512)
+	return backend.Connection{
+		ID:            "flow-1",
+		SourceIP:      "10.0.0.5",
+		DestIP:        "93.184.216.34",
+		SourcePort:    51000,
+		DestPort:      443,
+		Protocol:      "TCP",
+		Status:        "active",
+		StartTime:     "2026-03-01T12:00:00Z",
+		LastActivity:  "2026-03-01T12:00:01.5Z",
+		DurationMs:    &dur,
+		BytesIn:       &in,
+		BytesOut:      &out,
+		IntervalStart: "2026-03-01T12:00:00Z",
+		IntervalEnd:   "2026-03-01T12:00:01.5Z",
+		DeltaBytesIn:  &in,
+	}
+}
+
+func TestExportMetrics_Protobuf(t *testing.T) {
+	r := newReceiver(t)
+	e, err := New(r.URL+"/", ProtocolProtobuf, time.Second,
+		WithInterface("eth0"), WithResource(Resource{ServiceVersion: "1.2.3", InstanceID: "agent-1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportMetrics(context.Background(), testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ct := r.body("/v1/metrics")
+	if ct != "application/x-protobuf" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	rm := decode(t, body).msgs(t, 1)[0]
+	res := rm.msgs(t, 1)[0].attrs(t, 1)
+	if res["service.name"] != "byteroute-client" || res["service.instance.id"] != "agent-1" || res["service.version"] != "1.2.3" {
+		t.Fatalf("unexpected resource %v", res)
+	}
+	sm := rm.msgs(t, 2)[0]
+	if sm.msgs(t, 1)[0].str(1) != scopeName {
+		t.Fatalf("unexpected scope %q", sm.msgs(t, 1)[0].str(1))
+	}
+
+	byName := map[string]message{}
+	for _, m := range sm.msgs(t, 2) {
+		byName[m.str(1)] = m
+	}
+	netIO, ok := byName["system.network.io"]
+	if !ok || netIO.str(3) != "By" {
+		t.Fatalf("missing system.network.io, got %v", byName)
+	}
+	s := netIO.msgs(t, 7)[0]
+	if s[2][0].(uint64) != temporalityDelta || s[3][0].(uint64) != 1 {
+		t.Fatal("expected a monotonic delta sum")
+	}
+	points := s.msgs(t, 1)
+	if len(points) != 4 {
+		t.Fatalf("expected 4 points (2 protocols x 2 directions), got %d", len(points))
+	}
+	// Protocols are sorted, so TCP receive comes first.
+	p := points[0]
+	attrs := p.attrs(t, 7)
+	if attrs[attrInterface] != "eth0" || attrs[attrDirection] != "receive" || attrs[attrTransport] != "tcp" {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+	if int64(p[6][0].(uint64)) != 1000 {
+		t.Fatalf("expected 1000 bytes, got %d", p[6][0])
+	}
+	if p[2][0].(uint64) != unixNano(testSnapshot().Timestamp) || p[3][0].(uint64) != unixNano(testSnapshot().EndTime) {
+		t.Fatal("expected the point to cover the snapshot period")
+	}
+
+	flows := byName["byteroute.flows"].msgs(t, 5)[0].msgs(t, 1)[0]
+	if int64(flows[6][0].(uint64)) != 12 || len(flows[2]) != 0 {
+		t.Fatalf("expected gauge of 12 without start time, got %v", flows)
+	}
+
+	dropped := byName["byteroute.capture.dropped"].msgs(t, 7)[0].msgs(t, 1)
+	if len(dropped) != 3 || int64(dropped[0][6][0].(uint64)) != 5 || dropped[0].attrs(t, 7)["byteroute.capture.drop_reason"] != "queue" {
+		t.Fatalf("unexpected capture drops %v", dropped)
+	}
+
+	hist := byName["byteroute.network.packet.size"].msgs(t, 9)[0].msgs(t, 1)[0]
+	if hist[4][0].(uint64) != 16 {
+		t.Fatalf("expected count 16, got %v", hist[4][0])
+	}
+	bounds := hist[7][0].([]byte)
+	if len(bounds) != 8*len(metrics.PacketSizeBounds) {
+		t.Fatalf("expected %d packed bounds, got %d bytes", len(metrics.PacketSizeBounds), len(bounds))
+	}
+	if v, _ := protowire.ConsumeFixed64(bounds); math.Float64frombits(v) != 64 {
+		t.Fatalf("expected first bound 64, got %v", math.Float64frombits(v))
+	}
+}
+
+func TestExportMetrics_JSON(t *testing.T) {
+	r := newReceiver(t)
+	e, err := New(r.URL, ProtocolJSON, time.Second, WithInterface("eth0"), WithGzip(),
+		WithHeaders(map[string]string{"Api-Key": "secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportMetrics(context.Background(), testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ct := r.body("/v1/metrics")
+	if ct != "application/json" || r.headers.Get("Api-Key") != "secret" {
+		t.Fatalf("unexpected content type %q or headers %v", ct, r.headers)
+	}
+	var req struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string `json:"name"`
+					Sum  *struct {
+						AggregationTemporality int `json:"aggregationTemporality"`
+						DataPoints             []struct {
+							StartTimeUnixNano string `json:"startTimeUnixNano"`
+							AsInt             string `json:"asInt"`
+							Attributes        []struct {
+								Key   string `json:"key"`
+								Value struct {
+									StringValue string `json:"stringValue"`
+								} `json:"value"`
+							} `json:"attributes"`
+						} `json:"dataPoints"`
+					} `json:"sum"`
+					Histogram *struct {
+						DataPoints []struct {
+							Count        string   `json:"count"`
+							BucketCounts []string `json:"bucketCounts"`
+						} `json:"dataPoints"`
+					} `json:"histogram"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("invalid OTLP/JSON: %v\n%s", err, body)
+	}
+	ms := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if ms[0].Name != "system.network.io" || ms[0].Sum == nil || ms[0].Sum.AggregationTemporality != temporalityDelta {
+		t.Fatalf("unexpected first metric %+v", ms[0])
+	}
+	p := ms[0].Sum.DataPoints[1]
+	if p.AsInt != "500" || p.StartTimeUnixNano == "" {
+		t.Fatalf("expected TCP transmit of 500 as a string, got %+v", p)
+	}
+	if p.Attributes[1].Key != attrDirection || p.Attributes[1].Value.StringValue != "transmit" {
+		t.Fatalf("unexpected attributes %+v", p.Attributes)
+	}
+	last := ms[len(ms)-1]
+	if last.Histogram == nil || last.Histogram.DataPoints[0].Count != "16" || last.Histogram.DataPoints[0].BucketCounts[5] != "7" {
+		t.Fatalf("unexpected histogram %+v", last)
+	}
+}
+
+func TestExportFlows_Protobuf(t *testing.T) {
+	r := newReceiver(t)
+	e, err := New(r.URL, ProtocolProtobuf, time.Second, WithInterface("eth0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	observed := time.Date(2026, 3, 1, 12, 0, 5, 0, time.UTC)
+	e.now = func() time.Time { return observed }
+
+	if err := e.ExportFlows(context.Background(), []backend.Connection{testConnection()}); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := r.body("/v1/logs")
+	rec := decode(t, body).msgs(t, 1)[0].msgs(t, 2)[0].msgs(t, 2)[0]
+
+	if rec.str(12) != flowEvent || rec[2][0].(uint64) != severityInfo {
+		t.Fatalf("unexpected event %q / severity %v", rec.str(12), rec[2])
+	}
+	if rec[11][0].(uint64) != unixNano(observed) {
+		t.Fatal("expected observed timestamp")
+	}
+	if want := time.Date(2026, 3, 1, 12, 0, 1, 5e8, time.UTC); rec[1][0].(uint64) != unixNano(want) {
+		t.Fatal("expected the record to be stamped with the interval end")
+	}
+	attrs := rec.attrs(t, 6)
+	want := map[string]any{
+		attrTransport:              "tcp",
+		attrNetworkType:            "ipv4",
+		attrLocalAddress:           "10.0.0.5",
+		attrLocalPort:              int64(51000),
+		attrPeerAddress:            "93.184.216.34",
+		attrPeerPort:               int64(443),
+		attrInterface:              "eth0",
+		"byteroute.flow.id":        "flow-1",
+		"byteroute.flow.bytes_in":  int64(4096),
+		"byteroute.flow.bytes_out": int64(512),
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, attrs[k])
+		}
+	}
+	if _, ok := attrs["byteroute.flow.packets_in"]; ok {
+		t.Error("expected unset counters to be omitted")
+	}
+	if body := rec.msgs(t, 5)[0].str(1); !strings.Contains(body, "10.0.0.5:51000 -> 93.184.216.34:443") {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestExportFlows_JSON(t *testing.T) {
+	r := newReceiver(t)
+	e, err := New(r.URL, ProtocolJSON, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := testConnection()
+	conn.SourcePort, conn.DestPort = 0, 0
+	if err := e.ExportFlows(context.Background(), []backend.Connection{conn}); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := r.body("/v1/logs")
+	var req struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano string `json:"timeUnixNano"`
+					EventName    string `json:"eventName"`
+					Attributes   []struct {
+						Key   string `json:"key"`
+						Value struct {
+							StringValue *string `json:"stringValue"`
+							IntValue    *string `json:"intValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("invalid OTLP/JSON: %v\n%s", err, body)
+	}
+	rec := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if rec.EventName != flowEvent || rec.TimeUnixNano == "" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	for _, kv := range rec.Attributes {
+		switch kv.Key {
+		case attrLocalPort, attrPeerPort:
+			t.Errorf("expected no %s when ports are deduplicated away", kv.Key)
+		case "byteroute.flow.duration_ms":
+			if kv.Value.IntValue == nil || *kv.Value.IntValue != "1500" {
+				t.Errorf("expected duration as string int, got %+v", kv.Value)
+			}
+		}
+	}
+}
+
+func TestExport_ErrorStatus(t *testing.T) {
+	r := newReceiver(t)
+	r.failWith = http.StatusServiceUnavailable
+	e, err := New(r.URL, ProtocolProtobuf, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportFlows(context.Background(), []backend.Connection{testConnection()}); err == nil {
+		t.Fatal("expected an error for a 503")
+	}
+	if err := e.ExportFlows(context.Background(), nil); err != nil {
+		t.Fatalf("expected no request for an empty batch, got %v", err)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	h, err := ParseHeaders("api-key=abc%3D%3D, x-team = net ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h["api-key"] != "abc==" || h["x-team"] != "net" || len(h) != 2 {
+		t.Fatalf("unexpected headers %v", h)
+	}
+	if _, err := ParseHeaders("novalue"); err == nil {
+		t.Fatal("expected error for a pair without =")
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	if p, err := ParseProtocol(""); err != nil || p != ProtocolProtobuf {
+		t.Fatalf("expected protobuf default, got %q, %v", p, err)
+	}
+	if _, err := ParseProtocol("grpc"); err == nil {
+		t.Fatal("expected grpc to be rejected")
+	}
+}
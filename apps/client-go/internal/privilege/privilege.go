@@ -0,0 +1,232 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package privilege reduces what the agent may do once its capture handle
+// is open: it drops capabilities, switches to an unprivileged user and can
+// install a seccomp filter. It also reports the privileges a process holds.
+package privilege
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Cap is a Linux capability number.
+type Cap int
+
+const (
+	CapNetBindService Cap = 10
+	CapNetAdmin       Cap = 12
+	CapNetRaw         Cap = 13
+)
+
+// capNames lists capabilities by number, without the CAP_ prefix.
+var capNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill",
+	"setgid", "setuid", "setpcap", "linux_immutable", "net_bind_service",
+	"net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner",
+	"sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time",
+	"sys_tty_config", "mknod", "lease", "audit_write", "audit_control",
+	"setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm",
+	"block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+func (c Cap) String() string {
+	if c >= 0 && int(c) < len(capNames) {
+		return "cap_" + capNames[c]
+	}
+	return "cap_" + strconv.Itoa(int(c))
+}
+
+// CapSet is a set of capabilities as a bit mask, the format of the Cap*
+// lines in /proc/<pid>/status.
+type CapSet uint64
+
+func (s CapSet) Has(c Cap) bool { return s&(1<<uint(c)) != 0 }
+
+func (s CapSet) Add(c Cap) CapSet { return s | 1<<uint(c) }
+
+// String lists the capabilities in s, or "none" or "all".
+func (s CapSet) String() string {
+	switch s {
+	case 0:
+		return "none"
+	case 1<<len(capNames) - 1:
+		return "all"
+	}
+	var names []string
+	for c := Cap(0); c < 64; c++ {
+		if s.Has(c) {
+			names = append(names, c.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseCaps parses capability names such as "net_raw" or "CAP_NET_ADMIN".
+func ParseCaps(names []string) (CapSet, error) {
+	var s CapSet
+	for _, name := range names {
+		n := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "cap_")
+		found := false
+		for i, known := range capNames {
+			if n == known {
+				s, found = s.Add(Cap(i)), true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return s, nil
+}
+
+// Options controls Drop. UID and GID of -1 keep the current user and
+// group; see LookupUser.
+type Options struct {
+	UID, GID int
+	// Keep lists the capabilities retained; everything else is dropped from
+	// the effective, permitted, inheritable, ambient and bounding sets.
+	Keep CapSet
+	// Seccomp installs a filter refusing syscalls the agent never needs
+	// once capture is running, such as execve, ptrace and mount.
+	Seccomp bool
+}
+
+// LookupUser resolves a user and group, by name or number, for Options.
+// Without a group the user's primary group is used; an empty name keeps
+// the current user.
+func LookupUser(name, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if name != "" {
+		u, err := user.Lookup(name)
+		if _, ok := err.(user.UnknownUserError); ok {
+			u, err = user.LookupId(name)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("user %s: %w", name, err)
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return 0, 0, fmt.Errorf("user %s: %w", name, err)
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if _, ok := err.(user.UnknownGroupError); ok {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("group %s: %w", group, err)
+		}
+	}
+	return uid, gid, nil
+}
+
+// Status describes the privileges a process holds. The capability sets are
+// the union over all of its threads.
+type Status struct {
+	UID, EUID  int
+	GID, EGID  int
+	Effective  CapSet
+	Permitted  CapSet
+	Bounding   CapSet
+	Ambient    CapSet
+	NoNewPrivs bool
+	Seccomp    string // "disabled", "strict" or "filter"
+}
+
+// CanCapture reports whether the process may open a capture handle.
+func (s Status) CanCapture() bool { return s.Effective.Has(CapNetRaw) }
+
+func (s Status) String() string {
+	return fmt.Sprintf("uid=%d euid=%d gid=%d egid=%d caps=%s bounding=%s no_new_privs=%t seccomp=%s",
+		s.UID, s.EUID, s.GID, s.EGID, s.Effective, s.Bounding, s.NoNewPrivs, s.Seccomp)
+}
+
+// parseStatus merges one /proc/<pid>/task/<tid>/status file into st.
+func parseStatus(st *Status, data string) error {
+	for _, line := range strings.Split(data, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch key {
+		case "Uid":
+			st.UID, st.EUID, err = ids(fields)
+		case "Gid":
+			st.GID, st.EGID, err = ids(fields)
+		case "CapEff":
+			err = mergeCaps(&st.Effective, fields[0])
+		case "CapPrm":
+			err = mergeCaps(&st.Permitted, fields[0])
+		case "CapBnd":
+			err = mergeCaps(&st.Bounding, fields[0])
+		case "CapAmb":
+			err = mergeCaps(&st.Ambient, fields[0])
+		case "NoNewPrivs":
+			st.NoNewPrivs = fields[0] == "1"
+		case "Seccomp":
+			switch fields[0] {
+			case "0":
+				st.Seccomp = "disabled"
+			case "1":
+				st.Seccomp = "strict"
+			case "2":
+				st.Seccomp = "filter"
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func ids(fields []string) (real, effective int, err error) {
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("want real and effective id, got %q", fields)
+	}
+	if real, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	effective, err = strconv.Atoi(fields[1])
+	return real, effective, err
+}
+
+func mergeCaps(dst *CapSet, hex string) error {
+	v, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		return err
+	}
+	*dst |= CapSet(v)
+	return nil
+}
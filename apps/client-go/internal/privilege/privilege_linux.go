@@ -0,0 +1,206 @@
+//go:build linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prCapbsetDrop         = 24
+	prSetKeepCaps         = 8
+	prSetNoNewPrivs       = 38
+	prCapAmbient          = 47
+	prCapAmbientClear     = 4
+	linuxCapVersion3      = 0x20080522
+	capSetpcap        Cap = 8
+	defaultLastCap    Cap = 40
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective, permitted, inheritable uint32
+}
+
+// Check reports options Drop cannot carry out for every thread. Builds
+// using cgo change capabilities on one thread only; there, only a switch
+// away from root clears them everywhere, and it clears kept ones too.
+func Check(opts Options) error {
+	if threadsShared() {
+		return nil
+	}
+	if opts.Keep != 0 && (opts.UID >= 0 || opts.GID >= 0) {
+		return errors.New("--keep-caps cannot be combined with --user or --group in builds using cgo")
+	}
+	if opts.UID < 0 && os.Geteuid() == 0 {
+		return errors.New("running as root, capabilities can only be dropped from every thread by --user in builds using cgo")
+	}
+	return nil
+}
+
+// Drop reduces the privileges of the process as described by opts. It is
+// meant to run once, after the capture handle is open; an open handle keeps
+// working without any capability.
+func Drop(opts Options) error {
+	if err := Check(opts); err != nil {
+		return err
+	}
+
+	// Capabilities belong to threads: keep the ones read and changed below
+	// on the same thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	_, permitted, err := capget()
+	if err != nil {
+		return err
+	}
+	if permitted.Has(capSetpcap) {
+		for c := Cap(0); c <= lastCap(); c++ {
+			if !opts.Keep.Has(c) {
+				if err := allThreads(syscall.SYS_PRCTL, prCapbsetDrop, uintptr(c), 0); err != nil {
+					return fmt.Errorf("drop %s from bounding set: %w", c, err)
+				}
+			}
+		}
+	}
+	// Kernels before 4.3 have no ambient set.
+	if err := allThreads(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClear, 0); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("clear ambient capabilities: %w", err)
+	}
+
+	if opts.UID >= 0 || opts.GID >= 0 {
+		if opts.Keep != 0 {
+			if err := allThreads(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0); err != nil {
+				return fmt.Errorf("keep capabilities: %w", err)
+			}
+		}
+		if opts.GID >= 0 {
+			if err := syscall.Setgroups([]int{opts.GID}); err != nil {
+				return fmt.Errorf("setgroups: %w", err)
+			}
+			if err := syscall.Setresgid(opts.GID, opts.GID, opts.GID); err != nil {
+				return fmt.Errorf("setresgid %d: %w", opts.GID, err)
+			}
+		}
+		if opts.UID >= 0 {
+			if err := syscall.Setresuid(opts.UID, opts.UID, opts.UID); err != nil {
+				return fmt.Errorf("setresuid %d: %w", opts.UID, err)
+			}
+		}
+	}
+
+	if err := capset(opts.Keep & permitted); err != nil {
+		return fmt.Errorf("set capabilities: %w", err)
+	}
+	if err := allThreads(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	if opts.Seccomp {
+		return installSeccomp()
+	}
+	return nil
+}
+
+// Current reports the privileges of the running process.
+func Current() (Status, error) {
+	var st Status
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return st, err
+	}
+	if err := parseStatus(&st, string(data)); err != nil {
+		return st, err
+	}
+	// Threads can differ in their capabilities; report every one held.
+	tasks, _ := filepath.Glob("/proc/self/task/*/status")
+	for _, path := range tasks {
+		if data, err := os.ReadFile(path); err == nil {
+			_ = parseStatus(&st, string(data))
+		}
+	}
+	return st, nil
+}
+
+func capget() (effective, permitted CapSet, err error) {
+	hdr := capHeader{version: linuxCapVersion3}
+	var data [2]capData
+	if _, _, e := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); e != 0 {
+		return 0, 0, fmt.Errorf("capget: %w", e)
+	}
+	effective = CapSet(data[0].effective) | CapSet(data[1].effective)<<32
+	permitted = CapSet(data[0].permitted) | CapSet(data[1].permitted)<<32
+	return effective, permitted, nil
+}
+
+// capset makes keep the effective and permitted sets and clears the
+// inheritable set.
+func capset(keep CapSet) error {
+	hdr := capHeader{version: linuxCapVersion3}
+	data := [2]capData{
+		{effective: uint32(keep), permitted: uint32(keep)},
+		{effective: uint32(keep >> 32), permitted: uint32(keep >> 32)},
+	}
+	return allThreads(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+}
+
+// allThreads runs a syscall on every thread of the process. Binaries built
+// with cgo cannot do that, so there it only reaches the calling thread; a
+// switch away from root still clears the other threads' capabilities.
+func allThreads(trap, a1, a2, a3 uintptr) error {
+	_, _, e := syscall.AllThreadsSyscall(trap, a1, a2, a3)
+	if e == syscall.ENOTSUP {
+		_, _, e = syscall.RawSyscall(trap, a1, a2, a3)
+	}
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// threadsShared reports whether allThreads reaches every thread.
+func threadsShared() bool {
+	_, _, e := syscall.AllThreadsSyscall(syscall.SYS_GETPID, 0, 0, 0)
+	return e != syscall.ENOTSUP
+}
+
+func lastCap() Cap {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return defaultLastCap
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return defaultLastCap
+	}
+	return Cap(n)
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheck_Cgo(t *testing.T) {
+	if threadsShared() {
+		t.Skip("capabilities reach every thread in this build")
+	}
+	if err := Check(Options{UID: 1000, GID: -1, Keep: CapSet(0).Add(CapNetRaw)}); err == nil {
+		t.Fatal("expected --keep-caps with a user switch to be refused")
+	}
+	if err := Check(Options{UID: 1000, GID: -1}); err != nil {
+		t.Fatalf("user switch: %v", err)
+	}
+	err := Check(Options{UID: -1, GID: -1})
+	if root := os.Geteuid() == 0; root != (err != nil) {
+		t.Fatalf("root=%v without --user: %v", root, err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import "errors"
+
+var errUnsupported = errors.New("privilege dropping is only supported on linux")
+
+// Drop only fails when asked to change the user or install a seccomp
+// filter; there are no capabilities to drop.
+func Drop(opts Options) error {
+	if opts.UID >= 0 || opts.GID >= 0 || opts.Seccomp {
+		return errUnsupported
+	}
+	return nil
+}
+
+// Check has nothing to check outside linux; Drop reports what it cannot do.
+func Check(opts Options) error {
+	return nil
+}
+
+func Current() (Status, error) {
+	return Status{}, errUnsupported
+}
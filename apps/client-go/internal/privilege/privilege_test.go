@@ -0,0 +1,76 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import "testing"
+
+const sampleStatus = `Name:	byteroute-client
+Uid:	0	1000	0	1000
+Gid:	0	1001	0	1001
+CapInh:	0000000000000000
+CapPrm:	0000000000003000
+CapEff:	0000000000002000
+CapBnd:	000001ffffffffff
+CapAmb:	0000000000000000
+NoNewPrivs:	1
+Seccomp:	2
+`
+
+func TestParseStatus(t *testing.T) {
+	var st Status
+	if err := parseStatus(&st, sampleStatus); err != nil {
+		t.Fatal(err)
+	}
+	if st.UID != 0 || st.EUID != 1000 || st.GID != 0 || st.EGID != 1001 {
+		t.Fatalf("ids = %+v", st)
+	}
+	if st.Effective.String() != "cap_net_raw" || st.Permitted.String() != "cap_net_admin,cap_net_raw" {
+		t.Fatalf("caps = %s / %s", st.Effective, st.Permitted)
+	}
+	if !st.NoNewPrivs || st.Seccomp != "filter" || !st.CanCapture() {
+		t.Fatalf("status = %+v", st)
+	}
+	if got := st.Bounding.String(); got != "all" {
+		t.Fatalf("bounding = %s", got)
+	}
+}
+
+func TestParseStatus_MergesThreads(t *testing.T) {
+	var st Status
+	_ = parseStatus(&st, "CapEff:\t0000000000001000\n")
+	_ = parseStatus(&st, "CapEff:\t0000000000002000\n")
+	if st.Effective.String() != "cap_net_admin,cap_net_raw" {
+		t.Fatalf("effective = %s", st.Effective)
+	}
+}
+
+func TestParseCaps(t *testing.T) {
+	s, err := ParseCaps([]string{"net_raw", "CAP_NET_ADMIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has(CapNetRaw) || !s.Has(CapNetAdmin) || s.Has(CapNetBindService) {
+		t.Fatalf("set = %s", s)
+	}
+	if _, err := ParseCaps([]string{"net_everything"}); err == nil {
+		t.Fatal("expected error for unknown capability")
+	}
+	if s, _ := ParseCaps(nil); s.String() != "none" {
+		t.Fatalf("empty set = %s", s)
+	}
+}
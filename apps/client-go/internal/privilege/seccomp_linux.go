@@ -0,0 +1,115 @@
+//go:build linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// deniedSyscalls are refused by the seccomp filter. The agent needs none
+// of them once capture is running; they are what an attacker who took over
+// the packet parser would reach for first. Names missing on an
+// architecture are skipped.
+var deniedSyscalls = []string{
+	"execve", "execveat", "ptrace", "process_vm_readv", "process_vm_writev",
+	"mount", "umount2", "pivot_root", "chroot", "unshare", "setns",
+	"init_module", "finit_module", "delete_module", "kexec_load", "kexec_file_load",
+	"bpf", "perf_event_open", "userfaultfd", "io_uring_setup",
+	"keyctl", "add_key", "request_key", "personality",
+	"reboot", "swapon", "swapoff", "acct", "settimeofday", "clock_settime", "adjtimex",
+	"sethostname", "setdomainname", "open_by_handle_at", "iopl", "ioperm",
+}
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+
+	bpfLdWAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// installSeccomp applies the filter to every thread. The calling thread
+// must already have no_new_privs set.
+func installSeccomp() error {
+	if auditArch == 0 {
+		return fmt.Errorf("seccomp filter is not supported on %s", runtime.GOARCH)
+	}
+	prog := seccompFilter(auditArch, x32SyscallBit, deniedNumbers())
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	r, _, e := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&fprog)))
+	if e != 0 {
+		return fmt.Errorf("seccomp: %w", e)
+	}
+	if r != 0 {
+		return fmt.Errorf("seccomp: thread %d could not be synchronised", r)
+	}
+	return nil
+}
+
+func deniedNumbers() []uint32 {
+	var nrs []uint32
+	for _, name := range deniedSyscalls {
+		if nr, ok := syscallNumbers[name]; ok {
+			nrs = append(nrs, nr)
+		}
+	}
+	return nrs
+}
+
+// seccompFilter builds a program that fails the denied syscalls, and any
+// syscall made through another ABI, with EPERM. x32Bit, when not zero,
+// marks syscall numbers of an ABI sharing arch that is refused as well.
+func seccompFilter(arch, x32Bit uint32, denied []uint32) []syscall.SockFilter {
+	prog := []syscall.SockFilter{
+		{Code: bpfLdWAbs, K: seccompDataArch},
+		{Code: bpfJeqK, K: arch}, // jf patched below
+		{Code: bpfLdWAbs, K: seccompDataNr},
+	}
+	var jumps []int
+	if x32Bit != 0 {
+		jumps = append(jumps, len(prog))
+		prog = append(prog, syscall.SockFilter{Code: bpfJgeK, K: x32Bit})
+	}
+	for _, nr := range denied {
+		jumps = append(jumps, len(prog))
+		prog = append(prog, syscall.SockFilter{Code: bpfJeqK, K: nr})
+	}
+	prog = append(prog, syscall.SockFilter{Code: bpfRetK, K: seccompRetAllow})
+	deny := len(prog)
+	prog = append(prog, syscall.SockFilter{Code: bpfRetK, K: seccompRetErrno | uint32(syscall.EPERM)})
+
+	prog[1].Jf = uint8(deny - 1 - 1)
+	for _, i := range jumps {
+		prog[i].Jt = uint8(deny - i - 1)
+	}
+	return prog
+}
@@ -0,0 +1,34 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+const (
+	auditArch     = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSeccomp    = 317
+	x32SyscallBit = 0x40000000
+)
+
+var syscallNumbers = map[string]uint32{
+	"execve": 59, "execveat": 322, "ptrace": 101, "process_vm_readv": 310, "process_vm_writev": 311,
+	"mount": 165, "umount2": 166, "pivot_root": 155, "chroot": 161, "unshare": 272, "setns": 308,
+	"init_module": 175, "finit_module": 313, "delete_module": 176, "kexec_load": 246, "kexec_file_load": 320,
+	"bpf": 321, "perf_event_open": 298, "userfaultfd": 323, "io_uring_setup": 425,
+	"keyctl": 250, "add_key": 248, "request_key": 249, "personality": 135,
+	"reboot": 169, "swapon": 167, "swapoff": 168, "acct": 163, "settimeofday": 164, "clock_settime": 227, "adjtimex": 159,
+	"sethostname": 170, "setdomainname": 171, "open_by_handle_at": 304, "iopl": 172, "ioperm": 173,
+}
@@ -0,0 +1,34 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+const (
+	auditArch     = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sysSeccomp    = 277
+	x32SyscallBit = 0
+)
+
+var syscallNumbers = map[string]uint32{
+	"execve": 221, "execveat": 281, "ptrace": 117, "process_vm_readv": 270, "process_vm_writev": 271,
+	"mount": 40, "umount2": 39, "pivot_root": 41, "chroot": 51, "unshare": 97, "setns": 268,
+	"init_module": 105, "finit_module": 273, "delete_module": 106, "kexec_load": 104, "kexec_file_load": 294,
+	"bpf": 280, "perf_event_open": 241, "userfaultfd": 282, "io_uring_setup": 425,
+	"keyctl": 219, "add_key": 217, "request_key": 218, "personality": 92,
+	"reboot": 142, "swapon": 224, "swapoff": 225, "acct": 89, "settimeofday": 170, "clock_settime": 112, "adjtimex": 171,
+	"sethostname": 161, "setdomainname": 162, "open_by_handle_at": 265,
+}
@@ -0,0 +1,120 @@
+//go:build linux
+
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// run interprets the subset of classic BPF seccompFilter emits.
+func run(t *testing.T, prog []syscall.SockFilter, nr, arch uint32) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case bpfLdWAbs:
+			acc = map[uint32]uint32{seccompDataNr: nr, seccompDataArch: arch}[ins.K]
+		case bpfJeqK, bpfJgeK:
+			match := acc == ins.K
+			if ins.Code == bpfJgeK {
+				match = acc >= ins.K
+			}
+			if match {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfRetK:
+			return ins.K
+		default:
+			t.Fatalf("unexpected opcode %#x", ins.Code)
+		}
+	}
+	t.Fatal("program fell off the end")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	const arch = 0xc000003e
+	prog := seccompFilter(arch, 0x40000000, []uint32{59, 101})
+	deny := seccompRetErrno | uint32(syscall.EPERM)
+
+	for _, tc := range []struct {
+		name     string
+		nr, arch uint32
+		want     uint32
+	}{
+		{"allowed", 0, arch, seccompRetAllow},
+		{"execve", 59, arch, deny},
+		{"ptrace", 101, arch, deny},
+		{"x32 abi", 0x40000000 + 59, arch, deny},
+		{"other arch", 0, 0x40000003, deny},
+	} {
+		if got := run(t, prog, tc.nr, tc.arch); got != tc.want {
+			t.Errorf("%s: got %#x, want %#x", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestDrop_Seccomp drops privileges in a child process, since they cannot
+// be regained, and checks that exec is refused there.
+func TestDrop_Seccomp(t *testing.T) {
+	if auditArch == 0 {
+		t.Skip("no seccomp support for this architecture")
+	}
+	if os.Getenv("PRIVILEGE_TEST_CHILD") == "1" {
+		// Without AllThreadsSyscall (cgo builds) capabilities are only
+		// dropped on the calling thread, so check that one.
+		runtime.LockOSThread()
+		opts := Options{UID: -1, GID: -1, Seccomp: true}
+		if os.Geteuid() == 0 {
+			// Root has to switch user in cgo builds.
+			opts.UID, opts.GID = 65534, 65534
+		}
+		if err := Drop(opts); err != nil {
+			t.Fatalf("drop: %v", err)
+		}
+		if eff, prm, err := capget(); err != nil || eff != 0 || prm != 0 {
+			t.Fatalf("capabilities after drop: %s / %s (%v)", eff, prm, err)
+		}
+		st, err := Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.NoNewPrivs || st.Seccomp != "filter" {
+			t.Fatalf("status after drop: %s", st)
+		}
+		if err := syscall.Exec("/bin/true", []string{"true"}, nil); err != syscall.EPERM {
+			t.Fatalf("exec: got %v, want EPERM", err)
+		}
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDrop_Seccomp$")
+	cmd.Env = append(os.Environ(), "PRIVILEGE_TEST_CHILD=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("child: %v\n%s", err, out)
+	}
+}
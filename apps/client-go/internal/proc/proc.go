@@ -0,0 +1,146 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proc maps local sockets to the processes that own them by reading
+// procfs.
+//
+// Other users' /proc/[pid]/fd directories are only readable with
+// CAP_SYS_PTRACE or CAP_DAC_READ_SEARCH, so after switching to an
+// unprivileged user only the client's own sockets resolve unless those
+// capabilities are kept.
+package proc
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAge bounds how stale a snapshot may be before Lookup rebuilds it.
+const maxAge = 5 * time.Second
+
+type socket struct {
+	protocol string
+	port     int
+}
+
+// Table is a cached snapshot of local port to process name.
+type Table struct {
+	mu        sync.Mutex
+	root      string
+	refreshed time.Time
+	names     map[socket]string
+	now       func() time.Time
+}
+
+func newTable(root string) *Table {
+	return &Table{root: root, now: time.Now}
+}
+
+// Lookup returns the name of the process owning the local protocol ("TCP"
+// or "UDP") port, or "" when it is unknown.
+func (t *Table) Lookup(protocol string, port int) string {
+	if t == nil || t.root == "" {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now := t.now(); t.names == nil || now.Sub(t.refreshed) >= maxAge {
+		t.names = t.snapshot()
+		t.refreshed = now
+	}
+	return t.names[socket{protocol: strings.ToUpper(protocol), port: port}]
+}
+
+func (t *Table) snapshot() map[socket]string {
+	inodes := map[string]socket{}
+	for file, protocol := range map[string]string{"tcp": "TCP", "tcp6": "TCP", "udp": "UDP", "udp6": "UDP"} {
+		f, err := os.Open(filepath.Join(t.root, "net", file))
+		if err != nil {
+			continue
+		}
+		for inode, port := range parseNet(f) {
+			inodes[inode] = socket{protocol: protocol, port: port}
+		}
+		f.Close()
+	}
+
+	names := map[socket]string{}
+	pids, _ := os.ReadDir(t.root)
+	for _, pid := range pids {
+		if _, err := strconv.Atoi(pid.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(t.root, pid.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		var comm string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			s, ok := inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]
+			if !ok {
+				continue
+			}
+			if _, seen := names[s]; seen {
+				continue
+			}
+			if comm == "" {
+				data, err := os.ReadFile(filepath.Join(dir, "comm"))
+				if err != nil {
+					break
+				}
+				comm = strings.TrimSpace(string(data))
+			}
+			names[s] = comm
+		}
+	}
+	return names
+}
+
+// parseNet reads a /proc/net/{tcp,udp}[6] table and returns the local port
+// of each socket keyed by inode.
+func parseNet(f *os.File) map[string]int {
+	ports := map[string]int{}
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[9] == "0" {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			continue
+		}
+		ports[fields[9]] = int(port)
+	}
+	return ports
+}
@@ -0,0 +1,91 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const tcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000   101        0 1001 1 0000000000000000 100 0 0 10 5
+   1: 0A000001:D431 08080808:01BB 01 00000000:00000000 00:00000000 00000000  1000        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0A000001:D432 08080808:01BB 06 00000000:00000000 03:00000D5B 00000000     0        0 0 3 0000000000000000
+`
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTable_Lookup(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "net", "tcp"), tcpTable)
+	write(t, filepath.Join(root, "10", "comm"), "resolved\n")
+	write(t, filepath.Join(root, "20", "comm"), "curl\n")
+	write(t, filepath.Join(root, "self", "comm"), "ignored\n")
+	for pid, inode := range map[string]string{"10": "1001", "20": "1002"} {
+		fd := filepath.Join(root, pid, "fd")
+		if err := os.MkdirAll(fd, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("socket:["+inode+"]", filepath.Join(fd, "3")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("/dev/null", filepath.Join(fd, "0")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Unix(0, 0)
+	tab := newTable(root)
+	tab.now = func() time.Time { return now }
+
+	if got := tab.Lookup("TCP", 53); got != "resolved" {
+		t.Fatalf("port 53 = %q", got)
+	}
+	if got := tab.Lookup("tcp", 54321); got != "curl" {
+		t.Fatalf("port 54321 = %q", got)
+	}
+	if got := tab.Lookup("UDP", 53); got != "" {
+		t.Fatalf("udp port 53 = %q", got)
+	}
+
+	// Snapshots are reused until they are maxAge old.
+	write(t, filepath.Join(root, "20", "comm"), "wget\n")
+	if got := tab.Lookup("TCP", 54321); got != "curl" {
+		t.Fatalf("expected cached name, got %q", got)
+	}
+	now = now.Add(maxAge)
+	if got := tab.Lookup("TCP", 54321); got != "wget" {
+		t.Fatalf("expected refreshed name, got %q", got)
+	}
+}
+
+func TestTable_NoRoot(t *testing.T) {
+	if got := newTable("").Lookup("TCP", 80); got != "" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rdns caches reverse DNS names, resolving them in the background so
+// callers on a hot path never wait on the resolver.
+package rdns
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxNames      = 4096
+	nameTTL       = time.Hour
+	failedTTL     = time.Minute
+	lookupTimeout = 2 * time.Second
+	// maxWait bounds how long Lookup reports a name as still being
+	// resolved while no lookup could be started for it.
+	maxWait = 10 * time.Second
+)
+
+// Resolver is a reverse DNS cache. It keeps the most recently used names,
+// for an hour; failed lookups are cached as "" for a minute, then retried.
+type Resolver struct {
+	mu      sync.Mutex
+	names   map[string]*list.Element // of *cached
+	lru     *list.List               // most recently used first
+	max     int
+	pending map[string]struct{}
+	waiting map[string]time.Time // first asked for, while no slot was free
+	sem     chan struct{}
+	lookup  func(ctx context.Context, addr string) ([]string, error)
+	now     func() time.Time
+}
+
+type cached struct {
+	ip      string
+	name    string
+	expires time.Time
+}
+
+// New returns a Resolver that runs at most four lookups at a time.
+func New() *Resolver {
+	return &Resolver{
+		names:   map[string]*list.Element{},
+		lru:     list.New(),
+		max:     maxNames,
+		pending: map[string]struct{}{},
+		waiting: map[string]time.Time{},
+		sem:     make(chan struct{}, 4),
+		lookup:  net.DefaultResolver.LookupAddr,
+		now:     time.Now,
+	}
+}
+
+// Lookup returns the cached name for ip. ok is false while the name is
+// still being resolved; a lookup is started if none is in flight. When
+// lookups stay backed up for ip, Lookup gives up after a while and
+// reports "" with ok true; a later call tries again.
+func (r *Resolver) Lookup(ip string) (name string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if el, ok := r.names[ip]; ok {
+		c := el.Value.(*cached)
+		if now.Before(c.expires) {
+			r.lru.MoveToFront(el)
+			return c.name, true
+		}
+		r.lru.Remove(el)
+		delete(r.names, ip)
+	}
+	if _, ok := r.pending[ip]; ok {
+		return "", false
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		// Too many lookups in flight; try again on the next call.
+		return r.wait(ip, now)
+	}
+	delete(r.waiting, ip)
+	r.pending[ip] = struct{}{}
+
+	go func() {
+		defer func() { <-r.sem }()
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		name, ttl := "", failedTTL
+		if names, err := r.lookup(ctx, ip); err == nil && len(names) > 0 {
+			name, ttl = strings.TrimSuffix(names[0], "."), nameTTL
+		}
+		r.mu.Lock()
+		delete(r.pending, ip)
+		r.store(ip, name, ttl)
+		r.mu.Unlock()
+	}()
+	return "", false
+}
+
+// wait reports ip as pending until it has waited maxWait for a free slot.
+func (r *Resolver) wait(ip string, now time.Time) (string, bool) {
+	since, ok := r.waiting[ip]
+	if !ok {
+		if len(r.waiting) >= r.max {
+			for w, t := range r.waiting {
+				if now.Sub(t) >= maxWait {
+					delete(r.waiting, w)
+				}
+			}
+			if len(r.waiting) >= r.max {
+				return "", true
+			}
+		}
+		r.waiting[ip] = now
+		return "", false
+	}
+	if now.Sub(since) < maxWait {
+		return "", false
+	}
+	delete(r.waiting, ip)
+	return "", true
+}
+
+// store caches name for ip, evicting the least recently used names over
+// the limit.
+func (r *Resolver) store(ip, name string, ttl time.Duration) {
+	if el, ok := r.names[ip]; ok {
+		r.lru.Remove(el)
+	}
+	r.names[ip] = r.lru.PushFront(&cached{ip: ip, name: name, expires: r.now().Add(ttl)})
+	for r.lru.Len() > r.max {
+		el := r.lru.Back()
+		r.lru.Remove(el)
+		delete(r.names, el.Value.(*cached).ip)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rdns
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolver_Lookup(t *testing.T) {
+	r := New()
+	r.lookup = func(_ context.Context, addr string) ([]string, error) {
+		if addr == "192.0.2.1" {
+			return []string{"host.example."}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if _, ok := r.Lookup(ip); ok {
+			t.Fatalf("%s resolved before the lookup ran", ip)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		name1, ok1 := r.Lookup("192.0.2.1")
+		name2, ok2 := r.Lookup("192.0.2.2")
+		if ok1 && ok2 {
+			if name1 != "host.example" || name2 != "" {
+				t.Fatalf("names = %q, %q", name1, name2)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lookups did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// resolve polls Lookup until the name for ip is known.
+func resolve(t *testing.T, r *Resolver, ip string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if name, ok := r.Lookup(ip); ok {
+			return name
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lookup of %s did not finish", ip)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResolver_RetriesFailedLookups(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var calls atomic.Int32
+	r := New()
+	r.now = func() time.Time { return now }
+	r.lookup = func(context.Context, string) ([]string, error) {
+		if calls.Add(1) == 1 {
+			return nil, errors.New("timeout")
+		}
+		return []string{"host.example."}, nil
+	}
+
+	if name := resolve(t, r, "192.0.2.1"); name != "" {
+		t.Fatalf("name = %q after a failed lookup", name)
+	}
+	now = now.Add(failedTTL - time.Second)
+	if name, ok := r.Lookup("192.0.2.1"); !ok || name != "" {
+		t.Fatalf("expected the failure to stay cached, got %q/%v", name, ok)
+	}
+	now = now.Add(2 * time.Second)
+	if name := resolve(t, r, "192.0.2.1"); name != "host.example" {
+		t.Fatalf("name = %q after the retry", name)
+	}
+}
+
+func TestResolver_GivesUpWhenBusy(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := New()
+	r.now = func() time.Time { return now }
+	// Occupy every lookup slot.
+	for range cap(r.sem) {
+		r.sem <- struct{}{}
+	}
+
+	if _, ok := r.Lookup("192.0.2.1"); ok {
+		t.Fatal("expected the name to be pending while lookups are busy")
+	}
+	now = now.Add(maxWait)
+	if name, ok := r.Lookup("192.0.2.1"); !ok || name != "" {
+		t.Fatalf("expected Lookup to give up after %s, got %q/%v", maxWait, name, ok)
+	}
+	if _, ok := r.Lookup("192.0.2.1"); ok {
+		t.Fatal("expected a later call to try again")
+	}
+}
+
+func TestResolver_EvictsLeastRecentlyUsed(t *testing.T) {
+	r := New()
+	r.max = 2
+	r.lookup = func(_ context.Context, addr string) ([]string, error) {
+		return []string{addr + ".example."}, nil
+	}
+
+	resolve(t, r, "192.0.2.1")
+	resolve(t, r, "192.0.2.2")
+	r.Lookup("192.0.2.1")
+	resolve(t, r, "192.0.2.3")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.names) != 2 || r.names["192.0.2.2"] != nil {
+		t.Fatalf("expected 192.0.2.2 to be evicted, cache holds %d names", len(r.names))
+	}
+}
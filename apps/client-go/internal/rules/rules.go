@@ -0,0 +1,449 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rules decides which flows are exported, for exclusions BPF cannot
+// express such as hostnames or the owning process.
+//
+// A rules file is JSON:
+//
+//	{
+//	  "default": "allow",
+//	  "rules": [
+//	    {"name": "backups", "action": "deny", "processes": ["restic"]},
+//	    {"name": "probes", "action": "deny", "hosts": ["*.monitoring.example.com"], "ports": ["443"]}
+//	  ]
+//	}
+//
+// Within a rule every non-empty field must match, and a field matches when
+// any of its entries does. Rules are tried in order and the first match
+// decides; flows no rule matches get the default action.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+)
+
+// Actions.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// Rule is one entry of a rules file.
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Nets are CIDRs or addresses; either endpoint may match.
+	Nets []string `json:"nets,omitempty"`
+	// Ports are ports or ranges such as "8000-8080"; either port may match.
+	Ports []string `json:"ports,omitempty"`
+	// Protocols are TCP, UDP, ICMP or OTHER.
+	Protocols []string `json:"protocols,omitempty"`
+	// Hosts are globs matched against the reverse DNS name of DestIP.
+	Hosts []string `json:"hosts,omitempty"`
+	// Processes are globs matched against the name of the local process
+	// owning SourcePort.
+	Processes []string `json:"processes,omitempty"`
+	// Direction is "in" or "out", as in backend.Connection.
+	Direction string `json:"direction,omitempty"`
+}
+
+// File is the format of a rules file.
+type File struct {
+	Default string `json:"default,omitempty"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Verdict is the outcome of evaluating a flow.
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Deny
+	// Pending means the deciding rule needs a hostname that is still being
+	// resolved; evaluate the flow again later.
+	Pending
+)
+
+// RuleStats reports how many flow records a rule decided.
+type RuleStats struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Hits   uint64 `json:"hits"`
+}
+
+// Stats reports hit counters for every rule and for the default action.
+type Stats struct {
+	Default     string      `json:"default"`
+	DefaultHits uint64      `json:"defaultHits"`
+	Rules       []RuleStats `json:"rules"`
+	LoadedAt    time.Time   `json:"loadedAt"`
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// WithHostnames sets the reverse DNS lookup used by host rules. lookup
+// reports ok=false while a name is still being resolved. Without it host
+// rules never match.
+func WithHostnames(lookup func(ip string) (name string, ok bool)) Option {
+	return func(e *Engine) { e.hostname = lookup }
+}
+
+// WithProcesses sets the lookup of the process owning a local port. Without
+// it process rules never match.
+func WithProcesses(lookup func(protocol string, port int) string) Option {
+	return func(e *Engine) { e.process = lookup }
+}
+
+// Engine evaluates flows against the rules in a file and reloads them when
+// the file changes.
+type Engine struct {
+	path     string
+	hostname func(ip string) (string, bool)
+	process  func(protocol string, port int) string
+
+	mu          sync.Mutex
+	deny        bool // default action
+	rules       []*compiled
+	defaultHits uint64
+	loadedAt    time.Time
+	modTime     time.Time
+	size        int64
+}
+
+type compiled struct {
+	Rule
+	deny  bool
+	nets  []*net.IPNet
+	ports [][2]int
+	hits  uint64
+}
+
+// Load reads the rules file at path.
+func Load(path string, opts ...Option) (*Engine, error) {
+	e := &Engine{path: path}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if _, err := e.ReloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReloadIfChanged re-reads the rules file when its size or modification
+// time changed and reports whether it did. A file that fails to parse is
+// not retried until it changes again, and the previous rules stay in
+// effect. Hit counters carry over to rules with the same name.
+func (e *Engine) ReloadIfChanged() (bool, error) {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false, fmt.Errorf("rules file: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.loadedAt.IsZero() && info.ModTime().Equal(e.modTime) && info.Size() == e.size {
+		return false, nil
+	}
+	e.modTime, e.size = info.ModTime(), info.Size()
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return false, fmt.Errorf("rules file: %w", err)
+	}
+	deny, rules, err := parse(data)
+	if err != nil {
+		return false, fmt.Errorf("rules file %s: %w", e.path, err)
+	}
+
+	hits := map[string]uint64{}
+	for _, r := range e.rules {
+		hits[r.Name] = r.hits
+	}
+	for _, r := range rules {
+		r.hits = hits[r.Name]
+	}
+	e.deny, e.rules, e.loadedAt = deny, rules, time.Now()
+	return true, nil
+}
+
+// Evaluate decides whether c is exported and counts the hit.
+func (e *Engine) Evaluate(c backend.Connection) Verdict {
+	return e.evaluate(c, true)
+}
+
+// Check decides like Evaluate without counting the hit, for a record that
+// is counted when it is evaluated for another destination.
+func (e *Engine) Check(c backend.Connection) Verdict {
+	return e.evaluate(c, false)
+}
+
+func (e *Engine) evaluate(c backend.Connection, count bool) Verdict {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.rules {
+		switch e.match(r, c) {
+		case matchYes:
+			if count {
+				r.hits++
+			}
+			return verdict(r.deny)
+		case matchPending:
+			return Pending
+		}
+	}
+	if count {
+		e.defaultHits++
+	}
+	return verdict(e.deny)
+}
+
+// Stats returns the current hit counters.
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := Stats{Default: ActionAllow, DefaultHits: e.defaultHits, Rules: []RuleStats{}, LoadedAt: e.loadedAt}
+	if e.deny {
+		st.Default = ActionDeny
+	}
+	for _, r := range e.rules {
+		st.Rules = append(st.Rules, RuleStats{Name: r.Name, Action: r.Action, Hits: r.hits})
+	}
+	return st
+}
+
+func verdict(deny bool) Verdict {
+	if deny {
+		return Deny
+	}
+	return Allow
+}
+
+type matchResult int
+
+const (
+	matchNo matchResult = iota
+	matchYes
+	matchPending
+)
+
+// match checks the cheap conditions first so lookups only run for flows
+// that could otherwise match.
+func (e *Engine) match(r *compiled, c backend.Connection) matchResult {
+	if r.Direction != "" && r.Direction != c.Direction {
+		return matchNo
+	}
+	if len(r.Protocols) > 0 && !anyFold(r.Protocols, c.Protocol) {
+		return matchNo
+	}
+	if len(r.nets) > 0 && !r.matchNets(c) {
+		return matchNo
+	}
+	if len(r.ports) > 0 && !r.matchPorts(c) {
+		return matchNo
+	}
+	if len(r.Processes) > 0 {
+		if e.process == nil || c.SourcePort == 0 {
+			return matchNo
+		}
+		if !anyGlob(r.Processes, e.process(c.Protocol, c.SourcePort)) {
+			return matchNo
+		}
+	}
+	if len(r.Hosts) > 0 {
+		if e.hostname == nil {
+			return matchNo
+		}
+		name, ok := e.hostname(c.DestIP)
+		if !ok {
+			return matchPending
+		}
+		if !anyGlob(r.Hosts, name) {
+			return matchNo
+		}
+	}
+	return matchYes
+}
+
+func (r *compiled) matchNets(c backend.Connection) bool {
+	src, dst := net.ParseIP(c.SourceIP), net.ParseIP(c.DestIP)
+	for _, n := range r.nets {
+		if (src != nil && n.Contains(src)) || (dst != nil && n.Contains(dst)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiled) matchPorts(c backend.Connection) bool {
+	for _, p := range r.ports {
+		if (c.SourcePort >= p[0] && c.SourcePort <= p[1]) || (c.DestPort >= p[0] && c.DestPort <= p[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyGlob matches s against path.Match patterns, ignoring case. An empty
+// s (an unresolved name) matches nothing.
+func anyGlob(patterns []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	s = strings.ToLower(s)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(data []byte) (deny bool, rules []*compiled, err error) {
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return false, nil, err
+	}
+	switch f.Default {
+	case "", ActionAllow:
+	case ActionDeny:
+		deny = true
+	default:
+		return false, nil, fmt.Errorf("default must be %q or %q", ActionAllow, ActionDeny)
+	}
+
+	names := map[string]bool{}
+	for i, r := range f.Rules {
+		c, err := compile(r)
+		if err != nil {
+			if r.Name == "" {
+				return false, nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			return false, nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		if names[r.Name] {
+			return false, nil, fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+		rules = append(rules, c)
+	}
+	return deny, rules, nil
+}
+
+func compile(r Rule) (*compiled, error) {
+	c := &compiled{Rule: r}
+	if r.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	switch r.Action {
+	case ActionAllow:
+	case ActionDeny:
+		c.deny = true
+	default:
+		return nil, fmt.Errorf("action must be %q or %q", ActionAllow, ActionDeny)
+	}
+	switch r.Direction {
+	case "", "in", "out":
+	default:
+		return nil, errors.New(`direction must be "in" or "out"`)
+	}
+	for _, p := range r.Protocols {
+		switch strings.ToUpper(p) {
+		case "TCP", "UDP", "ICMP", "OTHER":
+		default:
+			return nil, fmt.Errorf("unknown protocol %q", p)
+		}
+	}
+	for _, s := range r.Nets {
+		n, err := parseNet(s)
+		if err != nil {
+			return nil, err
+		}
+		c.nets = append(c.nets, n)
+	}
+	for _, s := range r.Ports {
+		p, err := parsePorts(s)
+		if err != nil {
+			return nil, err
+		}
+		c.ports = append(c.ports, p)
+	}
+	for _, globs := range [][]string{r.Hosts, r.Processes} {
+		for _, g := range globs {
+			if _, err := path.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %q", g)
+			}
+		}
+	}
+	return c, nil
+}
+
+func parseNet(s string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid network %q", s)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func parsePorts(s string) ([2]int, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || from < 0 || to > 65535 || from > to {
+		return [2]int{}, fmt.Errorf("invalid port or range %q", s)
+	}
+	return [2]int{from, to}, nil
+}
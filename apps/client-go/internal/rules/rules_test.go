@@ -0,0 +1,201 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+)
+
+func writeRules(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func load(t *testing.T, data string, opts ...Option) *Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, data)
+	e, err := Load(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func conn(src string, sport int, dst string, dport int, proto, dir string) backend.Connection {
+	return backend.Connection{SourceIP: src, SourcePort: sport, DestIP: dst, DestPort: dport, Protocol: proto, Direction: dir}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	hosts := map[string]string{"192.0.2.10": "probe-1.monitoring.example.com", "192.0.2.11": "www.example.com"}
+	procs := map[int]string{40000: "restic"}
+	e := load(t, `{
+		"rules": [
+			{"name": "dns", "action": "allow", "ports": ["53"], "protocols": ["udp"]},
+			{"name": "backups", "action": "deny", "processes": ["rest*"]},
+			{"name": "lan", "action": "deny", "nets": ["10.20.0.0/16", "192.0.2.99"], "ports": ["8000-8080"]},
+			{"name": "probes", "action": "deny", "hosts": ["*.MONITORING.example.com"], "direction": "out"}
+		]
+	}`, WithHostnames(func(ip string) (string, bool) {
+		name, ok := hosts[ip]
+		return name, ok
+	}), WithProcesses(func(protocol string, port int) string {
+		return procs[port]
+	}))
+
+	tests := []struct {
+		name string
+		c    backend.Connection
+		want Verdict
+	}{
+		{"dns allowed first", conn("10.0.0.1", 40000, "8.8.8.8", 53, "UDP", "out"), Allow},
+		{"process", conn("10.0.0.1", 40000, "203.0.113.1", 443, "TCP", "out"), Deny},
+		{"net and port range", conn("10.0.0.1", 50000, "10.20.1.1", 8080, "TCP", "out"), Deny},
+		{"single address", conn("192.0.2.99", 8000, "10.0.0.1", 50000, "TCP", "in"), Deny},
+		{"net without port", conn("10.0.0.1", 50000, "10.20.1.1", 443, "TCP", ""), Allow},
+		{"hostname glob", conn("10.0.0.1", 50000, "192.0.2.10", 443, "TCP", "out"), Deny},
+		{"hostname wrong direction", conn("10.0.0.1", 50000, "192.0.2.10", 443, "TCP", "in"), Allow},
+		{"other hostname", conn("10.0.0.1", 50000, "192.0.2.11", 443, "TCP", "out"), Allow},
+		{"hostname pending", conn("10.0.0.1", 50000, "192.0.2.12", 443, "TCP", "out"), Pending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Evaluate(tt.c); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	st := e.Stats()
+	want := map[string]uint64{"dns": 1, "backups": 1, "lan": 2, "probes": 1}
+	for _, r := range st.Rules {
+		if r.Hits != want[r.Name] {
+			t.Errorf("rule %s hits = %d, want %d", r.Name, r.Hits, want[r.Name])
+		}
+	}
+	if st.Default != ActionAllow || st.DefaultHits != 3 {
+		t.Errorf("default %s hits = %d", st.Default, st.DefaultHits)
+	}
+}
+
+func TestEngine_DefaultDeny(t *testing.T) {
+	e := load(t, `{"default": "deny", "rules": [{"name": "web", "action": "allow", "ports": ["443"]}]}`)
+	if got := e.Evaluate(conn("10.0.0.1", 50000, "203.0.113.1", 443, "TCP", "out")); got != Allow {
+		t.Fatalf("web = %v", got)
+	}
+	if got := e.Evaluate(conn("10.0.0.1", 50000, "203.0.113.1", 22, "TCP", "out")); got != Deny {
+		t.Fatalf("ssh = %v", got)
+	}
+}
+
+func TestEngine_CheckDoesNotCount(t *testing.T) {
+	e := load(t, `{"rules": [{"name": "ssh", "action": "deny", "ports": ["22"]}]}`)
+	if got := e.Check(conn("10.0.0.1", 50000, "203.0.113.1", 22, "TCP", "out")); got != Deny {
+		t.Fatalf("ssh = %v", got)
+	}
+	e.Check(conn("10.0.0.1", 50000, "203.0.113.1", 443, "TCP", "out"))
+	if st := e.Stats(); st.Rules[0].Hits != 0 || st.DefaultHits != 0 {
+		t.Fatalf("expected no hits, got %+v", st)
+	}
+}
+
+func TestEngine_LookupsOptional(t *testing.T) {
+	// Without lookups, host and process rules never match.
+	e := load(t, `{"rules": [
+		{"name": "h", "action": "deny", "hosts": ["*"]},
+		{"name": "p", "action": "deny", "processes": ["*"]}
+	]}`)
+	if got := e.Evaluate(conn("10.0.0.1", 50000, "203.0.113.1", 443, "TCP", "out")); got != Allow {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestEngine_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, `{"rules": [{"name": "ssh", "action": "deny", "ports": ["22"]}]}`)
+	e, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssh := conn("10.0.0.1", 50000, "203.0.113.1", 22, "TCP", "out")
+	e.Evaluate(ssh)
+
+	if changed, err := e.ReloadIfChanged(); changed || err != nil {
+		t.Fatalf("unchanged file reloaded: %v, %v", changed, err)
+	}
+
+	// A broken file keeps the old rules.
+	writeRules(t, path, `{"rules": [{"name": "ssh", "action": "drop"}]}`)
+	if _, err := e.ReloadIfChanged(); err == nil || !strings.Contains(err.Error(), "action") {
+		t.Fatalf("expected action error, got %v", err)
+	}
+	if got := e.Evaluate(ssh); got != Deny {
+		t.Fatalf("old rules lost: %v", got)
+	}
+
+	writeRules(t, path, `{"rules": [{"name": "ssh", "action": "allow", "ports": ["22"]}, {"name": "new", "action": "deny"}]}`)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := e.ReloadIfChanged(); !changed || err != nil {
+		t.Fatalf("reload: %v, %v", changed, err)
+	}
+	if got := e.Evaluate(ssh); got != Allow {
+		t.Fatalf("new rules not applied: %v", got)
+	}
+
+	st := e.Stats()
+	if len(st.Rules) != 2 || st.Rules[0].Hits != 3 || st.Rules[1].Hits != 0 {
+		t.Fatalf("hits not carried over: %+v", st.Rules)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"syntax":         `{"rules": [`,
+		"unknown field":  `{"rules": [{"name": "a", "action": "deny", "port": ["22"]}]}`,
+		"no name":        `{"rules": [{"action": "deny"}]}`,
+		"duplicate name": `{"rules": [{"name": "a", "action": "deny"}, {"name": "a", "action": "allow"}]}`,
+		"default":        `{"default": "drop", "rules": []}`,
+		"net":            `{"rules": [{"name": "a", "action": "deny", "nets": ["10.0.0.0/33"]}]}`,
+		"port range":     `{"rules": [{"name": "a", "action": "deny", "ports": ["90-80"]}]}`,
+		"protocol":       `{"rules": [{"name": "a", "action": "deny", "protocols": ["sctp"]}]}`,
+		"direction":      `{"rules": [{"name": "a", "action": "deny", "direction": "both"}]}`,
+		"glob":           `{"rules": [{"name": "a", "action": "deny", "hosts": ["[a-"]}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			writeRules(t, path, data)
+			if _, err := Load(path); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package state keeps small pieces of agent state that must survive
+// restarts, stored as files in the agent's state directory.
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sequenceBlock is how many sequence numbers are reserved per file write.
+// A restart skips the unused rest of the block, which keeps the sequence
+// monotonic without a write per batch.
+const sequenceBlock = 1000
+
+// Sequence hands out monotonically increasing numbers that keep increasing
+// across restarts.
+type Sequence struct {
+	mu       sync.Mutex
+	path     string
+	next     uint64
+	reserved uint64
+}
+
+// OpenSequence loads the sequence stored at path, creating it if missing.
+func OpenSequence(path string) (*Sequence, error) {
+	start, err := readUint(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Sequence{path: path, next: start + 1, reserved: start}, nil
+}
+
+// Next returns the next sequence number, starting at 1.
+func (s *Sequence) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next > s.reserved {
+		reserved := s.next - 1 + sequenceBlock
+		if err := WriteFile(s.path, []byte(strconv.FormatUint(reserved, 10)+"\n"), 0o600); err != nil {
+			return 0, fmt.Errorf("persist sequence: %w", err)
+		}
+		s.reserved = reserved
+	}
+	n := s.next
+	s.next++
+	return n, nil
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// LoadSecret returns the secret stored at path: the file's content minus
+// surrounding whitespace. A missing file is created (mode 0600) holding size
+// random bytes, hex-encoded.
+func LoadSecret(path string, size int) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		raw := make([]byte, size)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		secret := []byte(hex.EncodeToString(raw))
+		return secret, WriteFile(path, append(secret, '\n'), 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret := []byte(strings.TrimSpace(string(b)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// WriteFile atomically replaces path with data, creating parent directories.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,119 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequence_MonotonicAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "sequence")
+
+	s, err := OpenSequence(path)
+	if err != nil {
+		t.Fatalf("OpenSequence: %v", err)
+	}
+	var last uint64
+	for range 3 {
+		n, err := s.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if n <= last {
+			t.Fatalf("sequence went from %d to %d", last, n)
+		}
+		last = n
+	}
+	if last != 3 {
+		t.Fatalf("expected sequence to start at 1, got last %d", last)
+	}
+
+	// A restart continues past every number handed out before.
+	s, err = OpenSequence(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	n, err := s.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if n <= last {
+		t.Fatalf("expected sequence after restart to exceed %d, got %d", last, n)
+	}
+}
+
+func TestSequence_ReservesInBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequence")
+	s, _ := OpenSequence(path)
+
+	for range sequenceBlock + 1 {
+		if _, err := s.Next(); err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+	}
+	b, _ := os.ReadFile(path)
+	if got := string(b); got != "2000\n" {
+		t.Fatalf("expected second block reservation, got %q", got)
+	}
+}
+
+func TestOpenSequence_RejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequence")
+	_ = os.WriteFile(path, []byte("garbage"), 0o600)
+	if _, err := OpenSequence(path); err == nil {
+		t.Fatalf("expected error for corrupt sequence file")
+	}
+}
+
+func TestWriteFile_Permissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestLoadSecret_CreatesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	first, err := LoadSecret(path, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 64 {
+		t.Fatalf("expected 32 hex-encoded bytes, got %d", len(first))
+	}
+	again, err := LoadSecret(path, 32)
+	if err != nil || string(again) != string(first) {
+		t.Fatalf("expected the stored secret back, got %q, %v", again, err)
+	}
+
+	if err := os.WriteFile(path, []byte("  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSecret(path, 32); err == nil {
+		t.Fatal("expected error for an empty secret file")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package top implements the model and renderer behind `byteroute-client top`:
+// a continuously refreshed table of live flows with per-flow rates.
+package top
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+	"github.com/byteroute/client-go/internal/util"
+)
+
+// Column identifies a sortable table column.
+type Column int
+
+const (
+	ColRemote Column = iota
+	ColHost
+	ColProto
+	ColIn
+	ColOut
+	ColDuration
+	ColStatus
+)
+
+var columns = []struct {
+	title string
+	key   byte
+	width int
+}{
+	ColRemote:   {"REMOTE", 'r', 40},
+	ColHost:     {"HOST", 'h', 32},
+	ColProto:    {"PROTO", 'p', 5},
+	ColIn:       {"IN/s", 'i', 10},
+	ColOut:      {"OUT/s", 'o', 10},
+	ColDuration: {"DURATION", 'd', 9},
+	ColStatus:   {"STATUS", 's', 8},
+}
+
+// Row is one rendered flow.
+type Row struct {
+	ID       string
+	Remote   string
+	RemoteIP string
+	Host     string
+	Protocol string
+	RateIn   float64 // bytes per second since the previous refresh
+	RateOut  float64
+	Duration time.Duration
+	Status   string
+}
+
+type totals struct {
+	bytesIn  int64
+	bytesOut int64
+}
+
+// View keeps the state between refreshes: the previous counters used to
+// derive rates and the current sort order.
+type View struct {
+	Sort Column
+	Asc  bool
+
+	prev     map[string]totals
+	prevAt   time.Time
+	rows     []Row
+	rateIn   float64
+	rateOut  float64
+	inactive int
+}
+
+// New returns a view sorted by inbound rate, highest first.
+func New() *View {
+	return &View{Sort: ColIn, prev: map[string]totals{}}
+}
+
+// Update recomputes rows and rates from a fresh aggregator listing. hostname
+// may return "" when the name of an address is not (yet) known.
+func (v *View) Update(now time.Time, flows []backend.Connection, hostname func(ip string) string) {
+	elapsed := now.Sub(v.prevAt).Seconds()
+	if v.prevAt.IsZero() || elapsed <= 0 {
+		elapsed = 0
+	}
+
+	next := make(map[string]totals, len(flows))
+	rows := make([]Row, 0, len(flows))
+	v.rateIn, v.rateOut, v.inactive = 0, 0, 0
+
+	for _, c := range flows {
+		cur := totals{bytesIn: deref(c.BytesIn), bytesOut: deref(c.BytesOut)}
+		next[c.ID] = cur
+
+		r := Row{
+			ID:       c.ID,
+			Remote:   net.JoinHostPort(c.DestIP, fmt.Sprint(c.DestPort)),
+			RemoteIP: c.DestIP,
+			Protocol: c.Protocol,
+			Status:   c.Status,
+		}
+		if hostname != nil {
+			r.Host = hostname(c.DestIP)
+		}
+		if c.DurationMs != nil {
+			r.Duration = time.Duration(*c.DurationMs) * time.Millisecond
+		}
+		if elapsed > 0 {
+			prev := v.prev[c.ID]
+			r.RateIn = float64(max(cur.bytesIn-prev.bytesIn, 0)) / elapsed
+			r.RateOut = float64(max(cur.bytesOut-prev.bytesOut, 0)) / elapsed
+		}
+
+		v.rateIn += r.RateIn
+		v.rateOut += r.RateOut
+		if c.Status == "inactive" {
+			v.inactive++
+		}
+		rows = append(rows, r)
+	}
+
+	v.prev = next
+	v.prevAt = now
+	v.rows = rows
+	v.sort()
+}
+
+// Rows returns the current rows in display order.
+func (v *View) Rows() []Row {
+	return v.rows
+}
+
+// HandleKey applies a key press. Column keys select the sort column (pressing
+// the active one flips the order); it reports true when the user asked to quit.
+func (v *View) HandleKey(b byte) (quit bool) {
+	switch b {
+	case 'q', 'Q', 3: // 3 = Ctrl-C in raw mode
+		return true
+	}
+	for i, col := range columns {
+		if col.key == b {
+			if v.Sort == Column(i) {
+				v.Asc = !v.Asc
+			} else {
+				v.Sort = Column(i)
+				// Text columns read naturally ascending, numbers descending.
+				v.Asc = v.Sort == ColRemote || v.Sort == ColHost || v.Sort == ColProto || v.Sort == ColStatus
+			}
+			v.sort()
+		}
+	}
+	return false
+}
+
+func (v *View) sort() {
+	slices.SortFunc(v.rows, func(a, b Row) int {
+		var c int
+		switch v.Sort {
+		case ColRemote:
+			c = cmp.Compare(a.Remote, b.Remote)
+		case ColHost:
+			c = cmp.Compare(a.Host, b.Host)
+		case ColProto:
+			c = cmp.Compare(a.Protocol, b.Protocol)
+		case ColIn:
+			c = cmp.Compare(a.RateIn, b.RateIn)
+		case ColOut:
+			c = cmp.Compare(a.RateOut, b.RateOut)
+		case ColDuration:
+			c = cmp.Compare(a.Duration, b.Duration)
+		case ColStatus:
+			c = cmp.Compare(a.Status, b.Status)
+		}
+		if !v.Asc {
+			c = -c
+		}
+		if c == 0 {
+			return cmp.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+}
+
+// Render draws a full frame sized to width x height terminal cells.
+func (v *View) Render(w io.Writer, title string, width, height int) {
+	var b strings.Builder
+
+	// Home the cursor and clear the screen.
+	b.WriteString("\x1b[H\x1b[2J")
+
+	fmt.Fprintf(&b, "%s\r\n", clip(title, width))
+	fmt.Fprintf(&b, "flows: %d (%d inactive)   in: %s/s   out: %s/s\r\n",
+		len(v.rows), v.inactive, util.FormatBytes(int64(v.rateIn)), util.FormatBytes(int64(v.rateOut)))
+	b.WriteString(clip("sort: r remote  h host  p proto  i in  o out  d duration  s status  (again to reverse)  q quit", width))
+	b.WriteString("\r\n\r\n")
+
+	var header strings.Builder
+	for i, col := range columns {
+		title := col.title
+		if Column(i) == v.Sort {
+			if v.Asc {
+				title += "^"
+			} else {
+				title += "v"
+			}
+		}
+		fmt.Fprintf(&header, "%-*s ", col.width, title)
+	}
+	fmt.Fprintf(&b, "\x1b[7m%s\x1b[0m\r\n", clip(padRight(header.String(), width), width))
+
+	// Four header lines plus the column header.
+	maxRows := height - 5
+	for i, r := range v.rows {
+		if i >= maxRows {
+			break
+		}
+		line := fmt.Sprintf("%-*s %-*s %-*s %*s %*s %*s %-*s",
+			columns[ColRemote].width, clip(r.Remote, columns[ColRemote].width),
+			columns[ColHost].width, clip(r.Host, columns[ColHost].width),
+			columns[ColProto].width, r.Protocol,
+			columns[ColIn].width, util.FormatBytes(int64(r.RateIn)),
+			columns[ColOut].width, util.FormatBytes(int64(r.RateOut)),
+			columns[ColDuration].width, formatDuration(r.Duration),
+			columns[ColStatus].width, r.Status,
+		)
+		fmt.Fprintf(&b, "%s\r\n", clip(line, width))
+	}
+
+	_, _ = io.WriteString(w, b.String())
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	s := int(d/time.Second) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func clip(s string, width int) string {
+	if width > 0 && len(s) > width {
+		return s[:width]
+	}
+	return s
+}
+
+func padRight(s string, width int) string {
+	if len(s) < width {
+		return s + strings.Repeat(" ", width-len(s))
+	}
+	return s
+}
+
+func deref(p *int64) int64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,123 @@
+/*
+
+ * Copyright 2026 Stefano Babini
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package top
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byteroute/client-go/internal/backend"
+)
+
+func conn(id, dst string, bytesIn, bytesOut int64, status string) backend.Connection {
+	dur := int64(90_000)
+	return backend.Connection{
+		ID: id, SourceIP: "10.0.0.1", DestIP: dst, SourcePort: 5000, DestPort: 443,
+		Protocol: "TCP", Status: status, BytesIn: &bytesIn, BytesOut: &bytesOut, DurationMs: &dur,
+	}
+}
+
+func TestView_RatesFromConsecutiveUpdates(t *testing.T) {
+	v := New()
+	now := time.Unix(1700000000, 0)
+
+	v.Update(now, []backend.Connection{conn("a", "1.1.1.1", 1000, 100, "active")}, nil)
+	if r := v.Rows()[0]; r.RateIn != 0 {
+		t.Fatalf("expected no rate on the first refresh, got %f", r.RateIn)
+	}
+
+	v.Update(now.Add(2*time.Second), []backend.Connection{
+		conn("a", "1.1.1.1", 5000, 300, "active"),
+		conn("b", "2.2.2.2", 200, 0, "inactive"),
+	}, func(ip string) string {
+		if ip == "1.1.1.1" {
+			return "one.one.one.one"
+		}
+		return ""
+	})
+
+	rows := v.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].ID != "a" || rows[0].RateIn != 2000 || rows[0].RateOut != 100 {
+		t.Fatalf("unexpected first row: %+v", rows[0])
+	}
+	if rows[0].Host != "one.one.one.one" || rows[0].Remote != "1.1.1.1:443" {
+		t.Fatalf("unexpected remote/host: %+v", rows[0])
+	}
+	if rows[1].RateIn != 100 {
+		t.Fatalf("expected new flow rate 100 B/s, got %f", rows[1].RateIn)
+	}
+}
+
+func TestView_HandleKeySorts(t *testing.T) {
+	v := New()
+	now := time.Unix(1700000000, 0)
+	v.Update(now, []backend.Connection{
+		conn("a", "9.9.9.9", 0, 0, "active"),
+		conn("b", "1.1.1.1", 0, 0, "active"),
+	}, nil)
+
+	if quit := v.HandleKey('r'); quit {
+		t.Fatalf("unexpected quit")
+	}
+	if v.Rows()[0].RemoteIP != "1.1.1.1" {
+		t.Fatalf("expected ascending remote sort, got %s first", v.Rows()[0].RemoteIP)
+	}
+
+	v.HandleKey('r')
+	if v.Rows()[0].RemoteIP != "9.9.9.9" {
+		t.Fatalf("expected pressing the key again to reverse, got %s first", v.Rows()[0].RemoteIP)
+	}
+
+	if !v.HandleKey('q') {
+		t.Fatalf("expected q to quit")
+	}
+}
+
+func TestView_RenderFitsHeight(t *testing.T) {
+	v := New()
+	flows := make([]backend.Connection, 0, 50)
+	for i := 0; i < 50; i++ {
+		flows = append(flows, conn(string(rune('a'+i%26))+string(rune('a'+i/26)), "1.1.1.1", 0, 0, "active"))
+	}
+	v.Update(time.Now(), flows, nil)
+
+	var buf bytes.Buffer
+	v.Render(&buf, "title", 120, 20)
+
+	out := buf.String()
+	if !strings.Contains(out, "flows: 50") {
+		t.Fatalf("expected aggregate header, got %q", out)
+	}
+	if lines := strings.Count(out, "\r\n"); lines > 20 {
+		t.Fatalf("expected at most 20 lines, got %d", lines)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	if got := formatDuration(90 * time.Second); got != "1:30" {
+		t.Fatalf("formatDuration(90s) = %q", got)
+	}
+	if got := formatDuration(2*time.Hour + 3*time.Minute + 4*time.Second); got != "2:03:04" {
+		t.Fatalf("formatDuration(2h3m4s) = %q", got)
+	}
+}
@@ -18,13 +18,25 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 )
 
+// StableID is the legacy, unkeyed flow ID: SHA-1 over the host ID and
+// parts. Anyone who sees an ID can recover small inputs such as addresses
+// and ports by brute force; prefer KeyedIDs.
 func StableID(hostID string, parts ...any) string {
 	h := sha1.New()
+	writeParts(h, hostID, parts)
+	sum := h.Sum(nil)
+	return hex.EncodeToString(sum)
+}
+
+func writeParts(h hash.Hash, hostID string, parts []any) {
 	if hostID != "" {
 		_, _ = h.Write([]byte(hostID))
 		_, _ = h.Write([]byte("|"))
@@ -35,6 +47,58 @@ func StableID(hostID string, parts ...any) string {
 		}
 		_, _ = h.Write([]byte(fmt.Sprint(p)))
 	}
-	sum := h.Sum(nil)
-	return hex.EncodeToString(sum)
+}
+
+// FlowIDs derives flow IDs from the parts of a flow key.
+type FlowIDs interface {
+	ID(parts ...any) string
+}
+
+// LegacyIDs produces StableID values, for backends that already hold
+// flows under them.
+type LegacyIDs struct {
+	HostID string
+}
+
+func (l LegacyIDs) ID(parts ...any) string {
+	return StableID(l.HostID, parts...)
+}
+
+// keyedIDScheme versions the keyed construction itself.
+const keyedIDScheme = "h1"
+
+// KeyedIDs produces HMAC-SHA256 flow IDs under a per-agent secret. IDs look
+// like "h1.<key id>.<mac>": the key ID is a fingerprint of the secret, so IDs
+// stay stable across restarts and a rotated secret is told apart from the
+// old one.
+type KeyedIDs struct {
+	hostID string
+	key    []byte
+	prefix string
+}
+
+// NewKeyedIDs creates the scheme for secret. hostID is mixed in as with
+// StableID.
+func NewKeyedIDs(hostID string, secret []byte) *KeyedIDs {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("byteroute/flow-id/key"))
+	key := m.Sum(nil)
+	fp := sha256.Sum256(key)
+	return &KeyedIDs{
+		hostID: hostID,
+		key:    key,
+		prefix: keyedIDScheme + "." + hex.EncodeToString(fp[:4]) + ".",
+	}
+}
+
+// KeyID returns the fingerprint of the secret used in IDs.
+func (k *KeyedIDs) KeyID() string {
+	return k.prefix[len(keyedIDScheme)+1 : len(k.prefix)-1]
+}
+
+func (k *KeyedIDs) ID(parts ...any) string {
+	m := hmac.New(sha256.New, k.key)
+	writeParts(m, k.hostID, parts)
+	// 128 bits are plenty against collisions and keep IDs short.
+	return k.prefix + hex.EncodeToString(m.Sum(nil)[:16])
 }
@@ -17,7 +17,10 @@
 
 package util
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestStableID_IsDeterministic(t *testing.T) {
 	a := StableID("host", "TCP", "1.2.3.4", "5.6.7.8", 123, 443)
@@ -37,3 +40,35 @@ func TestStableID_ChangesWithHostID(t *testing.T) {
 		t.Fatalf("expected different ids for different host IDs")
 	}
 }
+
+func TestStableID_Unchanged(t *testing.T) {
+	// Backends keep flows under existing IDs, so the legacy scheme must not drift.
+	if got := StableID("host", "TCP", "1.2.3.4", "5.6.7.8", 123, 443); got != "e84b2ad2b66261f511ba9d10434f2770cd154954" {
+		t.Fatalf("unexpected legacy ID %q", got)
+	}
+	if got := (LegacyIDs{HostID: "host"}).ID("TCP", "1.2.3.4"); got != StableID("host", "TCP", "1.2.3.4") {
+		t.Fatalf("expected LegacyIDs to match StableID, got %q", got)
+	}
+}
+
+func TestKeyedIDs(t *testing.T) {
+	a := NewKeyedIDs("host", []byte("secret-a"))
+	id := a.ID("TCP", "1.2.3.4", "5.6.7.8", 123, 443)
+	if id != NewKeyedIDs("host", []byte("secret-a")).ID("TCP", "1.2.3.4", "5.6.7.8", 123, 443) {
+		t.Fatal("expected IDs to be stable for the same secret")
+	}
+	if !strings.HasPrefix(id, "h1."+a.KeyID()+".") || len(id) != len("h1.")+8+1+32 {
+		t.Fatalf("unexpected ID format %q", id)
+	}
+	if id == StableID("host", "TCP", "1.2.3.4", "5.6.7.8", 123, 443) {
+		t.Fatal("expected keyed IDs to differ from legacy IDs")
+	}
+
+	b := NewKeyedIDs("host", []byte("secret-b"))
+	if b.KeyID() == a.KeyID() || b.ID("TCP", "1.2.3.4", "5.6.7.8", 123, 443) == id {
+		t.Fatal("expected a rotated secret to change key ID and IDs")
+	}
+	if NewKeyedIDs("other", []byte("secret-a")).ID("TCP", "1.2.3.4", "5.6.7.8", 123, 443) == id {
+		t.Fatal("expected the host ID to be mixed in")
+	}
+}
@@ -19,6 +19,7 @@
 
 export interface Connection {
   id: string
+  conversationId?: string
   tenantId?: string
   sourceIp: string
   destIp: string
@@ -26,6 +27,7 @@ export interface Connection {
   destPort: number
   protocol: 'TCP' | 'UDP' | 'ICMP' | 'OTHER'
   status: 'active' | 'inactive'
+  direction?: 'in' | 'out'
   enriched?: boolean
   country?: string
   countryCode?: string
@@ -44,6 +46,15 @@ export interface Connection {
   bytesOut?: number
   packetsIn?: number
   packetsOut?: number
+  // Traffic since the agent's previous acknowledged export of the flow.
+  intervalStart?: Date | string
+  intervalEnd?: Date | string
+  deltaBytesIn?: number
+  deltaBytesOut?: number
+  deltaPacketsIn?: number
+  deltaPacketsOut?: number
+  // Set when packets were captured 1-in-N; the counters are already scaled.
+  samplingRate?: number
   startTime: Date | string
   lastActivity: Date | string
   duration?: number
@@ -108,6 +119,19 @@ export interface TimeSeriesData {
   bandwidthIn: number
   bandwidthOut: number
   inactive?: number
+  // Set when packets were captured 1-in-N; the figures are already scaled.
+  samplingRate?: number
+  // Reported by agents; any drops mean the period's figures are incomplete.
+  capture?: CaptureStats
+}
+
+export interface CaptureStats {
+  policy: string
+  received: number
+  channelDrops: number
+  kernelDrops: number
+  ifDrops: number
+  queuePeak: number
 }
 
 export interface MapViewState {
@@ -132,6 +156,23 @@ export interface DashboardFilters {
   search?: string
 }
 
+export interface AgentStatus {
+  agentId: string
+  tenantId: string
+  hostname?: string
+  os?: string
+  kernel?: string
+  version?: string
+  interfaces: string[]
+  capabilities: string[]
+  registeredAt: string
+  lastSeenAt: string
+  uptimeSeconds?: number
+  configVersion?: string
+  configError?: string
+  online: boolean
+}
+
 // Socket.IO typed events for type-safe communication
 
 export interface ServerToClientEvents {
@@ -143,6 +184,7 @@ export interface ServerToClientEvents {
   'connections:batch': (data: Connection[]) => void
   'traffic:flows': (data: TrafficFlow[]) => void
   'statistics:update': (data: Statistics) => void
+  'agent:update': (data: AgentStatus) => void
   'error': (data: { message: string; code?: string }) => void
 }
 